@@ -0,0 +1,52 @@
+package gql
+
+import (
+	"device/pkg/web"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// Handler serves GraphQL requests
+type Handler struct {
+	schema   *graphql.Schema
+	business Business
+}
+
+// NewHandler creates a new GraphQL handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		schema:   graphql.MustParseSchema(schema, &Resolver{business: b}),
+		business: b,
+	}
+}
+
+// request represents a GraphQL request
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// ServeHTTP executes a GraphQL request. Each request gets its own device
+// loader, so device lookups of one request are batched together.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if req.Query == "" {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("query is required"))
+		return
+	}
+
+	ctx := withLoader(r.Context(), h.business.GetByIDs)
+	web.SendOk(w, h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
@@ -0,0 +1,189 @@
+package gql
+
+import (
+	"bytes"
+	"context"
+	"device/business/device"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Create(ctx context.Context, cd device.CreateDevice) (device.Device, error) {
+	args := bm.Called(ctx, cd)
+	return args.Get(0).(device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Update(ctx context.Context, id string, data device.UpdateDevice) error {
+	args := bm.Called(ctx, id, data)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) GetByID(ctx context.Context, id string) (device.Device, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) GetByIDs(ctx context.Context, ids []string) ([]device.Device, error) {
+	args := bm.Called(ctx, ids)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) GetAll(ctx context.Context, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Delete(ctx context.Context, id string) error {
+	args := bm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, brand, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, f, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+const (
+	id1 = "6f24bfd3-64ee-47c4-b903-0ba81852ac6e"
+	id2 = "7a35cfe4-75ff-48d5-a014-1cb92963bd7f"
+	id3 = "8b46d0f5-8600-49e6-b125-2dca3a74ce80"
+)
+
+// exec runs a query against the handler and decodes the data into out
+func exec(t *testing.T, b Business, query string, out interface{}) {
+	data, err := json.Marshal(request{Query: query})
+	if err != nil {
+		t.Fatalf("unable to marshal request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(b).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewBuffer(data)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []interface{}   `json:"errors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", resp.Errors)
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		t.Fatalf("unable to decode data: %v", err)
+	}
+}
+
+func TestDeviceBatching(t *testing.T) {
+	b := BusinessMock{}
+	b.On("GetByIDs", mock.Anything, mock.MatchedBy(func(ids []string) bool { return len(ids) == 3 })).Return([]device.Device{
+		{ID: id1, Name: "one", CreatedAt: time.Now()},
+		{ID: id2, Name: "two", CreatedAt: time.Now()},
+	}, nil)
+
+	var out struct {
+		A    *struct{ Name string }   `json:"a"`
+		B    *struct{ Name string }   `json:"b"`
+		Many []*struct{ Name string } `json:"many"`
+	}
+	exec(t, &b, `{
+		a: device(id: "`+id1+`") { name }
+		b: device(id: "`+id2+`") { name }
+		many: devicesByIds(ids: ["`+id2+`", "`+id3+`", "`+id1+`"]) { name }
+	}`, &out)
+
+	b.AssertNumberOfCalls(t, "GetByIDs", 1)
+	if out.A == nil || out.A.Name != "one" || out.B == nil || out.B.Name != "two" {
+		t.Fatalf("unexpected devices %+v %+v", out.A, out.B)
+	}
+	if len(out.Many) != 3 || out.Many[0].Name != "two" || out.Many[1] != nil || out.Many[2].Name != "one" {
+		t.Fatalf("unexpected devices %+v", out.Many)
+	}
+}
+
+func TestDevicesConnection(t *testing.T) {
+	b := BusinessMock{}
+	b.On("SearchByBrand", mock.Anything, "acme", 0, 3).Return([]device.Device{{ID: id1}, {ID: id2}, {ID: id3}}, nil)
+	b.On("SearchByBrand", mock.Anything, "acme", 2, 3).Return([]device.Device{{ID: id3}}, nil)
+
+	type page struct {
+		Devices struct {
+			Edges []struct {
+				Node struct{ ID string }
+			}
+			PageInfo struct {
+				HasNextPage bool
+				EndCursor   string
+			}
+		}
+	}
+
+	var first page
+	exec(t, &b, `{ devices(first: 2, brand: "acme") { edges { node { id } } pageInfo { hasNextPage endCursor } } }`, &first)
+	if len(first.Devices.Edges) != 2 || !first.Devices.PageInfo.HasNextPage {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+
+	var second page
+	exec(t, &b, `{ devices(first: 2, brand: "acme", after: "`+first.Devices.PageInfo.EndCursor+`") { edges { node { id } } pageInfo { hasNextPage endCursor } } }`, &second)
+	if len(second.Devices.Edges) != 1 || second.Devices.Edges[0].Node.ID != id3 || second.Devices.PageInfo.HasNextPage {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+}
+
+func TestDevicesByStatus(t *testing.T) {
+	seenAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := BusinessMock{}
+	b.On("Search", mock.Anything, device.Filter{Brand: "acme", Status: device.StatusOnline}, 0, 11).Return([]device.Device{
+		{ID: id1, Status: device.StatusOnline, LastSeenAt: &seenAt},
+	}, nil)
+
+	var out struct {
+		Devices struct {
+			Edges []struct {
+				Node struct {
+					Status     string
+					LastSeenAt *time.Time
+				}
+			}
+		}
+	}
+	exec(t, &b, `{ devices(brand: "acme", status: ONLINE) { edges { node { status lastSeenAt } } } }`, &out)
+	if len(out.Devices.Edges) != 1 {
+		t.Fatalf("expected 1 device, got %+v", out)
+	}
+	node := out.Devices.Edges[0].Node
+	if node.Status != "ONLINE" || node.LastSeenAt == nil || !node.LastSeenAt.Equal(seenAt) {
+		t.Fatalf("unexpected device %+v", node)
+	}
+}
+
+func TestCreateDevice(t *testing.T) {
+	b := BusinessMock{}
+	b.On("Create", mock.Anything, device.CreateDevice{Name: "name", Brand: "brand"}).Return(device.Device{ID: id1, Name: "name", Brand: "brand"}, nil)
+
+	var out struct {
+		CreateDevice struct{ ID string } `json:"createDevice"`
+	}
+	exec(t, &b, `mutation { createDevice(input: {name: "name", brand: "brand"}) { id } }`, &out)
+	if out.CreateDevice.ID != id1 {
+		t.Fatalf("expected %s, got %s", id1, out.CreateDevice.ID)
+	}
+}
@@ -0,0 +1,166 @@
+package gql
+
+import (
+	"context"
+	"device/business/device"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoaderWait     = 2 * time.Millisecond
+	defaultLoaderMaxBatch = 100
+)
+
+// loaderKey is the context key for the request's deviceLoader
+type loaderKey struct{}
+
+// deviceLoader batches the device lookups of one request into a single fetch.
+// Lookups that arrive within wait of the first one, or until maxBatch is
+// reached, share a fetch, and every result is cached for the request.
+type deviceLoader struct {
+	fetch    func(ctx context.Context, ids []string) ([]device.Device, error)
+	wait     time.Duration
+	maxBatch int
+
+	mu    sync.Mutex
+	cache map[string]*loaderResult
+	batch *loaderBatch
+}
+
+// loaderResult is the outcome of a lookup, ready once done is closed
+type loaderResult struct {
+	done   chan struct{}
+	device device.Device
+	err    error
+}
+
+// loaderBatch is a set of lookups waiting to be fetched
+type loaderBatch struct {
+	ids     []string
+	results []*loaderResult
+}
+
+// newDeviceLoader creates a new deviceLoader
+func newDeviceLoader(fetch func(ctx context.Context, ids []string) ([]device.Device, error)) *deviceLoader {
+	return &deviceLoader{
+		fetch:    fetch,
+		wait:     defaultLoaderWait,
+		maxBatch: defaultLoaderMaxBatch,
+		cache:    map[string]*loaderResult{},
+	}
+}
+
+// Load returns the device with the given ID, or device.ErrNotFound
+func (l *deviceLoader) Load(ctx context.Context, id string) (device.Device, error) {
+	return l.await(ctx, l.enqueue(ctx, id))
+}
+
+// LoadMany returns the devices with the given IDs in the same order. All the
+// IDs are queued before waiting, so they are fetched in the same batch.
+func (l *deviceLoader) LoadMany(ctx context.Context, ids []string) ([]device.Device, []error) {
+	results := make([]*loaderResult, len(ids))
+	for i, id := range ids {
+		results[i] = l.enqueue(ctx, id)
+	}
+
+	devices := make([]device.Device, len(ids))
+	errs := make([]error, len(ids))
+	for i, r := range results {
+		devices[i], errs[i] = l.await(ctx, r)
+	}
+	return devices, errs
+}
+
+// enqueue returns the cached result for id, or queues id in the pending batch
+func (l *deviceLoader) enqueue(ctx context.Context, id string) *loaderResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r, ok := l.cache[id]; ok {
+		return r
+	}
+
+	r := &loaderResult{done: make(chan struct{})}
+	l.cache[id] = r
+
+	if l.batch == nil {
+		l.batch = &loaderBatch{}
+		go l.dispatchAfterWait(ctx, l.batch)
+	}
+	l.batch.ids = append(l.batch.ids, id)
+	l.batch.results = append(l.batch.results, r)
+
+	if len(l.batch.ids) >= l.maxBatch {
+		b := l.batch
+		l.batch = nil
+		go l.run(ctx, b)
+	}
+	return r
+}
+
+// await waits for a result
+func (l *deviceLoader) await(ctx context.Context, r *loaderResult) (device.Device, error) {
+	select {
+	case <-r.done:
+		return r.device, r.err
+	case <-ctx.Done():
+		return device.Device{}, ctx.Err()
+	}
+}
+
+// Clear removes the cached result for id so the next Load fetches it again
+func (l *deviceLoader) Clear(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, id)
+}
+
+// dispatchAfterWait fetches b after the wait, unless it was already dispatched
+func (l *deviceLoader) dispatchAfterWait(ctx context.Context, b *loaderBatch) {
+	time.Sleep(l.wait)
+
+	l.mu.Lock()
+	if l.batch != b {
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	l.mu.Unlock()
+
+	l.run(ctx, b)
+}
+
+// run fetches a batch and resolves its results
+func (l *deviceLoader) run(ctx context.Context, b *loaderBatch) {
+	devices, err := l.fetch(ctx, b.ids)
+
+	byID := make(map[string]device.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+
+	for i, id := range b.ids {
+		r := b.results[i]
+		switch d, ok := byID[id]; {
+		case err != nil:
+			r.err = err
+		case !ok:
+			r.err = device.ErrNotFound
+		default:
+			r.device = d
+		}
+		close(r.done)
+	}
+}
+
+// withLoader returns a context carrying a new deviceLoader
+func withLoader(ctx context.Context, fetch func(ctx context.Context, ids []string) ([]device.Device, error)) context.Context {
+	return context.WithValue(ctx, loaderKey{}, newDeviceLoader(fetch))
+}
+
+// loaderFrom returns the deviceLoader carried by ctx
+func loaderFrom(ctx context.Context) (*deviceLoader, bool) {
+	l, ok := ctx.Value(loaderKey{}).(*deviceLoader)
+	return l, ok
+}
@@ -0,0 +1,326 @@
+package gql
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/logging"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// cursorPrefix prefixes the offset encoded in connection cursors
+const cursorPrefix = "offset:"
+
+// Business represents the device business interface
+type Business interface {
+	Create(ctx context.Context, cd device.CreateDevice) (device.Device, error)
+	Update(ctx context.Context, id string, data device.UpdateDevice) error
+	GetByID(ctx context.Context, id string) (device.Device, error)
+	GetByIDs(ctx context.Context, ids []string) ([]device.Device, error)
+	GetAll(ctx context.Context, offset, limit int) ([]device.Device, error)
+	Delete(ctx context.Context, id string) error
+	SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error)
+	Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error)
+}
+
+// Resolver is the root GraphQL resolver
+type Resolver struct {
+	business Business
+}
+
+// loader returns the request's deviceLoader, or a new one outside of a request
+func (r *Resolver) loader(ctx context.Context) *deviceLoader {
+	if l, ok := loaderFrom(ctx); ok {
+		return l
+	}
+	return newDeviceLoader(r.business.GetByIDs)
+}
+
+// Device resolves Query.device
+func (r *Resolver) Device(ctx context.Context, args struct{ ID graphql.ID }) (*deviceResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := r.loader(ctx).Load(ctx, id)
+	if errors.Is(err, device.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, internalError(ctx, fmt.Errorf("loader.Load: %w", err), "unable to get device")
+	}
+	return &deviceResolver{d: d}, nil
+}
+
+// DevicesByIds resolves Query.devicesByIds
+func (r *Resolver) DevicesByIds(ctx context.Context, args struct{ IDs []graphql.ID }) ([]*deviceResolver, error) {
+	ids := make([]string, len(args.IDs))
+	for i, gid := range args.IDs {
+		id, err := parseID(gid)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	devices, errs := r.loader(ctx).LoadMany(ctx, ids)
+	result := make([]*deviceResolver, len(ids))
+	for i, err := range errs {
+		if errors.Is(err, device.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, internalError(ctx, fmt.Errorf("loader.LoadMany: %w", err), "unable to get devices")
+		}
+		result[i] = &deviceResolver{d: devices[i]}
+	}
+	return result, nil
+}
+
+// Devices resolves Query.devices
+func (r *Resolver) Devices(ctx context.Context, args struct {
+	First          int32
+	After          *string
+	Brand          *string
+	Status         *string
+	LastSeenAfter  *graphql.Time
+	LastSeenBefore *graphql.Time
+}) (*connectionResolver, error) {
+	limit := int(args.First)
+	if limit < 0 {
+		return nil, fmt.Errorf("first must not be negative")
+	}
+
+	offset := 0
+	if args.After != nil {
+		var err error
+		if offset, err = decodeCursor(*args.After); err != nil {
+			return nil, err
+		}
+		offset++
+	}
+
+	var f device.Filter
+	if args.Brand != nil {
+		f.Brand = *args.Brand
+	}
+	if args.Status != nil {
+		f.Status = device.Status(strings.ToLower(*args.Status))
+	}
+	if args.LastSeenAfter != nil {
+		f.LastSeenAfter = &args.LastSeenAfter.Time
+	}
+	if args.LastSeenBefore != nil {
+		f.LastSeenBefore = &args.LastSeenBefore.Time
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	// fetch one extra device to know whether there is a next page
+	var (
+		devices []device.Device
+		err     error
+	)
+	switch {
+	case f.Status != "" || f.LastSeenAfter != nil || f.LastSeenBefore != nil:
+		devices, err = r.business.Search(ctx, f, offset, limit+1)
+	case f.Brand != "":
+		devices, err = r.business.SearchByBrand(ctx, f.Brand, offset, limit+1)
+	default:
+		devices, err = r.business.GetAll(ctx, offset, limit+1)
+	}
+	if err != nil {
+		return nil, internalError(ctx, fmt.Errorf("business.List: %w", err), "unable to get devices")
+	}
+
+	c := &connectionResolver{}
+	if len(devices) > limit {
+		c.hasNextPage = true
+		devices = devices[:limit]
+	}
+	for i, d := range devices {
+		c.edges = append(c.edges, &edgeResolver{cursor: encodeCursor(offset + i), d: d})
+	}
+	return c, nil
+}
+
+// CreateDevice resolves Mutation.createDevice
+func (r *Resolver) CreateDevice(ctx context.Context, args struct{ Input device.CreateDevice }) (*deviceResolver, error) {
+	if err := args.Input.Validate(); err != nil {
+		return nil, err
+	}
+
+	d, err := r.business.Create(ctx, args.Input)
+	if err != nil {
+		return nil, internalError(ctx, fmt.Errorf("business.Create: %w", err), "unable to create device")
+	}
+	return &deviceResolver{d: d}, nil
+}
+
+// UpdateDevice resolves Mutation.updateDevice
+func (r *Resolver) UpdateDevice(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input device.UpdateDevice
+}) (*deviceResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.business.Update(ctx, id, args.Input)
+	if errors.Is(err, device.ErrNotFound) {
+		return nil, fmt.Errorf("device not found")
+	}
+	if err != nil {
+		return nil, internalError(ctx, fmt.Errorf("business.Update: %w", err), "unable to update device")
+	}
+	r.loader(ctx).Clear(id)
+
+	d, err := r.business.GetByID(ctx, id)
+	if err != nil {
+		return nil, internalError(ctx, fmt.Errorf("business.GetByID: %w", err), "unable to get device")
+	}
+	return &deviceResolver{d: d}, nil
+}
+
+// DeleteDevice resolves Mutation.deleteDevice
+func (r *Resolver) DeleteDevice(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+
+	err = r.business.Delete(ctx, id)
+	if errors.Is(err, device.ErrNotFound) {
+		return false, fmt.Errorf("device not found")
+	}
+	if err != nil {
+		return false, internalError(ctx, fmt.Errorf("business.Delete: %w", err), "unable to delete device")
+	}
+	r.loader(ctx).Clear(id)
+	return true, nil
+}
+
+// deviceResolver resolves the Device type
+type deviceResolver struct {
+	d device.Device
+}
+
+func (r *deviceResolver) ID() graphql.ID {
+	return graphql.ID(r.d.ID)
+}
+
+func (r *deviceResolver) Name() string {
+	return r.d.Name
+}
+
+func (r *deviceResolver) Brand() string {
+	return r.d.Brand
+}
+
+func (r *deviceResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.d.CreatedAt}
+}
+
+func (r *deviceResolver) Status() string {
+	if r.d.Status == "" {
+		return strings.ToUpper(string(device.StatusUnknown))
+	}
+	return strings.ToUpper(string(r.d.Status))
+}
+
+func (r *deviceResolver) LastSeenAt() *graphql.Time {
+	if r.d.LastSeenAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.d.LastSeenAt}
+}
+
+// connectionResolver resolves the DeviceConnection type
+type connectionResolver struct {
+	edges       []*edgeResolver
+	hasNextPage bool
+}
+
+func (r *connectionResolver) Edges() []*edgeResolver {
+	return r.edges
+}
+
+func (r *connectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.edges) > 0 {
+		p.endCursor = &r.edges[len(r.edges)-1].cursor
+	}
+	return p
+}
+
+// edgeResolver resolves the DeviceEdge type
+type edgeResolver struct {
+	cursor string
+	d      device.Device
+}
+
+func (r *edgeResolver) Cursor() string {
+	return r.cursor
+}
+
+func (r *edgeResolver) Node() *deviceResolver {
+	return &deviceResolver{d: r.d}
+}
+
+// pageInfoResolver resolves the PageInfo type
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+// parseID checks that id is a valid UUID
+func parseID(id graphql.ID) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	if _, err := uuid.Parse(string(id)); err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return string(id), nil
+}
+
+// encodeCursor encodes an offset as an opaque cursor
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeCursor decodes a cursor created by encodeCursor
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), cursorPrefix))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return offset, nil
+}
+
+// internalError logs err and returns an error that is safe to show to clients
+func internalError(ctx context.Context, err error, msg string) error {
+	logging.FromContext(ctx).WithError(err).Error(msg)
+	return errors.New(msg)
+}
@@ -0,0 +1,216 @@
+package command
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// pollWriteMargin is how long a long poll has to write its response once it stops waiting
+const pollWriteMargin = 10 * time.Second
+
+// Business represents the command business interface
+type Business interface {
+	Enqueue(ctx context.Context, id string, cc command.CreateCommand) (command.Command, error)
+	Poll(ctx context.Context, id string, wait time.Duration) ([]command.Command, error)
+	Ack(ctx context.Context, id, commandID string, ack command.Ack) (command.Command, error)
+	GetByID(ctx context.Context, id, commandID string) (command.Command, error)
+	History(ctx context.Context, id string, offset, limit int) ([]command.Command, error)
+}
+
+// Handler represents the command handler
+type Handler struct {
+	business Business
+}
+
+// NewHandler creates a new command handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		business: b,
+	}
+}
+
+// Enqueue queues a command for a device
+func (h *Handler) Enqueue(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var cc command.CreateCommand
+	if err := json.NewDecoder(r.Body).Decode(&cc); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := cc.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := h.business.Enqueue(r.Context(), id, cc)
+	if err == nil {
+		web.SendCreated(w, c)
+		return
+	}
+
+	if errors.Is(err, device.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to enqueue command"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Enqueue: %w", err)).Error("unable to enqueue command")
+}
+
+// Poll delivers the pending commands of a device, waiting for some up to the
+// wait query parameter when there are none
+func (h *Handler) Poll(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var wait time.Duration
+	if v := web.ParseStrQuery("wait", r); v != "" {
+		if wait, err = time.ParseDuration(v); err != nil || wait < 0 {
+			web.SendError(w, http.StatusBadRequest, fmt.Errorf("wait must be a non-negative duration, e.g. 20s"))
+			return
+		}
+	}
+
+	// a long poll may outlast the server write timeout, which would cut off
+	// the response after its commands were marked delivered
+	if wait > 0 {
+		deadline := time.Now().Add(min(wait, command.MaxWait) + pollWriteMargin)
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			web.SendError(w, http.StatusInternalServerError, fmt.Errorf("long polling is not supported"))
+			return
+		}
+	}
+
+	commands, err := h.business.Poll(r.Context(), id, wait)
+	switch {
+	case err == nil:
+		web.SendOk(w, commands)
+	case errors.Is(err, device.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+	case r.Context().Err() != nil:
+		// the device went away while waiting, there is no one to answer
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to poll commands"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Poll: %w", err)).Error("unable to poll commands")
+	}
+}
+
+// Ack records the outcome of a command delivered to a device
+func (h *Handler) Ack(w http.ResponseWriter, r *http.Request) {
+	id, commandID, err := parseIDs(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var ack command.Ack
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := ack.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := h.business.Ack(r.Context(), id, commandID, ack)
+	switch {
+	case err == nil:
+		web.SendOk(w, c)
+	case errors.Is(err, command.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("command not found"))
+	case errors.Is(err, command.ErrNotDelivered):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("command is not awaiting an acknowledgement"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to acknowledge command"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Ack: %w", err)).Error("unable to acknowledge command")
+	}
+}
+
+// GetByID returns a command of a device
+func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, commandID, err := parseIDs(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := h.business.GetByID(r.Context(), id, commandID)
+	if err == nil {
+		web.SendOk(w, c)
+		return
+	}
+
+	if errors.Is(err, command.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("command not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get command"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetByID: %w", err)).Error("unable to get command")
+}
+
+// History returns the commands of a device, newest first
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, limit := web.ParsePaginationParams(r)
+
+	commands, err := h.business.History(r.Context(), id, offset, limit)
+	if err == nil {
+		web.SendOk(w, commands)
+		return
+	}
+
+	if errors.Is(err, device.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get commands"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.History: %w", err)).Error("unable to get commands")
+}
+
+// parseIDs parses the device and command IDs from the request
+func parseIDs(r *http.Request) (string, string, error) {
+	id, err := parseID(r)
+	if err != nil {
+		return "", "", err
+	}
+	commandID := web.ParseStrURLParam("commandID", r)
+	if _, err := uuid.Parse(commandID); err != nil {
+		return "", "", fmt.Errorf("command id is not a valid UUID")
+	}
+	return id, commandID, nil
+}
+
+// parseID parses the ID from the request
+func parseID(r *http.Request) (string, error) {
+	id := web.ParseStrURLParam("id", r)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return id, nil
+}
@@ -0,0 +1,239 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Enqueue(ctx context.Context, id string, cc command.CreateCommand) (command.Command, error) {
+	args := bm.Called(ctx, id, cc)
+	return args.Get(0).(command.Command), args.Error(1)
+}
+
+func (bm *BusinessMock) Poll(ctx context.Context, id string, wait time.Duration) ([]command.Command, error) {
+	args := bm.Called(ctx, id, wait)
+	return args.Get(0).([]command.Command), args.Error(1)
+}
+
+func (bm *BusinessMock) Ack(ctx context.Context, id, commandID string, ack command.Ack) (command.Command, error) {
+	args := bm.Called(ctx, id, commandID, ack)
+	return args.Get(0).(command.Command), args.Error(1)
+}
+
+func (bm *BusinessMock) GetByID(ctx context.Context, id, commandID string) (command.Command, error) {
+	args := bm.Called(ctx, id, commandID)
+	return args.Get(0).(command.Command), args.Error(1)
+}
+
+func (bm *BusinessMock) History(ctx context.Context, id string, offset, limit int) ([]command.Command, error) {
+	args := bm.Called(ctx, id, offset, limit)
+	return args.Get(0).([]command.Command), args.Error(1)
+}
+
+const (
+	id        = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+	commandID = "8d7c6b5a-4e3f-4a2b-9c1d-0e9f8a7b6c5d"
+)
+
+func TestEnqueue(t *testing.T) {
+	testTable := map[string]struct {
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			body:           `{"name": "reboot", "payload": {"delay": 5}, "ttl_seconds": 300}`,
+			expectedStatus: http.StatusCreated,
+		},
+		"invalid payload": {
+			body:           `{"name": `,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid command": {
+			body:           `{"name": "Reboot!"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			body:           `{"name": "reboot"}`,
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Enqueue", mock.Anything, id, mock.AnythingOfType("command.CreateCommand")).Return(command.Command{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/device/{id}/commands", h.Enqueue)
+
+			req := httptest.NewRequest("POST", "/device/"+id+"/commands", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPoll(t *testing.T) {
+	testTable := map[string]struct {
+		id             string
+		query          string
+		expectedWait   time.Duration
+		businessErr    error
+		expectedStatus int
+	}{
+		"without waiting": {
+			id:             id,
+			expectedStatus: http.StatusOK,
+		},
+		"long poll": {
+			id:             id,
+			query:          "?wait=15s",
+			expectedWait:   15 * time.Second,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid wait": {
+			id:             id,
+			query:          "?wait=soon",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid id": {
+			id:             "abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			id:             id,
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Poll", mock.Anything, tc.id, tc.expectedWait).Return([]command.Command{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Get("/device/{id}/commands/pending", h.Poll)
+
+			req := httptest.NewRequest("GET", "/device/"+tc.id+"/commands/pending"+tc.query, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPollOutlastsWriteTimeout(t *testing.T) {
+	commands := []command.Command{{ID: "c1", DeviceID: id, Name: "reboot"}}
+	b := BusinessMock{}
+	b.On("Poll", mock.Anything, id, 5*time.Second).Run(func(mock.Arguments) {
+		time.Sleep(200 * time.Millisecond)
+	}).Return(commands, nil)
+	h := NewHandler(&b)
+
+	r := chi.NewRouter()
+	r.Get("/device/{id}/commands/pending", h.Poll)
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/device/" + id + "/commands/pending?wait=5s")
+	if err != nil {
+		t.Fatalf("expected the response to be written, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	var got []command.Command
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("expected the commands, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(got) != 1 || got[0].ID != "c1" {
+		t.Fatalf("expected the delivered command, got %d %v", resp.StatusCode, got)
+	}
+}
+
+func TestAck(t *testing.T) {
+	testTable := map[string]struct {
+		commandID      string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			commandID:      commandID,
+			body:           `{"status": "succeeded", "result": {"rebooted": true}}`,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid command id": {
+			commandID:      "abc",
+			body:           `{"status": "succeeded"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid status": {
+			commandID:      commandID,
+			body:           `{"status": "done"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown command": {
+			commandID:      commandID,
+			body:           `{"status": "failed"}`,
+			businessErr:    fmt.Errorf("store.Complete: %w", command.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		"already acknowledged": {
+			commandID:      commandID,
+			body:           `{"status": "failed"}`,
+			businessErr:    fmt.Errorf("store.Complete: %w", command.ErrNotDelivered),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Ack", mock.Anything, id, tc.commandID, mock.AnythingOfType("command.Ack")).Return(command.Command{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/device/{id}/commands/{commandID}/ack", h.Ack)
+
+			req := httptest.NewRequest("POST", "/device/"+id+"/commands/"+tc.commandID+"/ack", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
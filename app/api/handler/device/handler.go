@@ -3,14 +3,17 @@ package device
 import (
 	"context"
 	"device/business/device"
+	"device/pkg/logging"
 	"device/pkg/web"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
 )
 
 // Business represents the device business interface
@@ -21,6 +24,8 @@ type Business interface {
 	GetAll(ctx context.Context, offset, limit int) ([]device.Device, error)
 	Delete(ctx context.Context, id string) error
 	SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error)
+	Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error)
+	Heartbeat(ctx context.Context, id string, hb device.Heartbeat) error
 }
 
 // Handler represents the device handler
@@ -51,7 +56,7 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	device, err := h.business.Create(r.Context(), createDevice)
 	if err != nil {
 		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to create device"))
-		logrus.WithError(fmt.Errorf("business.Create: %w", err)).Error("unable to create device")
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Create: %w", err)).Error("unable to create device")
 		return
 	}
 
@@ -71,6 +76,10 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
 		return
 	}
+	if err := updateDevice.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
 
 	err = h.business.Update(r.Context(), id, updateDevice)
 	if err == nil {
@@ -85,7 +94,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to update device"))
-	logrus.WithError(fmt.Errorf("business.Update: %w", err)).Error("unable to update device")
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Update: %w", err)).Error("unable to update device")
 }
 
 // GetByID returns a device by its ID
@@ -108,7 +117,7 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get device"))
-	logrus.WithError(fmt.Errorf("business.GetByID: %w", err)).Error("unable to get device")
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetByID: %w", err)).Error("unable to get device")
 }
 
 // Delete deletes a device
@@ -133,7 +142,7 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete device"))
-	logrus.WithError(fmt.Errorf("business.Delete: %w", err)).Error("unable to delete device")
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Delete: %w", err)).Error("unable to delete device")
 }
 
 // GetAll returns all devices
@@ -143,16 +152,27 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 	devices, err := h.business.GetAll(r.Context(), offset, limit)
 	if err != nil {
 		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get devices"))
-		logrus.WithError(fmt.Errorf("business.GetAll: %w", err)).Error("unable to get devices")
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetAll: %w", err)).Error("unable to get devices")
 		return
 	}
 
 	web.SendOk(w, devices)
 }
 
-// SearchByBrand searches devices by brand
+// SearchByBrand searches devices by brand, and by status and last heartbeat when
+// those filters are set
 func (h *Handler) SearchByBrand(w http.ResponseWriter, r *http.Request) {
-	brand := web.ParseStrQuery("brand", r)
+	f, err := parseFilter(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	if f.Status != "" || f.LastSeenAfter != nil || f.LastSeenBefore != nil || len(f.Labels) > 0 {
+		h.search(w, r, f)
+		return
+	}
+
+	brand := f.Brand
 	if brand == "" {
 		h.GetAll(w, r)
 		return
@@ -163,13 +183,117 @@ func (h *Handler) SearchByBrand(w http.ResponseWriter, r *http.Request) {
 	devices, err := h.business.SearchByBrand(r.Context(), brand, offset, limit)
 	if err != nil {
 		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to search devices by brand"))
-		logrus.WithError(fmt.Errorf("business.SearchByBrand: %w", err)).Error("unable to search devices by brand")
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.SearchByBrand: %w", err)).Error("unable to search devices by brand")
 		return
 	}
 
 	web.SendOk(w, devices)
 }
 
+// search returns the devices that match f
+func (h *Handler) search(w http.ResponseWriter, r *http.Request, f device.Filter) {
+	offset, limit := web.ParsePaginationParams(r)
+
+	devices, err := h.business.Search(r.Context(), f, offset, limit)
+	if err != nil {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to search devices"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Search: %w", err)).Error("unable to search devices")
+		return
+	}
+
+	web.SendOk(w, devices)
+}
+
+// Heartbeat records a heartbeat of a device
+func (h *Handler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the metadata is optional, so is the body
+	var hb device.Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil && !errors.Is(err, io.EOF) {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := hb.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.business.Heartbeat(r.Context(), id, hb)
+	if err == nil {
+		web.SendOk(w, map[string]string{
+			"message": "heartbeat recorded",
+		})
+		return
+	}
+
+	if errors.Is(err, device.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to record heartbeat"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Heartbeat: %w", err)).Error("unable to record heartbeat")
+}
+
+// parseFilter parses the device filter from the query of the request
+func parseFilter(r *http.Request) (device.Filter, error) {
+	f := device.Filter{
+		Brand:  web.ParseStrQuery("brand", r),
+		Status: device.Status(web.ParseStrQuery("status", r)),
+	}
+
+	var err error
+	if f.LastSeenAfter, err = parseTimeQuery("last_seen_after", r); err != nil {
+		return device.Filter{}, err
+	}
+	if f.LastSeenBefore, err = parseTimeQuery("last_seen_before", r); err != nil {
+		return device.Filter{}, err
+	}
+	if f.Labels, err = parseLabelsQuery(r); err != nil {
+		return device.Filter{}, err
+	}
+	if err := f.Validate(); err != nil {
+		return device.Filter{}, err
+	}
+	return f, nil
+}
+
+// parseLabelsQuery parses the label query parameters of the request, each a
+// key=value pair
+func parseLabelsQuery(r *http.Request) (map[string]string, error) {
+	values := r.URL.Query()["label"]
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(values))
+	for _, v := range values {
+		k, l, ok := strings.Cut(v, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("label must be a key=value pair, got %q", v)
+		}
+		labels[k] = l
+	}
+	return labels, nil
+}
+
+// parseTimeQuery parses an optional RFC 3339 time from the query of the request
+func parseTimeQuery(key string, r *http.Request) (*time.Time, error) {
+	v := web.ParseStrQuery(key, r)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", key)
+	}
+	return &t, nil
+}
+
 // parseID parses the ID from the request
 func parseID(r *http.Request) (string, error) {
 	id := web.ParseStrURLParam("id", r)
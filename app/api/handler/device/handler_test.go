@@ -47,6 +47,16 @@ func (bm *BusinessMock) SearchByBrand(ctx context.Context, brand string, offset,
 	return args.Get(0).([]device.Device), args.Error(1)
 }
 
+func (bm *BusinessMock) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, f, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Heartbeat(ctx context.Context, id string, hb device.Heartbeat) error {
+	args := bm.Called(ctx, id, hb)
+	return args.Error(0)
+}
+
 func TestCreate(t *testing.T) {
 	testTable := map[string]struct {
 		request        device.CreateDevice
@@ -94,3 +104,127 @@ func TestCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestHeartbeat(t *testing.T) {
+	id := "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+
+	testTable := map[string]struct {
+		id             string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"with metadata": {
+			id:             id,
+			body:           `{"ip": "10.0.0.7", "firmware": "1.4.2", "uptime_seconds": 3600}`,
+			expectedStatus: http.StatusOK,
+		},
+		"without body": {
+			id:             id,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid id": {
+			id:             "abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid ip": {
+			id:             id,
+			body:           `{"ip": "not an ip"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			id:             id,
+			businessErr:    device.ErrNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Heartbeat", mock.Anything, tc.id, mock.AnythingOfType("device.Heartbeat")).Return(tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/device/{id}/heartbeat", h.Heartbeat)
+
+			req := httptest.NewRequest("POST", "/device/"+tc.id+"/heartbeat", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d", tc.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestSearchByBrandFilters(t *testing.T) {
+	testTable := map[string]struct {
+		query          string
+		expectedCall   string
+		expectedStatus int
+	}{
+		"no filter": {
+			expectedCall:   "GetAll",
+			expectedStatus: http.StatusOK,
+		},
+		"brand": {
+			query:          "?brand=acme",
+			expectedCall:   "SearchByBrand",
+			expectedStatus: http.StatusOK,
+		},
+		"status and brand": {
+			query:          "?brand=acme&status=offline",
+			expectedCall:   "Search",
+			expectedStatus: http.StatusOK,
+		},
+		"last seen": {
+			query:          "?last_seen_after=2024-01-01T00:00:00Z&last_seen_before=2024-01-02T00:00:00Z",
+			expectedCall:   "Search",
+			expectedStatus: http.StatusOK,
+		},
+		"labels": {
+			query:          "?label=region=eu&label=tier=",
+			expectedCall:   "Search",
+			expectedStatus: http.StatusOK,
+		},
+		"invalid label": {
+			query:          "?label=region",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid status": {
+			query:          "?status=asleep",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid time": {
+			query:          "?last_seen_after=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("GetAll", mock.Anything, mock.Anything, mock.Anything).Return([]device.Device{}, nil)
+			b.On("SearchByBrand", mock.Anything, "acme", mock.Anything, mock.Anything).Return([]device.Device{}, nil)
+			b.On("Search", mock.Anything, mock.AnythingOfType("device.Filter"), mock.Anything, mock.Anything).Return([]device.Device{}, nil)
+			h := NewHandler(&b)
+
+			req := httptest.NewRequest("GET", "/devices"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			h.SearchByBrand(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedCall != "" {
+				b.AssertNumberOfCalls(t, tc.expectedCall, 1)
+			}
+			if len(b.Calls) > 1 || tc.expectedCall == "" && len(b.Calls) != 0 {
+				t.Fatalf("expected a single call to %q, got %v", tc.expectedCall, b.Calls)
+			}
+		})
+	}
+}
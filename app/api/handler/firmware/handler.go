@@ -0,0 +1,334 @@
+package firmware
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/firmware"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Business represents the firmware business interface
+type Business interface {
+	CreateFirmware(ctx context.Context, cf firmware.CreateFirmware) (firmware.Firmware, error)
+	GetFirmware(ctx context.Context, id string) (firmware.Firmware, error)
+	ListFirmware(ctx context.Context, brand string, offset, limit int) ([]firmware.Firmware, error)
+	DeleteFirmware(ctx context.Context, id string) error
+	CreateRollout(ctx context.Context, cr firmware.CreateRollout) (firmware.Rollout, error)
+	GetRollout(ctx context.Context, id string) (firmware.Rollout, error)
+	ListRollouts(ctx context.Context, status firmware.RolloutStatus, offset, limit int) ([]firmware.Rollout, error)
+	PauseRollout(ctx context.Context, id string) (firmware.Rollout, error)
+	ResumeRollout(ctx context.Context, id string) (firmware.Rollout, error)
+	CancelRollout(ctx context.Context, id string) (firmware.Rollout, error)
+	RolloutDevices(ctx context.Context, id string, status firmware.DeviceStatus, offset, limit int) ([]firmware.DeviceProgress, error)
+	PendingUpdate(ctx context.Context, id string) (firmware.DeviceUpdate, error)
+	Report(ctx context.Context, id string, rp firmware.Report) (firmware.DeviceProgress, error)
+}
+
+// Handler represents the firmware handler
+type Handler struct {
+	business Business
+}
+
+// NewHandler creates a new firmware handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		business: b,
+	}
+}
+
+// CreateFirmware registers a firmware
+func (h *Handler) CreateFirmware(w http.ResponseWriter, r *http.Request) {
+	var cf firmware.CreateFirmware
+	if err := json.NewDecoder(r.Body).Decode(&cf); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := cf.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f, err := h.business.CreateFirmware(r.Context(), cf)
+	if err == nil {
+		web.SendCreated(w, f)
+		return
+	}
+
+	if errors.Is(err, firmware.ErrVersionExists) {
+		web.SendError(w, http.StatusConflict, fmt.Errorf("firmware version %s already exists", cf.Version))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to create firmware"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.CreateFirmware: %w", err)).Error("unable to create firmware")
+}
+
+// GetFirmware returns a firmware by its ID
+func (h *Handler) GetFirmware(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f, err := h.business.GetFirmware(r.Context(), id)
+	if err == nil {
+		web.SendOk(w, f)
+		return
+	}
+
+	if errors.Is(err, firmware.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("firmware not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get firmware"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetFirmware: %w", err)).Error("unable to get firmware")
+}
+
+// ListFirmware returns the firmware, newest first, optionally only the one
+// compatible with the brand query parameter
+func (h *Handler) ListFirmware(w http.ResponseWriter, r *http.Request) {
+	offset, limit := web.ParsePaginationParams(r)
+
+	fs, err := h.business.ListFirmware(r.Context(), web.ParseStrQuery("brand", r), offset, limit)
+	if err != nil {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get firmware"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.ListFirmware: %w", err)).Error("unable to get firmware")
+		return
+	}
+
+	web.SendOk(w, fs)
+}
+
+// DeleteFirmware deletes a firmware no rollout installs
+func (h *Handler) DeleteFirmware(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.business.DeleteFirmware(r.Context(), id)
+	switch {
+	case err == nil:
+		web.SendOk(w, map[string]string{
+			"message": "firmware deleted",
+		})
+	case errors.Is(err, firmware.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("firmware not found"))
+	case errors.Is(err, firmware.ErrInUse):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("firmware is installed by a rollout"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete firmware"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.DeleteFirmware: %w", err)).Error("unable to delete firmware")
+	}
+}
+
+// CreateRollout starts a rollout
+func (h *Handler) CreateRollout(w http.ResponseWriter, r *http.Request) {
+	var cr firmware.CreateRollout
+	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := cr.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ro, err := h.business.CreateRollout(r.Context(), cr)
+	switch {
+	case err == nil:
+		web.SendCreated(w, ro)
+	case errors.Is(err, firmware.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("firmware not found"))
+	case errors.Is(err, firmware.ErrIncompatible):
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("firmware is not compatible with brand %s", cr.Target.Brand))
+	case errors.Is(err, firmware.ErrNoDevices):
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("no compatible device matches the target"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to create rollout"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.CreateRollout: %w", err)).Error("unable to create rollout")
+	}
+}
+
+// GetRollout returns a rollout by its ID, with its progress
+func (h *Handler) GetRollout(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ro, err := h.business.GetRollout(r.Context(), id)
+	if err == nil {
+		web.SendOk(w, ro)
+		return
+	}
+
+	if errors.Is(err, firmware.ErrRolloutNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("rollout not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get rollout"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetRollout: %w", err)).Error("unable to get rollout")
+}
+
+// ListRollouts returns the rollouts, newest first, optionally only the ones
+// with the status query parameter
+func (h *Handler) ListRollouts(w http.ResponseWriter, r *http.Request) {
+	status := firmware.RolloutStatus(web.ParseStrQuery("status", r))
+	if status != "" && !status.Valid() {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("status must be one of running, paused, completed or cancelled"))
+		return
+	}
+	offset, limit := web.ParsePaginationParams(r)
+
+	rs, err := h.business.ListRollouts(r.Context(), status, offset, limit)
+	if err != nil {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get rollouts"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.ListRollouts: %w", err)).Error("unable to get rollouts")
+		return
+	}
+
+	web.SendOk(w, rs)
+}
+
+// PauseRollout pauses a running rollout
+func (h *Handler) PauseRollout(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "pause", "PauseRollout", h.business.PauseRollout)
+}
+
+// ResumeRollout resumes a paused rollout
+func (h *Handler) ResumeRollout(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "resume", "ResumeRollout", h.business.ResumeRollout)
+}
+
+// CancelRollout cancels a running or paused rollout
+func (h *Handler) CancelRollout(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "cancel", "CancelRollout", h.business.CancelRollout)
+}
+
+// transition applies action to the rollout of the request with the business method name
+func (h *Handler) transition(w http.ResponseWriter, r *http.Request, action, name string, transition func(ctx context.Context, id string) (firmware.Rollout, error)) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ro, err := transition(r.Context(), id)
+	switch {
+	case err == nil:
+		web.SendOk(w, ro)
+	case errors.Is(err, firmware.ErrRolloutNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("rollout not found"))
+	case errors.Is(err, firmware.ErrInvalidTransition):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("unable to %s the rollout in its current status", action))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to %s rollout", action))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.%s: %w", name, err)).Errorf("unable to %s rollout", action)
+	}
+}
+
+// RolloutDevices returns the progress of the devices of a rollout,
+// optionally only the ones with the status query parameter
+func (h *Handler) RolloutDevices(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	status := firmware.DeviceStatus(web.ParseStrQuery("status", r))
+	if status != "" && !status.Valid() {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("status must be one of pending, installing, succeeded or failed"))
+		return
+	}
+	offset, limit := web.ParsePaginationParams(r)
+
+	ds, err := h.business.RolloutDevices(r.Context(), id, status, offset, limit)
+	if err == nil {
+		web.SendOk(w, ds)
+		return
+	}
+
+	if errors.Is(err, firmware.ErrRolloutNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("rollout not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get rollout devices"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.RolloutDevices: %w", err)).Error("unable to get rollout devices")
+}
+
+// PendingUpdate returns the firmware a device has to install
+func (h *Handler) PendingUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.business.PendingUpdate(r.Context(), id)
+	switch {
+	case err == nil:
+		web.SendOk(w, u)
+	case errors.Is(err, device.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+	case errors.Is(err, firmware.ErrNoUpdate):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("no firmware update"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get firmware update"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.PendingUpdate: %w", err)).Error("unable to get firmware update")
+	}
+}
+
+// Report records the progress a device reports on its update
+func (h *Handler) Report(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var rp firmware.Report
+	if err := json.NewDecoder(r.Body).Decode(&rp); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := rp.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	p, err := h.business.Report(r.Context(), id, rp)
+	switch {
+	case err == nil:
+		web.SendOk(w, p)
+	case errors.Is(err, firmware.ErrNotAssigned):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device has no update in this rollout"))
+	case errors.Is(err, firmware.ErrAlreadyReported):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("the outcome of the update is already reported"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to record report"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Report: %w", err)).Error("unable to record report")
+	}
+}
+
+// parseID parses the ID from the request
+func parseID(r *http.Request) (string, error) {
+	id := web.ParseStrURLParam("id", r)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return id, nil
+}
@@ -0,0 +1,330 @@
+package firmware
+
+import (
+	"bytes"
+	"context"
+	"device/business/device"
+	"device/business/firmware"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) CreateFirmware(ctx context.Context, cf firmware.CreateFirmware) (firmware.Firmware, error) {
+	args := bm.Called(ctx, cf)
+	return args.Get(0).(firmware.Firmware), args.Error(1)
+}
+
+func (bm *BusinessMock) GetFirmware(ctx context.Context, id string) (firmware.Firmware, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(firmware.Firmware), args.Error(1)
+}
+
+func (bm *BusinessMock) ListFirmware(ctx context.Context, brand string, offset, limit int) ([]firmware.Firmware, error) {
+	args := bm.Called(ctx, brand, offset, limit)
+	return args.Get(0).([]firmware.Firmware), args.Error(1)
+}
+
+func (bm *BusinessMock) DeleteFirmware(ctx context.Context, id string) error {
+	args := bm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) CreateRollout(ctx context.Context, cr firmware.CreateRollout) (firmware.Rollout, error) {
+	args := bm.Called(ctx, cr)
+	return args.Get(0).(firmware.Rollout), args.Error(1)
+}
+
+func (bm *BusinessMock) GetRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(firmware.Rollout), args.Error(1)
+}
+
+func (bm *BusinessMock) ListRollouts(ctx context.Context, status firmware.RolloutStatus, offset, limit int) ([]firmware.Rollout, error) {
+	args := bm.Called(ctx, status, offset, limit)
+	return args.Get(0).([]firmware.Rollout), args.Error(1)
+}
+
+func (bm *BusinessMock) PauseRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(firmware.Rollout), args.Error(1)
+}
+
+func (bm *BusinessMock) ResumeRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(firmware.Rollout), args.Error(1)
+}
+
+func (bm *BusinessMock) CancelRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(firmware.Rollout), args.Error(1)
+}
+
+func (bm *BusinessMock) RolloutDevices(ctx context.Context, id string, status firmware.DeviceStatus, offset, limit int) ([]firmware.DeviceProgress, error) {
+	args := bm.Called(ctx, id, status, offset, limit)
+	return args.Get(0).([]firmware.DeviceProgress), args.Error(1)
+}
+
+func (bm *BusinessMock) PendingUpdate(ctx context.Context, id string) (firmware.DeviceUpdate, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(firmware.DeviceUpdate), args.Error(1)
+}
+
+func (bm *BusinessMock) Report(ctx context.Context, id string, rp firmware.Report) (firmware.DeviceProgress, error) {
+	args := bm.Called(ctx, id, rp)
+	return args.Get(0).(firmware.DeviceProgress), args.Error(1)
+}
+
+const id = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+
+func TestCreateFirmware(t *testing.T) {
+	valid := fmt.Sprintf(`{"version": "1.4.2", "brands": ["acme"], "checksum": "sha256:%s", "artifact_url": "https://cdn.example.com/1.4.2.bin"}`, strings.Repeat("0f", 32))
+
+	testTable := map[string]struct {
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			body:           valid,
+			expectedStatus: http.StatusCreated,
+		},
+		"invalid payload": {
+			body:           `{"version": `,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid firmware": {
+			body:           `{"version": "1.4.2", "brands": ["acme"], "checksum": "abc"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"existing version": {
+			body:           valid,
+			businessErr:    fmt.Errorf("store.CreateFirmware: %w", firmware.ErrVersionExists),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("CreateFirmware", mock.Anything, mock.AnythingOfType("firmware.CreateFirmware")).Return(firmware.Firmware{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/firmware", h.CreateFirmware)
+
+			req := httptest.NewRequest("POST", "/firmware", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateRollout(t *testing.T) {
+	valid := fmt.Sprintf(`{"firmware_id": %q, "target": {"brand": "acme", "labels": {"region": "eu"}}, "stages": [10, 100]}`, id)
+
+	testTable := map[string]struct {
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			body:           valid,
+			expectedStatus: http.StatusCreated,
+		},
+		"invalid rollout": {
+			body:           fmt.Sprintf(`{"firmware_id": %q, "stages": [50]}`, id),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown firmware": {
+			body:           valid,
+			businessErr:    fmt.Errorf("store.FirmwareByID: %w", firmware.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		"incompatible firmware": {
+			body:           valid,
+			businessErr:    fmt.Errorf("%w: acme", firmware.ErrIncompatible),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"no devices": {
+			body:           valid,
+			businessErr:    firmware.ErrNoDevices,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("CreateRollout", mock.Anything, mock.AnythingOfType("firmware.CreateRollout")).Return(firmware.Rollout{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/rollouts", h.CreateRollout)
+
+			req := httptest.NewRequest("POST", "/rollouts", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	testTable := map[string]struct {
+		path           string
+		method         string
+		businessErr    error
+		expectedStatus int
+	}{
+		"pause": {
+			path:           "pause",
+			method:         "PauseRollout",
+			expectedStatus: http.StatusOK,
+		},
+		"resume": {
+			path:           "resume",
+			method:         "ResumeRollout",
+			expectedStatus: http.StatusOK,
+		},
+		"cancel a completed rollout": {
+			path:           "cancel",
+			method:         "CancelRollout",
+			businessErr:    fmt.Errorf("store.UpdateRollout: %w", firmware.ErrInvalidTransition),
+			expectedStatus: http.StatusConflict,
+		},
+		"unknown rollout": {
+			path:           "pause",
+			method:         "PauseRollout",
+			businessErr:    fmt.Errorf("store.UpdateRollout: %w", firmware.ErrRolloutNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On(tc.method, mock.Anything, id).Return(firmware.Rollout{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/rollouts/{id}/pause", h.PauseRollout)
+			r.Post("/rollouts/{id}/resume", h.ResumeRollout)
+			r.Post("/rollouts/{id}/cancel", h.CancelRollout)
+
+			req := httptest.NewRequest("POST", "/rollouts/"+id+"/"+tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			b.AssertNumberOfCalls(t, tc.method, 1)
+		})
+	}
+}
+
+func TestPendingUpdate(t *testing.T) {
+	testTable := map[string]struct {
+		businessErr    error
+		expectedStatus int
+	}{
+		"update": {
+			expectedStatus: http.StatusOK,
+		},
+		"no update": {
+			businessErr:    fmt.Errorf("store.PendingUpdate: %w", firmware.ErrNoUpdate),
+			expectedStatus: http.StatusNotFound,
+		},
+		"unknown device": {
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("PendingUpdate", mock.Anything, id).Return(firmware.DeviceUpdate{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Get("/devices/{id}/firmware", h.PendingUpdate)
+
+			req := httptest.NewRequest("GET", "/devices/"+id+"/firmware", nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	testTable := map[string]struct {
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			body:           fmt.Sprintf(`{"rollout_id": %q, "status": "failed", "error": "checksum mismatch"}`, id),
+			expectedStatus: http.StatusOK,
+		},
+		"invalid status": {
+			body:           fmt.Sprintf(`{"rollout_id": %q, "status": "done"}`, id),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"not assigned": {
+			body:           fmt.Sprintf(`{"rollout_id": %q, "status": "installing"}`, id),
+			businessErr:    fmt.Errorf("store.Report: %w", firmware.ErrNotAssigned),
+			expectedStatus: http.StatusNotFound,
+		},
+		"already reported": {
+			body:           fmt.Sprintf(`{"rollout_id": %q, "status": "succeeded"}`, id),
+			businessErr:    fmt.Errorf("store.Report: %w", firmware.ErrAlreadyReported),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Report", mock.Anything, id, mock.AnythingOfType("firmware.Report")).Return(firmware.DeviceProgress{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/devices/{id}/firmware/report", h.Report)
+
+			req := httptest.NewRequest("POST", "/devices/"+id+"/firmware/report", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
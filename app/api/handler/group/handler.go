@@ -0,0 +1,373 @@
+package group
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/business/group"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Business represents the group business interface
+type Business interface {
+	Create(ctx context.Context, cg group.CreateGroup) (group.Group, error)
+	Get(ctx context.Context, id string) (group.Group, error)
+	List(ctx context.Context, parentID string, offset, limit int) ([]group.Group, error)
+	Update(ctx context.Context, id string, ug group.UpdateGroup) (group.Group, error)
+	Delete(ctx context.Context, id string) error
+	Devices(ctx context.Context, id string, offset, limit int) ([]device.Device, error)
+	AddMembers(ctx context.Context, id string, m group.Members) error
+	RemoveMember(ctx context.Context, id, deviceID string) error
+	UpdateLabels(ctx context.Context, id string, lc group.LabelChange) (group.Operation, error)
+	SendCommand(ctx context.Context, id string, cc command.CreateCommand) (group.Operation, error)
+	Operation(ctx context.Context, id, operationID string) (group.Operation, error)
+}
+
+// Handler represents the group handler
+type Handler struct {
+	business Business
+}
+
+// NewHandler creates a new group handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		business: b,
+	}
+}
+
+// Create creates a group
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var cg group.CreateGroup
+	if err := json.NewDecoder(r.Body).Decode(&cg); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := cg.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	g, err := h.business.Create(r.Context(), cg)
+	switch {
+	case err == nil:
+		web.SendCreated(w, g)
+	case errors.Is(err, group.ErrParentNotFound):
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("parent group not found"))
+	case errors.Is(err, group.ErrTooDeep):
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("groups can be nested at most %d levels deep", group.MaxDepth))
+	case errors.Is(err, group.ErrUnknownDevice):
+		web.SendError(w, http.StatusBadRequest, err)
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to create group"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Create: %w", err)).Error("unable to create group")
+	}
+}
+
+// Get returns a group by its ID
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	g, err := h.business.Get(r.Context(), id)
+	if err == nil {
+		web.SendOk(w, g)
+		return
+	}
+
+	if errors.Is(err, group.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get group"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Get: %w", err)).Error("unable to get group")
+}
+
+// List returns the top-level groups by name, or the groups nested in the
+// parent_id query parameter
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	parentID := web.ParseStrQuery("parent_id", r)
+	if parentID != "" {
+		if _, err := uuid.Parse(parentID); err != nil {
+			web.SendError(w, http.StatusBadRequest, fmt.Errorf("parent_id is not a valid UUID"))
+			return
+		}
+	}
+	offset, limit := web.ParsePaginationParams(r)
+
+	gs, err := h.business.List(r.Context(), parentID, offset, limit)
+	if err != nil {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get groups"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.List: %w", err)).Error("unable to get groups")
+		return
+	}
+
+	web.SendOk(w, gs)
+}
+
+// Update updates a group
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var ug group.UpdateGroup
+	if err := json.NewDecoder(r.Body).Decode(&ug); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := ug.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	g, err := h.business.Update(r.Context(), id, ug)
+	switch {
+	case err == nil:
+		web.SendOk(w, g)
+	case errors.Is(err, group.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+	case errors.Is(err, group.ErrParentNotFound):
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("parent group not found"))
+	case errors.Is(err, group.ErrCycle):
+		web.SendError(w, http.StatusBadRequest, group.ErrCycle)
+	case errors.Is(err, group.ErrTooDeep):
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("groups can be nested at most %d levels deep", group.MaxDepth))
+	case errors.Is(err, group.ErrNotDynamic):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("only dynamic groups have a filter"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to update group"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Update: %w", err)).Error("unable to update group")
+	}
+}
+
+// Delete deletes a group without subgroups
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.business.Delete(r.Context(), id)
+	switch {
+	case err == nil:
+		web.SendOk(w, map[string]string{
+			"message": "group deleted",
+		})
+	case errors.Is(err, group.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+	case errors.Is(err, group.ErrHasSubgroups):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("group has subgroups, delete or move them first"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete group"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Delete: %w", err)).Error("unable to delete group")
+	}
+}
+
+// Devices returns the devices of a group, its subgroups included, by ID
+func (h *Handler) Devices(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, limit := web.ParsePaginationParams(r)
+
+	devices, err := h.business.Devices(r.Context(), id, offset, limit)
+	if err == nil {
+		web.SendOk(w, devices)
+		return
+	}
+
+	if errors.Is(err, group.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get devices"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Devices: %w", err)).Error("unable to get devices")
+}
+
+// AddMembers adds devices to a static group
+func (h *Handler) AddMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var m group.Members
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := m.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.business.AddMembers(r.Context(), id, m)
+	switch {
+	case err == nil:
+		web.SendOk(w, map[string]string{
+			"message": "devices added",
+		})
+	case errors.Is(err, group.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+	case errors.Is(err, group.ErrUnknownDevice):
+		web.SendError(w, http.StatusBadRequest, err)
+	case errors.Is(err, group.ErrNotStatic):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("the members of a dynamic group are chosen by its filter"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to add devices"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.AddMembers: %w", err)).Error("unable to add devices")
+	}
+}
+
+// RemoveMember removes a device from a static group
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	deviceID := web.ParseStrURLParam("deviceID", r)
+	if _, err := uuid.Parse(deviceID); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("device id is not a valid UUID"))
+		return
+	}
+
+	err = h.business.RemoveMember(r.Context(), id, deviceID)
+	switch {
+	case err == nil:
+		web.SendOk(w, map[string]string{
+			"message": "device removed",
+		})
+	case errors.Is(err, group.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+	case errors.Is(err, group.ErrNotMember):
+		web.SendError(w, http.StatusNotFound, group.ErrNotMember)
+	case errors.Is(err, group.ErrNotStatic):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("the members of a dynamic group are chosen by its filter"))
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to remove device"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.RemoveMember: %w", err)).Error("unable to remove device")
+	}
+}
+
+// UpdateLabels starts an operation setting and removing labels on every
+// device of a group, its subgroups included
+func (h *Handler) UpdateLabels(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var lc group.LabelChange
+	if err := json.NewDecoder(r.Body).Decode(&lc); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := lc.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	op, err := h.business.UpdateLabels(r.Context(), id, lc)
+	if err == nil {
+		web.Send(w, http.StatusAccepted, op)
+		return
+	}
+
+	if errors.Is(err, group.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to update labels"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.UpdateLabels: %w", err)).Error("unable to update labels")
+}
+
+// SendCommand starts an operation enqueuing a command for every device of a
+// group, its subgroups included
+func (h *Handler) SendCommand(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var cc command.CreateCommand
+	if err := json.NewDecoder(r.Body).Decode(&cc); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := cc.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	op, err := h.business.SendCommand(r.Context(), id, cc)
+	if err == nil {
+		web.Send(w, http.StatusAccepted, op)
+		return
+	}
+
+	if errors.Is(err, group.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("group not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to send command"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.SendCommand: %w", err)).Error("unable to send command")
+}
+
+// Operation returns an operation of a group, to follow its progress
+func (h *Handler) Operation(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	operationID := web.ParseStrURLParam("operationID", r)
+	if _, err := uuid.Parse(operationID); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("operation id is not a valid UUID"))
+		return
+	}
+
+	op, err := h.business.Operation(r.Context(), id, operationID)
+	if err == nil {
+		web.SendOk(w, op)
+		return
+	}
+
+	if errors.Is(err, group.ErrOperationNotFound) {
+		web.SendError(w, http.StatusNotFound, group.ErrOperationNotFound)
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get operation"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Operation: %w", err)).Error("unable to get operation")
+}
+
+// parseID parses the ID from the request
+func parseID(r *http.Request) (string, error) {
+	id := web.ParseStrURLParam("id", r)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return id, nil
+}
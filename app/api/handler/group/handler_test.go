@@ -0,0 +1,478 @@
+package group
+
+import (
+	"bytes"
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/business/group"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Create(ctx context.Context, cg group.CreateGroup) (group.Group, error) {
+	args := bm.Called(ctx, cg)
+	return args.Get(0).(group.Group), args.Error(1)
+}
+
+func (bm *BusinessMock) Get(ctx context.Context, id string) (group.Group, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(group.Group), args.Error(1)
+}
+
+func (bm *BusinessMock) List(ctx context.Context, parentID string, offset, limit int) ([]group.Group, error) {
+	args := bm.Called(ctx, parentID, offset, limit)
+	return args.Get(0).([]group.Group), args.Error(1)
+}
+
+func (bm *BusinessMock) Update(ctx context.Context, id string, ug group.UpdateGroup) (group.Group, error) {
+	args := bm.Called(ctx, id, ug)
+	return args.Get(0).(group.Group), args.Error(1)
+}
+
+func (bm *BusinessMock) Delete(ctx context.Context, id string) error {
+	args := bm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) Devices(ctx context.Context, id string, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, id, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) AddMembers(ctx context.Context, id string, m group.Members) error {
+	args := bm.Called(ctx, id, m)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) RemoveMember(ctx context.Context, id, deviceID string) error {
+	args := bm.Called(ctx, id, deviceID)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) UpdateLabels(ctx context.Context, id string, lc group.LabelChange) (group.Operation, error) {
+	args := bm.Called(ctx, id, lc)
+	return args.Get(0).(group.Operation), args.Error(1)
+}
+
+func (bm *BusinessMock) SendCommand(ctx context.Context, id string, cc command.CreateCommand) (group.Operation, error) {
+	args := bm.Called(ctx, id, cc)
+	return args.Get(0).(group.Operation), args.Error(1)
+}
+
+func (bm *BusinessMock) Operation(ctx context.Context, id, operationID string) (group.Operation, error) {
+	args := bm.Called(ctx, id, operationID)
+	return args.Get(0).(group.Operation), args.Error(1)
+}
+
+const (
+	id          = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+	deviceID    = "9b0d3c55-4a4b-4d8e-8f0a-6c1f3e0b2a71"
+	operationID = "4c8e2a61-7d3b-4f5a-9e0c-1b2d3f4a5e6c"
+)
+
+func TestCreate(t *testing.T) {
+	valid := fmt.Sprintf(`{"name": "lobby", "kind": "static", "parent_id": %q, "device_ids": [%q]}`, id, deviceID)
+
+	testTable := map[string]struct {
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			body:           valid,
+			expectedStatus: http.StatusCreated,
+		},
+		"dynamic group": {
+			body:           `{"name": "eu sensors", "kind": "dynamic", "filter": {"labels": {"region": "eu"}}}`,
+			expectedStatus: http.StatusCreated,
+		},
+		"invalid payload": {
+			body:           `{"name": `,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid group": {
+			body:           `{"name": "eu sensors", "kind": "dynamic"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown parent": {
+			body:           valid,
+			businessErr:    group.ErrParentNotFound,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"nested too deep": {
+			body:           valid,
+			businessErr:    group.ErrTooDeep,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			body:           valid,
+			businessErr:    fmt.Errorf("%w: %s", group.ErrUnknownDevice, deviceID),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"internal error": {
+			body:           valid,
+			businessErr:    fmt.Errorf("store.Create: connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Create", mock.Anything, mock.AnythingOfType("group.CreateGroup")).Return(group.Group{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/groups", h.Create)
+
+			req := httptest.NewRequest("POST", "/groups", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	testTable := map[string]struct {
+		id             string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			id:             id,
+			body:           `{"name": "hall", "parent_id": ""}`,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid id": {
+			id:             "1",
+			body:           `{"name": "hall"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid update": {
+			id:             id,
+			body:           `{"parent_id": "abc"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"not found": {
+			id:             id,
+			body:           `{"name": "hall"}`,
+			businessErr:    fmt.Errorf("store.Update: %w", group.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		"cycle": {
+			id:             id,
+			body:           fmt.Sprintf(`{"parent_id": %q}`, deviceID),
+			businessErr:    group.ErrCycle,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"filter of a static group": {
+			id:             id,
+			body:           `{"filter": {"brand": "acme"}}`,
+			businessErr:    fmt.Errorf("store.Update: %w", group.ErrNotDynamic),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Update", mock.Anything, tc.id, mock.AnythingOfType("group.UpdateGroup")).Return(group.Group{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Put("/groups/{id}", h.Update)
+
+			req := httptest.NewRequest("PUT", "/groups/"+tc.id, bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	testTable := map[string]struct {
+		businessErr    error
+		expectedStatus int
+	}{
+		"success":       {expectedStatus: http.StatusOK},
+		"not found":     {businessErr: fmt.Errorf("store.Delete: %w", group.ErrNotFound), expectedStatus: http.StatusNotFound},
+		"has subgroups": {businessErr: fmt.Errorf("store.Delete: %w", group.ErrHasSubgroups), expectedStatus: http.StatusConflict},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Delete", mock.Anything, id).Return(tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Delete("/groups/{id}", h.Delete)
+
+			req := httptest.NewRequest("DELETE", "/groups/"+id, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDevices(t *testing.T) {
+	testTable := map[string]struct {
+		query          string
+		offset         int
+		limit          int
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			query:          "?offset=20&limit=10",
+			offset:         20,
+			limit:          10,
+			expectedStatus: http.StatusOK,
+		},
+		"not found": {
+			offset:         0,
+			limit:          10,
+			businessErr:    fmt.Errorf("store.ByID: %w", group.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Devices", mock.Anything, id, tc.offset, tc.limit).Return([]device.Device{{ID: deviceID}}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Get("/groups/{id}/devices", h.Devices)
+
+			req := httptest.NewRequest("GET", "/groups/"+id+"/devices"+tc.query, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMembers(t *testing.T) {
+	testTable := map[string]struct {
+		method         string
+		path           string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"add": {
+			method:         "AddMembers",
+			path:           "/members",
+			body:           fmt.Sprintf(`{"device_ids": [%q]}`, deviceID),
+			expectedStatus: http.StatusOK,
+		},
+		"add nothing": {
+			method:         "AddMembers",
+			path:           "/members",
+			body:           `{"device_ids": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"add to a dynamic group": {
+			method:         "AddMembers",
+			path:           "/members",
+			body:           fmt.Sprintf(`{"device_ids": [%q]}`, deviceID),
+			businessErr:    group.ErrNotStatic,
+			expectedStatus: http.StatusConflict,
+		},
+		"add an unknown device": {
+			method:         "AddMembers",
+			path:           "/members",
+			body:           fmt.Sprintf(`{"device_ids": [%q]}`, deviceID),
+			businessErr:    fmt.Errorf("%w: %s", group.ErrUnknownDevice, deviceID),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"remove": {
+			method:         "RemoveMember",
+			path:           "/members/" + deviceID,
+			expectedStatus: http.StatusOK,
+		},
+		"remove an invalid device": {
+			method:         "RemoveMember",
+			path:           "/members/1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"remove a device that is not a member": {
+			method:         "RemoveMember",
+			path:           "/members/" + deviceID,
+			businessErr:    fmt.Errorf("store.RemoveMember: %w", group.ErrNotMember),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("AddMembers", mock.Anything, id, mock.AnythingOfType("group.Members")).Return(tc.businessErr)
+			b.On("RemoveMember", mock.Anything, id, deviceID).Return(tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/groups/{id}/members", h.AddMembers)
+			r.Delete("/groups/{id}/members/{deviceID}", h.RemoveMember)
+
+			httpMethod := "POST"
+			if tc.method == "RemoveMember" {
+				httpMethod = "DELETE"
+			}
+			req := httptest.NewRequest(httpMethod, "/groups/"+id+tc.path, bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOperations(t *testing.T) {
+	testTable := map[string]struct {
+		path           string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"labels": {
+			path:           "labels",
+			body:           `{"set": {"env": "prod"}, "remove": ["beta"]}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		"invalid labels": {
+			path:           "labels",
+			body:           `{"set": {"env": "prod"}, "remove": ["env"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"labels of an unknown group": {
+			path:           "labels",
+			body:           `{"remove": ["beta"]}`,
+			businessErr:    fmt.Errorf("store.ByID: %w", group.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		"command": {
+			path:           "commands",
+			body:           `{"name": "reboot"}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		"invalid command": {
+			path:           "commands",
+			body:           `{"name": "Reboot!"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"command failing": {
+			path:           "commands",
+			body:           `{"name": "reboot"}`,
+			businessErr:    fmt.Errorf("store.CreateOperation: connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			op := group.Operation{ID: operationID, GroupID: id, Status: group.OperationRunning}
+			b.On("UpdateLabels", mock.Anything, id, mock.AnythingOfType("group.LabelChange")).Return(op, tc.businessErr)
+			b.On("SendCommand", mock.Anything, id, mock.AnythingOfType("command.CreateCommand")).Return(op, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/groups/{id}/labels", h.UpdateLabels)
+			r.Post("/groups/{id}/commands", h.SendCommand)
+
+			req := httptest.NewRequest("POST", "/groups/"+id+"/"+tc.path, bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOperation(t *testing.T) {
+	testTable := map[string]struct {
+		operationID    string
+		businessErr    error
+		expectedStatus int
+	}{
+		"operation": {
+			operationID:    operationID,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid operation id": {
+			operationID:    "1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"operation of another group": {
+			operationID:    operationID,
+			businessErr:    group.ErrOperationNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		"lookup failing": {
+			operationID:    operationID,
+			businessErr:    fmt.Errorf("store.OperationByID: connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			op := group.Operation{ID: operationID, GroupID: id, Status: group.OperationCompleted, Devices: 2, Succeeded: 1, Failed: 1,
+				Failures: []group.Failure{{DeviceID: deviceID, Error: "device not found"}}}
+			b.On("Operation", mock.Anything, id, tc.operationID).Return(op, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Get("/groups/{id}/operations/{operationID}", h.Operation)
+
+			req := httptest.NewRequest("GET", "/groups/"+id+"/operations/"+tc.operationID, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package health
+
+import (
+	"context"
+	"device/pkg/web"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Statuses reported by the health endpoints
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// Checker checks that a dependency is usable
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckFunc adapts a function to a Checker
+type CheckFunc func(ctx context.Context) error
+
+// Check calls f
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Response is the body of the health endpoints
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// namedChecker is a registered checker
+type namedChecker struct {
+	name    string
+	checker Checker
+}
+
+// Handler represents the health handler
+type Handler struct {
+	checkers []namedChecker
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewHandler creates a new health handler
+func NewHandler() *Handler {
+	return &Handler{
+		timeout: defaultCheckTimeout,
+	}
+}
+
+// Register adds a checker run by the readiness endpoint
+func (h *Handler) Register(name string, c Checker) {
+	h.checkers = append(h.checkers, namedChecker{name: name, checker: c})
+}
+
+// Drain makes the readiness endpoint fail, so traffic moves away before shutdown
+func (h *Handler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is running
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	web.SendOk(w, Response{Status: StatusOK})
+}
+
+// Ready runs every checker concurrently and reports whether the service can take traffic
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	resp := Response{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(h.checkers)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range h.checkers {
+		wg.Add(1)
+		go func(c namedChecker) {
+			defer wg.Done()
+			result := run(ctx, c.checker)
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[c.name] = result
+			if result.Status != StatusOK {
+				resp.Status = StatusFailing
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if h.draining.Load() {
+		resp.Status = StatusDraining
+	}
+
+	if resp.Status != StatusOK {
+		web.Send(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	web.SendOk(w, resp)
+}
+
+// run runs a checker and measures it
+func run(ctx context.Context, c Checker) CheckResult {
+	start := time.Now()
+	err := c.Check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = fmt.Sprintf("%v", err)
+	}
+	return result
+}
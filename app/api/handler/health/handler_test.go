@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLive(t *testing.T) {
+	h := NewHandler()
+	h.Register("database", CheckFunc(func(ctx context.Context) error {
+		return fmt.Errorf("db err")
+	}))
+
+	w := httptest.NewRecorder()
+	h.Live(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestReady(t *testing.T) {
+	ok := CheckFunc(func(ctx context.Context) error { return nil })
+	failing := CheckFunc(func(ctx context.Context) error { return fmt.Errorf("db err") })
+
+	testTable := map[string]struct {
+		checks         map[string]Checker
+		draining       bool
+		expectedStatus int
+		expectedBody   string
+		expectedChecks map[string]string
+	}{
+		"success": {
+			checks:         map[string]Checker{"database": ok, "outbox": ok},
+			expectedStatus: http.StatusOK,
+			expectedBody:   StatusOK,
+			expectedChecks: map[string]string{"database": StatusOK, "outbox": StatusOK},
+		},
+		"failing check": {
+			checks:         map[string]Checker{"database": failing, "outbox": ok},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   StatusFailing,
+			expectedChecks: map[string]string{"database": StatusFailing, "outbox": StatusOK},
+		},
+		"draining": {
+			checks:         map[string]Checker{"database": ok},
+			draining:       true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   StatusDraining,
+			expectedChecks: map[string]string{"database": StatusOK},
+		},
+	}
+
+	for name, tt := range testTable {
+		t.Run(name, func(t *testing.T) {
+			h := NewHandler()
+			for name, c := range tt.checks {
+				h.Register(name, c)
+			}
+			if tt.draining {
+				h.Drain()
+			}
+
+			w := httptest.NewRecorder()
+			h.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var resp Response
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+			if resp.Status != tt.expectedBody {
+				t.Fatalf("expected status %q, got %q", tt.expectedBody, resp.Status)
+			}
+			for name, status := range tt.expectedChecks {
+				if resp.Checks[name].Status != status {
+					t.Errorf("expected check %s to be %q, got %q", name, status, resp.Checks[name].Status)
+				}
+			}
+			if resp.Checks["database"].Status == StatusFailing && resp.Checks["database"].Error == "" {
+				t.Errorf("expected the failing check to report its error")
+			}
+		})
+	}
+}
+
+func TestReadyTimeout(t *testing.T) {
+	h := NewHandler()
+	h.timeout = 10 * time.Millisecond
+	h.Register("slow", CheckFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
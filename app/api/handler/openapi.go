@@ -0,0 +1,792 @@
+package handler
+
+import (
+	"device/app/api/handler/health"
+	"device/business/command"
+	"device/business/device"
+	"device/business/event"
+	"device/business/firmware"
+	"device/business/group"
+	"device/business/shadow"
+	"device/business/telemetry"
+	"device/business/webhook"
+	"device/pkg/openapi"
+	"device/pkg/web"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// routes that serve the documentation itself and are left out of the spec
+var undocumented = map[string]bool{
+	"GET /openapi.json": true,
+	"GET /docs":         true,
+}
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// messageResponse is the body of responses that only confirm an action
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// graphQLRequest is the body of a GraphQL request
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphQLResponse is the body of a GraphQL response
+type graphQLResponse struct {
+	Data   map[string]interface{}   `json:"data,omitempty"`
+	Errors []map[string]interface{} `json:"errors,omitempty"`
+}
+
+// operations describes every documented route, keyed by "METHOD /path"
+func operations(d *openapi.Document) map[string]*openapi.Operation {
+	errResp := func(desc string) openapi.Response {
+		return openapi.Response{Description: desc, Content: openapi.JSON(d.SchemaOf(errorResponse{}))}
+	}
+	okResp := func(desc string, v interface{}) openapi.Response {
+		return openapi.Response{Description: desc, Content: openapi.JSON(d.SchemaOf(v))}
+	}
+	body := func(v interface{}) *openapi.RequestBody {
+		return &openapi.RequestBody{Required: true, Content: openapi.JSON(d.SchemaOf(v))}
+	}
+
+	idParam := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}}
+	pagination := []openapi.Parameter{
+		{Name: "offset", In: "query", Schema: &openapi.Schema{Type: "integer", Default: 0}},
+		{Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer", Default: 10}},
+	}
+	shadowUpdateResponses := map[string]openapi.Response{
+		"200": okResp("The updated shadow", shadow.Shadow{}),
+		"400": errResp("Invalid ID or payload, or a section too large"),
+		"404": errResp("Device not found"),
+		"409": errResp("The shadow is not at the version of the update"),
+		"500": errResp("Unable to update shadow"),
+	}
+	commandParams := []openapi.Parameter{
+		idParam,
+		{Name: "commandID", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+	}
+	groupParams := []openapi.Parameter{
+		idParam,
+		{Name: "deviceID", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+	}
+	transitionResponses := func(action string) map[string]openapi.Response {
+		return map[string]openapi.Response{
+			"200": okResp("The rollout", firmware.Rollout{}),
+			"400": errResp("Invalid ID"),
+			"404": errResp("Rollout not found"),
+			"409": errResp(fmt.Sprintf("Unable to %s the rollout in its current status", action)),
+			"500": errResp(fmt.Sprintf("Unable to %s rollout", action)),
+		}
+	}
+
+	return map[string]*openapi.Operation{
+		"GET /api/v1/devices": {
+			OperationID: "listDevices",
+			Summary:     "List devices, optionally filtered by brand, status, last heartbeat and labels",
+			Tags:        []string{"devices"},
+			Parameters: append([]openapi.Parameter{
+				{Name: "brand", In: "query", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"unknown", "online", "offline"}}},
+				{Name: "last_seen_after", In: "query", Description: "Only devices last seen at or after this time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "last_seen_before", In: "query", Description: "Only devices last seen before this time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "label", In: "query", Description: "Only devices with this label, as key=value; repeat it to require several", Schema: &openapi.Schema{Type: "string"}},
+			}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The devices", []device.Device{}),
+				"400": errResp("Invalid filter"),
+				"500": errResp("Unable to get devices"),
+			},
+		},
+		"POST /api/v1/devices": {
+			OperationID: "createDevice",
+			Summary:     "Create a device",
+			Tags:        []string{"devices"},
+			RequestBody: body(device.CreateDevice{}),
+			Responses: map[string]openapi.Response{
+				"201": okResp("The created device", device.Device{}),
+				"400": errResp("Invalid payload"),
+				"500": errResp("Unable to create device"),
+			},
+		},
+		"GET /api/v1/devices/{id}": {
+			OperationID: "getDevice",
+			Summary:     "Get a device",
+			Tags:        []string{"devices"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The device", device.Device{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Device not found"),
+			},
+		},
+		"PUT /api/v1/devices/{id}": {
+			OperationID: "updateDevice",
+			Summary:     "Update the fields of a device that are set",
+			Tags:        []string{"devices"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(device.UpdateDevice{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("Device updated", messageResponse{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Device not found"),
+			},
+		},
+		"DELETE /api/v1/devices/{id}": {
+			OperationID: "deleteDevice",
+			Summary:     "Delete a device",
+			Tags:        []string{"devices"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("Device deleted", messageResponse{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Device not found"),
+			},
+		},
+		"POST /api/v1/devices/{id}/heartbeat": {
+			OperationID: "deviceHeartbeat",
+			Summary:     "Record that a device is alive, with optional metadata",
+			Tags:        []string{"devices"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: &openapi.RequestBody{Content: openapi.JSON(d.SchemaOf(device.Heartbeat{}))},
+			Responses: map[string]openapi.Response{
+				"200": okResp("Heartbeat recorded", messageResponse{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Device not found"),
+			},
+		},
+		"POST /api/v1/devices/{id}/telemetry": {
+			OperationID: "ingestTelemetry",
+			Summary:     "Store a batch of telemetry samples of a device",
+			Tags:        []string{"telemetry"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(telemetry.Batch{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The number of samples stored", telemetry.IngestResult{}),
+				"400": errResp("Invalid ID, payload or sample time"),
+				"404": errResp("Device not found"),
+				"500": errResp("Unable to ingest telemetry"),
+			},
+		},
+		"GET /api/v1/devices/{id}/telemetry": {
+			OperationID: "queryTelemetry",
+			Summary:     "Query the samples of a metric of a device, downsampled when a step is set",
+			Tags:        []string{"telemetry"},
+			Parameters: []openapi.Parameter{
+				idParam,
+				{Name: "metric", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+				{Name: "from", In: "query", Description: "Start of the range, inclusive; defaults to an hour before to", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "to", In: "query", Description: "End of the range, exclusive; defaults to now", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "step", In: "query", Description: "Width of the aggregated points, e.g. 30s or 5m", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "agg", In: "query", Description: "Aggregation of the samples of a step; defaults to avg", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"avg", "min", "max", "last"}}},
+			},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The points of the metric, oldest first", telemetry.Series{}),
+				"400": errResp("Invalid ID or query, or too many points"),
+				"404": errResp("Device not found"),
+				"500": errResp("Unable to query telemetry"),
+			},
+		},
+		"GET /api/v1/devices/{id}/shadow": {
+			OperationID: "getShadow",
+			Summary:     "Get the shadow of a device, with the desired state it has yet to report as delta",
+			Tags:        []string{"shadows"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The shadow", shadow.Shadow{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Device not found"),
+				"500": errResp("Unable to get shadow"),
+			},
+		},
+		"PUT /api/v1/devices/{id}/shadow/desired": {
+			OperationID: "updateDesiredState",
+			Summary:     "Merge a change into the state desired for a device",
+			Tags:        []string{"shadows"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(shadow.UpdateState{}),
+			Responses:   shadowUpdateResponses,
+		},
+		"PUT /api/v1/devices/{id}/shadow/reported": {
+			OperationID: "updateReportedState",
+			Summary:     "Merge a change into the state a device reports",
+			Tags:        []string{"shadows"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(shadow.UpdateState{}),
+			Responses:   shadowUpdateResponses,
+		},
+		"POST /api/v1/devices/{id}/commands": {
+			OperationID: "enqueueCommand",
+			Summary:     "Queue a command for a device",
+			Tags:        []string{"commands"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(command.CreateCommand{}),
+			Responses: map[string]openapi.Response{
+				"201": okResp("The queued command", command.Command{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Device not found"),
+				"500": errResp("Unable to enqueue command"),
+			},
+		},
+		"GET /api/v1/devices/{id}/commands": {
+			OperationID: "listCommands",
+			Summary:     "List the commands of a device, newest first",
+			Tags:        []string{"commands"},
+			Parameters:  append([]openapi.Parameter{idParam}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The commands", []command.Command{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Device not found"),
+				"500": errResp("Unable to get commands"),
+			},
+		},
+		"GET /api/v1/devices/{id}/commands/pending": {
+			OperationID: "pollCommands",
+			Summary:     "Deliver the queued commands of a device, waiting for some when there are none",
+			Tags:        []string{"commands"},
+			Parameters: []openapi.Parameter{
+				idParam,
+				{Name: "wait", In: "query", Description: fmt.Sprintf("How long to wait for a command, e.g. 20s; capped at %s, defaults to not waiting", command.MaxWait), Schema: &openapi.Schema{Type: "string"}},
+			},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The delivered commands, oldest first; empty if none arrived in time", []command.Command{}),
+				"400": errResp("Invalid ID or wait"),
+				"404": errResp("Device not found"),
+				"500": errResp("Unable to poll commands"),
+			},
+		},
+		"GET /api/v1/devices/{id}/commands/{commandID}": {
+			OperationID: "getCommand",
+			Summary:     "Get a command of a device",
+			Tags:        []string{"commands"},
+			Parameters:  commandParams,
+			Responses: map[string]openapi.Response{
+				"200": okResp("The command", command.Command{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Command not found"),
+				"500": errResp("Unable to get command"),
+			},
+		},
+		"POST /api/v1/devices/{id}/commands/{commandID}/ack": {
+			OperationID: "ackCommand",
+			Summary:     "Record whether a delivered command succeeded or failed",
+			Tags:        []string{"commands"},
+			Parameters:  commandParams,
+			RequestBody: body(command.Ack{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The completed command", command.Command{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Command not found"),
+				"409": errResp("The command is not awaiting an acknowledgement"),
+				"500": errResp("Unable to acknowledge command"),
+			},
+		},
+		"GET /api/v1/devices/events": {
+			OperationID: "streamDeviceEvents",
+			Summary:     "Stream device events as Server-Sent Events",
+			Tags:        []string{"devices"},
+			Parameters: []openapi.Parameter{
+				{Name: "Last-Event-ID", In: "header", Description: "Resume after this event", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "brand", In: "query", Schema: &openapi.Schema{Type: "string"}},
+			},
+			Responses: map[string]openapi.Response{
+				"200": {
+					Description: "A stream of events, each with the JSON encoded event as data",
+					Content:     map[string]openapi.MediaType{"text/event-stream": {Schema: d.SchemaOf(event.Event{})}},
+				},
+			},
+		},
+		"GET /api/v1/webhooks": {
+			OperationID: "listWebhooks",
+			Summary:     "List webhook subscriptions",
+			Tags:        []string{"webhooks"},
+			Parameters:  pagination,
+			Responses: map[string]openapi.Response{
+				"200": okResp("The subscriptions, without secrets", []webhook.Subscription{}),
+				"500": errResp("Unable to get webhooks"),
+			},
+		},
+		"POST /api/v1/webhooks": {
+			OperationID: "createWebhook",
+			Summary:     "Create a webhook subscription",
+			Tags:        []string{"webhooks"},
+			RequestBody: body(webhook.CreateSubscription{}),
+			Responses: map[string]openapi.Response{
+				"201": okResp("The created subscription, including its secret", webhook.Subscription{}),
+				"400": errResp("Invalid payload"),
+				"500": errResp("Unable to create webhook"),
+			},
+		},
+		"GET /api/v1/webhooks/{id}": {
+			OperationID: "getWebhook",
+			Summary:     "Get a webhook subscription",
+			Tags:        []string{"webhooks"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The subscription, without its secret", webhook.Subscription{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Webhook not found"),
+			},
+		},
+		"PUT /api/v1/webhooks/{id}": {
+			OperationID: "updateWebhook",
+			Summary:     "Update the fields of a webhook subscription that are set",
+			Tags:        []string{"webhooks"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(webhook.UpdateSubscription{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("Webhook updated", messageResponse{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Webhook not found"),
+			},
+		},
+		"DELETE /api/v1/webhooks/{id}": {
+			OperationID: "deleteWebhook",
+			Summary:     "Delete a webhook subscription and its delivery log",
+			Tags:        []string{"webhooks"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("Webhook deleted", messageResponse{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Webhook not found"),
+			},
+		},
+		"GET /api/v1/webhooks/{id}/deliveries": {
+			OperationID: "listWebhookDeliveries",
+			Summary:     "List the deliveries of a webhook subscription, newest first",
+			Tags:        []string{"webhooks"},
+			Parameters:  append([]openapi.Parameter{idParam}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The deliveries", []webhook.Delivery{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Webhook not found"),
+			},
+		},
+		"GET /api/v1/devices/{id}/firmware": {
+			OperationID: "getFirmwareUpdate",
+			Summary:     "Get the firmware update a device should install, if any",
+			Tags:        []string{"rollouts"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The update", firmware.DeviceUpdate{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Device not found, or no firmware update"),
+				"500": errResp("Unable to get firmware update"),
+			},
+		},
+		"POST /api/v1/devices/{id}/firmware/report": {
+			OperationID: "reportFirmwareUpdate",
+			Summary:     "Report the progress of a firmware update on a device",
+			Tags:        []string{"rollouts"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(firmware.Report{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The progress of the device", firmware.DeviceProgress{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Device has no update in the rollout"),
+				"409": errResp("The outcome of the update is already reported"),
+				"500": errResp("Unable to record report"),
+			},
+		},
+		"GET /api/v1/firmware": {
+			OperationID: "listFirmware",
+			Summary:     "List firmware, newest first, optionally only the firmware compatible with a brand",
+			Tags:        []string{"firmware"},
+			Parameters: append([]openapi.Parameter{
+				{Name: "brand", In: "query", Schema: &openapi.Schema{Type: "string"}},
+			}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The firmware", []firmware.Firmware{}),
+				"500": errResp("Unable to get firmware"),
+			},
+		},
+		"POST /api/v1/firmware": {
+			OperationID: "createFirmware",
+			Summary:     "Register a firmware version",
+			Tags:        []string{"firmware"},
+			RequestBody: body(firmware.CreateFirmware{}),
+			Responses: map[string]openapi.Response{
+				"201": okResp("The registered firmware", firmware.Firmware{}),
+				"400": errResp("Invalid payload"),
+				"409": errResp("The version already exists"),
+				"500": errResp("Unable to create firmware"),
+			},
+		},
+		"GET /api/v1/firmware/{id}": {
+			OperationID: "getFirmware",
+			Summary:     "Get a firmware",
+			Tags:        []string{"firmware"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The firmware", firmware.Firmware{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Firmware not found"),
+				"500": errResp("Unable to get firmware"),
+			},
+		},
+		"DELETE /api/v1/firmware/{id}": {
+			OperationID: "deleteFirmware",
+			Summary:     "Delete a firmware no rollout installs",
+			Tags:        []string{"firmware"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("Firmware deleted", messageResponse{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Firmware not found"),
+				"409": errResp("A rollout installs the firmware"),
+				"500": errResp("Unable to delete firmware"),
+			},
+		},
+		"GET /api/v1/rollouts": {
+			OperationID: "listRollouts",
+			Summary:     "List rollouts, newest first, optionally filtered by status",
+			Tags:        []string{"rollouts"},
+			Parameters: append([]openapi.Parameter{
+				{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"running", "paused", "completed", "cancelled"}}},
+			}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The rollouts, without progress", []firmware.Rollout{}),
+				"400": errResp("Invalid status"),
+				"500": errResp("Unable to get rollouts"),
+			},
+		},
+		"POST /api/v1/rollouts": {
+			OperationID: "createRollout",
+			Summary:     "Start rolling out a firmware to the devices matching a target, in stages",
+			Tags:        []string{"rollouts"},
+			RequestBody: body(firmware.CreateRollout{}),
+			Responses: map[string]openapi.Response{
+				"201": okResp("The started rollout", firmware.Rollout{}),
+				"400": errResp("Invalid payload, incompatible firmware or no matching device"),
+				"404": errResp("Firmware not found"),
+				"500": errResp("Unable to create rollout"),
+			},
+		},
+		"GET /api/v1/rollouts/{id}": {
+			OperationID: "getRollout",
+			Summary:     "Get a rollout along with its progress",
+			Tags:        []string{"rollouts"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The rollout", firmware.Rollout{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Rollout not found"),
+				"500": errResp("Unable to get rollout"),
+			},
+		},
+		"POST /api/v1/rollouts/{id}/pause": {
+			OperationID: "pauseRollout",
+			Summary:     "Pause a running rollout",
+			Tags:        []string{"rollouts"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses:   transitionResponses("pause"),
+		},
+		"POST /api/v1/rollouts/{id}/resume": {
+			OperationID: "resumeRollout",
+			Summary:     "Resume a paused rollout, accepting the failures so far",
+			Tags:        []string{"rollouts"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses:   transitionResponses("resume"),
+		},
+		"POST /api/v1/rollouts/{id}/cancel": {
+			OperationID: "cancelRollout",
+			Summary:     "Cancel a running or paused rollout",
+			Tags:        []string{"rollouts"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses:   transitionResponses("cancel"),
+		},
+		"GET /api/v1/rollouts/{id}/devices": {
+			OperationID: "listRolloutDevices",
+			Summary:     "List the progress of the devices of a rollout, by stage",
+			Tags:        []string{"rollouts"},
+			Parameters: append([]openapi.Parameter{
+				idParam,
+				{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"pending", "installing", "succeeded", "failed"}}},
+			}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The progress of the devices", []firmware.DeviceProgress{}),
+				"400": errResp("Invalid ID or status"),
+				"404": errResp("Rollout not found"),
+				"500": errResp("Unable to get rollout devices"),
+			},
+		},
+		"GET /api/v1/groups": {
+			OperationID: "listGroups",
+			Summary:     "List the top-level groups by name, or the groups nested in a parent",
+			Tags:        []string{"groups"},
+			Parameters: append([]openapi.Parameter{
+				{Name: "parent_id", In: "query", Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+			}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The groups", []group.Group{}),
+				"400": errResp("Invalid parent ID"),
+				"500": errResp("Unable to get groups"),
+			},
+		},
+		"POST /api/v1/groups": {
+			OperationID: "createGroup",
+			Summary:     "Create a static group listing its devices, or a dynamic group selecting them by brand and labels",
+			Tags:        []string{"groups"},
+			RequestBody: body(group.CreateGroup{}),
+			Responses: map[string]openapi.Response{
+				"201": okResp("The created group", group.Group{}),
+				"400": errResp("Invalid payload, unknown parent or device, or groups nested too deep"),
+				"500": errResp("Unable to create group"),
+			},
+		},
+		"GET /api/v1/groups/{id}": {
+			OperationID: "getGroup",
+			Summary:     "Get a group",
+			Tags:        []string{"groups"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The group", group.Group{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Group not found"),
+				"500": errResp("Unable to get group"),
+			},
+		},
+		"PUT /api/v1/groups/{id}": {
+			OperationID: "updateGroup",
+			Summary:     "Rename a group, move it to another parent, or change the filter of a dynamic group",
+			Tags:        []string{"groups"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(group.UpdateGroup{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The updated group", group.Group{}),
+				"400": errResp("Invalid ID or payload, unknown parent, a cycle, or groups nested too deep"),
+				"404": errResp("Group not found"),
+				"409": errResp("Only dynamic groups have a filter"),
+				"500": errResp("Unable to update group"),
+			},
+		},
+		"DELETE /api/v1/groups/{id}": {
+			OperationID: "deleteGroup",
+			Summary:     "Delete a group without subgroups, leaving its devices as they are",
+			Tags:        []string{"groups"},
+			Parameters:  []openapi.Parameter{idParam},
+			Responses: map[string]openapi.Response{
+				"200": okResp("Group deleted", messageResponse{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Group not found"),
+				"409": errResp("The group has subgroups"),
+				"500": errResp("Unable to delete group"),
+			},
+		},
+		"GET /api/v1/groups/{id}/devices": {
+			OperationID: "listGroupDevices",
+			Summary:     "List the devices of a group, its subgroups included, by ID",
+			Tags:        []string{"groups"},
+			Parameters:  append([]openapi.Parameter{idParam}, pagination...),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The devices", []device.Device{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Group not found"),
+				"500": errResp("Unable to get devices"),
+			},
+		},
+		"POST /api/v1/groups/{id}/members": {
+			OperationID: "addGroupMembers",
+			Summary:     "Add devices to a static group",
+			Tags:        []string{"groups"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(group.Members{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("Devices added", messageResponse{}),
+				"400": errResp("Invalid ID or payload, or unknown device"),
+				"404": errResp("Group not found"),
+				"409": errResp("The group is dynamic"),
+				"500": errResp("Unable to add devices"),
+			},
+		},
+		"DELETE /api/v1/groups/{id}/members/{deviceID}": {
+			OperationID: "removeGroupMember",
+			Summary:     "Remove a device from a static group",
+			Tags:        []string{"groups"},
+			Parameters:  groupParams,
+			Responses: map[string]openapi.Response{
+				"200": okResp("Device removed", messageResponse{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Group not found, or the device is not a member"),
+				"409": errResp("The group is dynamic"),
+				"500": errResp("Unable to remove device"),
+			},
+		},
+		"POST /api/v1/groups/{id}/labels": {
+			OperationID: "updateGroupLabels",
+			Summary:     "Start setting and removing labels on every device of a group, its subgroups included",
+			Tags:        []string{"groups"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(group.LabelChange{}),
+			Responses: map[string]openapi.Response{
+				"202": okResp("The started operation", group.Operation{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Group not found"),
+				"500": errResp("Unable to update labels"),
+			},
+		},
+		"POST /api/v1/groups/{id}/commands": {
+			OperationID: "sendGroupCommand",
+			Summary:     "Start enqueuing a command for every device of a group, its subgroups included",
+			Tags:        []string{"groups"},
+			Parameters:  []openapi.Parameter{idParam},
+			RequestBody: body(command.CreateCommand{}),
+			Responses: map[string]openapi.Response{
+				"202": okResp("The started operation", group.Operation{}),
+				"400": errResp("Invalid ID or payload"),
+				"404": errResp("Group not found"),
+				"500": errResp("Unable to send command"),
+			},
+		},
+		"GET /api/v1/groups/{id}/operations/{operationID}": {
+			OperationID: "getGroupOperation",
+			Summary:     "Get the progress of an operation on the devices of a group",
+			Tags:        []string{"groups"},
+			Parameters: []openapi.Parameter{
+				idParam,
+				{Name: "operationID", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+			},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The operation", group.Operation{}),
+				"400": errResp("Invalid ID"),
+				"404": errResp("Operation not found"),
+				"500": errResp("Unable to get operation"),
+			},
+		},
+		"POST /graphql": {
+			OperationID: "graphql",
+			Summary:     "Execute a GraphQL query or mutation",
+			Tags:        []string{"graphql"},
+			RequestBody: body(graphQLRequest{}),
+			Responses: map[string]openapi.Response{
+				"200": okResp("The GraphQL result", graphQLResponse{}),
+				"400": errResp("Invalid payload"),
+			},
+		},
+		"GET /healthz": {
+			OperationID: "liveness",
+			Summary:     "Report that the process is alive",
+			Tags:        []string{"health"},
+			Responses: map[string]openapi.Response{
+				"200": okResp("The process is alive", health.Response{}),
+			},
+		},
+		"GET /readyz": {
+			OperationID: "readiness",
+			Summary:     "Check the dependencies and report whether the service can take traffic",
+			Tags:        []string{"health"},
+			Responses: map[string]openapi.Response{
+				"200": okResp("Every check passed", health.Response{}),
+				"503": {Description: "A check failed or the server is draining", Content: openapi.JSON(d.SchemaOf(health.Response{}))},
+			},
+		},
+		"GET /metrics": {
+			OperationID: "metrics",
+			Summary:     "Expose the metrics in the Prometheus text format",
+			Tags:        []string{"health"},
+			Responses: map[string]openapi.Response{
+				"200": {Description: "The metrics", Content: openapi.Text("text/plain")},
+			},
+		},
+	}
+}
+
+// NewSpec assembles the OpenAPI document of the routes registered on r.
+// It fails when a route is not documented or a documented route does not exist.
+func NewSpec(r chi.Routes) (*openapi.Document, error) {
+	d := openapi.NewDocument(openapi.Info{
+		Title:   "Device API",
+		Version: "1.0.0",
+	})
+	ops := operations(d)
+
+	var errs []string
+	seen := map[string]bool{}
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = normalizeRoute(route)
+		key := method + " " + route
+		if undocumented[key] {
+			return nil
+		}
+		seen[key] = true
+
+		op, ok := ops[key]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("route %s is not documented", key))
+			return nil
+		}
+
+		item, ok := d.Paths[route]
+		if !ok {
+			item = &openapi.PathItem{}
+			d.Paths[route] = item
+		}
+		if !item.SetOperation(method, op) {
+			errs = append(errs, fmt.Sprintf("method of route %s is not supported", key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("chi.Walk: %w", err)
+	}
+
+	for key := range ops {
+		if !seen[key] {
+			errs = append(errs, fmt.Sprintf("documented route %s does not exist", key))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("spec does not match routes: %s", strings.Join(errs, "; "))
+	}
+	return d, nil
+}
+
+// normalizeRoute removes the trailing slash chi adds to the root of sub-routers
+func normalizeRoute(route string) string {
+	if len(route) > 1 {
+		return strings.TrimSuffix(route, "/")
+	}
+	return route
+}
+
+// specHandler serves the OpenAPI document of r, built on first use
+func specHandler(r chi.Routes) http.HandlerFunc {
+	var (
+		once sync.Once
+		spec *openapi.Document
+		err  error
+	)
+	return func(w http.ResponseWriter, _ *http.Request) {
+		once.Do(func() {
+			spec, err = NewSpec(r)
+		})
+		if err != nil {
+			web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to build OpenAPI document"))
+			return
+		}
+		web.SendOk(w, spec)
+	}
+}
+
+// docsHandler serves the API documentation page
+func docsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
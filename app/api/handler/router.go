@@ -1,7 +1,15 @@
 package handler
 
 import (
+	"device/app/api/handler/command"
 	"device/app/api/handler/device"
+	"device/app/api/handler/firmware"
+	"device/app/api/handler/group"
+	"device/app/api/handler/health"
+	"device/app/api/handler/shadow"
+	"device/app/api/handler/stream"
+	"device/app/api/handler/telemetry"
+	"device/app/api/handler/webhook"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -9,18 +17,88 @@ import (
 
 // Handlers represents the handlers
 type Handlers struct {
-	Device *device.Handler
+	Device    *device.Handler
+	Webhook   *webhook.Handler
+	Stream    *stream.Handler
+	Telemetry *telemetry.Handler
+	Shadow    *shadow.Handler
+	Command   *command.Handler
+	Firmware  *firmware.Handler
+	Group     *group.Handler
+	GraphQL   http.Handler
+	Health    *health.Handler
+	Metrics   http.Handler
+
+	// Middlewares wrap every route, outermost first
+	Middlewares []func(http.Handler) http.Handler
 }
 
 // NewRouter creates a new router
 func NewRouter(hs Handlers) http.Handler {
 	r := chi.NewRouter()
+	r.Use(hs.Middlewares...)
 	r.Route("/api/v1/devices", func(r chi.Router) {
+		r.Get("/events", hs.Stream.Devices)
 		r.Get("/{id}", hs.Device.GetByID)
 		r.Put("/{id}", hs.Device.Update)
 		r.Delete("/{id}", hs.Device.Delete)
+		r.Post("/{id}/heartbeat", hs.Device.Heartbeat)
+		r.Get("/{id}/telemetry", hs.Telemetry.Query)
+		r.Post("/{id}/telemetry", hs.Telemetry.Ingest)
+		r.Get("/{id}/shadow", hs.Shadow.Get)
+		r.Put("/{id}/shadow/desired", hs.Shadow.UpdateDesired)
+		r.Put("/{id}/shadow/reported", hs.Shadow.UpdateReported)
+		r.Get("/{id}/commands", hs.Command.History)
+		r.Post("/{id}/commands", hs.Command.Enqueue)
+		r.Get("/{id}/commands/pending", hs.Command.Poll)
+		r.Get("/{id}/commands/{commandID}", hs.Command.GetByID)
+		r.Post("/{id}/commands/{commandID}/ack", hs.Command.Ack)
+		r.Get("/{id}/firmware", hs.Firmware.PendingUpdate)
+		r.Post("/{id}/firmware/report", hs.Firmware.Report)
 		r.Get("/", hs.Device.SearchByBrand)
 		r.Post("/", hs.Device.Create)
 	})
+	r.Route("/api/v1/webhooks", func(r chi.Router) {
+		r.Get("/{id}", hs.Webhook.GetByID)
+		r.Put("/{id}", hs.Webhook.Update)
+		r.Delete("/{id}", hs.Webhook.Delete)
+		r.Get("/{id}/deliveries", hs.Webhook.Deliveries)
+		r.Get("/", hs.Webhook.GetAll)
+		r.Post("/", hs.Webhook.Create)
+	})
+	r.Route("/api/v1/firmware", func(r chi.Router) {
+		r.Get("/{id}", hs.Firmware.GetFirmware)
+		r.Delete("/{id}", hs.Firmware.DeleteFirmware)
+		r.Get("/", hs.Firmware.ListFirmware)
+		r.Post("/", hs.Firmware.CreateFirmware)
+	})
+	r.Route("/api/v1/rollouts", func(r chi.Router) {
+		r.Get("/{id}", hs.Firmware.GetRollout)
+		r.Post("/{id}/pause", hs.Firmware.PauseRollout)
+		r.Post("/{id}/resume", hs.Firmware.ResumeRollout)
+		r.Post("/{id}/cancel", hs.Firmware.CancelRollout)
+		r.Get("/{id}/devices", hs.Firmware.RolloutDevices)
+		r.Get("/", hs.Firmware.ListRollouts)
+		r.Post("/", hs.Firmware.CreateRollout)
+	})
+	r.Route("/api/v1/groups", func(r chi.Router) {
+		r.Get("/{id}", hs.Group.Get)
+		r.Put("/{id}", hs.Group.Update)
+		r.Delete("/{id}", hs.Group.Delete)
+		r.Get("/{id}/devices", hs.Group.Devices)
+		r.Post("/{id}/members", hs.Group.AddMembers)
+		r.Delete("/{id}/members/{deviceID}", hs.Group.RemoveMember)
+		r.Post("/{id}/labels", hs.Group.UpdateLabels)
+		r.Post("/{id}/commands", hs.Group.SendCommand)
+		r.Get("/{id}/operations/{operationID}", hs.Group.Operation)
+		r.Get("/", hs.Group.List)
+		r.Post("/", hs.Group.Create)
+	})
+	r.Post("/graphql", hs.GraphQL.ServeHTTP)
+	r.Get("/healthz", hs.Health.Live)
+	r.Get("/readyz", hs.Health.Ready)
+	r.Get("/metrics", hs.Metrics.ServeHTTP)
+	r.Get("/openapi.json", specHandler(r))
+	r.Get("/docs", docsHandler)
 	return r
 }
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"device/app/api/gql"
+	"device/app/api/handler/command"
+	"device/app/api/handler/device"
+	"device/app/api/handler/firmware"
+	"device/app/api/handler/group"
+	"device/app/api/handler/health"
+	"device/app/api/handler/shadow"
+	"device/app/api/handler/stream"
+	"device/app/api/handler/telemetry"
+	"device/app/api/handler/webhook"
+	"device/business/event"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newTestRouter() http.Handler {
+	return NewRouter(Handlers{
+		Device:    device.NewHandler(nil),
+		Webhook:   webhook.NewHandler(nil),
+		Stream:    stream.NewHandler(event.NewBroadcaster(0, 1)),
+		Telemetry: telemetry.NewHandler(nil),
+		Shadow:    shadow.NewHandler(nil),
+		Command:   command.NewHandler(nil),
+		Firmware:  firmware.NewHandler(nil),
+		Group:     group.NewHandler(nil),
+		GraphQL:   gql.NewHandler(nil),
+		Health:    health.NewHandler(),
+		Metrics:   http.NotFoundHandler(),
+	})
+}
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	r := newTestRouter().(chi.Routes)
+
+	spec, err := NewSpec(r)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	routes := 0
+	err = chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if undocumented[method+" "+normalizeRoute(route)] {
+			return nil
+		}
+		routes++
+		if spec.Paths[normalizeRoute(route)].Operation(method) == nil {
+			t.Errorf("route %s %s is missing from the spec", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to walk routes: %v", err)
+	}
+
+	operations := 0
+	for _, item := range spec.Paths {
+		for _, method := range []string{"GET", "PUT", "POST", "DELETE", "PATCH"} {
+			if item.Operation(method) != nil {
+				operations++
+			}
+		}
+	}
+	if operations != routes {
+		t.Fatalf("expected %d operations, got %d", routes, operations)
+	}
+}
+
+func TestSpecRejectsUndocumentedRoutes(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/api/v1/unknown", func(http.ResponseWriter, *http.Request) {})
+
+	if _, err := NewSpec(r); err == nil {
+		t.Fatalf("expected an error for an undocumented route")
+	}
+}
+
+func TestServeSpec(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("unable to decode spec: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("expected 3.1.0, got %s", doc.OpenAPI)
+	}
+	for _, name := range []string{"Device", "CreateDevice", "UpdateDevice", "GroupFilter", "FirmwareRollout"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Fatalf("expected schema %s", name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	newTestRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package shadow
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/shadow"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Business represents the shadow business interface
+type Business interface {
+	Get(ctx context.Context, id string) (shadow.Shadow, error)
+	UpdateDesired(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error)
+	UpdateReported(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error)
+}
+
+// Handler represents the shadow handler
+type Handler struct {
+	business Business
+}
+
+// NewHandler creates a new shadow handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		business: b,
+	}
+}
+
+// Get returns the shadow of a device
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s, err := h.business.Get(r.Context(), id)
+	if err == nil {
+		web.SendOk(w, s)
+		return
+	}
+
+	if errors.Is(err, device.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get shadow"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Get: %w", err)).Error("unable to get shadow")
+}
+
+// UpdateDesired updates the state desired for a device
+func (h *Handler) UpdateDesired(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, "business.UpdateDesired", h.business.UpdateDesired)
+}
+
+// UpdateReported updates the state a device reports
+func (h *Handler) UpdateReported(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, "business.UpdateReported", h.business.UpdateReported)
+}
+
+// update decodes an update of a section of a shadow and applies it with fn
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, name string, fn func(context.Context, string, shadow.UpdateState) (shadow.Shadow, error)) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var u shadow.UpdateState
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := u.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s, err := fn(r.Context(), id, u)
+	switch {
+	case err == nil:
+		web.SendOk(w, s)
+	case errors.Is(err, device.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+	case errors.Is(err, shadow.ErrVersionConflict):
+		web.SendError(w, http.StatusConflict, fmt.Errorf("the shadow changed, get it and retry with its version"))
+	case errors.Is(err, shadow.ErrTooLarge):
+		web.SendError(w, http.StatusBadRequest, err)
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to update shadow"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("%s: %w", name, err)).Error("unable to update shadow")
+	}
+}
+
+// parseID parses the ID from the request
+func parseID(r *http.Request) (string, error) {
+	id := web.ParseStrURLParam("id", r)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return id, nil
+}
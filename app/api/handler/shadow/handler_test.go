@@ -0,0 +1,157 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"device/business/device"
+	"device/business/shadow"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Get(ctx context.Context, id string) (shadow.Shadow, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(shadow.Shadow), args.Error(1)
+}
+
+func (bm *BusinessMock) UpdateDesired(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error) {
+	args := bm.Called(ctx, id, u)
+	return args.Get(0).(shadow.Shadow), args.Error(1)
+}
+
+func (bm *BusinessMock) UpdateReported(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error) {
+	args := bm.Called(ctx, id, u)
+	return args.Get(0).(shadow.Shadow), args.Error(1)
+}
+
+const id = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+
+func TestGet(t *testing.T) {
+	testTable := map[string]struct {
+		id             string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			id:             id,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid id": {
+			id:             "abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			id:             id,
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		"business error": {
+			id:             id,
+			businessErr:    fmt.Errorf("db err"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Get", mock.Anything, tc.id).Return(shadow.Shadow{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Get("/device/{id}/shadow", h.Get)
+
+			req := httptest.NewRequest("GET", "/device/"+tc.id+"/shadow", nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d", tc.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	testTable := map[string]struct {
+		section        string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"desired": {
+			section:        "desired",
+			body:           `{"state": {"mode": "eco"}}`,
+			expectedStatus: http.StatusOK,
+		},
+		"reported with a version": {
+			section:        "reported",
+			body:           `{"state": {"mode": "eco"}, "version": 3}`,
+			expectedStatus: http.StatusOK,
+		},
+		"missing state": {
+			section:        "desired",
+			body:           `{"version": 3}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"state not an object": {
+			section:        "desired",
+			body:           `{"state": [1, 2]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"version conflict": {
+			section:        "desired",
+			body:           `{"state": {"mode": "eco"}, "version": 2}`,
+			businessErr:    fmt.Errorf("%w: the shadow is at version 3, not 2", shadow.ErrVersionConflict),
+			expectedStatus: http.StatusConflict,
+		},
+		"too large": {
+			section:        "reported",
+			body:           `{"state": {"mode": "eco"}}`,
+			businessErr:    fmt.Errorf("%w: reported would be 9000 bytes", shadow.ErrTooLarge),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			section:        "reported",
+			body:           `{"state": {"mode": "eco"}}`,
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("UpdateDesired", mock.Anything, id, mock.AnythingOfType("shadow.UpdateState")).Return(shadow.Shadow{}, tc.businessErr)
+			b.On("UpdateReported", mock.Anything, id, mock.AnythingOfType("shadow.UpdateState")).Return(shadow.Shadow{}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Put("/device/{id}/shadow/desired", h.UpdateDesired)
+			r.Put("/device/{id}/shadow/reported", h.UpdateReported)
+
+			req := httptest.NewRequest("PUT", "/device/"+id+"/shadow/"+tc.section, bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus == http.StatusOK {
+				method := map[string]string{"desired": "UpdateDesired", "reported": "UpdateReported"}[tc.section]
+				b.AssertCalled(t, method, mock.Anything, id, mock.AnythingOfType("shadow.UpdateState"))
+			}
+		})
+	}
+}
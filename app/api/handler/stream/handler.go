@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"device/business/device"
+	"device/business/event"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// Broadcaster represents the event broadcaster interface
+type Broadcaster interface {
+	Subscribe(lastEventID string, filter func(event.Event) bool) (*event.Subscriber, []event.Event)
+	Unsubscribe(s *event.Subscriber)
+}
+
+// Handler represents the event stream handler
+type Handler struct {
+	broadcaster Broadcaster
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewHandler creates a new event stream handler
+func NewHandler(b Broadcaster) *Handler {
+	return &Handler{
+		broadcaster: b,
+		done:        make(chan struct{}),
+	}
+}
+
+// Close ends every open stream so the server can shut down. Clients are
+// expected to reconnect with Last-Event-ID.
+func (h *Handler) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// Devices streams device events as Server-Sent Events. Clients resume with the
+// Last-Event-ID header and can filter by the brand query parameter. A client
+// that falls too far behind is disconnected and should reconnect to resume.
+func (h *Handler) Devices(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = web.ParseStrQuery("last_event_id", r)
+	}
+
+	// streams outlive the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	sub, missed := h.broadcaster.Subscribe(lastEventID, device.EventFilter(web.ParseStrQuery("brand", r)))
+	defer h.broadcaster.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes an event in the Server-Sent Events format
+func writeEvent(w http.ResponseWriter, e event.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"device/business/device"
+	"device/business/event"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func deviceEvent(t *testing.T, typ, brand string) event.Event {
+	e, err := event.New(typ, "1", device.DeviceCreated{Device: device.Device{ID: "1", Brand: brand}})
+	if err != nil {
+		t.Fatalf("unable to create event: %v", err)
+	}
+	return e
+}
+
+func TestDevices(t *testing.T) {
+	b := event.NewBroadcaster(10, 10)
+	first := deviceEvent(t, device.EventDeviceCreated, "acme")
+	b.Publish(context.Background(), first)
+	b.Publish(context.Background(), deviceEvent(t, device.EventDeviceCreated, "other"))
+	resumed := deviceEvent(t, device.EventDeviceUpdated, "acme")
+	b.Publish(context.Background(), resumed)
+
+	srv := httptest.NewServer(http.HandlerFunc(NewHandler(b).Devices))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?brand=acme", nil)
+	req.Header.Set("Last-Event-ID", first.ID)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %s", ct)
+	}
+
+	live := deviceEvent(t, device.EventDeviceDeleted, "acme")
+	b.Publish(context.Background(), deviceEvent(t, device.EventDeviceDeleted, "other"))
+	b.Publish(context.Background(), live)
+
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(got) < 2 {
+		if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+			got = append(got, id)
+		}
+	}
+
+	if len(got) != 2 || got[0] != resumed.ID || got[1] != live.ID {
+		t.Fatalf("expected [%s %s], got %v", resumed.ID, live.ID, got)
+	}
+}
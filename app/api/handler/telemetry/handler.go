@@ -0,0 +1,161 @@
+package telemetry
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/telemetry"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultRange is how far back a query without from goes
+const defaultRange = time.Hour
+
+// Business represents the telemetry business interface
+type Business interface {
+	Ingest(ctx context.Context, id string, batch telemetry.Batch) (telemetry.IngestResult, error)
+	Query(ctx context.Context, q telemetry.Query) (telemetry.Series, error)
+}
+
+// Handler represents the telemetry handler
+type Handler struct {
+	business Business
+	now      func() time.Time
+}
+
+// NewHandler creates a new telemetry handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		business: b,
+		now:      time.Now,
+	}
+}
+
+// Ingest stores a batch of samples of a device
+func (h *Handler) Ingest(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var batch telemetry.Batch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+	if err := batch.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.business.Ingest(r.Context(), id, batch)
+	switch {
+	case err == nil:
+		web.SendOk(w, result)
+	case errors.Is(err, device.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+	case errors.Is(err, telemetry.ErrInvalidSample):
+		web.SendError(w, http.StatusBadRequest, err)
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to ingest telemetry"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Ingest: %w", err)).Error("unable to ingest telemetry")
+	}
+}
+
+// Query returns the samples of a metric of a device, downsampled when a step is set
+func (h *Handler) Query(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	q, err := h.parseQuery(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.DeviceID = id
+
+	series, err := h.business.Query(r.Context(), q)
+	switch {
+	case err == nil:
+		web.SendOk(w, series)
+	case errors.Is(err, device.ErrNotFound):
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("device not found"))
+	case errors.Is(err, telemetry.ErrTooManyPoints):
+		web.SendError(w, http.StatusBadRequest, err)
+	default:
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to query telemetry"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Query: %w", err)).Error("unable to query telemetry")
+	}
+}
+
+// parseQuery parses the telemetry query from the query of the request. to
+// defaults to now and from to an hour before to; agg defaults to avg when a
+// step is set.
+func (h *Handler) parseQuery(r *http.Request) (telemetry.Query, error) {
+	q := telemetry.Query{
+		Metric:      web.ParseStrQuery("metric", r),
+		Aggregation: telemetry.Aggregation(web.ParseStrQuery("agg", r)),
+	}
+
+	var err error
+	if q.To, err = parseTimeQuery("to", r, h.now()); err != nil {
+		return telemetry.Query{}, err
+	}
+	if q.From, err = parseTimeQuery("from", r, q.To.Add(-defaultRange)); err != nil {
+		return telemetry.Query{}, err
+	}
+
+	if v := web.ParseStrQuery("step", r); v != "" {
+		if q.Step, err = time.ParseDuration(v); err != nil || q.Step <= 0 {
+			return telemetry.Query{}, fmt.Errorf("step must be a positive duration, e.g. 30s or 5m")
+		}
+		if q.Aggregation == "" {
+			q.Aggregation = telemetry.AggregationAvg
+		}
+	} else if q.Aggregation != "" {
+		return telemetry.Query{}, fmt.Errorf("agg requires a step")
+	}
+
+	if err := q.Validate(); err != nil {
+		return telemetry.Query{}, err
+	}
+	return q, nil
+}
+
+// parseTimeQuery parses an RFC 3339 time from the query of the request, or
+// returns def if it is not set
+func parseTimeQuery(key string, r *http.Request, def time.Time) (time.Time, error) {
+	v := web.ParseStrQuery(key, r)
+	if v == "" {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", key)
+	}
+	return t, nil
+}
+
+// parseID parses the ID from the request
+func parseID(r *http.Request) (string, error) {
+	id := web.ParseStrURLParam("id", r)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return id, nil
+}
@@ -0,0 +1,188 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"device/business/device"
+	"device/business/telemetry"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Ingest(ctx context.Context, id string, batch telemetry.Batch) (telemetry.IngestResult, error) {
+	args := bm.Called(ctx, id, batch)
+	return args.Get(0).(telemetry.IngestResult), args.Error(1)
+}
+
+func (bm *BusinessMock) Query(ctx context.Context, q telemetry.Query) (telemetry.Series, error) {
+	args := bm.Called(ctx, q)
+	return args.Get(0).(telemetry.Series), args.Error(1)
+}
+
+const id = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+
+func TestIngest(t *testing.T) {
+	testTable := map[string]struct {
+		id             string
+		body           string
+		businessErr    error
+		expectedStatus int
+	}{
+		"success": {
+			id:             id,
+			body:           `{"samples": [{"metric": "battery", "value": 87.5}, {"metric": "door_open", "value": true, "time": "2024-05-01T12:00:00Z"}]}`,
+			expectedStatus: http.StatusOK,
+		},
+		"invalid id": {
+			id:             "abc",
+			body:           `{"samples": [{"metric": "battery", "value": 1}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid payload": {
+			id:             id,
+			body:           `{"samples": `,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid metric": {
+			id:             id,
+			body:           `{"samples": [{"metric": "Battery Level", "value": 1}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"string value": {
+			id:             id,
+			body:           `{"samples": [{"metric": "mode", "value": "eco"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"expired sample": {
+			id:             id,
+			body:           `{"samples": [{"metric": "battery", "value": 1}]}`,
+			businessErr:    fmt.Errorf("%w: samples[0].time is older than the retention", telemetry.ErrInvalidSample),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			id:             id,
+			body:           `{"samples": [{"metric": "battery", "value": 1}]}`,
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		"business error": {
+			id:             id,
+			body:           `{"samples": [{"metric": "battery", "value": 1}]}`,
+			businessErr:    fmt.Errorf("db err"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Ingest", mock.Anything, tc.id, mock.AnythingOfType("telemetry.Batch")).Return(telemetry.IngestResult{Samples: 1}, tc.businessErr)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/device/{id}/telemetry", h.Ingest)
+
+			req := httptest.NewRequest("POST", "/device/"+tc.id+"/telemetry", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testTable := map[string]struct {
+		query          string
+		expected       telemetry.Query
+		businessErr    error
+		expectedStatus int
+	}{
+		"defaults to the last hour": {
+			query:          "metric=battery",
+			expected:       telemetry.Query{DeviceID: id, Metric: "battery", From: now.Add(-time.Hour), To: now},
+			expectedStatus: http.StatusOK,
+		},
+		"downsampled, avg by default": {
+			query:          "metric=battery&from=2024-05-01T00:00:00Z&to=2024-05-01T06:00:00Z&step=5m",
+			expected:       telemetry.Query{DeviceID: id, Metric: "battery", From: now.Add(-12 * time.Hour), To: now.Add(-6 * time.Hour), Step: 5 * time.Minute, Aggregation: telemetry.AggregationAvg},
+			expectedStatus: http.StatusOK,
+		},
+		"downsampled with an aggregation": {
+			query:          "metric=battery&step=1m&agg=last",
+			expected:       telemetry.Query{DeviceID: id, Metric: "battery", From: now.Add(-time.Hour), To: now, Step: time.Minute, Aggregation: telemetry.AggregationLast},
+			expectedStatus: http.StatusOK,
+		},
+		"missing metric": {
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid time": {
+			query:          "metric=battery&from=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid step": {
+			query:          "metric=battery&step=often",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"aggregation without step": {
+			query:          "metric=battery&agg=max",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown aggregation": {
+			query:          "metric=battery&step=1m&agg=sum",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"too many points": {
+			query:          "metric=battery",
+			expected:       telemetry.Query{DeviceID: id, Metric: "battery", From: now.Add(-time.Hour), To: now},
+			businessErr:    fmt.Errorf("%w: more than 10000 samples match, set a step", telemetry.ErrTooManyPoints),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown device": {
+			query:          "metric=battery",
+			expected:       telemetry.Query{DeviceID: id, Metric: "battery", From: now.Add(-time.Hour), To: now},
+			businessErr:    fmt.Errorf("devices.GetByID: %w", device.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Query", mock.Anything, tc.expected).Return(telemetry.Series{Points: []telemetry.Point{}}, tc.businessErr)
+			h := NewHandler(&b)
+			h.now = func() time.Time { return now }
+
+			r := chi.NewRouter()
+			r.Get("/device/{id}/telemetry", h.Query)
+
+			req := httptest.NewRequest("GET", "/device/"+id+"/telemetry?"+tc.query, nil)
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expected.DeviceID != "" {
+				b.AssertExpectations(t)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"context"
+	"device/business/webhook"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Business represents the webhook business interface
+type Business interface {
+	Create(ctx context.Context, cs webhook.CreateSubscription) (webhook.Subscription, error)
+	Update(ctx context.Context, id string, data webhook.UpdateSubscription) error
+	GetByID(ctx context.Context, id string) (webhook.Subscription, error)
+	GetAll(ctx context.Context, offset, limit int) ([]webhook.Subscription, error)
+	Delete(ctx context.Context, id string) error
+	Deliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]webhook.Delivery, error)
+}
+
+// Handler represents the webhook handler
+type Handler struct {
+	business Business
+}
+
+// NewHandler creates a new webhook handler
+func NewHandler(b Business) *Handler {
+	return &Handler{
+		business: b,
+	}
+}
+
+// Create creates a subscription. The response is the only one that includes the secret.
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var cs webhook.CreateSubscription
+	if err := json.NewDecoder(r.Body).Decode(&cs); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+
+	if err := cs.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s, err := h.business.Create(r.Context(), cs)
+	if err != nil {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to create webhook"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Create: %w", err)).Error("unable to create webhook")
+		return
+	}
+
+	web.SendCreated(w, s)
+}
+
+// Update updates a subscription
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var us webhook.UpdateSubscription
+	if err := json.NewDecoder(r.Body).Decode(&us); err != nil {
+		web.SendError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
+		return
+	}
+
+	if err := us.Validate(); err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.business.Update(r.Context(), id, us)
+	if err == nil {
+		web.SendOk(w, map[string]string{
+			"message": "webhook updated",
+		})
+		return
+	}
+
+	if errors.Is(err, webhook.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("webhook not found"))
+		return
+	}
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to update webhook"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Update: %w", err)).Error("unable to update webhook")
+}
+
+// GetByID returns a subscription by its ID
+func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s, err := h.business.GetByID(r.Context(), id)
+	if err == nil {
+		web.SendOk(w, redact(s))
+		return
+	}
+
+	if errors.Is(err, webhook.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("webhook not found"))
+		return
+	}
+
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get webhook"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetByID: %w", err)).Error("unable to get webhook")
+}
+
+// GetAll returns all subscriptions
+func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
+	offset, limit := web.ParsePaginationParams(r)
+
+	subs, err := h.business.GetAll(r.Context(), offset, limit)
+	if err != nil {
+		web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get webhooks"))
+		logging.FromContext(r.Context()).WithError(fmt.Errorf("business.GetAll: %w", err)).Error("unable to get webhooks")
+		return
+	}
+
+	for i := range subs {
+		subs[i] = redact(subs[i])
+	}
+	web.SendOk(w, subs)
+}
+
+// Delete deletes a subscription
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.business.Delete(r.Context(), id)
+	if err == nil {
+		web.SendOk(w, map[string]string{
+			"message": "webhook deleted",
+		})
+		return
+	}
+
+	if errors.Is(err, webhook.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("webhook not found"))
+		return
+	}
+
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete webhook"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Delete: %w", err)).Error("unable to delete webhook")
+}
+
+// Deliveries returns the delivery log of a subscription
+func (h *Handler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		web.SendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	offset, limit := web.ParsePaginationParams(r)
+
+	ds, err := h.business.Deliveries(r.Context(), id, offset, limit)
+	if err == nil {
+		web.SendOk(w, ds)
+		return
+	}
+
+	if errors.Is(err, webhook.ErrNotFound) {
+		web.SendError(w, http.StatusNotFound, fmt.Errorf("webhook not found"))
+		return
+	}
+
+	web.SendError(w, http.StatusInternalServerError, fmt.Errorf("unable to get webhook deliveries"))
+	logging.FromContext(r.Context()).WithError(fmt.Errorf("business.Deliveries: %w", err)).Error("unable to get webhook deliveries")
+}
+
+// redact removes the secret from a subscription
+func redact(s webhook.Subscription) webhook.Subscription {
+	s.Secret = ""
+	return s
+}
+
+// parseID parses the ID from the request
+func parseID(r *http.Request) (string, error) {
+	id := web.ParseStrURLParam("id", r)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("id is not a valid UUID")
+	}
+	return id, nil
+}
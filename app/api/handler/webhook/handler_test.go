@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"device/business/webhook"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Create(ctx context.Context, cs webhook.CreateSubscription) (webhook.Subscription, error) {
+	args := bm.Called(ctx, cs)
+	return args.Get(0).(webhook.Subscription), args.Error(1)
+}
+
+func (bm *BusinessMock) Update(ctx context.Context, id string, data webhook.UpdateSubscription) error {
+	args := bm.Called(ctx, id, data)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) GetByID(ctx context.Context, id string) (webhook.Subscription, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(webhook.Subscription), args.Error(1)
+}
+
+func (bm *BusinessMock) GetAll(ctx context.Context, offset, limit int) ([]webhook.Subscription, error) {
+	args := bm.Called(ctx, offset, limit)
+	return args.Get(0).([]webhook.Subscription), args.Error(1)
+}
+
+func (bm *BusinessMock) Delete(ctx context.Context, id string) error {
+	args := bm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) Deliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]webhook.Delivery, error) {
+	args := bm.Called(ctx, subscriptionID, offset, limit)
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
+
+func TestCreate(t *testing.T) {
+	testTable := map[string]struct {
+		request        webhook.CreateSubscription
+		expectedStatus int
+	}{
+		"success": {
+			request: webhook.CreateSubscription{
+				URL:    "https://example.com/hook",
+				Events: []string{"device.created"},
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		"missing url": {
+			request:        webhook.CreateSubscription{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid url": {
+			request: webhook.CreateSubscription{
+				URL: "ftp://example.com",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"unknown event": {
+			request: webhook.CreateSubscription{
+				URL:    "https://example.com/hook",
+				Events: []string{"device.exploded"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("Create", mock.Anything, mock.AnythingOfType("webhook.CreateSubscription")).Return(webhook.Subscription{}, nil)
+			h := NewHandler(&b)
+
+			r := chi.NewRouter()
+			r.Post("/webhooks", h.Create)
+
+			data, err := json.Marshal(tc.request)
+			if err != nil {
+				t.Fatalf("unable to marshal request: %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/webhooks", bytes.NewBuffer(data))
+			rec := httptest.NewRecorder()
+
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected %d, got %d", tc.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -1,77 +1,465 @@
 package main
 
 import (
+	"context"
+	"device/app/api/gql"
 	"device/app/api/handler"
+	"device/business/command"
 	"device/business/device"
+	"device/business/event"
+	"device/business/firmware"
+	"device/business/group"
+	"device/business/outbox"
+	"device/business/shadow"
+	"device/business/telemetry"
+	"device/business/webhook"
 	"device/config"
+	"device/pkg/database"
+	"device/pkg/logging"
+	"device/pkg/metrics"
+	"device/pkg/ratelimit"
+	"device/pkg/server"
+	"device/pkg/tracing"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
+	commandHandler "device/app/api/handler/command"
 	deviceHandler "device/app/api/handler/device"
+	firmwareHandler "device/app/api/handler/firmware"
+	groupHandler "device/app/api/handler/group"
+	healthHandler "device/app/api/handler/health"
+	shadowHandler "device/app/api/handler/shadow"
+	streamHandler "device/app/api/handler/stream"
+	telemetryHandler "device/app/api/handler/telemetry"
+	webhookHandler "device/app/api/handler/webhook"
+	deviceMQTT "device/app/api/mqtt/device"
+	deviceRPC "device/app/api/rpc/device"
+	commandStore "device/business/command/store/postgres"
+	deviceCache "device/business/device/store/cache"
+	deviceMetrics "device/business/device/store/metrics"
 	deviceStore "device/business/device/store/postgres"
+	firmwareStore "device/business/firmware/store/postgres"
+	groupStore "device/business/group/store/postgres"
+	outboxStore "device/business/outbox/store/postgres"
+	shadowStore "device/business/shadow/store/postgres"
+	telemetryStore "device/business/telemetry/store/postgres"
+	webhookStore "device/business/webhook/store/postgres"
+	devicev1 "device/pkg/pb/device/v1"
 
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	log "github.com/sirupsen/logrus"
-	"gorm.io/driver/postgres"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+)
+
+const (
+	// eventReplaySize is the number of events kept for resuming event streams
+	eventReplaySize = 1000
+	// eventSubscriberBuffer is the number of events buffered per stream before it is dropped
+	eventSubscriberBuffer = 64
 )
 
 func main() {
-	appCfg := config.MustLoad()
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		os.Exit(printConfig(os.Args[3:]))
+	}
 
-	db := initDBClient(appCfg.Database)
+	appCfg := config.MustLoad()
 
-	deviceStore := deviceStore.NewStore(db)
-	deviceBusiness := device.NewBusiness(deviceStore)
-	router := handler.NewRouter(handler.Handlers{
-		Device: deviceHandler.NewHandler(deviceBusiness),
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     appCfg.Tracing.Exporter,
+		File:         appCfg.Tracing.File,
+		OTLPEndpoint: appCfg.Tracing.OTLPEndpoint,
+		ServiceName:  appCfg.Tracing.ServiceName,
+		SampleRatio:  appCfg.Tracing.SampleRatio,
 	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
 
-	log.Info("Starting server on port ", appCfg.Server.Port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", appCfg.Server.Port), router); err != nil {
-		log.Fatalf("unable to start server: %v", err)
+	db, err := initDBClient(appCfg.Database)
+	if err != nil {
+		log.Fatalf("failed to initialize the database: %v", err)
 	}
-}
+	replicas, err := initReplicas(appCfg.Database, db)
+	if err != nil {
+		log.Fatalf("failed to initialize the read replicas: %v", err)
+	}
+	app := initHandlers(appCfg, db, replicas)
+	app.shutdownTracing = shutdownTracing
 
-func initDBClient(cfg config.Database) *gorm.DB {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s TimeZone=UTC",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName,
-	)
+	// the partitions samples are ingested into must exist before the server accepts them
+	if err := app.retention.Apply(context.Background()); err != nil {
+		log.Fatalf("failed to create the telemetry partitions: %v", err)
+	}
 
-	// Initialize GORM with the PostgreSQL driver
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info), // Log SQL queries for debugging
-	})
+	if err := startServer(appCfg.Server, db, app); err != nil {
+		log.Fatalf("server stopped with error: %v", err)
+	}
+}
+
+// printConfig prints the effective configuration with its secrets redacted,
+// followed by its problems if it is invalid, and returns the exit code
+func printConfig(args []string) int {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if printErr := config.Print(os.Stdout, cfg); printErr != nil {
+		fmt.Fprintf(os.Stderr, "unable to print configuration: %v\n", printErr)
+		return 1
+	}
 	if err != nil {
-		panic(fmt.Errorf("failed to connect to PostgreSQL: %w", err))
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		return 1
 	}
+	return 0
+}
 
-	// Configure the connection pool (optional)
-	sqlDB, err := db.DB()
+// application holds the wired router and the parts of the process the server has to run and stop
+type application struct {
+	router        http.Handler
+	stream        *streamHandler.Handler
+	health        *healthHandler.Handler
+	deviceRPC     *deviceRPC.Server
+	grpcOptions   []grpc.ServerOption
+	relay         *outbox.Relay
+	webhookWorker *webhook.Worker
+	replicas      *database.Cluster
+	status        *device.StatusEvaluator
+	retention     *telemetry.Retention
+	expirer       *command.Expirer
+	rollouts      *firmware.Engine
+	operations    *group.Runner
+	// mqtt is nil unless the MQTT transport is enabled
+	mqtt *deviceMQTT.Bridge
+
+	shutdownTracing func(ctx context.Context) error
+}
+
+// databaseConfig converts the database configuration of the application
+func databaseConfig(cfg config.Database) database.Config {
+	return database.Config{
+		Host:                cfg.Host,
+		Port:                cfg.Port,
+		Name:                cfg.DBName,
+		User:                cfg.User,
+		Password:            cfg.Password,
+		SSLMode:             cfg.SSLMode,
+		TimeZone:            cfg.TimeZone,
+		StatementTimeout:    cfg.StatementTimeout,
+		MaxOpenConns:        cfg.MaxOpenConns,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		ConnMaxLifetime:     cfg.ConnMaxLifetime,
+		ConnMaxIdleTime:     cfg.ConnMaxIdleTime,
+		LogLevel:            cfg.LogLevel,
+		SlowQueryThreshold:  cfg.SlowQueryThreshold,
+		ConnectTimeout:      cfg.ConnectTimeout,
+		StartupTimeout:      cfg.StartupTimeout,
+		RetryInitialBackoff: cfg.RetryInitialBackoff,
+		RetryMaxBackoff:     cfg.RetryMaxBackoff,
+	}
+}
+
+func initDBClient(cfg config.Database) (*gorm.DB, error) {
+	db, err := database.Open(context.Background(), databaseConfig(cfg))
 	if err != nil {
-		panic(fmt.Errorf("failed to get database handle: %w", err))
+		return nil, fmt.Errorf("database.Open: %w", err)
 	}
 
-	sqlDB.SetMaxOpenConns(25)                 // Maximum number of open connections
-	sqlDB.SetMaxIdleConns(10)                 // Maximum number of idle connections
-	sqlDB.SetConnMaxLifetime(5 * time.Minute) // Maximum connection lifetime
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("db.Use: %w", err)
+	}
 
 	log.Info("PostgreSQL client initialized successfully")
 
 	// migration
-	if err := db.AutoMigrate(&deviceStore.Device{}); err != nil {
-		panic(fmt.Errorf("failed to migrate database: %w", err))
+	if err := db.AutoMigrate(
+		&deviceStore.Device{},
+		&outboxStore.Event{},
+		&webhookStore.Subscription{},
+		&webhookStore.Delivery{},
+		&shadowStore.Shadow{},
+		&commandStore.Command{},
+		&firmwareStore.Firmware{},
+		&firmwareStore.Rollout{},
+		&firmwareStore.RolloutDevice{},
+		&groupStore.Group{},
+		&groupStore.Member{},
+		&groupStore.Operation{},
+	); err != nil {
+		return nil, fmt.Errorf("db.AutoMigrate: %w", err)
+	}
+	if err := telemetryStore.NewStore(db).Migrate(context.Background()); err != nil {
+		return nil, fmt.Errorf("telemetryStore.Migrate: %w", err)
+	}
+
+	return db, nil
+}
+
+// initReplicas connects to the read replicas. They take reads once the
+// cluster's health check, run by the server, finds them reachable.
+func initReplicas(cfg config.Database, db *gorm.DB) (*database.Cluster, error) {
+	replicas := make([]database.Replica, 0, len(cfg.Replicas))
+	for i, dsn := range cfg.Replicas {
+		replica, err := database.OpenReplica(databaseConfig(cfg), dsn)
+		if err != nil {
+			return nil, fmt.Errorf("database.OpenReplica[%d]: %w", i, err)
+		}
+		if err := replica.Use(tracing.GormPlugin{}); err != nil {
+			return nil, fmt.Errorf("replica.Use: %w", err)
+		}
+		replicas = append(replicas, database.Replica{Name: fmt.Sprintf("replica-%d", i+1), DB: replica})
+	}
+
+	cluster := database.NewCluster(db, replicas...)
+	cluster.SetCheckInterval(cfg.ReplicaCheckInterval)
+	return cluster, nil
+}
+
+func initHandlers(cfg config.App, db *gorm.DB, replicas *database.Cluster) application {
+	registry := metrics.NewRegistry()
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.WithError(fmt.Errorf("db.DB: %w", err)).Warn("connection pool metrics are disabled")
+	} else {
+		registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, cfg.Database.DBName))
+	}
+	for _, r := range replicas.Replicas() {
+		if sqlDB, err := r.DB.DB(); err == nil {
+			registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, r.Name))
+		}
+	}
+
+	tx := database.NewTransactor(db)
+	outboxStore := outboxStore.NewStore(db)
+	var deviceStore device.Store = deviceMetrics.NewStore(deviceStore.NewStore(db, deviceStore.WithReplicas(replicas)), registry)
+	if cfg.Cache.Enabled {
+		cache := deviceCache.NewStore(deviceStore, cfg.Cache.Size, cfg.Cache.TTL)
+		cache.Register(registry)
+		deviceStore = cache
+	}
+	shadowStore := shadowStore.NewStore(db)
+	commandStore := commandStore.NewStore(db)
+	firmwareStore := firmwareStore.NewStore(db)
+	groupStore := groupStore.NewStore(db)
+	telemetryStore := telemetryStore.NewStore(db)
+	broadcaster := event.NewBroadcaster(eventReplaySize, eventSubscriberBuffer)
+	deviceBusiness := device.NewBusiness(
+		deviceStore,
+		device.WithOutbox(tx, outboxStore),
+		device.WithPublisher(broadcaster),
+		device.WithDependents(shadowStore, commandStore, firmwareStore, groupStore, telemetryStore),
+	)
+	shadowBusiness := shadow.NewBusiness(shadowStore, deviceBusiness)
+	commandBusiness := command.NewBusiness(commandStore, deviceBusiness, cfg.Commands.DefaultTTL)
+	firmwareBusiness := firmware.NewBusiness(firmwareStore, deviceBusiness)
+	groupBusiness := group.NewBusiness(groupStore, deviceBusiness, commandBusiness)
+
+	webhookStore := webhookStore.NewStore(db)
+	webhookBusiness := webhook.NewBusiness(webhookStore)
+
+	telemetryBusiness := telemetry.NewBusiness(telemetryStore, deviceBusiness, cfg.Telemetry.Retention)
+
+	middlewares := []func(http.Handler) http.Handler{
+		tracing.Middleware,
+		logging.RequestIDMiddleware,
+		logging.AccessLog(logging.NewAccessLogger()),
+		database.ReadPrimaryMiddleware,
+		metrics.NewHTTP(registry).Middleware,
+	}
+	var grpcOptions []grpc.ServerOption
+	if cfg.RateLimit.Enabled {
+		middleware, interceptors, err := rateLimit(cfg.RateLimit)
+		if err != nil {
+			log.Fatalf("invalid rate limit configuration: %v", err)
+		}
+		middlewares = append(middlewares, middleware)
+		grpcOptions = append(grpcOptions, interceptors...)
 	}
 
-	return db
+	stream := streamHandler.NewHandler(broadcaster)
+	relay := outbox.NewRelay(outboxStore, tx, event.Publishers{event.LogPublisher{}, webhookBusiness})
+	relay.Register(registry)
+
+	health := healthHandler.NewHandler()
+	health.Register("database", healthHandler.CheckFunc(func(ctx context.Context) error {
+		return database.Ping(ctx, db)
+	}))
+
+	router := handler.NewRouter(handler.Handlers{
+		Device:    deviceHandler.NewHandler(deviceBusiness),
+		Webhook:   webhookHandler.NewHandler(webhookBusiness),
+		Stream:    stream,
+		Telemetry: telemetryHandler.NewHandler(telemetryBusiness),
+		Shadow:    shadowHandler.NewHandler(shadowBusiness),
+		Command:   commandHandler.NewHandler(commandBusiness),
+		Firmware:  firmwareHandler.NewHandler(firmwareBusiness),
+		Group:     groupHandler.NewHandler(groupBusiness),
+		GraphQL:   gql.NewHandler(deviceBusiness),
+		Health:    health,
+		Metrics:   metrics.Handler(registry),
+
+		Middlewares: middlewares,
+	})
+
+	var bridge *deviceMQTT.Bridge
+	if cfg.MQTT.Enabled {
+		bridge = initMQTT(cfg.MQTT, deviceMQTT.Services{
+			Devices:     deviceBusiness,
+			Telemetry:   telemetryBusiness,
+			Shadows:     shadowBusiness,
+			Commands:    commandBusiness,
+			Firmware:    firmwareBusiness,
+			Broadcaster: broadcaster,
+		})
+	}
+
+	return application{
+		router:        router,
+		stream:        stream,
+		health:        health,
+		deviceRPC:     deviceRPC.NewServer(deviceBusiness, broadcaster),
+		grpcOptions:   grpcOptions,
+		relay:         relay,
+		webhookWorker: webhook.NewWorker(webhookStore, nil),
+		replicas:      replicas,
+		status:        device.NewStatusEvaluator(deviceBusiness, cfg.Status.OfflineThreshold, cfg.Status.CheckInterval),
+		retention:     telemetry.NewRetention(telemetryStore, cfg.Telemetry.Retention),
+		expirer:       command.NewExpirer(commandBusiness, cfg.Commands.ExpireInterval),
+		rollouts:      firmware.NewEngine(firmwareBusiness, cfg.Firmware.RolloutInterval),
+		operations:    group.NewRunner(groupBusiness, cfg.Groups.OperationInterval),
+		mqtt:          bridge,
+	}
 }
 
-func initHandlers() {
+// initMQTT creates the bridge carrying device traffic over the broker of cfg
+func initMQTT(cfg config.MQTT, s deviceMQTT.Services) *deviceMQTT.Bridge {
+	opts := []deviceMQTT.ClientOption{deviceMQTT.WithKeepAlive(cfg.KeepAlive)}
+	if cfg.Username != "" || cfg.Password != "" {
+		opts = append(opts, deviceMQTT.WithCredentials(cfg.Username, cfg.Password))
+	}
+	client := deviceMQTT.NewClient(cfg.Broker, cfg.ClientID, opts...)
 
+	var bridgeOpts []deviceMQTT.Option
+	if cfg.SharedGroup != "" {
+		bridgeOpts = append(bridgeOpts, deviceMQTT.WithSharedGroup(cfg.SharedGroup))
+	}
+	return deviceMQTT.NewBridge(client, cfg.TopicPrefix, s, bridgeOpts...)
 }
 
-func startServer() {
+// rateLimit builds the rate limiting HTTP middleware and gRPC interceptors from
+// cfg. They share one limiter, so a client has the same budget on both.
+// Health and metrics routes are never limited unless configured, so probes and
+// scrapes keep working.
+func rateLimit(cfg config.RateLimit) (func(http.Handler) http.Handler, []grpc.ServerOption, error) {
+	key, err := ratelimit.KeyFuncByName(cfg.KeyBy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rules := ratelimit.Rules{Routes: map[string]ratelimit.Limit{}}
+	if rules.Default, err = ratelimit.ParseLimit(cfg.Default); err != nil {
+		return nil, nil, fmt.Errorf("default: %w", err)
+	}
+	for route, limit := range cfg.Routes {
+		if rules.Routes[route], err = ratelimit.ParseLimit(limit); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", route, err)
+		}
+	}
+	for _, route := range []string{"GET /healthz", "GET /readyz", "GET /metrics"} {
+		if _, ok := rules.Routes[route]; !ok {
+			rules.Routes[route] = ratelimit.Limit{}
+		}
+	}
+
+	limiter := ratelimit.NewMemory()
+	interceptors := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(ratelimit.UnaryServerInterceptor(limiter, rules)),
+		grpc.ChainStreamInterceptor(ratelimit.StreamServerInterceptor(limiter, rules)),
+	}
+	return ratelimit.Middleware(limiter, rules, key), interceptors, nil
+}
+
+func startServer(cfg config.Server, db *gorm.DB, app application) error {
+	srv := server.New(server.Config{
+		Addr:              fmt.Sprintf(":%s", cfg.Port),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ShutdownTimeout:   cfg.ShutdownTimeout,
+		DrainDelay:        cfg.DrainDelay,
+	}, app.router)
+	srv.OnShutdown(app.health.Drain)
+	srv.OnShutdown(app.stream.Close)
+
+	if cfg.GRPCPort != "" {
+		grpcSrv := grpc.NewServer(app.grpcOptions...)
+		devicev1.RegisterDeviceServiceServer(grpcSrv, app.deviceRPC)
+		reflection.Register(grpcSrv)
+
+		srv.OnShutdown(app.deviceRPC.Close)
+		srv.AddListener(fmt.Sprintf("gRPC server on port %s", cfg.GRPCPort), func() error {
+			lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.GRPCPort))
+			if err != nil {
+				return fmt.Errorf("net.Listen: %w", err)
+			}
+			return grpcSrv.Serve(lis)
+		}, func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				grpcSrv.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				grpcSrv.Stop()
+				return ctx.Err()
+			}
+		})
+	}
+
+	// workers stop last registered first: the MQTT bridge, the webhook
+	// worker, the status evaluator, the group operation runner, the rollout
+	// engine, the command expirer, the outbox relay, the telemetry retention,
+	// then the replica health check
+	srv.AddWorker("replica health check", app.replicas.Run)
+	srv.AddWorker("telemetry retention", app.retention.Run)
+	srv.AddWorker("outbox relay", app.relay.Run)
+	srv.AddWorker("command expirer", app.expirer.Run)
+	srv.AddWorker("rollout engine", app.rollouts.Run)
+	srv.AddWorker("group operation runner", app.operations.Run)
+	srv.AddWorker("device status evaluator", app.status.Run)
+	srv.AddWorker("webhook worker", app.webhookWorker.Run)
+	if app.mqtt != nil {
+		srv.AddWorker("mqtt bridge", app.mqtt.Run)
+	}
+
+	srv.AddCloser("replicas", app.replicas.Close)
+	srv.AddCloser("database", func() error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return fmt.Errorf("db.DB: %w", err)
+		}
+		return sqlDB.Close()
+	})
+	if app.shutdownTracing != nil {
+		srv.AddCloser("tracing", func() error {
+			// closers take no context, so flushing the remaining spans gets its own deadline
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return app.shutdownTracing(ctx)
+		})
+	}
 
+	return srv.ListenAndServe()
 }
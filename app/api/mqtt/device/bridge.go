@@ -0,0 +1,502 @@
+package device
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/business/event"
+	"device/business/firmware"
+	"device/business/shadow"
+	"device/business/telemetry"
+	"device/pkg/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// retryDelay is how long the command poller waits before trying again
+	// after a failure, or for the client to connect
+	retryDelay = time.Second
+	// recheckInterval is how often the command poller delivers the commands
+	// of the waiting devices unwoken, for those enqueued through other instances
+	recheckInterval = 2 * time.Second
+)
+
+// Client represents the MQTT client interface
+type Client interface {
+	Subscribe(ctx context.Context, filter string, qos byte, h Handler) error
+	Publish(ctx context.Context, topic string, qos byte, retain bool, payload []byte) error
+	Check(ctx context.Context) error
+	Run(ctx context.Context)
+}
+
+// Devices represents the device business interface
+type Devices interface {
+	GetByID(ctx context.Context, id string) (device.Device, error)
+	Heartbeat(ctx context.Context, id string, hb device.Heartbeat) error
+}
+
+// Telemetry represents the telemetry business interface
+type Telemetry interface {
+	Ingest(ctx context.Context, id string, batch telemetry.Batch) (telemetry.IngestResult, error)
+}
+
+// Shadows represents the shadow business interface
+type Shadows interface {
+	UpdateReported(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error)
+}
+
+// Commands represents the command business interface
+type Commands interface {
+	DeliverPending(ctx context.Context, ids []string) ([]command.Command, error)
+	Enqueued() <-chan struct{}
+	Ack(ctx context.Context, id, commandID string, ack command.Ack) (command.Command, error)
+}
+
+// Firmware represents the firmware business interface
+type Firmware interface {
+	Report(ctx context.Context, id string, rp firmware.Report) (firmware.DeviceProgress, error)
+}
+
+// Broadcaster represents the event broadcaster interface
+type Broadcaster interface {
+	Subscribe(lastEventID string, filter func(event.Event) bool) (*event.Subscriber, []event.Event)
+	Unsubscribe(s *event.Subscriber)
+}
+
+// Services are the business services the bridge routes device traffic to
+type Services struct {
+	Devices     Devices
+	Telemetry   Telemetry
+	Shadows     Shadows
+	Commands    Commands
+	Firmware    Firmware
+	Broadcaster Broadcaster
+}
+
+// Bridge carries device traffic over MQTT. Under the topic prefix, devices
+// publish to {id}/heartbeat, {id}/telemetry, {id}/shadow/reported,
+// {id}/commands/{command_id}/ack and {id}/firmware/report the payloads they
+// would send to the HTTP endpoints. A device retaining a non-empty message
+// on {id}/commands/pending gets its commands published to {id}/commands
+// until it clears it. Device events are published to {id}/events, and the
+// messages the bridge rejects are reported on {id}/errors.
+type Bridge struct {
+	client   Client
+	prefix   string
+	group    string
+	services Services
+
+	mu sync.Mutex
+	// waiting holds the devices retaining a pending message
+	waiting map[string]struct{}
+	// wake tells the command poller a device started waiting
+	wake chan struct{}
+}
+
+// Option configures the Bridge
+type Option func(*Bridge)
+
+// WithSharedGroup makes the bridge subscribe to the device topics as a
+// member of group, so that the bridges of several instances share the
+// messages instead of each handling all of them
+func WithSharedGroup(group string) Option {
+	return func(b *Bridge) {
+		b.group = group
+	}
+}
+
+// NewBridge creates a bridge between the devices talking to the broker of
+// client under the topic prefix and the services
+func NewBridge(client Client, prefix string, s Services, opts ...Option) *Bridge {
+	b := &Bridge{
+		client:   client,
+		prefix:   strings.TrimSuffix(prefix, "/"),
+		services: s,
+		waiting:  map[string]struct{}{},
+		wake:     make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Check reports an error unless the bridge is connected to the broker
+func (b *Bridge) Check(ctx context.Context) error {
+	return b.client.Check(ctx)
+}
+
+// Run subscribes to the device topics and runs the client until ctx is
+// cancelled, publishing the device events meanwhile
+func (b *Bridge) Run(ctx context.Context) {
+	routes := map[string]func(context.Context, deviceTopic, []byte) error{
+		"heartbeat":       b.heartbeat,
+		"telemetry":       b.ingest,
+		"shadow/reported": b.updateReported,
+		"commands/+/ack":  b.ack,
+		"firmware/report": b.report,
+	}
+	for suffix, route := range routes {
+		filter := b.prefix + "/+/" + suffix
+		if b.group != "" {
+			filter = shared(b.group, filter)
+		}
+		b.subscribe(ctx, filter, route)
+	}
+	// the broker does not send retained messages to shared subscriptions,
+	// every bridge polls for the devices waiting for commands instead. A
+	// command is delivered by a single poll.
+	b.subscribe(ctx, b.prefix+"/+/commands/pending", b.pending)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		b.forwardEvents(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		b.pollCommands(ctx)
+	}()
+
+	b.client.Run(ctx)
+	wg.Wait()
+}
+
+// subscribe routes the messages of the topics matching filter to route,
+// reporting the errors it returns to the device
+func (b *Bridge) subscribe(ctx context.Context, filter string, route func(context.Context, deviceTopic, []byte) error) {
+	err := b.client.Subscribe(ctx, filter, 1, func(ctx context.Context, m Message) {
+		t, err := b.parseTopic(m.Topic)
+		if err == nil {
+			err = route(ctx, t, m.Payload)
+		}
+		if err != nil {
+			b.reject(ctx, t.deviceID, m.Topic, err)
+		}
+	})
+	if err != nil {
+		// the filters are built from the prefix, which the configuration validates
+		logging.FromContext(ctx).WithError(fmt.Errorf("client.Subscribe: %w", err)).WithField("filter", filter).Error("unable to subscribe")
+	}
+}
+
+// deviceTopic is a topic of a device, split into the device ID and the
+// levels following it
+type deviceTopic struct {
+	deviceID string
+	levels   []string
+}
+
+// parseTopic parses a topic under the prefix. The device ID is set even if
+// it is not a valid UUID so the error can be reported to the device.
+func (b *Bridge) parseTopic(topic string) (deviceTopic, error) {
+	levels := strings.Split(strings.TrimPrefix(topic, b.prefix+"/"), "/")
+	t := deviceTopic{deviceID: levels[0], levels: levels[1:]}
+	if _, err := uuid.Parse(t.deviceID); err != nil {
+		return t, fmt.Errorf("id is not a valid UUID")
+	}
+	return t, nil
+}
+
+// topic returns the topic of the device id with the given levels
+func (b *Bridge) topic(id string, levels ...string) string {
+	return strings.Join(append([]string{b.prefix, id}, levels...), "/")
+}
+
+// reject reports err about the message the device id published to topic
+func (b *Bridge) reject(ctx context.Context, id, topic string, err error) {
+	payload, _ := json.Marshal(map[string]string{"topic": topic, "error": err.Error()})
+	if err := b.client.Publish(ctx, b.topic(id, "errors"), 0, false, payload); err != nil && ctx.Err() == nil {
+		logging.FromContext(ctx).WithError(fmt.Errorf("client.Publish: %w", err)).WithField("topic", topic).Warn("unable to report a rejected message")
+	}
+}
+
+// heartbeat records a heartbeat of a device
+func (b *Bridge) heartbeat(ctx context.Context, t deviceTopic, payload []byte) error {
+	// the metadata is optional, so is the payload
+	var hb device.Heartbeat
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &hb); err != nil {
+			return fmt.Errorf("invalid payload")
+		}
+	}
+	if err := hb.Validate(); err != nil {
+		return err
+	}
+
+	err := b.services.Devices.Heartbeat(ctx, t.deviceID, hb)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, device.ErrNotFound):
+		return fmt.Errorf("device not found")
+	default:
+		logging.FromContext(ctx).WithError(fmt.Errorf("business.Heartbeat: %w", err)).Error("unable to record heartbeat")
+		return fmt.Errorf("unable to record heartbeat")
+	}
+}
+
+// ingest stores a batch of samples of a device
+func (b *Bridge) ingest(ctx context.Context, t deviceTopic, payload []byte) error {
+	var batch telemetry.Batch
+	if err := json.Unmarshal(payload, &batch); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+	if err := batch.Validate(); err != nil {
+		return err
+	}
+
+	_, err := b.services.Telemetry.Ingest(ctx, t.deviceID, batch)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, device.ErrNotFound):
+		return fmt.Errorf("device not found")
+	case errors.Is(err, telemetry.ErrInvalidSample):
+		return err
+	default:
+		logging.FromContext(ctx).WithError(fmt.Errorf("business.Ingest: %w", err)).Error("unable to ingest telemetry")
+		return fmt.Errorf("unable to ingest telemetry")
+	}
+}
+
+// updateReported updates the state a device reports
+func (b *Bridge) updateReported(ctx context.Context, t deviceTopic, payload []byte) error {
+	var u shadow.UpdateState
+	if err := json.Unmarshal(payload, &u); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	_, err := b.services.Shadows.UpdateReported(ctx, t.deviceID, u)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, device.ErrNotFound):
+		return fmt.Errorf("device not found")
+	case errors.Is(err, shadow.ErrVersionConflict):
+		return fmt.Errorf("the shadow changed, get it and retry with its version")
+	case errors.Is(err, shadow.ErrTooLarge):
+		return err
+	default:
+		logging.FromContext(ctx).WithError(fmt.Errorf("business.UpdateReported: %w", err)).Error("unable to update shadow")
+		return fmt.Errorf("unable to update shadow")
+	}
+}
+
+// ack records the outcome of a command delivered to a device
+func (b *Bridge) ack(ctx context.Context, t deviceTopic, payload []byte) error {
+	commandID := t.levels[1]
+	if _, err := uuid.Parse(commandID); err != nil {
+		return fmt.Errorf("command id is not a valid UUID")
+	}
+
+	var ack command.Ack
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+	if err := ack.Validate(); err != nil {
+		return err
+	}
+
+	_, err := b.services.Commands.Ack(ctx, t.deviceID, commandID, ack)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, command.ErrNotFound):
+		return fmt.Errorf("command not found")
+	case errors.Is(err, command.ErrNotDelivered):
+		return fmt.Errorf("command is not awaiting an acknowledgement")
+	default:
+		logging.FromContext(ctx).WithError(fmt.Errorf("business.Ack: %w", err)).Error("unable to acknowledge command")
+		return fmt.Errorf("unable to acknowledge command")
+	}
+}
+
+// report records the progress a device reports on its firmware update
+func (b *Bridge) report(ctx context.Context, t deviceTopic, payload []byte) error {
+	var rp firmware.Report
+	if err := json.Unmarshal(payload, &rp); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+	if err := rp.Validate(); err != nil {
+		return err
+	}
+
+	_, err := b.services.Firmware.Report(ctx, t.deviceID, rp)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, firmware.ErrNotAssigned):
+		return fmt.Errorf("device has no update in this rollout")
+	case errors.Is(err, firmware.ErrAlreadyReported):
+		return fmt.Errorf("the outcome of the update is already reported")
+	default:
+		logging.FromContext(ctx).WithError(fmt.Errorf("business.Report: %w", err)).Error("unable to record report")
+		return fmt.Errorf("unable to record report")
+	}
+}
+
+// pending adds a device retaining a non-empty message to the devices the
+// command poller publishes the commands of, and removes it when it clears it
+func (b *Bridge) pending(ctx context.Context, t deviceTopic, payload []byte) error {
+	if len(payload) == 0 {
+		b.mu.Lock()
+		delete(b.waiting, t.deviceID)
+		b.mu.Unlock()
+		return nil
+	}
+
+	_, err := b.services.Devices.GetByID(ctx, t.deviceID)
+	switch {
+	case err == nil:
+	case errors.Is(err, device.ErrNotFound):
+		return fmt.Errorf("device not found")
+	default:
+		logging.FromContext(ctx).WithError(fmt.Errorf("business.GetByID: %w", err)).Error("unable to look up device")
+		return fmt.Errorf("unable to look up device")
+	}
+
+	b.mu.Lock()
+	b.waiting[t.deviceID] = struct{}{}
+	b.mu.Unlock()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pollCommands publishes the commands of the waiting devices until ctx is
+// cancelled. The commands of all of them are delivered at once, when a
+// command is enqueued through this instance, when a device starts waiting and
+// every recheckInterval for the commands enqueued through other instances.
+func (b *Bridge) pollCommands(ctx context.Context) {
+	log := logging.FromContext(ctx)
+
+	for {
+		// waiting starts before delivering, so commands enqueued in between wake the poller up
+		enqueued := b.services.Commands.Enqueued()
+		delay := b.deliverCommands(ctx, log)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-enqueued:
+		case <-b.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deliverCommands publishes the pending commands of the waiting devices and
+// returns how long to wait before delivering again
+func (b *Bridge) deliverCommands(ctx context.Context, log *logrus.Entry) time.Duration {
+	b.mu.Lock()
+	ids := make([]string, 0, len(b.waiting))
+	for id := range b.waiting {
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+	if len(ids) == 0 {
+		return recheckInterval
+	}
+
+	// a delivered command is not delivered again, so delivering waits for a
+	// connection to publish it on
+	if err := b.client.Check(ctx); err != nil {
+		return retryDelay
+	}
+
+	commands, err := b.services.Commands.DeliverPending(ctx, ids)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithError(fmt.Errorf("business.DeliverPending: %w", err)).Error("unable to deliver commands")
+		}
+		return retryDelay
+	}
+
+	for _, c := range commands {
+		payload, err := json.Marshal(c)
+		if err != nil {
+			log.WithError(fmt.Errorf("json.Marshal: %w", err)).Error("unable to encode command")
+			continue
+		}
+		if err := b.client.Publish(ctx, b.topic(c.DeviceID, "commands"), 1, false, payload); err != nil && ctx.Err() == nil {
+			// the command expires unless the device acknowledges it anyway
+			log.WithError(fmt.Errorf("client.Publish: %w", err)).WithField("device_id", c.DeviceID).WithField("command_id", c.ID).Error("unable to publish command")
+		}
+	}
+	// a delivery returns a batch, more commands may be queued
+	if len(commands) > 0 {
+		return 0
+	}
+	return recheckInterval
+}
+
+// forwardEvents publishes the device events to the topics of their devices
+// until ctx is cancelled
+func (b *Bridge) forwardEvents(ctx context.Context) {
+	var lastEventID string
+	for {
+		sub, missed := b.services.Broadcaster.Subscribe(lastEventID, device.EventFilter(""))
+		for _, e := range missed {
+			b.publishEvent(ctx, e)
+			lastEventID = e.ID
+		}
+
+	forward:
+		for {
+			select {
+			case <-ctx.Done():
+				b.services.Broadcaster.Unsubscribe(sub)
+				return
+			case e, ok := <-sub.Events():
+				if !ok {
+					// the bridge fell behind, it resumes after the last event it published
+					break forward
+				}
+				b.publishEvent(ctx, e)
+				lastEventID = e.ID
+			}
+		}
+		b.services.Broadcaster.Unsubscribe(sub)
+	}
+}
+
+// publishEvent publishes e to the events topic of its device
+func (b *Bridge) publishEvent(ctx context.Context, e event.Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		logging.FromContext(ctx).WithError(fmt.Errorf("json.Marshal: %w", err)).Error("unable to encode event")
+		return
+	}
+	// events are best effort, like the server-sent stream without a last event ID
+	if err := b.client.Publish(ctx, b.topic(e.AggregateID, "events"), 0, false, payload); err != nil && ctx.Err() == nil && !errors.Is(err, ErrNotConnected) {
+		logging.FromContext(ctx).WithError(fmt.Errorf("client.Publish: %w", err)).WithField("event_id", e.ID).Error("unable to publish event")
+	}
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,350 @@
+package device
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/business/event"
+	"device/business/firmware"
+	"device/business/shadow"
+	"device/business/telemetry"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/mock"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) GetByID(ctx context.Context, id string) (device.Device, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Heartbeat(ctx context.Context, id string, hb device.Heartbeat) error {
+	args := bm.Called(ctx, id, hb)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) Ingest(ctx context.Context, id string, batch telemetry.Batch) (telemetry.IngestResult, error) {
+	args := bm.Called(ctx, id, batch)
+	return args.Get(0).(telemetry.IngestResult), args.Error(1)
+}
+
+func (bm *BusinessMock) UpdateReported(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error) {
+	args := bm.Called(ctx, id, u)
+	return args.Get(0).(shadow.Shadow), args.Error(1)
+}
+
+func (bm *BusinessMock) DeliverPending(ctx context.Context, ids []string) ([]command.Command, error) {
+	args := bm.Called(ctx, ids)
+	return args.Get(0).([]command.Command), args.Error(1)
+}
+
+func (bm *BusinessMock) Enqueued() <-chan struct{} {
+	// nothing is enqueued, the poller is woken up by devices starting to wait
+	return nil
+}
+
+func (bm *BusinessMock) Ack(ctx context.Context, id, commandID string, ack command.Ack) (command.Command, error) {
+	args := bm.Called(ctx, id, commandID, ack)
+	return args.Get(0).(command.Command), args.Error(1)
+}
+
+func (bm *BusinessMock) Report(ctx context.Context, id string, rp firmware.Report) (firmware.DeviceProgress, error) {
+	args := bm.Called(ctx, id, rp)
+	return args.Get(0).(firmware.DeviceProgress), args.Error(1)
+}
+
+const (
+	id        = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+	commandID = "9b0d3c55-4a4b-4d8e-8f0a-6c1f3e0b2a71"
+)
+
+// startBridge runs a bridge over an embedded broker until the test ends and
+// returns a connected client of the broker acting as the device
+func startBridge(t *testing.T, b *BusinessMock, bc Broadcaster) *PahoClient {
+	t.Helper()
+	addr := startBroker(t)
+
+	client := NewClient(addr, "device-api")
+	bridge := NewBridge(client, "devices", Services{
+		Devices:     b,
+		Telemetry:   b,
+		Shadows:     b,
+		Commands:    b,
+		Firmware:    b,
+		Broadcaster: bc,
+	})
+	run(t, bridge.Run)
+
+	dev := NewClient(addr, id)
+	run(t, dev.Run)
+	for _, c := range []interface{ Check(context.Context) error }{bridge, dev} {
+		deadline := time.Now().Add(5 * time.Second)
+		for c.Check(context.Background()) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("not connected to the broker")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	return dev
+}
+
+// startBroker runs an embedded broker until the test ends and returns its address
+func startBroker(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.AddListener(listeners.NewNet("tcp", l)); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = broker.Close() })
+	return "tcp://" + l.Addr().String()
+}
+
+// run runs fn until the test ends
+func run(t *testing.T, fn func(context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// subscribe returns the messages of the device to the topics matching filter
+func subscribe(t *testing.T, dev *PahoClient, filter string) <-chan Message {
+	t.Helper()
+	ms := make(chan Message, 10)
+	err := dev.Subscribe(context.Background(), filter, 1, func(_ context.Context, m Message) {
+		ms <- m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ms
+}
+
+// receive returns the next message of ms
+func receive(t *testing.T, ms <-chan Message) Message {
+	t.Helper()
+	select {
+	case m := <-ms:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	testTable := map[string]struct {
+		topic         string
+		payload       string
+		method        string
+		businessErr   error
+		expectedError string
+	}{
+		"heartbeat": {
+			topic:   "heartbeat",
+			payload: `{"ip": "10.0.0.7"}`,
+			method:  "Heartbeat",
+		},
+		"heartbeat without metadata": {
+			topic:  "heartbeat",
+			method: "Heartbeat",
+		},
+		"heartbeat of an unknown device": {
+			topic:         "heartbeat",
+			method:        "Heartbeat",
+			businessErr:   device.ErrNotFound,
+			expectedError: "device not found",
+		},
+		"telemetry": {
+			topic:   "telemetry",
+			payload: `{"samples": [{"metric": "temperature", "value": 21.5}]}`,
+			method:  "Ingest",
+		},
+		"invalid telemetry": {
+			topic:         "telemetry",
+			payload:       `{"samples": `,
+			expectedError: "invalid payload",
+		},
+		"reported state": {
+			topic:   "shadow/reported",
+			payload: `{"state": {"led": "on"}}`,
+			method:  "UpdateReported",
+		},
+		"shadow version conflict": {
+			topic:         "shadow/reported",
+			payload:       `{"state": {"led": "on"}, "version": 3}`,
+			method:        "UpdateReported",
+			businessErr:   shadow.ErrVersionConflict,
+			expectedError: "the shadow changed, get it and retry with its version",
+		},
+		"command acknowledgement": {
+			topic:   "commands/" + commandID + "/ack",
+			payload: `{"status": "succeeded"}`,
+			method:  "Ack",
+		},
+		"invalid command id": {
+			topic:         "commands/1/ack",
+			payload:       `{"status": "succeeded"}`,
+			expectedError: "command id is not a valid UUID",
+		},
+		"firmware report": {
+			topic:   "firmware/report",
+			payload: `{"rollout_id": "` + commandID + `", "status": "installing"}`,
+			method:  "Report",
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			calls := make(chan string, 1)
+			notify := func(method string) func(mock.Arguments) {
+				return func(mock.Arguments) { calls <- method }
+			}
+			b := &BusinessMock{}
+			b.On("Heartbeat", mock.Anything, id, mock.AnythingOfType("device.Heartbeat")).Return(tc.businessErr).Run(notify("Heartbeat"))
+			b.On("Ingest", mock.Anything, id, mock.AnythingOfType("telemetry.Batch")).Return(telemetry.IngestResult{}, tc.businessErr).Run(notify("Ingest"))
+			b.On("UpdateReported", mock.Anything, id, mock.AnythingOfType("shadow.UpdateState")).Return(shadow.Shadow{}, tc.businessErr).Run(notify("UpdateReported"))
+			b.On("Ack", mock.Anything, id, commandID, mock.AnythingOfType("command.Ack")).Return(command.Command{}, tc.businessErr).Run(notify("Ack"))
+			b.On("Report", mock.Anything, id, mock.AnythingOfType("firmware.Report")).Return(firmware.DeviceProgress{}, tc.businessErr).Run(notify("Report"))
+			dev := startBridge(t, b, event.NewBroadcaster(0, 1))
+			errs := subscribe(t, dev, "devices/"+id+"/errors")
+
+			if err := dev.Publish(context.Background(), "devices/"+id+"/"+tc.topic, 1, false, []byte(tc.payload)); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.method != "" {
+				select {
+				case method := <-calls:
+					if method != tc.method {
+						t.Fatalf("expected %s to be called, got %s", tc.method, method)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("%s not called", tc.method)
+				}
+			}
+			if tc.expectedError == "" {
+				select {
+				case m := <-errs:
+					t.Fatalf("unexpected error %s", m.Payload)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+
+			var rejected map[string]string
+			if err := json.Unmarshal(receive(t, errs).Payload, &rejected); err != nil {
+				t.Fatal(err)
+			}
+			if rejected["error"] != tc.expectedError || rejected["topic"] != "devices/"+id+"/"+tc.topic {
+				t.Fatalf("unexpected rejection %v", rejected)
+			}
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	other := "5c0e7a8b-1f2d-4c3b-9a4e-6d7f8e9a0b1c"
+	b := &BusinessMock{}
+	b.On("GetByID", mock.Anything, id).Return(device.Device{ID: id}, nil)
+	b.On("GetByID", mock.Anything, other).Return(device.Device{}, device.ErrNotFound)
+	b.On("DeliverPending", mock.Anything, []string{id}).Return([]command.Command{{ID: commandID, DeviceID: id, Name: "reboot"}}, nil).Once()
+	var mu sync.Mutex
+	delivered := 1
+	b.On("DeliverPending", mock.Anything, []string{id}).Return([]command.Command{}, nil).Run(func(mock.Arguments) {
+		mu.Lock()
+		delivered++
+		mu.Unlock()
+	})
+	dev := startBridge(t, b, event.NewBroadcaster(0, 1))
+	commands := subscribe(t, dev, "devices/"+id+"/commands")
+	errs := subscribe(t, dev, "devices/"+other+"/errors")
+
+	ctx := context.Background()
+	if err := dev.Publish(ctx, "devices/"+id+"/commands/pending", 1, true, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	var c command.Command
+	if err := json.Unmarshal(receive(t, commands).Payload, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != commandID || c.Name != "reboot" {
+		t.Fatalf("unexpected command %+v", c)
+	}
+
+	// unknown devices are rejected instead of waiting
+	if err := dev.Publish(ctx, "devices/"+other+"/commands/pending", 1, true, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if m := receive(t, errs); !strings.Contains(string(m.Payload), "device not found") {
+		t.Fatalf("unexpected error %s", m.Payload)
+	}
+
+	// clearing the pending message stops the deliveries
+	if err := dev.Publish(ctx, "devices/"+id+"/commands/pending", 1, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	before := delivered
+	mu.Unlock()
+	time.Sleep(recheckInterval + 500*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if delivered != before {
+		t.Fatalf("expected no delivery once the device stopped waiting, got %d more", delivered-before)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	bc := event.NewBroadcaster(10, 10)
+	dev := startBridge(t, &BusinessMock{}, bc)
+	events := subscribe(t, dev, "devices/"+id+"/events")
+
+	e, err := event.New(device.EventDeviceUpdated, id, device.DeviceUpdated{Device: device.Device{ID: id, Name: "sensor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	var got event.Event
+	if err := json.Unmarshal(receive(t, events).Payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != e.ID || got.Type != device.EventDeviceUpdated {
+		t.Fatalf("unexpected event %+v", got)
+	}
+}
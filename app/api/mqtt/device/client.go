@@ -0,0 +1,237 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKeepAlive      = 30 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+	maxReconnectDelay     = 30 * time.Second
+	// disconnectQuiesce is how long, in milliseconds, the client waits for
+	// the work in flight when disconnecting
+	disconnectQuiesce = 250
+)
+
+// ErrNotConnected is returned when publishing while the client is not
+// connected, or when the connection is lost before the broker acknowledged
+// a message
+var ErrNotConnected = errors.New("not connected to the broker")
+
+// Message is a message published to a topic
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// Handler handles the messages of a subscription. Messages are handled
+// concurrently, and a QoS 1 message is acknowledged once its handler returns.
+type Handler func(ctx context.Context, m Message)
+
+// subscription is a topic filter along with its QoS and handler
+type subscription struct {
+	filter  string
+	qos     byte
+	handler paho.MessageHandler
+}
+
+// PahoClient is the Client of a broker, built on the Eclipse Paho client. It
+// starts a clean session on every connection, so its subscriptions are made
+// again each time it reconnects.
+type PahoClient struct {
+	broker string
+	client paho.Client
+
+	mu   sync.Mutex
+	subs []subscription
+	// ready is set once the subscriptions of the current connection are made
+	ready bool
+	// stopped is set when Run ends, no message is handled afterwards
+	stopped bool
+
+	handlers sync.WaitGroup
+}
+
+var _ Client = (*PahoClient)(nil)
+
+// ClientOption configures the PahoClient
+type ClientOption func(*paho.ClientOptions)
+
+// WithCredentials sets the user name and password the client connects with
+func WithCredentials(username, password string) ClientOption {
+	return func(o *paho.ClientOptions) {
+		o.SetUsername(username)
+		o.SetPassword(password)
+	}
+}
+
+// WithKeepAlive sets how long the connection may stay idle before the
+// broker considers the client gone
+func WithKeepAlive(d time.Duration) ClientOption {
+	return func(o *paho.ClientOptions) {
+		o.SetKeepAlive(d)
+	}
+}
+
+// NewClient creates a client of the broker at addr, e.g. tcp://localhost:1883
+// or tls://broker.example.com:8883, identified by clientID. It connects once
+// run.
+func NewClient(addr, clientID string, opts ...ClientOption) *PahoClient {
+	c := &PahoClient{broker: addr}
+
+	o := paho.NewClientOptions().
+		AddBroker(addr).
+		SetClientID(clientID).
+		SetCleanSession(true).
+		SetKeepAlive(defaultKeepAlive).
+		SetConnectTimeout(defaultConnectTimeout).
+		SetConnectRetry(true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(maxReconnectDelay).
+		// messages are handled concurrently, each acknowledged once handled
+		SetOrderMatters(false).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(c.onConnectionLost)
+	for _, opt := range opts {
+		opt(o)
+	}
+	c.client = paho.NewClient(o)
+	return c
+}
+
+// Subscribe subscribes h to the messages of the topics matching filter, at
+// most at qos, handling them with ctx. The subscription is made on every
+// connection, and right away if the client is connected.
+func (c *PahoClient) Subscribe(ctx context.Context, filter string, qos byte, h Handler) error {
+	s := subscription{
+		filter: filter,
+		qos:    qos,
+		handler: func(_ paho.Client, m paho.Message) {
+			c.mu.Lock()
+			if c.stopped {
+				c.mu.Unlock()
+				return
+			}
+			c.handlers.Add(1)
+			c.mu.Unlock()
+			defer c.handlers.Done()
+			h(ctx, Message{Topic: m.Topic(), Payload: m.Payload(), Retained: m.Retained()})
+		},
+	}
+
+	c.mu.Lock()
+	c.subs = append(c.subs, s)
+	ready := c.ready
+	c.mu.Unlock()
+
+	if !ready {
+		return nil
+	}
+	return c.subscribe(ctx, s)
+}
+
+// subscribe makes s on the current connection
+func (c *PahoClient) subscribe(ctx context.Context, s subscription) error {
+	if err := wait(ctx, c.client.Subscribe(s.filter, s.qos, s.handler)); err != nil {
+		return fmt.Errorf("subscription to %s: %w", s.filter, err)
+	}
+	return nil
+}
+
+// Publish publishes payload to topic. At QoS 1 it waits for the broker to
+// acknowledge the message, and fails with ErrNotConnected if the connection
+// is lost meanwhile; the message may then have been delivered or not.
+func (c *PahoClient) Publish(ctx context.Context, topic string, qos byte, retain bool, payload []byte) error {
+	// paho would queue the message until reconnected otherwise
+	if !c.client.IsConnectionOpen() {
+		return ErrNotConnected
+	}
+	return wait(ctx, c.client.Publish(topic, qos, retain, payload))
+}
+
+// Check reports an error unless the client is connected
+func (c *PahoClient) Check(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.ready || !c.client.IsConnectionOpen() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// Run keeps the client connected until ctx is cancelled, reconnecting with
+// an exponential backoff. It returns once the messages being handled are.
+func (c *PahoClient) Run(ctx context.Context) {
+	// the connection is retried until it succeeds, the token completes then
+	c.client.Connect()
+	<-ctx.Done()
+	c.client.Disconnect(disconnectQuiesce)
+
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	c.handlers.Wait()
+}
+
+// onConnect makes the subscriptions, including the ones added meanwhile,
+// before the client is considered connected
+func (c *PahoClient) onConnect(paho.Client) {
+	ctx := context.Background()
+	for subscribed := 0; ; {
+		c.mu.Lock()
+		subs := c.subs[subscribed:]
+		if len(subs) == 0 {
+			c.ready = true
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		for _, s := range subs {
+			if err := c.subscribe(ctx, s); err != nil {
+				// the broker refused it, the other subscriptions are still made
+				logrus.WithError(fmt.Errorf("client.subscribe: %w", err)).WithField("broker", c.broker).Error("unable to subscribe")
+			}
+		}
+		subscribed += len(subs)
+	}
+	logrus.WithField("broker", c.broker).Info("connected to the MQTT broker")
+}
+
+// onConnectionLost marks the client disconnected until it reconnects
+func (c *PahoClient) onConnectionLost(_ paho.Client, err error) {
+	c.mu.Lock()
+	c.ready = false
+	c.mu.Unlock()
+	logrus.WithError(err).WithField("broker", c.broker).Warn("MQTT connection lost")
+}
+
+// wait waits for t to complete or ctx to be cancelled
+func wait(ctx context.Context, t paho.Token) error {
+	select {
+	case <-t.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := t.Error(); err != nil {
+		if errors.Is(err, paho.ErrNotConnected) {
+			return ErrNotConnected
+		}
+		return err
+	}
+	return nil
+}
+
+// shared returns the filter of a subscription shared by the members of
+// group, which the broker hands each message to one of
+func shared(group, filter string) string {
+	return "$share/" + group + "/" + filter
+}
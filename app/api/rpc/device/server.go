@@ -0,0 +1,274 @@
+package device
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/event"
+	"device/pkg/logging"
+	"device/pkg/web"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	devicev1 "device/pkg/pb/device/v1"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultPageSize = 10
+
+// Business represents the device business interface
+type Business interface {
+	Create(ctx context.Context, cd device.CreateDevice) (device.Device, error)
+	Update(ctx context.Context, id string, data device.UpdateDevice) error
+	GetByID(ctx context.Context, id string) (device.Device, error)
+	GetAll(ctx context.Context, offset, limit int) ([]device.Device, error)
+	Delete(ctx context.Context, id string) error
+	SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error)
+	Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error)
+}
+
+// Broadcaster represents the event broadcaster interface
+type Broadcaster interface {
+	Subscribe(lastEventID string, filter func(event.Event) bool) (*event.Subscriber, []event.Event)
+	Unsubscribe(s *event.Subscriber)
+}
+
+// Server is the gRPC implementation of the device service
+type Server struct {
+	devicev1.UnimplementedDeviceServiceServer
+	business    Business
+	broadcaster Broadcaster
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// this is a compile time check to ensure Server implements devicev1.DeviceServiceServer
+var _ devicev1.DeviceServiceServer = (*Server)(nil)
+
+// NewServer creates a new device gRPC server
+func NewServer(b Business, bc Broadcaster) *Server {
+	return &Server{
+		business:    b,
+		broadcaster: bc,
+		done:        make(chan struct{}),
+	}
+}
+
+// Close ends every open watch stream so the server can stop gracefully
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// GetDevice returns a device by its ID
+func (s *Server) GetDevice(ctx context.Context, req *devicev1.GetDeviceRequest) (*devicev1.Device, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	d, err := s.business.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, fmt.Errorf("business.GetByID: %w", err), "unable to get device")
+	}
+	return toProtoDevice(d), nil
+}
+
+// CreateDevice creates a device
+func (s *Server) CreateDevice(ctx context.Context, req *devicev1.CreateDeviceRequest) (*devicev1.Device, error) {
+	cd := device.CreateDevice{
+		Name:  req.GetName(),
+		Brand: req.GetBrand(),
+	}
+	if err := cd.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	d, err := s.business.Create(ctx, cd)
+	if err != nil {
+		return nil, toStatus(ctx, fmt.Errorf("business.Create: %w", err), "unable to create device")
+	}
+	return toProtoDevice(d), nil
+}
+
+// UpdateDevice updates a device
+func (s *Server) UpdateDevice(ctx context.Context, req *devicev1.UpdateDeviceRequest) (*devicev1.UpdateDeviceResponse, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	err := s.business.Update(ctx, req.GetId(), device.UpdateDevice{
+		Name:  req.Name,
+		Brand: req.Brand,
+	})
+	if err != nil {
+		return nil, toStatus(ctx, fmt.Errorf("business.Update: %w", err), "unable to update device")
+	}
+	return &devicev1.UpdateDeviceResponse{}, nil
+}
+
+// DeleteDevice deletes a device
+func (s *Server) DeleteDevice(ctx context.Context, req *devicev1.DeleteDeviceRequest) (*devicev1.DeleteDeviceResponse, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.business.Delete(ctx, req.GetId()); err != nil {
+		return nil, toStatus(ctx, fmt.Errorf("business.Delete: %w", err), "unable to delete device")
+	}
+	return &devicev1.DeleteDeviceResponse{}, nil
+}
+
+// ListDevices returns a page of devices
+func (s *Server) ListDevices(ctx context.Context, req *devicev1.ListDevicesRequest) (*devicev1.ListDevicesResponse, error) {
+	limit := int(req.GetPageSize())
+	switch {
+	case limit <= 0:
+		limit = defaultPageSize
+	case limit > web.MaxLimit:
+		limit = web.MaxLimit
+	}
+
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		if offset, err = strconv.Atoi(req.GetPageToken()); err != nil || offset < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	var (
+		devices []device.Device
+		err     error
+	)
+	switch {
+	case req.GetStatus() != devicev1.DeviceStatus_DEVICE_STATUS_UNSPECIFIED:
+		st, ok := fromProtoStatus[req.GetStatus()]
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, "invalid status")
+		}
+		devices, err = s.business.Search(ctx, device.Filter{Brand: req.GetBrand(), Status: st}, offset, limit)
+	case req.GetBrand() != "":
+		devices, err = s.business.SearchByBrand(ctx, req.GetBrand(), offset, limit)
+	default:
+		devices, err = s.business.GetAll(ctx, offset, limit)
+	}
+	if err != nil {
+		return nil, toStatus(ctx, fmt.Errorf("business.List: %w", err), "unable to list devices")
+	}
+
+	resp := &devicev1.ListDevicesResponse{
+		Devices: make([]*devicev1.Device, len(devices)),
+	}
+	for i, d := range devices {
+		resp.Devices[i] = toProtoDevice(d)
+	}
+	if len(devices) == limit {
+		resp.NextPageToken = strconv.Itoa(offset + limit)
+	}
+	return resp, nil
+}
+
+// WatchDevices streams device events until the client goes away
+func (s *Server) WatchDevices(req *devicev1.WatchDevicesRequest, stream devicev1.DeviceService_WatchDevicesServer) error {
+	sub, missed := s.broadcaster.Subscribe(req.GetLastEventId(), device.EventFilter(req.GetBrand()))
+	defer s.broadcaster.Unsubscribe(sub)
+
+	for _, e := range missed {
+		if err := sendEvent(stream, e); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down, resume with last_event_id")
+		case e, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "client is too slow, resume with last_event_id")
+			}
+			if err := sendEvent(stream, e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendEvent sends a device event on the stream
+func sendEvent(stream devicev1.DeviceService_WatchDevicesServer, e event.Event) error {
+	d, err := device.DeviceFromEvent(e)
+	if err != nil {
+		return toStatus(stream.Context(), fmt.Errorf("device.DeviceFromEvent: %w", err), "unable to decode device event")
+	}
+
+	return stream.Send(&devicev1.DeviceEvent{
+		Id:         e.ID,
+		Type:       e.Type,
+		Device:     toProtoDevice(d),
+		OccurredAt: timestamppb.New(e.OccurredAt),
+	})
+}
+
+// validateID checks that id is a valid UUID
+func validateID(id string) error {
+	if id == "" {
+		return status.Error(codes.InvalidArgument, "id is required")
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return status.Error(codes.InvalidArgument, "id is not a valid UUID")
+	}
+	return nil
+}
+
+// toStatus maps a business error to a gRPC status error
+func toStatus(ctx context.Context, err error, msg string) error {
+	if errors.Is(err, device.ErrNotFound) {
+		return status.Error(codes.NotFound, "device not found")
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, msg)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, msg)
+	}
+
+	logging.FromContext(ctx).WithError(err).Error(msg)
+	return status.Error(codes.Internal, msg)
+}
+
+// protoStatuses maps the device statuses to their devicev1 values
+var protoStatuses = map[device.Status]devicev1.DeviceStatus{
+	device.StatusUnknown: devicev1.DeviceStatus_DEVICE_STATUS_UNKNOWN,
+	device.StatusOnline:  devicev1.DeviceStatus_DEVICE_STATUS_ONLINE,
+	device.StatusOffline: devicev1.DeviceStatus_DEVICE_STATUS_OFFLINE,
+}
+
+// fromProtoStatus maps the devicev1 statuses back to the device statuses
+var fromProtoStatus = map[devicev1.DeviceStatus]device.Status{
+	devicev1.DeviceStatus_DEVICE_STATUS_UNKNOWN: device.StatusUnknown,
+	devicev1.DeviceStatus_DEVICE_STATUS_ONLINE:  device.StatusOnline,
+	devicev1.DeviceStatus_DEVICE_STATUS_OFFLINE: device.StatusOffline,
+}
+
+// toProtoDevice converts a device.Device to a devicev1.Device
+func toProtoDevice(d device.Device) *devicev1.Device {
+	pd := &devicev1.Device{
+		Id:        d.ID,
+		Name:      d.Name,
+		Brand:     d.Brand,
+		CreatedAt: timestamppb.New(d.CreatedAt),
+		Status:    protoStatuses[d.Status],
+	}
+	if d.LastSeenAt != nil {
+		pd.LastSeenAt = timestamppb.New(*d.LastSeenAt)
+	}
+	return pd
+}
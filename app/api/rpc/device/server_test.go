@@ -0,0 +1,204 @@
+package device
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/event"
+	"device/pkg/web"
+	"net"
+	"testing"
+	"time"
+
+	devicev1 "device/pkg/pb/device/v1"
+
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type BusinessMock struct {
+	mock.Mock
+}
+
+func (bm *BusinessMock) Create(ctx context.Context, cd device.CreateDevice) (device.Device, error) {
+	args := bm.Called(ctx, cd)
+	return args.Get(0).(device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Update(ctx context.Context, id string, data device.UpdateDevice) error {
+	args := bm.Called(ctx, id, data)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) GetByID(ctx context.Context, id string) (device.Device, error) {
+	args := bm.Called(ctx, id)
+	return args.Get(0).(device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) GetAll(ctx context.Context, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Delete(ctx context.Context, id string) error {
+	args := bm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (bm *BusinessMock) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, brand, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (bm *BusinessMock) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	args := bm.Called(ctx, f, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+// newClient serves s over an in-memory listener and returns a client for it
+func newClient(t *testing.T, s *Server) devicev1.DeviceServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	devicev1.RegisterDeviceServiceServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return devicev1.NewDeviceServiceClient(conn)
+}
+
+func TestGetDevice(t *testing.T) {
+	id := "6f24bfd3-64ee-47c4-b903-0ba81852ac6e"
+
+	testTable := map[string]struct {
+		id           string
+		businessErr  error
+		expectedCode codes.Code
+	}{
+		"ok": {
+			id:           id,
+			expectedCode: codes.OK,
+		},
+		"not found": {
+			id:           id,
+			businessErr:  device.ErrNotFound,
+			expectedCode: codes.NotFound,
+		},
+		"invalid id": {
+			id:           "1",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := BusinessMock{}
+			b.On("GetByID", mock.Anything, tc.id).Return(device.Device{ID: tc.id}, tc.businessErr)
+			client := newClient(t, NewServer(&b, event.NewBroadcaster(0, 1)))
+
+			d, err := client.GetDevice(context.Background(), &devicev1.GetDeviceRequest{Id: tc.id})
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Fatalf("expected %v, got %v", tc.expectedCode, code)
+			}
+			if err == nil && d.GetId() != tc.id {
+				t.Fatalf("expected %s, got %s", tc.id, d.GetId())
+			}
+		})
+	}
+}
+
+func TestListDevices(t *testing.T) {
+	b := BusinessMock{}
+	b.On("SearchByBrand", mock.Anything, "acme", 2, 2).Return([]device.Device{{ID: "1"}, {ID: "2"}}, nil)
+	client := newClient(t, NewServer(&b, event.NewBroadcaster(0, 1)))
+
+	resp, err := client.ListDevices(context.Background(), &devicev1.ListDevicesRequest{
+		PageSize:  2,
+		PageToken: "2",
+		Brand:     "acme",
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(resp.GetDevices()) != 2 || resp.GetNextPageToken() != "4" {
+		t.Fatalf("unexpected response %v", resp)
+	}
+}
+
+func TestListDevicesPageSizeCap(t *testing.T) {
+	b := BusinessMock{}
+	b.On("GetAll", mock.Anything, 0, web.MaxLimit).Return([]device.Device{{ID: "1"}}, nil)
+	client := newClient(t, NewServer(&b, event.NewBroadcaster(0, 1)))
+
+	if _, err := client.ListDevices(context.Background(), &devicev1.ListDevicesRequest{PageSize: 100000}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	b.AssertExpectations(t)
+}
+
+func TestListDevicesByStatus(t *testing.T) {
+	seenAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := BusinessMock{}
+	b.On("Search", mock.Anything, device.Filter{Status: device.StatusOffline}, 0, defaultPageSize).Return([]device.Device{
+		{ID: "1", Status: device.StatusOffline, LastSeenAt: &seenAt},
+	}, nil)
+	client := newClient(t, NewServer(&b, event.NewBroadcaster(0, 1)))
+
+	resp, err := client.ListDevices(context.Background(), &devicev1.ListDevicesRequest{
+		Status: devicev1.DeviceStatus_DEVICE_STATUS_OFFLINE,
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(resp.GetDevices()) != 1 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	d := resp.GetDevices()[0]
+	if d.GetStatus() != devicev1.DeviceStatus_DEVICE_STATUS_OFFLINE || !d.GetLastSeenAt().AsTime().Equal(seenAt) {
+		t.Fatalf("unexpected device %v", d)
+	}
+
+	_, err = client.ListDevices(context.Background(), &devicev1.ListDevicesRequest{Status: 42})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestWatchDevices(t *testing.T) {
+	bc := event.NewBroadcaster(10, 10)
+	client := newClient(t, NewServer(&BusinessMock{}, bc))
+
+	first, _ := event.New(device.EventDeviceCreated, "1", device.DeviceCreated{Device: device.Device{ID: "1", Brand: "acme"}})
+	second, _ := event.New(device.EventDeviceDeleted, "1", device.DeviceDeleted{Device: device.Device{ID: "1", Brand: "acme"}})
+	bc.Publish(context.Background(), first)
+	bc.Publish(context.Background(), second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.WatchDevices(ctx, &devicev1.WatchDevicesRequest{Brand: "acme", LastEventId: first.ID})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	e, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if e.GetId() != second.ID || e.GetType() != device.EventDeviceDeleted || e.GetDevice().GetBrand() != "acme" {
+		t.Fatalf("unexpected event %v", e)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/client"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pageSize is the size of the pages fetched to list every device
+const pageSize = 100
+
+// env is what a command runs with
+type env struct {
+	name   string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// set by parse
+	client *client.Client
+	format string
+}
+
+// connFlags are the flags every command accepts
+type connFlags struct {
+	profile  string
+	endpoint string
+	apiKey   string
+	output   string
+}
+
+// flagSet returns the flag set of the command, with the flags every command accepts
+func (e *env) flagSet(args, defaultFormat string) (*flag.FlagSet, *connFlags) {
+	fs := flag.NewFlagSet(e.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: devicectl %s [flags] %s\n\nFlags:\n", e.name, args)
+		fs.PrintDefaults()
+	}
+
+	c := &connFlags{}
+	fs.StringVar(&c.profile, "profile", "", "profile of the config file")
+	fs.StringVar(&c.endpoint, "endpoint", "", "URL of the API, overrides the profile")
+	fs.StringVar(&c.apiKey, "api-key", "", "API key, overrides the profile")
+	fs.StringVar(&c.output, "o", defaultFormat, "output format: table, json or yaml")
+	return fs, c
+}
+
+// parse parses args, which may mix flags and positional arguments, checks
+// that there are between min and max positional arguments and connects to the API
+func (e *env) parse(fs *flag.FlagSet, c *connFlags, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < min || len(positional) > max {
+		fmt.Fprintf(e.stderr, "devicectl %s: expected between %d and %d arguments, got %d\n", e.name, min, max, len(positional))
+		fs.Usage()
+		return nil, errUsage
+	}
+	if !validFormat(c.output) {
+		fmt.Fprintf(e.stderr, "devicectl %s: invalid output format %q, expected table, json or yaml\n", e.name, c.output)
+		return nil, errUsage
+	}
+	e.format = c.output
+
+	profile, err := loadProfile(c.profile)
+	if err != nil {
+		return nil, fmt.Errorf("loadProfile: %w", err)
+	}
+	if c.endpoint != "" {
+		profile.Endpoint = c.endpoint
+	}
+	if c.apiKey != "" {
+		profile.APIKey = c.apiKey
+	}
+
+	var opts []client.Option
+	if profile.APIKey != "" {
+		opts = append(opts, client.WithAPIKey(profile.APIKey))
+	}
+	if e.client, err = client.New(profile.Endpoint, opts...); err != nil {
+		return nil, fmt.Errorf("client.New: %w", err)
+	}
+	return positional, nil
+}
+
+func getCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("<id>", formatTable)
+	positional, err := e.parse(fs, c, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	d, err := e.client.GetDevice(ctx, positional[0])
+	if err != nil {
+		return fmt.Errorf("client.GetDevice: %w", err)
+	}
+	return printDevice(e.stdout, e.format, d)
+}
+
+func listCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("", formatTable)
+	brand := fs.String("brand", "", "only list the devices of this brand")
+	status := fs.String("status", "", "only list the devices with this status: unknown, online or offline")
+	offset := fs.Int("offset", 0, "number of devices to skip")
+	limit := fs.Int("limit", 0, "size of the page, 10 by default")
+	all := fs.Bool("all", false, "list every page")
+	if _, err := e.parse(fs, c, args, 0, 0); err != nil {
+		return err
+	}
+	opts := client.ListOptions{Brand: *brand, Status: device.Status(*status), Offset: *offset, Limit: *limit}
+	if opts.Status != "" && !opts.Status.Valid() {
+		fmt.Fprintf(e.stderr, "devicectl %s: invalid status %q, expected unknown, online or offline\n", e.name, *status)
+		return errUsage
+	}
+
+	var (
+		devices []device.Device
+		err     error
+	)
+	if *all {
+		if opts.Limit <= 0 {
+			opts.Limit = pageSize
+		}
+		devices, err = e.client.Devices(opts).All(ctx)
+	} else {
+		devices, err = e.client.ListDevices(ctx, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("client.ListDevices: %w", err)
+	}
+	return printDevices(e.stdout, e.format, devices)
+}
+
+func createCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("", formatTable)
+	var cd device.CreateDevice
+	fs.StringVar(&cd.Name, "name", "", "name of the device")
+	fs.StringVar(&cd.Brand, "brand", "", "brand of the device")
+	if _, err := e.parse(fs, c, args, 0, 0); err != nil {
+		return err
+	}
+	if err := cd.Validate(); err != nil {
+		fmt.Fprintf(e.stderr, "devicectl %s: %v\n", e.name, err)
+		return errUsage
+	}
+
+	d, err := e.client.CreateDevice(ctx, cd)
+	if err != nil {
+		return fmt.Errorf("client.CreateDevice: %w", err)
+	}
+	return printDevice(e.stdout, e.format, d)
+}
+
+func updateCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("<id>", formatTable)
+	name := fs.String("name", "", "new name of the device")
+	brand := fs.String("brand", "", "new brand of the device")
+	positional, err := e.parse(fs, c, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	var data device.UpdateDevice
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			data.Name = name
+		case "brand":
+			data.Brand = brand
+		}
+	})
+	if data.Name == nil && data.Brand == nil {
+		fmt.Fprintf(e.stderr, "devicectl %s: nothing to update, set -name or -brand\n", e.name)
+		return errUsage
+	}
+
+	id := positional[0]
+	if err := e.client.UpdateDevice(ctx, id, data); err != nil {
+		return fmt.Errorf("client.UpdateDevice: %w", err)
+	}
+	d, err := e.client.GetDevice(ctx, id)
+	if err != nil {
+		return fmt.Errorf("client.GetDevice: %w", err)
+	}
+	return printDevice(e.stdout, e.format, d)
+}
+
+func deleteCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("<id>", formatTable)
+	positional, err := e.parse(fs, c, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := e.client.DeleteDevice(ctx, positional[0]); err != nil {
+		return fmt.Errorf("client.DeleteDevice: %w", err)
+	}
+	fmt.Fprintf(e.stdout, "device %s deleted\n", positional[0])
+	return nil
+}
+
+func importCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("[file]", formatTable)
+	positional, err := e.parse(fs, c, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	r := e.stdin
+	if len(positional) == 1 && positional[0] != "-" {
+		f, err := os.Open(positional[0])
+		if err != nil {
+			return fmt.Errorf("os.Open: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("io.ReadAll: %w", err)
+	}
+
+	// JSON is valid YAML, and the fields of an export that CreateDevice lacks are ignored
+	var cds []device.CreateDevice
+	if err := yaml.Unmarshal(data, &cds); err != nil {
+		return fmt.Errorf("expected a JSON or YAML list of devices: %w", err)
+	}
+	var invalid []error
+	for i, cd := range cds {
+		if err := cd.Validate(); err != nil {
+			invalid = append(invalid, fmt.Errorf("device %d: %w", i+1, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("nothing imported: %w", errors.Join(invalid...))
+	}
+
+	var (
+		created []device.Device
+		failed  int
+	)
+	for i, cd := range cds {
+		d, err := e.client.CreateDevice(ctx, cd)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "devicectl %s: device %d: %v\n", e.name, i+1, err)
+			failed++
+			continue
+		}
+		created = append(created, d)
+	}
+	if err := printDevices(e.stdout, e.format, created); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d devices failed", failed, len(cds))
+	}
+	return nil
+}
+
+func exportCommand(ctx context.Context, e *env, args []string) error {
+	fs, c := e.flagSet("[file]", formatJSON)
+	brand := fs.String("brand", "", "only export the devices of this brand")
+	positional, err := e.parse(fs, c, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	devices, err := listAll(ctx, e.client, *brand, 0, pageSize)
+	if err != nil {
+		return fmt.Errorf("listAll: %w", err)
+	}
+
+	if len(positional) == 0 || positional[0] == "-" {
+		return printDevices(e.stdout, e.format, devices)
+	}
+	f, err := os.Create(positional[0])
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	if err := printDevices(f, e.format, devices); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("f.Close: %w", err)
+	}
+	fmt.Fprintf(e.stderr, "exported %d devices to %s\n", len(devices), positional[0])
+	return nil
+}
+
+// listAll lists the devices from offset on, size at a time
+func listAll(ctx context.Context, c *client.Client, brand string, offset, size int) ([]device.Device, error) {
+	return c.Devices(client.ListOptions{Brand: brand, Offset: offset, Limit: size}).All(ctx)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+)
+
+const usage = `devicectl manages the devices of the device API.
+
+Usage:
+  devicectl <command> [flags] [arguments]
+
+Commands:
+  get <id>        show a device
+  list            list devices, -all to list every page
+  create          create a device from -name and -brand
+  update <id>     change the -name or -brand of a device
+  delete <id>     delete a device
+  import [file]   create the devices of a JSON or YAML list, stdin by default
+  export [file]   write every device, stdout by default
+
+Every command accepts:
+  -profile   profile of the config file (env DEVICECTL_PROFILE)
+  -endpoint  URL of the API (env DEVICECTL_ENDPOINT)
+  -api-key   API key (env DEVICECTL_API_KEY)
+  -o         output format: table, json or yaml
+
+Profiles are read from $DEVICECTL_CONFIG, or devicectl/config.yaml in the
+user config directory:
+
+  current: prod
+  profiles:
+    prod:
+      endpoint: https://devices.example.com
+      api_key: secret
+
+Run "devicectl <command> -h" for the flags of a command.
+`
+
+// errUsage is returned for invalid arguments, after printing the problem
+var errUsage = errors.New("invalid usage")
+
+// command runs a subcommand
+type command func(ctx context.Context, env *env, args []string) error
+
+var commands = map[string]command{
+	"get":    getCommand,
+	"list":   listCommand,
+	"create": createCommand,
+	"update": updateCommand,
+	"delete": deleteCommand,
+	"import": importCommand,
+	"export": exportCommand,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code: 0 on success, 2 on
+// invalid usage and 1 on any other error
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(stderr, "unknown command %q, expected one of %v\n", args[0], names)
+		return 2
+	}
+
+	err := cmd(ctx, &env{name: args[0], stdin: stdin, stdout: stdout, stderr: stderr}, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "devicectl %s: %v\n", args[0], err)
+		return 1
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"device/business/device"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI is an in-memory device API
+type fakeAPI struct {
+	mu      sync.Mutex
+	devices map[string]device.Device
+	nextID  int
+	apiKeys []string
+}
+
+func newFakeAPI(t *testing.T, devices ...device.Device) *fakeAPI {
+	api := &fakeAPI{devices: map[string]device.Device{}}
+	for _, d := range devices {
+		api.devices[d.ID] = d
+	}
+
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "config.yaml"))
+	t.Setenv(profileEnv, "")
+	t.Setenv(endpointEnv, srv.URL)
+	t.Setenv(apiKeyEnv, "")
+	return api
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.apiKeys = append(a.apiKeys, r.Header.Get("X-API-Key"))
+
+	send := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		var devices []device.Device
+		for _, d := range a.devices {
+			brand, status := r.URL.Query().Get("brand"), device.Status(r.URL.Query().Get("status"))
+			if (brand == "" || d.Brand == brand) && (status == "" || d.Status == status) {
+				devices = append(devices, d)
+			}
+		}
+		sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			limit = 10
+		}
+		devices = devices[min(offset, len(devices)):min(offset+limit, len(devices))]
+		send(http.StatusOK, devices)
+	case r.Method == http.MethodPost && id == "":
+		var cd device.CreateDevice
+		json.NewDecoder(r.Body).Decode(&cd)
+		a.nextID++
+		d := device.Device{ID: fmt.Sprintf("new-%d", a.nextID), Name: cd.Name, Brand: cd.Brand, Status: device.StatusUnknown}
+		a.devices[d.ID] = d
+		send(http.StatusCreated, d)
+	default:
+		d, ok := a.devices[id]
+		if !ok {
+			send(http.StatusNotFound, map[string]string{"error": "device not found"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			send(http.StatusOK, d)
+		case http.MethodPut:
+			var data device.UpdateDevice
+			json.NewDecoder(r.Body).Decode(&data)
+			if data.Name != nil {
+				d.Name = *data.Name
+			}
+			if data.Brand != nil {
+				d.Brand = *data.Brand
+			}
+			a.devices[id] = d
+			send(http.StatusOK, map[string]string{"message": "device updated"})
+		case http.MethodDelete:
+			delete(a.devices, id)
+			send(http.StatusOK, map[string]string{"message": "device deleted"})
+		}
+	}
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	testTable := map[string]struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		"get as table": {
+			args:         []string{"get", "a"},
+			expectedCode: 0,
+			expectedStdout: "ID  NAME   BRAND  STATUS  LAST SEEN             CREATED AT\n" +
+				"a   phone  acme   online  2024-05-01T13:00:00Z  2024-05-01T12:00:00Z\n",
+		},
+		"get as json with flags after the id": {
+			args:           []string{"get", "a", "-o", "json"},
+			expectedCode:   0,
+			expectedStdout: "\"name\": \"phone\"",
+		},
+		"get unknown device": {
+			args:           []string{"get", "missing"},
+			expectedCode:   1,
+			expectedStderr: "404 Not Found: device not found",
+		},
+		"get without id": {
+			args:           []string{"get"},
+			expectedCode:   2,
+			expectedStderr: "expected between 1 and 1 arguments, got 0",
+		},
+		"list every page of a brand": {
+			args:           []string{"list", "-brand", "acme", "-all", "-limit", "1", "-o", "yaml"},
+			expectedCode:   0,
+			expectedStdout: "- brand: acme\n  created_at: \"2024-05-01T12:00:00Z\"\n  id: a\n  last_seen_at: \"2024-05-01T13:00:00Z\"\n  name: phone\n  status: online\n- brand: acme\n",
+		},
+		"list offline devices": {
+			args:           []string{"list", "-status", "offline"},
+			expectedCode:   0,
+			expectedStdout: "\nb   laptop  acme   offline  2024-05-01T12:00:00Z  2024-05-01T12:00:00Z\n",
+		},
+		"list with invalid status": {
+			args:           []string{"list", "-status", "asleep"},
+			expectedCode:   2,
+			expectedStderr: `invalid status "asleep"`,
+		},
+		"create": {
+			args:           []string{"create", "-name", "watch", "-brand", "acme", "-o", "json"},
+			expectedCode:   0,
+			expectedStdout: "\"id\": \"new-1\"",
+		},
+		"create without brand": {
+			args:           []string{"create", "-name", "watch"},
+			expectedCode:   2,
+			expectedStderr: "brand is required",
+		},
+		"update": {
+			args:           []string{"update", "b", "-name", "tablet"},
+			expectedCode:   0,
+			expectedStdout: "b   tablet",
+		},
+		"update nothing": {
+			args:           []string{"update", "b"},
+			expectedCode:   2,
+			expectedStderr: "nothing to update",
+		},
+		"delete": {
+			args:           []string{"delete", "c"},
+			expectedCode:   0,
+			expectedStdout: "device c deleted\n",
+		},
+		"unknown command": {
+			args:           []string{"reboot"},
+			expectedCode:   2,
+			expectedStderr: `unknown command "reboot"`,
+		},
+	}
+
+	for name, test := range testTable {
+		t.Run(name, func(t *testing.T) {
+			seenAt := createdAt.Add(time.Hour)
+			newFakeAPI(t,
+				device.Device{ID: "a", Name: "phone", Brand: "acme", CreatedAt: createdAt, Status: device.StatusOnline, LastSeenAt: &seenAt},
+				device.Device{ID: "b", Name: "laptop", Brand: "acme", CreatedAt: createdAt, Status: device.StatusOffline, LastSeenAt: &createdAt},
+				device.Device{ID: "c", Name: "router", Brand: "other", CreatedAt: createdAt, Status: device.StatusUnknown},
+			)
+
+			code, stdout, stderr := runCLI(test.args...)
+			if code != test.expectedCode {
+				t.Fatalf("expected exit code %d, got %d, stderr: %s", test.expectedCode, code, stderr)
+			}
+			if !strings.Contains(stdout, test.expectedStdout) {
+				t.Errorf("expected stdout to contain %q, got %q", test.expectedStdout, stdout)
+			}
+			if !strings.Contains(stderr, test.expectedStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", test.expectedStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	var devices []device.Device
+	for i := 0; i < 250; i++ {
+		devices = append(devices, device.Device{ID: fmt.Sprintf("%03d", i), Name: fmt.Sprintf("device %d", i), Brand: "acme"})
+	}
+	newFakeAPI(t, devices...)
+
+	file := filepath.Join(t.TempDir(), "devices.yaml")
+	if code, _, stderr := runCLI("export", "-o", "yaml", file); code != 0 {
+		t.Fatalf("export failed: %s", stderr)
+	}
+
+	api := newFakeAPI(t)
+	code, stdout, stderr := runCLI("import", file, "-o", "json")
+	if code != 0 {
+		t.Fatalf("import failed: %s", stderr)
+	}
+
+	var created []device.Device
+	if err := json.Unmarshal([]byte(stdout), &created); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(created) != len(devices) || len(api.devices) != len(devices) {
+		t.Fatalf("expected %d devices to be imported, got %d", len(devices), len(api.devices))
+	}
+}
+
+func TestImportValidatesFirst(t *testing.T) {
+	api := newFakeAPI(t)
+	file := filepath.Join(t.TempDir(), "devices.json")
+	if err := os.WriteFile(file, []byte(`[{"name": "phone", "brand": "acme"}, {"name": "watch"}]`), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	code, _, stderr := runCLI("import", file)
+	if code != 1 || !strings.Contains(stderr, "device 2: brand is required") {
+		t.Fatalf("expected the invalid device to be reported, got %d: %s", code, stderr)
+	}
+	if len(api.devices) != 0 {
+		t.Fatalf("expected nothing to be imported, got %d devices", len(api.devices))
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	api := newFakeAPI(t, device.Device{ID: "a", Name: "phone", Brand: "acme"})
+	endpoint := os.Getenv(endpointEnv)
+	t.Setenv(endpointEnv, "")
+
+	config := fmt.Sprintf("current: staging\nprofiles:\n  staging:\n    endpoint: %s\n    api_key: staging-key\n  prod:\n    endpoint: %s\n    api_key: prod-key\n", endpoint, endpoint)
+	if err := os.WriteFile(os.Getenv(configEnv), []byte(config), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runCLI("get", "a")
+	runCLI("get", "a", "-profile", "prod")
+	runCLI("get", "a", "-profile", "prod", "-api-key", "flag-key")
+	t.Setenv(apiKeyEnv, "env-key")
+	runCLI("get", "a")
+
+	expected := []string{"staging-key", "prod-key", "flag-key", "env-key"}
+	if strings.Join(api.apiKeys, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected API keys %v, got %v", expected, api.apiKeys)
+	}
+
+	code, _, stderr := runCLI("get", "a", "-profile", "dev")
+	if code != 1 || !strings.Contains(stderr, `profile "dev" not found`) {
+		t.Fatalf("expected an unknown profile error, got %d: %s", code, stderr)
+	}
+}
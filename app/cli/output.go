@@ -0,0 +1,85 @@
+package main
+
+import (
+	"device/business/device"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// validFormat reports whether format is an output format
+func validFormat(format string) bool {
+	return format == formatTable || format == formatJSON || format == formatYAML
+}
+
+// printDevices writes devices to w in format
+func printDevices(w io.Writer, format string, devices []device.Device) error {
+	if devices == nil {
+		devices = []device.Device{}
+	}
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(devices)
+	case formatYAML:
+		return printYAML(w, devices)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tBRAND\tSTATUS\tLAST SEEN\tCREATED AT")
+		for _, d := range devices {
+			lastSeen := "-"
+			if d.LastSeenAt != nil {
+				lastSeen = d.LastSeenAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Name, d.Brand, d.Status, lastSeen, d.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	}
+}
+
+// printDevice writes a single device to w in format
+func printDevice(w io.Writer, format string, d device.Device) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case formatYAML:
+		return printYAML(w, d)
+	default:
+		return printDevices(w, format, []device.Device{d})
+	}
+}
+
+// printYAML writes v as YAML under the keys of its JSON encoding, since the
+// API types only have JSON tags
+func printYAML(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return fmt.Errorf("enc.Encode: %w", err)
+	}
+	return enc.Close()
+}
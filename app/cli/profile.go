@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables overriding the profile
+const (
+	configEnv   = "DEVICECTL_CONFIG"
+	profileEnv  = "DEVICECTL_PROFILE"
+	endpointEnv = "DEVICECTL_ENDPOINT"
+	apiKeyEnv   = "DEVICECTL_API_KEY"
+)
+
+const (
+	defaultProfile  = "default"
+	defaultEndpoint = "http://localhost:8080"
+)
+
+// Profile is where and as whom devicectl calls the API
+type Profile struct {
+	Endpoint string `yaml:"endpoint"`
+	APIKey   string `yaml:"api_key"`
+}
+
+// profiles is the devicectl config file
+type profiles struct {
+	// Current is the profile used when none is given
+	Current  string             `yaml:"current"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// configPath returns the path of the config file
+func configPath() (string, error) {
+	if path := os.Getenv(configEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserConfigDir: %w", err)
+	}
+	return filepath.Join(dir, "devicectl", "config.yaml"), nil
+}
+
+// loadProfile returns the profile named name, or the current one if name is
+// empty, with the environment applied on top. A missing config file is not an
+// error unless a profile was asked for.
+func loadProfile(name string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv(profileEnv)
+	}
+
+	path, err := configPath()
+	if err != nil {
+		return Profile{}, err
+	}
+	var cfg profiles
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && name == "":
+	case err != nil:
+		return Profile{}, fmt.Errorf("os.ReadFile: %w", err)
+	default:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return Profile{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	explicit := name != ""
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		name = defaultProfile
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok && explicit {
+		return Profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+
+	if endpoint := os.Getenv(endpointEnv); endpoint != "" {
+		p.Endpoint = endpoint
+	}
+	if key := os.Getenv(apiKeyEnv); key != "" {
+		p.APIKey = key
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = defaultEndpoint
+	}
+	return p, nil
+}
@@ -0,0 +1,269 @@
+package command
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/database"
+	"device/pkg/tracing"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxWait is the longest a poll waits for commands. The poll handler
+	// extends the write deadline of the server to cover it.
+	MaxWait = 20 * time.Second
+	// pollBatchSize is the most commands a poll delivers at once
+	pollBatchSize = 10
+	// deliverBatchSize is the most commands DeliverPending delivers at once
+	deliverBatchSize = 100
+	// recheckInterval is how often a waiting poll checks the store, for the
+	// commands enqueued through other instances
+	recheckInterval = 2 * time.Second
+)
+
+// Store is an interface to interact with the database
+type Store interface {
+	Create(ctx context.Context, c Command) error
+	// ByID returns the command id of the device deviceID
+	ByID(ctx context.Context, deviceID, id string) (Command, error)
+	// Deliver marks at most limit queued commands of the devices that have
+	// not expired at now delivered, oldest first, and returns them
+	Deliver(ctx context.Context, deviceIDs []string, now time.Time, limit int) ([]Command, error)
+	// Complete records the outcome of a delivered command that has not expired
+	// at at. It fails with ErrNotDelivered for commands in any other status.
+	Complete(ctx context.Context, deviceID, id string, ack Ack, at time.Time) (Command, error)
+	// History returns the commands of the device, newest first
+	History(ctx context.Context, deviceID string, offset, limit int) ([]Command, error)
+	// Expire marks at most limit queued or delivered commands that expired at
+	// now expired and returns how many it marked
+	Expire(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+// Devices looks up the devices commands are sent to
+type Devices interface {
+	GetByID(ctx context.Context, id string) (device.Device, error)
+}
+
+// Business is the business logic for device commands
+type Business struct {
+	store      Store
+	devices    Devices
+	defaultTTL time.Duration
+	waiters    *waiters
+	now        func() time.Time
+}
+
+// NewBusiness creates a new business logic for device commands. Commands
+// without a TTL of their own expire after defaultTTL.
+func NewBusiness(store Store, devices Devices, defaultTTL time.Duration) *Business {
+	return &Business{
+		store:      store,
+		devices:    devices,
+		defaultTTL: defaultTTL,
+		waiters:    newWaiters(),
+		now:        time.Now,
+	}
+}
+
+// Enqueue queues a valid command for the device id and wakes up its polls
+func (b *Business) Enqueue(ctx context.Context, id string, cc CreateCommand) (_ Command, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.Enqueue")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return Command{}, fmt.Errorf("devices.GetByID: %w", err)
+	}
+
+	c := cc.toCommand(id, b.now().UTC(), b.defaultTTL)
+	if err := b.store.Create(ctx, c); err != nil {
+		return Command{}, fmt.Errorf("store.Create: %w", err)
+	}
+	// within a transaction, the polls could not deliver the command before it commits
+	database.AfterCommit(ctx, func() { b.waiters.notify(id) })
+	return c, nil
+}
+
+// Poll delivers the pending commands of the device id. When there are none,
+// it waits up to wait, at most MaxWait, for commands to be enqueued.
+func (b *Business) Poll(ctx context.Context, id string, wait time.Duration) (_ []Command, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.Poll")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return nil, fmt.Errorf("devices.GetByID: %w", err)
+	}
+
+	deadline := b.now().Add(min(wait, MaxWait))
+	for {
+		// waiting starts before delivering, so commands enqueued in between wake the poll up
+		enqueued, stop := b.waiters.wait(id)
+		commands, err := b.store.Deliver(ctx, []string{id}, b.now().UTC(), pollBatchSize)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("store.Deliver: %w", err)
+		}
+		remaining := deadline.Sub(b.now())
+		if len(commands) > 0 || remaining <= 0 {
+			stop()
+			if commands == nil {
+				commands = []Command{}
+			}
+			return commands, nil
+		}
+
+		timer := time.NewTimer(min(remaining, recheckInterval))
+		select {
+		case <-enqueued:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		stop()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// DeliverPending delivers the pending commands of the devices ids at once,
+// without waiting for more. Callers waiting for the devices should deliver
+// again when Enqueued is closed, and now and then for the commands enqueued
+// through other instances.
+func (b *Business) DeliverPending(ctx context.Context, ids []string) (_ []Command, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.DeliverPending")
+	defer func() { tracing.End(span, err) }()
+
+	commands, err := b.store.Deliver(ctx, ids, b.now().UTC(), deliverBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("store.Deliver: %w", err)
+	}
+	return commands, nil
+}
+
+// Enqueued returns a channel closed once a command is next enqueued through
+// this instance, for any device
+func (b *Business) Enqueued() <-chan struct{} {
+	return b.waiters.waitAny()
+}
+
+// Ack records the outcome of a command the device id was delivered
+func (b *Business) Ack(ctx context.Context, id, commandID string, ack Ack) (_ Command, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.Ack")
+	defer func() { tracing.End(span, err) }()
+
+	ack.Result = documentOrNil(ack.Result)
+	c, err := b.store.Complete(ctx, id, commandID, ack, b.now().UTC())
+	if err != nil {
+		return Command{}, fmt.Errorf("store.Complete: %w", err)
+	}
+	return c, nil
+}
+
+// GetByID returns the command commandID of the device id
+func (b *Business) GetByID(ctx context.Context, id, commandID string) (_ Command, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.GetByID")
+	defer func() { tracing.End(span, err) }()
+
+	c, err := b.store.ByID(ctx, id, commandID)
+	if err != nil {
+		return Command{}, fmt.Errorf("store.ByID: %w", err)
+	}
+	return c, nil
+}
+
+// History returns the commands of the device id, newest first
+func (b *Business) History(ctx context.Context, id string, offset, limit int) (_ []Command, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.History")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return nil, fmt.Errorf("devices.GetByID: %w", err)
+	}
+	commands, err := b.store.History(ctx, id, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.History: %w", err)
+	}
+	return commands, nil
+}
+
+// Expire marks at most limit commands whose TTL ran out expired and returns how many
+func (b *Business) Expire(ctx context.Context, limit int) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "command.Business.Expire")
+	defer func() { tracing.End(span, err) }()
+
+	n, err := b.store.Expire(ctx, b.now().UTC(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("store.Expire: %w", err)
+	}
+	return n, nil
+}
+
+// waiters wakes up the polls of a device when commands are enqueued for it
+type waiters struct {
+	mu    sync.Mutex
+	chans map[string]*waiting
+	// any is closed on the next notification of any device, if waited for
+	any chan struct{}
+}
+
+// waiting is the channel the polls of a device wait on, with how many they are
+type waiting struct {
+	ch    chan struct{}
+	polls int
+}
+
+func newWaiters() *waiters {
+	return &waiters{chans: map[string]*waiting{}}
+}
+
+// wait returns a channel closed on the next notification of the device id,
+// and a function to call once done waiting on it. The channel is dropped when
+// the last poll waiting on it is done, so polls that time out leave nothing behind.
+func (w *waiters) wait(id string) (<-chan struct{}, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt, ok := w.chans[id]
+	if !ok {
+		wt = &waiting{ch: make(chan struct{})}
+		w.chans[id] = wt
+	}
+	wt.polls++
+
+	var once sync.Once
+	return wt.ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			// a notification may have dropped the channel, or replaced it
+			if wt.polls--; wt.polls == 0 && w.chans[id] == wt {
+				delete(w.chans, id)
+			}
+		})
+	}
+}
+
+// waitAny returns a channel closed on the next notification of any device
+func (w *waiters) waitAny() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.any == nil {
+		w.any = make(chan struct{})
+	}
+	return w.any
+}
+
+// notify wakes up the polls waiting for the device id
+func (w *waiters) notify(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if wt, ok := w.chans[id]; ok {
+		close(wt.ch)
+		delete(w.chans, id)
+	}
+	if w.any != nil {
+		close(w.any)
+		w.any = nil
+	}
+}
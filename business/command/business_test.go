@@ -0,0 +1,331 @@
+package command_test
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/command/store/mocks"
+	"device/business/device"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// devicesMock knows the devices of its set
+type devicesMock map[string]bool
+
+func (d devicesMock) GetByID(_ context.Context, id string) (device.Device, error) {
+	if !d[id] {
+		return device.Device{}, device.ErrNotFound
+	}
+	return device.Device{ID: id}, nil
+}
+
+func TestValidate(t *testing.T) {
+	testTable := map[string]struct {
+		validate    func() error
+		expectedErr []string
+	}{
+		"command": {
+			validate: command.CreateCommand{Name: "reboot", Payload: json.RawMessage(`{"delay": 5}`), TTLSeconds: 60}.Validate,
+		},
+		"command without payload": {
+			validate: command.CreateCommand{Name: "locate", Payload: json.RawMessage(`null`)}.Validate,
+		},
+		"invalid command": {
+			validate: command.CreateCommand{Name: "Factory Reset", Payload: json.RawMessage(`[1]`), TTLSeconds: -1}.Validate,
+			expectedErr: []string{
+				"name must be at most 64 lowercase letters",
+				"payload must be a JSON object",
+				"ttl_seconds must be between 1 and 604800",
+			},
+		},
+		"missing name": {
+			validate:    command.CreateCommand{}.Validate,
+			expectedErr: []string{"name is required"},
+		},
+		"payload too large": {
+			validate:    command.CreateCommand{Name: "wipe", Payload: json.RawMessage(fmt.Sprintf(`{"a": %q}`, strings.Repeat("a", 5000)))}.Validate,
+			expectedErr: []string{"payload must be at most 4096 bytes"},
+		},
+		"ack": {
+			validate: command.Ack{Status: command.StatusFailed, Result: json.RawMessage(`{"error": "busy"}`)}.Validate,
+		},
+		"invalid ack": {
+			validate:    command.Ack{Status: command.StatusExpired, Result: json.RawMessage(`"done"`)}.Validate,
+			expectedErr: []string{"status must be succeeded or failed", "result must be a JSON object"},
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			err := tc.validate()
+			if (err != nil) != (len(tc.expectedErr) > 0) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			for _, msg := range tc.expectedErr {
+				if !strings.Contains(err.Error(), msg) {
+					t.Fatalf("expected %q in %v", msg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	testTable := map[string]struct {
+		id          string
+		cc          command.CreateCommand
+		expectedTTL time.Duration
+		storeErr    error
+		expectedErr error
+	}{
+		"default ttl": {
+			id:          "1",
+			cc:          command.CreateCommand{Name: "reboot"},
+			expectedTTL: time.Hour,
+		},
+		"own ttl": {
+			id:          "1",
+			cc:          command.CreateCommand{Name: "locate", Payload: json.RawMessage(`{"sound": true}`), TTLSeconds: 30},
+			expectedTTL: 30 * time.Second,
+		},
+		"unknown device": {
+			id:          "2",
+			cc:          command.CreateCommand{Name: "reboot"},
+			expectedErr: device.ErrNotFound,
+		},
+		"store error": {
+			id:          "1",
+			cc:          command.CreateCommand{Name: "reboot"},
+			storeErr:    fmt.Errorf("db err"),
+			expectedErr: fmt.Errorf("store.Create: db err"),
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			m.On("Create", mock.Anything, mock.AnythingOfType("command.Command")).Return(tc.storeErr)
+
+			b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+			c, err := b.Enqueue(context.Background(), tc.id, tc.cc)
+			if tc.expectedErr != nil {
+				if err == nil || (!errors.Is(err, tc.expectedErr) && err.Error() != tc.expectedErr.Error()) {
+					t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if c.ID == "" || c.DeviceID != tc.id || c.Name != tc.cc.Name || c.Status != command.StatusQueued {
+				t.Fatalf("unexpected command %+v", c)
+			}
+			if ttl := c.ExpiresAt.Sub(c.CreatedAt); ttl != tc.expectedTTL {
+				t.Fatalf("expected a ttl of %s, got %s", tc.expectedTTL, ttl)
+			}
+		})
+	}
+}
+
+func TestPoll(t *testing.T) {
+	pending := []command.Command{{ID: "c1", DeviceID: "1", Name: "reboot", Status: command.StatusDelivered}}
+
+	t.Run("pending commands", func(t *testing.T) {
+		m := mocks.Store{}
+		m.On("Deliver", mock.Anything, []string{"1"}, mock.AnythingOfType("time.Time"), 10).Return(pending, nil)
+
+		b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+		commands, err := b.Poll(context.Background(), "1", time.Minute)
+		if err != nil || len(commands) != 1 {
+			t.Fatalf("expected the pending command, got %v, %v", commands, err)
+		}
+	})
+
+	t.Run("nothing pending", func(t *testing.T) {
+		m := mocks.Store{}
+		m.On("Deliver", mock.Anything, []string{"1"}, mock.AnythingOfType("time.Time"), 10).Return([]command.Command(nil), nil)
+
+		b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+		commands, err := b.Poll(context.Background(), "1", 0)
+		if err != nil || commands == nil || len(commands) != 0 {
+			t.Fatalf("expected no commands, got %v, %v", commands, err)
+		}
+		m.AssertNumberOfCalls(t, "Deliver", 1)
+	})
+
+	t.Run("woken up by an enqueued command", func(t *testing.T) {
+		polled := make(chan struct{})
+		m := mocks.Store{}
+		m.On("Deliver", mock.Anything, []string{"1"}, mock.AnythingOfType("time.Time"), 10).Run(func(mock.Arguments) {
+			close(polled)
+		}).Return([]command.Command(nil), nil).Once()
+		m.On("Deliver", mock.Anything, []string{"1"}, mock.AnythingOfType("time.Time"), 10).Return(pending, nil).Once()
+		m.On("Create", mock.Anything, mock.AnythingOfType("command.Command")).Return(nil)
+
+		b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+		result := make(chan []command.Command)
+		go func() {
+			commands, _ := b.Poll(context.Background(), "1", command.MaxWait)
+			result <- commands
+		}()
+
+		// enqueue once the poll found nothing
+		<-polled
+		start := time.Now()
+		if _, err := b.Enqueue(context.Background(), "1", command.CreateCommand{Name: "reboot"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		select {
+		case commands := <-result:
+			if len(commands) != 1 {
+				t.Fatalf("expected the enqueued command, got %v", commands)
+			}
+			if time.Since(start) > time.Second {
+				t.Fatalf("expected the poll to wake up on the enqueue, took %s", time.Since(start))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the poll to return")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		m := mocks.Store{}
+		m.On("Deliver", mock.Anything, []string{"1"}, mock.AnythingOfType("time.Time"), 10).Return([]command.Command(nil), nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+		if _, err := b.Poll(ctx, "1", command.MaxWait); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("unknown device", func(t *testing.T) {
+		m := mocks.Store{}
+		b := command.NewBusiness(&m, devicesMock{}, time.Hour)
+		if _, err := b.Poll(context.Background(), "1", 0); !errors.Is(err, device.ErrNotFound) {
+			t.Fatalf("expected %v, got %v", device.ErrNotFound, err)
+		}
+	})
+}
+
+func TestDeliverPending(t *testing.T) {
+	pending := []command.Command{{ID: "c1", DeviceID: "1"}, {ID: "c2", DeviceID: "2"}}
+	m := mocks.Store{}
+	m.On("Deliver", mock.Anything, []string{"1", "2"}, mock.AnythingOfType("time.Time"), 100).Return(pending, nil)
+	m.On("Create", mock.Anything, mock.AnythingOfType("command.Command")).Return(nil)
+	b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+
+	enqueued := b.Enqueued()
+	commands, err := b.DeliverPending(context.Background(), []string{"1", "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected the commands of both devices, got %+v", commands)
+	}
+
+	select {
+	case <-enqueued:
+		t.Fatalf("expected no command enqueued yet")
+	default:
+	}
+	if _, err := b.Enqueue(context.Background(), "1", command.CreateCommand{Name: "reboot"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-enqueued:
+	case <-time.After(time.Second):
+		t.Fatalf("expected enqueuing a command to wake up the waiters of any device")
+	}
+}
+
+func TestAck(t *testing.T) {
+	testTable := map[string]struct {
+		ack         command.Ack
+		expected    command.Ack
+		storeErr    error
+		expectedErr error
+	}{
+		"succeeded": {
+			ack:      command.Ack{Status: command.StatusSucceeded, Result: json.RawMessage(`{"uptime": 3}`)},
+			expected: command.Ack{Status: command.StatusSucceeded, Result: json.RawMessage(`{"uptime": 3}`)},
+		},
+		"null result": {
+			ack:      command.Ack{Status: command.StatusFailed, Result: json.RawMessage(`null`)},
+			expected: command.Ack{Status: command.StatusFailed},
+		},
+		"not delivered": {
+			ack:         command.Ack{Status: command.StatusSucceeded},
+			expected:    command.Ack{Status: command.StatusSucceeded},
+			storeErr:    command.ErrNotDelivered,
+			expectedErr: command.ErrNotDelivered,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			m.On("Complete", mock.Anything, "1", "c1", tc.expected, mock.AnythingOfType("time.Time")).Return(command.Command{ID: "c1"}, tc.storeErr)
+
+			b := command.NewBusiness(&m, devicesMock{"1": true}, time.Hour)
+			_, err := b.Ack(context.Background(), "1", "c1", tc.ack)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExpirer(t *testing.T) {
+	testTable := map[string]struct {
+		batches     []int
+		batchErr    error
+		expected    int
+		expectedErr bool
+	}{
+		"nothing to expire": {
+			batches: []int{0},
+		},
+		"several batches": {
+			batches:  []int{100, 100, 7},
+			expected: 207,
+		},
+		"store error": {
+			batches:     []int{100},
+			batchErr:    fmt.Errorf("db err"),
+			expected:    100,
+			expectedErr: true,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			for _, n := range tc.batches {
+				m.On("Expire", mock.Anything, mock.AnythingOfType("time.Time"), 100).Return(n, nil).Once()
+			}
+			if tc.batchErr != nil {
+				m.On("Expire", mock.Anything, mock.AnythingOfType("time.Time"), 100).Return(0, tc.batchErr).Once()
+			}
+
+			e := command.NewExpirer(command.NewBusiness(&m, devicesMock{}, time.Hour), time.Second)
+			n, err := e.ExpireAll(context.Background())
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if n != tc.expected {
+				t.Fatalf("expected %d commands expired, got %d", tc.expected, n)
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// expireBatchSize is the number of commands the Expirer marks expired per statement
+const expireBatchSize = 100
+
+// Expirer marks expired the commands not acknowledged before their TTL ran out
+type Expirer struct {
+	business  *Business
+	interval  time.Duration
+	batchSize int
+}
+
+// NewExpirer creates a new Expirer instance that looks for expired commands every interval
+func NewExpirer(b *Business, interval time.Duration) *Expirer {
+	return &Expirer{
+		business:  b,
+		interval:  interval,
+		batchSize: expireBatchSize,
+	}
+}
+
+// Run expires commands until ctx is cancelled
+func (e *Expirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.ExpireAll(ctx); err != nil {
+			logrus.WithError(fmt.Errorf("expirer.ExpireAll: %w", err)).Error("unable to expire commands")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireAll marks expired every command whose TTL ran out and returns how many it marked
+func (e *Expirer) ExpireAll(ctx context.Context) (int, error) {
+	var n int
+	for {
+		expired, err := e.business.Expire(ctx, e.batchSize)
+		if err != nil {
+			return n, fmt.Errorf("business.Expire: %w", err)
+		}
+		n += expired
+		if expired < e.batchSize {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxTTL is the longest a command may wait for its device
+	MaxTTL = 7 * 24 * time.Hour
+	// maxNameLength is the longest command name
+	maxNameLength = 64
+	// maxDocumentSize is the largest size of the payload or the result of a command
+	maxDocumentSize = 4 << 10
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrNotDelivered is returned when acknowledging a command that is not
+	// delivered, e.g. one already acknowledged or expired
+	ErrNotDelivered = errors.New("command not delivered")
+)
+
+// commandName is the format of command names, e.g. reboot or factory_reset
+var commandName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Status is the stage of the lifecycle of a command: queued, then delivered
+// when the device polls it, then succeeded or failed when the device
+// acknowledges it. Commands not acknowledged in time expire.
+type Status string
+
+// Statuses
+const (
+	StatusQueued    Status = "queued"
+	StatusDelivered Status = "delivered"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusExpired   Status = "expired"
+)
+
+// Command is an instruction for a device
+type Command struct {
+	ID          string          `json:"id"`
+	DeviceID    string          `json:"device_id"`
+	Name        string          `json:"name"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Status      Status          `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+}
+
+// CreateCommand represents the data needed to enqueue a command. The payload
+// is an optional JSON object; the TTL, in seconds, defaults to the one of the
+// Business.
+type CreateCommand struct {
+	Name       string          `json:"name"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	TTLSeconds int             `json:"ttl_seconds,omitempty"`
+}
+
+// Validate validates the CreateCommand fields
+func (cc CreateCommand) Validate() error {
+	var errs []error
+	switch {
+	case cc.Name == "":
+		errs = append(errs, fmt.Errorf("name is required"))
+	case len(cc.Name) > maxNameLength || !commandName.MatchString(cc.Name):
+		errs = append(errs, fmt.Errorf("name must be at most %d lowercase letters, digits and underscores, starting with a letter", maxNameLength))
+	}
+	if err := validateDocument("payload", cc.Payload); err != nil {
+		errs = append(errs, err)
+	}
+	if cc.TTLSeconds < 0 || time.Duration(cc.TTLSeconds)*time.Second > MaxTTL {
+		errs = append(errs, fmt.Errorf("ttl_seconds must be between 1 and %d", int(MaxTTL/time.Second)))
+	}
+	return errors.Join(errs...)
+}
+
+// toCommand converts a CreateCommand to a Command of the device id, queued at
+// now and expiring after ttl unless cc has its own
+func (cc CreateCommand) toCommand(deviceID string, now time.Time, ttl time.Duration) Command {
+	if cc.TTLSeconds > 0 {
+		ttl = time.Duration(cc.TTLSeconds) * time.Second
+	}
+	return Command{
+		ID:        uuid.NewString(),
+		DeviceID:  deviceID,
+		Name:      cc.Name,
+		Payload:   documentOrNil(cc.Payload),
+		Status:    StatusQueued,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// Ack represents the data a device acknowledges a command with
+type Ack struct {
+	// Status is succeeded or failed
+	Status Status `json:"status"`
+	// Result is an optional JSON object describing the outcome
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Validate validates the Ack fields
+func (a Ack) Validate() error {
+	var errs []error
+	if a.Status != StatusSucceeded && a.Status != StatusFailed {
+		errs = append(errs, fmt.Errorf("status must be succeeded or failed"))
+	}
+	if err := validateDocument("result", a.Result); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validateDocument reports an error when doc is set but is not a JSON object
+// of at most maxDocumentSize bytes
+func validateDocument(name string, doc json.RawMessage) error {
+	if documentOrNil(doc) == nil {
+		return nil
+	}
+	if len(doc) > maxDocumentSize {
+		return fmt.Errorf("%s must be at most %d bytes", name, maxDocumentSize)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return fmt.Errorf("%s must be a JSON object", name)
+	}
+	return nil
+}
+
+// documentOrNil returns nil for documents left out or null
+func documentOrNil(doc json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	return doc
+}
@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"context"
+	"device/business/command"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the command store
+type Store struct {
+	mock.Mock
+}
+
+var _ command.Store = (*Store)(nil)
+
+func (s *Store) Create(ctx context.Context, c command.Command) error {
+	args := s.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (s *Store) ByID(ctx context.Context, deviceID, id string) (command.Command, error) {
+	args := s.Called(ctx, deviceID, id)
+	return args.Get(0).(command.Command), args.Error(1)
+}
+
+func (s *Store) Deliver(ctx context.Context, deviceIDs []string, now time.Time, limit int) ([]command.Command, error) {
+	args := s.Called(ctx, deviceIDs, now, limit)
+	return args.Get(0).([]command.Command), args.Error(1)
+}
+
+func (s *Store) Complete(ctx context.Context, deviceID, id string, ack command.Ack, at time.Time) (command.Command, error) {
+	args := s.Called(ctx, deviceID, id, ack, at)
+	return args.Get(0).(command.Command), args.Error(1)
+}
+
+func (s *Store) History(ctx context.Context, deviceID string, offset, limit int) ([]command.Command, error) {
+	args := s.Called(ctx, deviceID, offset, limit)
+	return args.Get(0).([]command.Command), args.Error(1)
+}
+
+func (s *Store) Expire(ctx context.Context, now time.Time, limit int) (int, error) {
+	args := s.Called(ctx, now, limit)
+	return args.Int(0), args.Error(1)
+}
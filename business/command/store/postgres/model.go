@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"device/business/command"
+	"encoding/json"
+	"time"
+)
+
+// Command represents a device command
+type Command struct {
+	ID          string          `gorm:"primaryKey;column:id"`
+	DeviceID    string          `gorm:"column:device_id;index:idx_device_commands_device,priority:1"`
+	Name        string          `gorm:"column:name"`
+	Payload     json.RawMessage `gorm:"column:payload;type:jsonb"`
+	Status      string          `gorm:"column:status;index:idx_device_commands_expiry,priority:1"`
+	Result      json.RawMessage `gorm:"column:result;type:jsonb"`
+	CreatedAt   time.Time       `gorm:"column:created_at;index:idx_device_commands_device,priority:2"`
+	ExpiresAt   time.Time       `gorm:"column:expires_at;index:idx_device_commands_expiry,priority:2"`
+	DeliveredAt *time.Time      `gorm:"column:delivered_at"`
+	CompletedAt *time.Time      `gorm:"column:completed_at"`
+}
+
+// TableName overrides the default table name
+func (Command) TableName() string {
+	return "device_commands"
+}
+
+// toBusinessCommand converts a Command to a command.Command
+func toBusinessCommand(c Command) command.Command {
+	return command.Command{
+		ID:          c.ID,
+		DeviceID:    c.DeviceID,
+		Name:        c.Name,
+		Payload:     c.Payload,
+		Status:      command.Status(c.Status),
+		Result:      c.Result,
+		CreatedAt:   c.CreatedAt,
+		ExpiresAt:   c.ExpiresAt,
+		DeliveredAt: c.DeliveredAt,
+		CompletedAt: c.CompletedAt,
+	}
+}
+
+// toBusinessCommands converts a slice of Command to a slice of command.Command
+func toBusinessCommands(cs []Command) []command.Command {
+	commands := make([]command.Command, len(cs))
+	for i, c := range cs {
+		commands[i] = toBusinessCommand(c)
+	}
+	return commands
+}
+
+// fromBusinessCommand converts a command.Command to a Command
+func fromBusinessCommand(c command.Command) Command {
+	return Command{
+		ID:          c.ID,
+		DeviceID:    c.DeviceID,
+		Name:        c.Name,
+		Payload:     c.Payload,
+		Status:      string(c.Status),
+		Result:      c.Result,
+		CreatedAt:   c.CreatedAt,
+		ExpiresAt:   c.ExpiresAt,
+		DeliveredAt: c.DeliveredAt,
+		CompletedAt: c.CompletedAt,
+	}
+}
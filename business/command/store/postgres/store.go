@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/pkg/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is a postgres implementation of the command.Store
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements command.Store and device.Dependent
+var (
+	_ command.Store    = (*Store)(nil)
+	_ device.Dependent = (*Store)(nil)
+)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create creates a new command
+func (s *Store) Create(ctx context.Context, c command.Command) error {
+	createData := fromBusinessCommand(c)
+	result := database.Conn(ctx, s.db).Create(&createData)
+	if result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	return nil
+}
+
+// ByID returns the command id of the device deviceID
+func (s *Store) ByID(ctx context.Context, deviceID, id string) (command.Command, error) {
+	var c Command
+	result := database.Conn(ctx, s.db).First(&c, "id = ? AND device_id = ?", id, deviceID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return command.Command{}, command.ErrNotFound
+	}
+	if result.Error != nil {
+		return command.Command{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessCommand(c), nil
+}
+
+// Deliver marks at most limit queued commands of the devices that have not
+// expired at now delivered, oldest first, and returns them. Commands locked
+// by a concurrent poll are skipped, so each is delivered once.
+func (s *Store) Deliver(ctx context.Context, deviceIDs []string, now time.Time, limit int) ([]command.Command, error) {
+	var commands []Command
+	err := database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("device_id IN ? AND status = ? AND expires_at > ?", deviceIDs, string(command.StatusQueued), now).
+			Order("created_at").
+			Limit(limit).
+			Find(&commands)
+		if result.Error != nil {
+			return fmt.Errorf("db.Find: %w", result.Error)
+		}
+		if len(commands) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(commands))
+		for i := range commands {
+			ids[i] = commands[i].ID
+			commands[i].Status = string(command.StatusDelivered)
+			commands[i].DeliveredAt = &now
+		}
+		result = tx.Model(&Command{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       string(command.StatusDelivered),
+			"delivered_at": now,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("db.Updates: %w", result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toBusinessCommands(commands), nil
+}
+
+// Complete records the outcome of a delivered command that has not expired at at
+func (s *Store) Complete(ctx context.Context, deviceID, id string, ack command.Ack, at time.Time) (command.Command, error) {
+	var c Command
+	err := database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&c, "id = ? AND device_id = ?", id, deviceID)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return command.ErrNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+		if c.Status != string(command.StatusDelivered) || !c.ExpiresAt.After(at) {
+			return command.ErrNotDelivered
+		}
+
+		c.Status, c.Result, c.CompletedAt = string(ack.Status), ack.Result, &at
+		result = tx.Model(&c).Select("status", "result", "completed_at").Updates(&c)
+		if result.Error != nil {
+			return fmt.Errorf("db.Updates[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return command.Command{}, err
+	}
+	return toBusinessCommand(c), nil
+}
+
+// History returns the commands of the device, newest first
+func (s *Store) History(ctx context.Context, deviceID string, offset, limit int) ([]command.Command, error) {
+	var commands []Command
+	result := database.Conn(ctx, s.db).
+		Where("device_id = ?", deviceID).
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&commands)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessCommands(commands), nil
+}
+
+// Expire marks at most limit queued or delivered commands that expired at now
+// expired and returns how many it marked
+func (s *Store) Expire(ctx context.Context, now time.Time, limit int) (int, error) {
+	result := database.Conn(ctx, s.db).Exec(`UPDATE device_commands SET status = ?, completed_at = ?
+		WHERE id IN (
+			SELECT id FROM device_commands
+			WHERE status IN ? AND expires_at <= ?
+			LIMIT ? FOR UPDATE SKIP LOCKED
+		)`,
+		string(command.StatusExpired), now,
+		[]string{string(command.StatusQueued), string(command.StatusDelivered)}, now, limit,
+	)
+	if result.Error != nil {
+		return 0, fmt.Errorf("db.Exec: %w", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// DeleteDevice deletes the commands of the device id
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	result := database.Conn(ctx, s.db).Delete(&Command{}, "device_id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+	}
+	return nil
+}
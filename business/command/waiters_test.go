@@ -0,0 +1,83 @@
+package command
+
+import (
+	"context"
+	"device/business/device"
+	"testing"
+	"time"
+)
+
+// emptyStore has no command to deliver
+type emptyStore struct {
+	Store
+}
+
+func (emptyStore) Deliver(context.Context, []string, time.Time, int) ([]Command, error) {
+	return nil, nil
+}
+
+// devices knows every device
+type devices struct{}
+
+func (devices) GetByID(_ context.Context, id string) (device.Device, error) {
+	return device.Device{ID: id}, nil
+}
+
+func TestWaitersTimedOutPolls(t *testing.T) {
+	b := NewBusiness(emptyStore{}, devices{}, time.Hour)
+
+	done := make(chan struct{})
+	for _, id := range []string{"1", "1", "2"} {
+		go func(id string) {
+			if _, err := b.Poll(context.Background(), id, 10*time.Millisecond); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			done <- struct{}{}
+		}(id)
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	b.waiters.mu.Lock()
+	defer b.waiters.mu.Unlock()
+	if len(b.waiters.chans) != 0 {
+		t.Fatalf("expected the polls that timed out to leave no waiter, got %d", len(b.waiters.chans))
+	}
+}
+
+func TestWaitersNotify(t *testing.T) {
+	w := newWaiters()
+	first, stopFirst := w.wait("1")
+	_, stopSecond := w.wait("1")
+
+	// the channel stays while a poll waits on it
+	stopFirst()
+	if len(w.chans) != 1 {
+		t.Fatalf("expected the channel to be kept for the other poll")
+	}
+
+	w.notify("1")
+	select {
+	case <-first:
+	default:
+		t.Fatalf("expected the channel to be closed")
+	}
+
+	// a poll waiting after the notification gets a new channel, which the
+	// older poll must not drop
+	next, stopNext := w.wait("1")
+	stopSecond()
+	if len(w.chans) != 1 {
+		t.Fatalf("expected the new channel to be kept")
+	}
+	stopNext()
+	if len(w.chans) != 0 {
+		t.Fatalf("expected no channel left, got %d", len(w.chans))
+	}
+	select {
+	case <-next:
+		t.Fatalf("expected the new channel to be open")
+	default:
+	}
+}
@@ -2,8 +2,11 @@ package device
 
 import (
 	"context"
+	"device/business/event"
+	"device/pkg/tracing"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -13,43 +16,92 @@ var (
 // Store is an interface to interact with the database
 type Store interface {
 	ByID(ctx context.Context, id string) (Device, error)
+	ByIDs(ctx context.Context, ids []string) ([]Device, error)
 	Create(ctx context.Context, d Device) error
 	Update(ctx context.Context, id string, data UpdateDevice) error
 	GetAll(ctx context.Context, offset, limit int) ([]Device, error)
 	Delete(ctx context.Context, id string) error
 	SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]Device, error)
+	Search(ctx context.Context, f Filter, offset, limit int) ([]Device, error)
+	// RecordHeartbeat marks the device online, records hb as seen at at and
+	// returns the status the device had before
+	RecordHeartbeat(ctx context.Context, id string, hb Heartbeat, at time.Time) (Status, error)
+	// MarkOffline marks at most limit online devices last seen before seenBefore
+	// offline and returns them
+	MarkOffline(ctx context.Context, seenBefore time.Time, limit int) ([]Device, error)
+}
+
+// Dependent holds data of devices that must go away with them
+type Dependent interface {
+	// DeleteDevice deletes the data of the device id. It runs in the
+	// transaction deleting the device, if there is one.
+	DeleteDevice(ctx context.Context, id string) error
 }
 
 // Business is the business logic for the device
 type Business struct {
-	store Store
+	store      Store
+	tx         Transactor
+	outbox     Outbox
+	publisher  event.Publisher
+	dependents []Dependent
 }
 
 // NewBusiness creates a new business logic for the device
-func NewBusiness(store Store) *Business {
-	return &Business{
+func NewBusiness(store Store, opts ...Option) *Business {
+	b := &Business{
 		store: store,
+		tx:    noTx{},
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 // GetByID returns a device by its ID
-func (b *Business) Create(ctx context.Context, cd CreateDevice) (Device, error) {
+func (b *Business) Create(ctx context.Context, cd CreateDevice) (_ Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.Create")
+	defer func() { tracing.End(span, err) }()
+
 	d := cd.toDevice()
-	if err := b.store.Create(ctx, d); err != nil {
-		return Device{}, fmt.Errorf("store.Create: %w", err)
+	err = b.emit(ctx, func(ctx context.Context) (*event.Event, error) {
+		if err := b.store.Create(ctx, d); err != nil {
+			return nil, fmt.Errorf("store.Create: %w", err)
+		}
+		return b.newEvent(EventDeviceCreated, d.ID, DeviceCreated{Device: d})
+	})
+	if err != nil {
+		return Device{}, err
 	}
 	return d, nil
 }
 
 // Update updates a device
-func (b *Business) Update(ctx context.Context, id string, data UpdateDevice) error {
-	if err := b.store.Update(ctx, id, data); err != nil {
-		return fmt.Errorf("store.Update: %w", err)
-	}
-	return nil
+func (b *Business) Update(ctx context.Context, id string, data UpdateDevice) (err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.Update")
+	defer func() { tracing.End(span, err) }()
+
+	return b.emit(ctx, func(ctx context.Context) (*event.Event, error) {
+		if err := b.store.Update(ctx, id, data); err != nil {
+			return nil, fmt.Errorf("store.Update: %w", err)
+		}
+		if !b.eventsEnabled() {
+			return nil, nil
+		}
+
+		d, err := b.store.ByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("store.ByID: %w", err)
+		}
+		return b.newEvent(EventDeviceUpdated, id, DeviceUpdated{Device: d, Changes: data})
+	})
 }
 
-func (b *Business) GetByID(ctx context.Context, id string) (Device, error) {
+func (b *Business) GetByID(ctx context.Context, id string) (_ Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.GetByID")
+	defer func() { tracing.End(span, err) }()
+
 	device, err := b.store.ByID(ctx, id)
 	if err != nil {
 		return Device{}, fmt.Errorf("store.ByID: %w", err)
@@ -57,8 +109,24 @@ func (b *Business) GetByID(ctx context.Context, id string) (Device, error) {
 	return device, nil
 }
 
+// GetByIDs returns the devices with the given IDs. IDs that do not exist are
+// left out, and the order of the result is unspecified.
+func (b *Business) GetByIDs(ctx context.Context, ids []string) (_ []Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.GetByIDs")
+	defer func() { tracing.End(span, err) }()
+
+	devices, err := b.store.ByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("store.ByIDs: %w", err)
+	}
+	return devices, nil
+}
+
 // Getall returns all devices
-func (b *Business) GetAll(ctx context.Context, offset, limit int) ([]Device, error) {
+func (b *Business) GetAll(ctx context.Context, offset, limit int) (_ []Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.GetAll")
+	defer func() { tracing.End(span, err) }()
+
 	devices, err := b.store.GetAll(ctx, offset, limit)
 	if err != nil {
 		return nil, fmt.Errorf("store.GetAll: %w", err)
@@ -67,18 +135,51 @@ func (b *Business) GetAll(ctx context.Context, offset, limit int) ([]Device, err
 }
 
 // Delete deletes a device
-func (b *Business) Delete(ctx context.Context, id string) error {
-	if err := b.store.Delete(ctx, id); err != nil {
-		return fmt.Errorf("store.Delete: %w", err)
-	}
-	return nil
+func (b *Business) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.Delete")
+	defer func() { tracing.End(span, err) }()
+
+	return b.emit(ctx, func(ctx context.Context) (*event.Event, error) {
+		var d Device
+		if b.eventsEnabled() {
+			var err error
+			if d, err = b.store.ByID(ctx, id); err != nil {
+				return nil, fmt.Errorf("store.ByID: %w", err)
+			}
+		}
+
+		if err := b.store.Delete(ctx, id); err != nil {
+			return nil, fmt.Errorf("store.Delete: %w", err)
+		}
+		for _, dep := range b.dependents {
+			if err := dep.DeleteDevice(ctx, id); err != nil {
+				return nil, fmt.Errorf("dependent.DeleteDevice: %w", err)
+			}
+		}
+		return b.newEvent(EventDeviceDeleted, id, DeviceDeleted{Device: d})
+	})
 }
 
 // SearchByBrand returns all devices by a brand
-func (b *Business) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]Device, error) {
+func (b *Business) SearchByBrand(ctx context.Context, brand string, offset, limit int) (_ []Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.SearchByBrand")
+	defer func() { tracing.End(span, err) }()
+
 	devices, err := b.store.SearchByBrand(ctx, brand, offset, limit)
 	if err != nil {
 		return nil, fmt.Errorf("store.SearchByBrand: %w", err)
 	}
 	return devices, nil
 }
+
+// Search returns the devices that match f
+func (b *Business) Search(ctx context.Context, f Filter, offset, limit int) (_ []Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.Search")
+	defer func() { tracing.End(span, err) }()
+
+	devices, err := b.store.Search(ctx, f, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.Search: %w", err)
+	}
+	return devices, nil
+}
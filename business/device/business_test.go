@@ -4,6 +4,8 @@ import (
 	"context"
 	"device/business/device"
 	"device/business/device/store/mocks"
+	"device/business/event"
+	outboxMocks "device/business/outbox/store/mocks"
 	"fmt"
 	"reflect"
 	"testing"
@@ -164,6 +166,49 @@ func TestGetByID(t *testing.T) {
 	}
 }
 
+func TestGetByIDs(t *testing.T) {
+	testTable := map[string]struct {
+		ids         []string
+		dbResponse  []device.Device
+		dbError     error
+		expectedErr error
+	}{
+		"ok": {
+			ids: []string{"1", "2"},
+			dbResponse: []device.Device{
+				{ID: "1", Name: "name1"},
+				{ID: "2", Name: "name2"},
+			},
+		},
+		"error": {
+			ids:         []string{"1"},
+			dbResponse:  nil,
+			dbError:     fmt.Errorf("db err"),
+			expectedErr: fmt.Errorf("store.ByIDs: db err"),
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			m.On("ByIDs", mock.Anything, tc.ids).Return(tc.dbResponse, tc.dbError)
+
+			b := device.NewBusiness(&m)
+			result, err := b.GetByIDs(context.Background(), tc.ids)
+			if (err == nil && tc.expectedErr != nil) || (err != nil && tc.expectedErr == nil) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+
+			if !reflect.DeepEqual(result, tc.dbResponse) {
+				t.Fatalf("expected %v, got %v", tc.dbResponse, result)
+			}
+		})
+	}
+}
+
 func TestGetAll(t *testing.T) {
 	testTable := map[string]struct {
 		offset      int
@@ -224,20 +269,29 @@ func TestGetAll(t *testing.T) {
 
 func TestDelete(t *testing.T) {
 	testTable := map[string]struct {
-		id          string
-		dbResponse  error
-		expectedErr error
+		id                 string
+		dbResponse         error
+		dependentErr       error
+		expectedErr        error
+		expectedDependents int
 	}{
 		"ok": {
-			id:          "1",
-			dbResponse:  nil,
-			expectedErr: nil,
+			id:                 "1",
+			dbResponse:         nil,
+			expectedErr:        nil,
+			expectedDependents: 1,
 		},
 		"not found": {
 			id:          "2",
 			dbResponse:  device.ErrNotFound,
 			expectedErr: fmt.Errorf("store.Delete: %w", device.ErrNotFound),
 		},
+		"dependent error": {
+			id:                 "1",
+			dependentErr:       fmt.Errorf("db err"),
+			expectedErr:        fmt.Errorf("dependent.DeleteDevice: db err"),
+			expectedDependents: 1,
+		},
 	}
 
 	for tn, tc := range testTable {
@@ -245,7 +299,8 @@ func TestDelete(t *testing.T) {
 			m := mocks.Store{}
 			m.On("Delete", mock.Anything, tc.id).Return(tc.dbResponse)
 
-			b := device.NewBusiness(&m)
+			dep := dependentMock{err: tc.dependentErr}
+			b := device.NewBusiness(&m, device.WithDependents(&dep))
 			err := b.Delete(context.Background(), tc.id)
 			if (err == nil && tc.expectedErr != nil) || (err != nil && tc.expectedErr == nil) {
 				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
@@ -253,9 +308,23 @@ func TestDelete(t *testing.T) {
 			if err != nil && err.Error() != tc.expectedErr.Error() {
 				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
 			}
+			if len(dep.deleted) != tc.expectedDependents {
+				t.Fatalf("expected %d dependent deletions, got %v", tc.expectedDependents, dep.deleted)
+			}
 		})
 	}
 }
+
+// dependentMock records the devices it deletes the data of
+type dependentMock struct {
+	deleted []string
+	err     error
+}
+
+func (d *dependentMock) DeleteDevice(_ context.Context, id string) error {
+	d.deleted = append(d.deleted, id)
+	return d.err
+}
 func TestSearchByBrand(t *testing.T) {
 	testTable := map[string]struct {
 		brand       string
@@ -316,3 +385,117 @@ func TestSearchByBrand(t *testing.T) {
 		})
 	}
 }
+
+type txMock struct {
+	calls int
+}
+
+func (tx *txMock) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx.calls++
+	return fn(ctx)
+}
+
+type publisherMock struct {
+	events []event.Event
+}
+
+func (p *publisherMock) Publish(ctx context.Context, e event.Event) error {
+	p.events = append(p.events, e)
+	return nil
+}
+
+func TestEvents(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	testTable := map[string]struct {
+		setup        func(m *mocks.Store)
+		run          func(b *device.Business) error
+		outboxErr    error
+		expectedType string
+		expectedErr  error
+	}{
+		"create": {
+			setup: func(m *mocks.Store) {
+				m.On("Create", mock.Anything, mock.AnythingOfType("device.Device")).Return(nil)
+			},
+			run: func(b *device.Business) error {
+				_, err := b.Create(context.Background(), device.CreateDevice{Name: "name", Brand: "brand"})
+				return err
+			},
+			expectedType: device.EventDeviceCreated,
+		},
+		"update": {
+			setup: func(m *mocks.Store) {
+				m.On("Update", mock.Anything, "1", mock.Anything).Return(nil)
+				m.On("ByID", mock.Anything, "1").Return(device.Device{ID: "1"}, nil)
+			},
+			run: func(b *device.Business) error {
+				return b.Update(context.Background(), "1", device.UpdateDevice{Name: strPtr("new name")})
+			},
+			expectedType: device.EventDeviceUpdated,
+		},
+		"delete": {
+			setup: func(m *mocks.Store) {
+				m.On("ByID", mock.Anything, "1").Return(device.Device{ID: "1"}, nil)
+				m.On("Delete", mock.Anything, "1").Return(nil)
+			},
+			run: func(b *device.Business) error {
+				return b.Delete(context.Background(), "1")
+			},
+			expectedType: device.EventDeviceDeleted,
+		},
+		"outbox error": {
+			setup: func(m *mocks.Store) {
+				m.On("ByID", mock.Anything, "1").Return(device.Device{ID: "1"}, nil)
+				m.On("Delete", mock.Anything, "1").Return(nil)
+			},
+			run: func(b *device.Business) error {
+				return b.Delete(context.Background(), "1")
+			},
+			outboxErr:    fmt.Errorf("db err"),
+			expectedType: device.EventDeviceDeleted,
+			expectedErr:  fmt.Errorf("outbox.Add: db err"),
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			tc.setup(&m)
+
+			o := outboxMocks.Store{}
+			o.On("Add", mock.Anything, mock.MatchedBy(func(events []event.Event) bool {
+				return len(events) == 1 && events[0].Type == tc.expectedType
+			})).Return(tc.outboxErr)
+
+			tx := txMock{}
+			p := publisherMock{}
+			b := device.NewBusiness(&m, device.WithOutbox(&tx, &o), device.WithPublisher(&p))
+			err := tc.run(b)
+			if (err == nil && tc.expectedErr != nil) || (err != nil && tc.expectedErr == nil) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+
+			if tx.calls != 1 {
+				t.Fatalf("expected 1 transaction, got %d", tx.calls)
+			}
+			o.AssertExpectations(t)
+
+			if tc.expectedErr != nil {
+				if len(p.events) != 0 {
+					t.Fatalf("expected no published events, got %d", len(p.events))
+				}
+				return
+			}
+			if len(p.events) != 1 || p.events[0].Type != tc.expectedType {
+				t.Fatalf("expected a published %s event, got %v", tc.expectedType, p.events)
+			}
+			if d, err := device.DeviceFromEvent(p.events[0]); err != nil || d.ID == "" {
+				t.Fatalf("expected a device snapshot, got %v, %v", d, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package device
+
+import (
+	"context"
+	"device/business/event"
+	"device/pkg/database"
+	"device/pkg/logging"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Device event types
+const (
+	EventDeviceCreated = "device.created"
+	EventDeviceUpdated = "device.updated"
+	EventDeviceDeleted = "device.deleted"
+	// EventDeviceStatusChanged is emitted when a device comes online or goes offline
+	EventDeviceStatusChanged = "device.status_changed"
+)
+
+// EventTypes lists every event type emitted for devices
+var EventTypes = []string{EventDeviceCreated, EventDeviceUpdated, EventDeviceDeleted, EventDeviceStatusChanged}
+
+// DeviceCreated is the data of an EventDeviceCreated event
+type DeviceCreated struct {
+	Device Device `json:"device"`
+}
+
+// DeviceUpdated is the data of an EventDeviceUpdated event
+type DeviceUpdated struct {
+	Device  Device       `json:"device"`
+	Changes UpdateDevice `json:"changes"`
+}
+
+// DeviceDeleted is the data of an EventDeviceDeleted event
+type DeviceDeleted struct {
+	Device Device `json:"device"`
+}
+
+// DeviceStatusChanged is the data of an EventDeviceStatusChanged event
+type DeviceStatusChanged struct {
+	Device         Device `json:"device"`
+	PreviousStatus Status `json:"previous_status"`
+}
+
+// DeviceFromEvent returns the device snapshot carried by a device event
+func DeviceFromEvent(e event.Event) (Device, error) {
+	var data struct {
+		Device Device `json:"device"`
+	}
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return Device{}, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return data.Device, nil
+}
+
+// EventFilter returns a filter that keeps device events, and only those of
+// devices of the given brand when brand is set
+func EventFilter(brand string) func(event.Event) bool {
+	return func(e event.Event) bool {
+		switch e.Type {
+		case EventDeviceCreated, EventDeviceUpdated, EventDeviceDeleted, EventDeviceStatusChanged:
+		default:
+			return false
+		}
+		if brand == "" {
+			return true
+		}
+
+		d, err := DeviceFromEvent(e)
+		if err != nil {
+			logrus.WithError(fmt.Errorf("DeviceFromEvent: %w", err)).Error("unable to decode device event")
+			return false
+		}
+		return d.Brand == brand
+	}
+}
+
+// Transactor runs a function inside a database transaction
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Outbox records events for later delivery
+type Outbox interface {
+	Add(ctx context.Context, events ...event.Event) error
+}
+
+// Option configures the Business
+type Option func(*Business)
+
+// WithOutbox records device events in the outbox in the same transaction as the store mutation
+func WithOutbox(tx Transactor, outbox Outbox) Option {
+	return func(b *Business) {
+		b.tx = tx
+		b.outbox = outbox
+	}
+}
+
+// WithPublisher publishes device events to p once the store mutation is committed
+func WithPublisher(p event.Publisher) Option {
+	return func(b *Business) {
+		b.publisher = p
+	}
+}
+
+// WithDependents deletes the data deps hold about a device along with it. The
+// deletion is atomic when the Business has an outbox, whose transaction it shares.
+func WithDependents(deps ...Dependent) Option {
+	return func(b *Business) {
+		b.dependents = append(b.dependents, deps...)
+	}
+}
+
+// noTx runs functions without a transaction
+type noTx struct{}
+
+func (noTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// eventsEnabled reports whether the Business has anywhere to send events
+func (b *Business) eventsEnabled() bool {
+	return b.outbox != nil || b.publisher != nil
+}
+
+// newEvent creates an event, or returns nil when events are disabled
+func (b *Business) newEvent(typ, id string, data interface{}) (*event.Event, error) {
+	if !b.eventsEnabled() {
+		return nil, nil
+	}
+
+	e, err := event.New(typ, id, data)
+	if err != nil {
+		return nil, fmt.Errorf("event.New: %w", err)
+	}
+	return &e, nil
+}
+
+// emit runs fn in a transaction and records the event it returns in the outbox
+// within the same transaction. The event is published once the outermost
+// transaction commits, so a rollback of a caller's transaction hides it too.
+func (b *Business) emit(ctx context.Context, fn func(ctx context.Context) (*event.Event, error)) error {
+	return b.emitAll(ctx, func(ctx context.Context) ([]event.Event, error) {
+		e, err := fn(ctx)
+		if err != nil || e == nil {
+			return nil, err
+		}
+		return []event.Event{*e}, nil
+	})
+}
+
+// emitAll is emit for functions that return any number of events
+func (b *Business) emitAll(ctx context.Context, fn func(ctx context.Context) ([]event.Event, error)) error {
+	return b.tx.WithinTx(ctx, func(ctx context.Context) error {
+		events, err := fn(ctx)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		if b.outbox != nil {
+			if err := b.outbox.Add(ctx, events...); err != nil {
+				return fmt.Errorf("outbox.Add: %w", err)
+			}
+		}
+		if b.publisher != nil {
+			database.AfterCommit(ctx, func() { b.publish(ctx, events) })
+		}
+		return nil
+	})
+}
+
+// publish publishes events to the publisher, logging the failures
+func (b *Business) publish(ctx context.Context, events []event.Event) {
+	for _, e := range events {
+		if err := b.publisher.Publish(ctx, e); err != nil {
+			logging.FromContext(ctx).WithError(fmt.Errorf("publisher.Publish: %w", err)).Error("unable to publish device event")
+		}
+	}
+}
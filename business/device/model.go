@@ -2,23 +2,54 @@ package device
 
 import (
 	"fmt"
+	"net"
+	"regexp"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Status tells whether a device is sending heartbeats
+type Status string
+
+// Device statuses
+const (
+	// StatusUnknown is the status of a device that never sent a heartbeat
+	StatusUnknown Status = "unknown"
+	StatusOnline  Status = "online"
+	StatusOffline Status = "offline"
+)
+
+// Valid reports whether s is a known status
+func (s Status) Valid() bool {
+	switch s {
+	case StatusUnknown, StatusOnline, StatusOffline:
+		return true
+	}
+	return false
+}
+
 // Device represents a device
 type Device struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
 	Brand     string    `json:"brand"`
 	CreatedAt time.Time `json:"created_at"`
+	Status    Status    `json:"status"`
+	// LastSeenAt is the time of the last heartbeat, if any
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	// Heartbeat holds the metadata the device last reported
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+	// Labels are the key/value pairs devices are grouped and targeted by
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // CreateDevice represents the data needed to create a device
 type CreateDevice struct {
-	Name  string `json:"name"`
-	Brand string `json:"brand"`
+	Name   string            `json:"name"`
+	Brand  string            `json:"brand"`
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // Validate validates the CreateDevice fields
@@ -29,7 +60,7 @@ func (cd CreateDevice) Validate() error {
 	if cd.Brand == "" {
 		return fmt.Errorf("brand is required")
 	}
-	return nil
+	return ValidateLabels(cd.Labels)
 }
 
 // toDevice converts a CreateDevice to a Device
@@ -39,6 +70,8 @@ func (cd CreateDevice) toDevice() Device {
 		Name:      cd.Name,
 		Brand:     cd.Brand,
 		CreatedAt: time.Now(),
+		Status:    StatusUnknown,
+		Labels:    cd.Labels,
 	}
 }
 
@@ -46,4 +79,110 @@ func (cd CreateDevice) toDevice() Device {
 type UpdateDevice struct {
 	Name  *string `json:"name,omitempty"`
 	Brand *string `json:"brand,omitempty"`
+	// Labels, if set, replace every label of the device; an empty object
+	// removes them all
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Validate validates the UpdateDevice fields
+func (ud UpdateDevice) Validate() error {
+	return ValidateLabels(ud.Labels)
+}
+
+// labelKey is the format of label keys, e.g. region or env.tier
+var labelKey = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+
+const (
+	// maxLabels is the number of labels a device may have
+	maxLabels = 32
+	// maxLabelLength bounds label keys and values
+	maxLabelLength = 63
+)
+
+// ValidateLabels reports an error when labels has too many entries, or a
+// key or value that is not valid
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("labels must be at most %d", maxLabels)
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(k) > maxLabelLength || !labelKey.MatchString(k) {
+			return fmt.Errorf("label %q must be at most %d lowercase letters, digits, dots, dashes and underscores", k, maxLabelLength)
+		}
+		if len(labels[k]) > maxLabelLength {
+			return fmt.Errorf("the value of label %q must be at most %d characters", k, maxLabelLength)
+		}
+	}
+	return nil
+}
+
+// Heartbeat is the metadata a device reports with a heartbeat. Every field is
+// optional, and the ones left empty keep their previously reported value.
+type Heartbeat struct {
+	IP            string `json:"ip,omitempty"`
+	Firmware      string `json:"firmware,omitempty"`
+	UptimeSeconds int64  `json:"uptime_seconds,omitempty"`
+}
+
+// Validate validates the Heartbeat fields
+func (hb Heartbeat) Validate() error {
+	if hb.IP != "" && net.ParseIP(hb.IP) == nil {
+		return fmt.Errorf("ip is not a valid IP address")
+	}
+	if len(hb.Firmware) > 64 {
+		return fmt.Errorf("firmware must be at most 64 characters")
+	}
+	if hb.UptimeSeconds < 0 {
+		return fmt.Errorf("uptime_seconds must not be negative")
+	}
+	return nil
+}
+
+// Filter selects devices. Empty fields match every device.
+type Filter struct {
+	Brand  string
+	Status Status
+	// LastSeenAfter and LastSeenBefore bound the time of the last heartbeat,
+	// which leaves out the devices that never sent one
+	LastSeenAfter  *time.Time
+	LastSeenBefore *time.Time
+	// Labels selects the devices that have every one of these labels
+	Labels map[string]string
+}
+
+// Validate validates the Filter fields
+func (f Filter) Validate() error {
+	if f.Status != "" && !f.Status.Valid() {
+		return fmt.Errorf("status must be one of unknown, online or offline")
+	}
+	if f.LastSeenAfter != nil && f.LastSeenBefore != nil && !f.LastSeenAfter.Before(*f.LastSeenBefore) {
+		return fmt.Errorf("last_seen_after must be before last_seen_before")
+	}
+	return ValidateLabels(f.Labels)
+}
+
+// Matches reports whether d matches f
+func (f Filter) Matches(d Device) bool {
+	if f.Brand != "" && d.Brand != f.Brand || f.Status != "" && d.Status != f.Status {
+		return false
+	}
+	if f.LastSeenAfter != nil || f.LastSeenBefore != nil {
+		if d.LastSeenAt == nil ||
+			f.LastSeenAfter != nil && d.LastSeenAt.Before(*f.LastSeenAfter) ||
+			f.LastSeenBefore != nil && !d.LastSeenAt.Before(*f.LastSeenBefore) {
+			return false
+		}
+	}
+	for k, v := range f.Labels {
+		if l, ok := d.Labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,128 @@
+package device
+
+import (
+	"context"
+	"device/business/event"
+	"device/pkg/tracing"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// statusBatchSize is the number of devices the StatusEvaluator marks offline per transaction
+const statusBatchSize = 100
+
+// Heartbeat records that the device id is alive, along with the metadata in
+// hb. A device that was not online comes online with a status change event.
+func (b *Business) Heartbeat(ctx context.Context, id string, hb Heartbeat) (err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.Heartbeat")
+	defer func() { tracing.End(span, err) }()
+
+	at := time.Now()
+	return b.emit(ctx, func(ctx context.Context) (*event.Event, error) {
+		previous, err := b.store.RecordHeartbeat(ctx, id, hb, at)
+		if err != nil {
+			return nil, fmt.Errorf("store.RecordHeartbeat: %w", err)
+		}
+		if previous == StatusOnline || !b.eventsEnabled() {
+			return nil, nil
+		}
+
+		d, err := b.store.ByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("store.ByID: %w", err)
+		}
+		return b.newEvent(EventDeviceStatusChanged, id, DeviceStatusChanged{Device: d, PreviousStatus: previous})
+	})
+}
+
+// MarkOffline marks at most limit online devices whose last heartbeat is
+// older than seenBefore offline, with a status change event each, and
+// returns them
+func (b *Business) MarkOffline(ctx context.Context, seenBefore time.Time, limit int) (_ []Device, err error) {
+	ctx, span := tracing.Start(ctx, "device.Business.MarkOffline")
+	defer func() { tracing.End(span, err) }()
+
+	var devices []Device
+	err = b.emitAll(ctx, func(ctx context.Context) ([]event.Event, error) {
+		var err error
+		if devices, err = b.store.MarkOffline(ctx, seenBefore, limit); err != nil {
+			return nil, fmt.Errorf("store.MarkOffline: %w", err)
+		}
+
+		var events []event.Event
+		for _, d := range devices {
+			e, err := b.newEvent(EventDeviceStatusChanged, d.ID, DeviceStatusChanged{Device: d, PreviousStatus: StatusOnline})
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				events = append(events, *e)
+			}
+		}
+		return events, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// StatusEvaluator marks offline the devices that stopped sending heartbeats
+// for longer than a threshold
+type StatusEvaluator struct {
+	business  *Business
+	threshold time.Duration
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+// NewStatusEvaluator creates a new StatusEvaluator instance that looks for
+// silent devices every interval
+func NewStatusEvaluator(b *Business, threshold, interval time.Duration) *StatusEvaluator {
+	return &StatusEvaluator{
+		business:  b,
+		threshold: threshold,
+		interval:  interval,
+		batchSize: statusBatchSize,
+		now:       time.Now,
+	}
+}
+
+// Run evaluates the status of the devices until ctx is cancelled
+func (e *StatusEvaluator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.Evaluate(ctx); err != nil {
+			logrus.WithError(fmt.Errorf("evaluator.Evaluate: %w", err)).Error("unable to mark devices offline")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate marks offline every online device last seen more than the
+// threshold ago and returns how many it marked
+func (e *StatusEvaluator) Evaluate(ctx context.Context) (int, error) {
+	seenBefore := e.now().Add(-e.threshold)
+
+	var n int
+	for {
+		devices, err := e.business.MarkOffline(ctx, seenBefore, e.batchSize)
+		if err != nil {
+			return n, fmt.Errorf("business.MarkOffline: %w", err)
+		}
+		n += len(devices)
+		if len(devices) < e.batchSize {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package device_test
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/device/store/mocks"
+	"device/business/event"
+	outboxMocks "device/business/outbox/store/mocks"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHeartbeat(t *testing.T) {
+	testTable := map[string]struct {
+		previous       device.Status
+		storeErr       error
+		expectedEvents int
+		expectedErr    error
+	}{
+		"first heartbeat": {
+			previous:       device.StatusUnknown,
+			expectedEvents: 1,
+		},
+		"back online": {
+			previous:       device.StatusOffline,
+			expectedEvents: 1,
+		},
+		"already online": {
+			previous: device.StatusOnline,
+		},
+		"not found": {
+			storeErr:    device.ErrNotFound,
+			expectedErr: device.ErrNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			hb := device.Heartbeat{IP: "10.0.0.7", Firmware: "1.4.2"}
+			m := mocks.Store{}
+			m.On("RecordHeartbeat", mock.Anything, "1", hb, mock.AnythingOfType("time.Time")).Return(tc.previous, tc.storeErr)
+			m.On("ByID", mock.Anything, "1").Return(device.Device{ID: "1", Status: device.StatusOnline}, nil)
+
+			o := outboxMocks.Store{}
+			o.On("Add", mock.Anything, mock.Anything).Return(nil)
+
+			p := publisherMock{}
+			b := device.NewBusiness(&m, device.WithOutbox(&txMock{}, &o), device.WithPublisher(&p))
+			err := b.Heartbeat(context.Background(), "1", hb)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+
+			if len(p.events) != tc.expectedEvents {
+				t.Fatalf("expected %d events, got %d", tc.expectedEvents, len(p.events))
+			}
+			if tc.expectedEvents == 0 {
+				o.AssertNotCalled(t, "Add", mock.Anything, mock.Anything)
+				return
+			}
+			if p.events[0].Type != device.EventDeviceStatusChanged {
+				t.Fatalf("expected a %s event, got %s", device.EventDeviceStatusChanged, p.events[0].Type)
+			}
+			if d, err := device.DeviceFromEvent(p.events[0]); err != nil || d.Status != device.StatusOnline {
+				t.Fatalf("expected an online device, got %v, %v", d, err)
+			}
+		})
+	}
+}
+
+func TestMarkOffline(t *testing.T) {
+	seenBefore := time.Now()
+	devices := []device.Device{
+		{ID: "1", Brand: "acme", Status: device.StatusOffline},
+		{ID: "2", Brand: "acme", Status: device.StatusOffline},
+	}
+
+	m := mocks.Store{}
+	m.On("MarkOffline", mock.Anything, seenBefore, 10).Return(devices, nil)
+
+	o := outboxMocks.Store{}
+	o.On("Add", mock.Anything, mock.MatchedBy(func(events []event.Event) bool {
+		return len(events) == 2
+	})).Return(nil)
+
+	tx := txMock{}
+	p := publisherMock{}
+	b := device.NewBusiness(&m, device.WithOutbox(&tx, &o), device.WithPublisher(&p))
+	got, err := b.MarkOffline(context.Background(), seenBefore, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(got))
+	}
+	if tx.calls != 1 {
+		t.Fatalf("expected 1 transaction, got %d", tx.calls)
+	}
+	o.AssertExpectations(t)
+
+	if len(p.events) != 2 {
+		t.Fatalf("expected 2 published events, got %d", len(p.events))
+	}
+	for i, e := range p.events {
+		if e.Type != device.EventDeviceStatusChanged || e.AggregateID != devices[i].ID {
+			t.Fatalf("expected a %s event of device %s, got %+v", device.EventDeviceStatusChanged, devices[i].ID, e)
+		}
+		if !device.EventFilter("acme")(e) {
+			t.Fatalf("expected the event to pass the brand filter")
+		}
+	}
+}
+
+func TestStatusEvaluator(t *testing.T) {
+	full := make([]device.Device, 100)
+	for i := range full {
+		full[i] = device.Device{ID: fmt.Sprint(i), Status: device.StatusOffline}
+	}
+
+	testTable := map[string]struct {
+		batches     [][]device.Device
+		batchErr    error
+		expected    int
+		expectedErr bool
+	}{
+		"nothing to mark": {
+			batches: [][]device.Device{{}},
+		},
+		"several batches": {
+			batches:  [][]device.Device{full, full, full[:3]},
+			expected: 203,
+		},
+		"store error": {
+			batches:     [][]device.Device{full},
+			batchErr:    fmt.Errorf("db err"),
+			expected:    100,
+			expectedErr: true,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			seenBefore := mock.MatchedBy(func(before time.Time) bool {
+				// the threshold is subtracted from the time of the evaluation
+				return time.Since(before) >= time.Minute && time.Since(before) < 2*time.Minute
+			})
+			for _, batch := range tc.batches {
+				m.On("MarkOffline", mock.Anything, seenBefore, 100).Return(batch, nil).Once()
+			}
+			if tc.batchErr != nil {
+				m.On("MarkOffline", mock.Anything, seenBefore, 100).Return([]device.Device(nil), tc.batchErr).Once()
+			}
+
+			e := device.NewStatusEvaluator(device.NewBusiness(&m), time.Minute, time.Second)
+			n, err := e.Evaluate(context.Background())
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if n != tc.expected {
+				t.Fatalf("expected %d devices marked offline, got %d", tc.expected, n)
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"container/list"
+	"device/business/device"
+	"time"
+)
+
+// entry is a cached device and when it expires
+type entry struct {
+	id        string
+	device    device.Device
+	expiresAt time.Time
+}
+
+// lru is a fixed size least recently used map of devices. It is not safe
+// for concurrent use.
+type lru struct {
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+// newLRU creates a new lru holding at most size devices
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// get returns the device cached under id unless it expired at now
+func (c *lru) get(id string, now time.Time) (device.Device, bool) {
+	el, ok := c.items[id]
+	if !ok {
+		return device.Device{}, false
+	}
+
+	e := el.Value.(*entry)
+	if !now.Before(e.expiresAt) {
+		c.remove(el)
+		return device.Device{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.device, true
+}
+
+// add caches d until expiresAt and reports whether it evicted another device
+func (c *lru) add(d device.Device, expiresAt time.Time) bool {
+	if el, ok := c.items[d.ID]; ok {
+		e := el.Value.(*entry)
+		e.device, e.expiresAt = d, expiresAt
+		c.order.MoveToFront(el)
+		return false
+	}
+
+	c.items[d.ID] = c.order.PushFront(&entry{id: d.ID, device: d, expiresAt: expiresAt})
+	if c.order.Len() <= c.size {
+		return false
+	}
+	c.remove(c.order.Back())
+	return true
+}
+
+// delete removes the device cached under id
+func (c *lru) delete(id string) {
+	if el, ok := c.items[id]; ok {
+		c.remove(el)
+	}
+}
+
+// len returns the number of cached devices, expired ones included
+func (c *lru) len() int {
+	return c.order.Len()
+}
+
+func (c *lru) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry).id)
+}
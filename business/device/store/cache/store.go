@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/database"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// Stats are the counters of a Store
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// Store is a device.Store that caches devices by ID in a bounded LRU.
+//
+// Concurrent misses on the same ID share one load. Devices are invalidated
+// once the transaction that updated or deleted them committed, and a load
+// that raced with an invalidation of its device is not cached, so the cache never holds a
+// device older than the last committed write. Loads read from the primary
+// so a lagging replica cannot refill the cache with stale devices.
+// Invalidation is local to the process: other instances see a write once
+// their entry expired.
+type Store struct {
+	next  device.Store
+	ttl   time.Duration
+	now   func() time.Time
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries *lru
+	// loading holds the IDs being loaded, so an invalidation only keeps the
+	// loads of its own device from being cached
+	loading map[string]*loading
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+var _ device.Store = (*Store)(nil)
+
+// NewStore creates a new Store instance around next caching at most size
+// devices for ttl each
+func NewStore(next device.Store, size int, ttl time.Duration) *Store {
+	return &Store{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: newLRU(size),
+		loading: make(map[string]*loading),
+	}
+}
+
+// loading tracks the loads in flight of one device
+type loading struct {
+	// generation changes on every invalidation of the device
+	generation uint64
+	loads      int
+}
+
+// Stats returns the counters of the cache
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	entries := s.entries.len()
+	s.mu.Unlock()
+
+	return Stats{
+		Hits:      s.hits.Load(),
+		Misses:    s.misses.Load(),
+		Evictions: s.evictions.Load(),
+		Entries:   entries,
+	}
+}
+
+// Register registers the counters of the cache on reg
+func (s *Store) Register(reg prometheus.Registerer) {
+	reg.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "device_cache_hits_total",
+			Help: "Number of devices served from the cache.",
+		}, func() float64 { return float64(s.hits.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "device_cache_misses_total",
+			Help: "Number of devices loaded from the store.",
+		}, func() float64 { return float64(s.misses.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "device_cache_evictions_total",
+			Help: "Number of devices evicted to make room for others.",
+		}, func() float64 { return float64(s.evictions.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "device_cache_entries",
+			Help: "Number of devices in the cache.",
+		}, func() float64 { return float64(s.Stats().Entries) }),
+	)
+}
+
+func (s *Store) ByID(ctx context.Context, id string) (device.Device, error) {
+	// a transaction may see its own uncommitted writes, which must not be cached
+	if database.InTx(ctx) {
+		return s.next.ByID(ctx, id)
+	}
+
+	s.mu.Lock()
+	d, ok := s.entries.get(id, s.now())
+	s.mu.Unlock()
+	if ok {
+		s.hits.Add(1)
+		return d, nil
+	}
+	s.misses.Add(1)
+
+	// the load is shared, so it must not be cancelled by the caller that started it
+	ch := s.group.DoChan(id, func() (interface{}, error) {
+		generations := s.begin(id)
+		d, err := s.next.ByID(database.ReadPrimary(context.WithoutCancel(ctx)), id)
+		if err != nil {
+			s.add(generations)
+			return device.Device{}, err
+		}
+		s.add(generations, d)
+		return d, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return device.Device{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return device.Device{}, res.Err
+		}
+		return res.Val.(device.Device), nil
+	}
+}
+
+func (s *Store) ByIDs(ctx context.Context, ids []string) ([]device.Device, error) {
+	if database.InTx(ctx) {
+		return s.next.ByIDs(ctx, ids)
+	}
+
+	var (
+		devices []device.Device
+		missing []string
+	)
+	s.mu.Lock()
+	now := s.now()
+	for _, id := range ids {
+		if d, ok := s.entries.get(id, now); ok {
+			devices = append(devices, d)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	s.mu.Unlock()
+
+	s.hits.Add(uint64(len(devices)))
+	if len(missing) == 0 {
+		return devices, nil
+	}
+	s.misses.Add(uint64(len(missing)))
+
+	generations := s.begin(missing...)
+	loaded, err := s.next.ByIDs(database.ReadPrimary(ctx), missing)
+	if err != nil {
+		s.add(generations)
+		return nil, fmt.Errorf("next.ByIDs: %w", err)
+	}
+	s.add(generations, loaded...)
+	return append(devices, loaded...), nil
+}
+
+func (s *Store) Create(ctx context.Context, d device.Device) error {
+	return s.next.Create(ctx, d)
+}
+
+func (s *Store) Update(ctx context.Context, id string, data device.UpdateDevice) error {
+	if err := s.next.Update(ctx, id, data); err != nil {
+		return err
+	}
+	database.AfterCommit(ctx, func() { s.invalidate(id) })
+	return nil
+}
+
+func (s *Store) GetAll(ctx context.Context, offset, limit int) ([]device.Device, error) {
+	return s.next.GetAll(ctx, offset, limit)
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	if err := s.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	database.AfterCommit(ctx, func() { s.invalidate(id) })
+	return nil
+}
+
+func (s *Store) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error) {
+	return s.next.SearchByBrand(ctx, brand, offset, limit)
+}
+
+func (s *Store) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	return s.next.Search(ctx, f, offset, limit)
+}
+
+func (s *Store) RecordHeartbeat(ctx context.Context, id string, hb device.Heartbeat, at time.Time) (device.Status, error) {
+	previous, err := s.next.RecordHeartbeat(ctx, id, hb, at)
+	if err != nil {
+		return "", err
+	}
+	database.AfterCommit(ctx, func() { s.invalidate(id) })
+	return previous, nil
+}
+
+func (s *Store) MarkOffline(ctx context.Context, seenBefore time.Time, limit int) ([]device.Device, error) {
+	devices, err := s.next.MarkOffline(ctx, seenBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	database.AfterCommit(ctx, func() {
+		for _, d := range devices {
+			s.invalidate(d.ID)
+		}
+	})
+	return devices, nil
+}
+
+// begin registers loads of ids and returns the generation of each, to be
+// passed to add once they are loaded
+func (s *Store) begin(ids ...string) map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	generations := make(map[string]uint64, len(ids))
+	for _, id := range ids {
+		if _, ok := generations[id]; ok {
+			continue
+		}
+		l, ok := s.loading[id]
+		if !ok {
+			l = &loading{}
+			s.loading[id] = l
+		}
+		l.loads++
+		generations[id] = l.generation
+	}
+	return generations
+}
+
+// add ends the loads begin registered and caches the devices loaded, except
+// those invalidated since the load began
+func (s *Store) add(generations map[string]uint64, devices ...device.Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := s.now().Add(s.ttl)
+	for _, d := range devices {
+		generation, ok := generations[d.ID]
+		if !ok || s.loading[d.ID].generation != generation {
+			continue
+		}
+		if s.entries.add(d, expiresAt) {
+			s.evictions.Add(1)
+		}
+	}
+
+	for id := range generations {
+		l := s.loading[id]
+		if l.loads--; l.loads == 0 {
+			delete(s.loading, id)
+		}
+	}
+}
+
+// invalidate drops the device id and keeps its in-flight loads from caching it
+func (s *Store) invalidate(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries.delete(id)
+	if l, ok := s.loading[id]; ok {
+		l.generation++
+	}
+	// later misses must not join a load that may have read the old device
+	s.group.Forget(id)
+}
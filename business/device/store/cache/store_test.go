@@ -0,0 +1,366 @@
+package cache
+
+import (
+	"context"
+	"device/business/device"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory device.Store counting its ByID calls
+type fakeStore struct {
+	device.Store
+	mu      sync.Mutex
+	devices map[string]device.Device
+	calls   atomic.Int64
+	// block, if set, holds ByID until it is closed
+	block chan struct{}
+}
+
+func newFakeStore(devices ...device.Device) *fakeStore {
+	s := &fakeStore{devices: map[string]device.Device{}}
+	for _, d := range devices {
+		s.devices[d.ID] = d
+	}
+	return s
+}
+
+func (s *fakeStore) ByID(_ context.Context, id string) (device.Device, error) {
+	s.calls.Add(1)
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mu.Lock()
+	d, ok := s.devices[id]
+	s.mu.Unlock()
+	// let writers run between the read and the caching of its result
+	runtime.Gosched()
+	if !ok {
+		return device.Device{}, device.ErrNotFound
+	}
+	return d, nil
+}
+
+func (s *fakeStore) ByIDs(_ context.Context, ids []string) ([]device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []device.Device
+	for _, id := range ids {
+		if d, ok := s.devices[id]; ok {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (s *fakeStore) Update(_ context.Context, id string, data device.UpdateDevice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return device.ErrNotFound
+	}
+	if data.Name != nil {
+		d.Name = *data.Name
+	}
+	s.devices[id] = d
+	return nil
+}
+
+func (s *fakeStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.devices, id)
+	return nil
+}
+
+func (s *fakeStore) RecordHeartbeat(_ context.Context, id string, _ device.Heartbeat, at time.Time) (device.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return "", device.ErrNotFound
+	}
+	previous := d.Status
+	d.Status, d.LastSeenAt = device.StatusOnline, &at
+	s.devices[id] = d
+	return previous, nil
+}
+
+func (s *fakeStore) MarkOffline(_ context.Context, seenBefore time.Time, _ int) ([]device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []device.Device
+	for id, d := range s.devices {
+		if d.Status == device.StatusOnline && d.LastSeenAt.Before(seenBefore) {
+			d.Status = device.StatusOffline
+			s.devices[id] = d
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func TestStoreByID(t *testing.T) {
+	ctx := context.Background()
+	next := newFakeStore(device.Device{ID: "1", Name: "a"}, device.Device{ID: "2", Name: "b"}, device.Device{ID: "3", Name: "c"})
+	s := NewStore(next, 2, time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	for _, id := range []string{"1", "1", "2", "1"} {
+		if _, err := s.ByID(ctx, id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := next.calls.Load(); got != 2 {
+		t.Fatalf("expected 2 loads, got %d", got)
+	}
+
+	// 2 is the least recently used device
+	if _, err := s.ByID(ctx, "3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.ByID(ctx, "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := next.calls.Load(); got != 3 {
+		t.Fatalf("expected device 1 to stay cached, got %d loads", got)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := s.ByID(ctx, "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := next.calls.Load(); got != 4 {
+		t.Fatalf("expected the expired device to be loaded, got %d loads", got)
+	}
+
+	expected := Stats{Hits: 3, Misses: 4, Evictions: 1, Entries: 2}
+	if got := s.Stats(); got != expected {
+		t.Fatalf("expected stats %+v, got %+v", expected, got)
+	}
+}
+
+func TestStoreInvalidation(t *testing.T) {
+	ctx := context.Background()
+	next := newFakeStore(device.Device{ID: "1", Name: "a"})
+	s := NewStore(next, 10, time.Minute)
+
+	if _, err := s.ByID(ctx, "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	name := "b"
+	if err := s.Update(ctx, "1", device.UpdateDevice{Name: &name}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, err := s.ByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Name != name {
+		t.Fatalf("expected the updated name %s, got %s", name, d.Name)
+	}
+
+	if err := s.Delete(ctx, "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.ByID(ctx, "1"); err != device.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreStatusInvalidation(t *testing.T) {
+	ctx := context.Background()
+	next := newFakeStore(device.Device{ID: "1", Status: device.StatusUnknown})
+	s := NewStore(next, 10, time.Minute)
+
+	status := func() device.Status {
+		t.Helper()
+		d, err := s.ByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return d.Status
+	}
+
+	status()
+	if _, err := s.RecordHeartbeat(ctx, "1", device.Heartbeat{}, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := status(); got != device.StatusOnline {
+		t.Fatalf("expected the device online after a heartbeat, got %s", got)
+	}
+
+	if _, err := s.MarkOffline(ctx, time.Now().Add(time.Second), 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := status(); got != device.StatusOffline {
+		t.Fatalf("expected the device offline, got %s", got)
+	}
+}
+
+func TestStoreByIDs(t *testing.T) {
+	ctx := context.Background()
+	next := newFakeStore(device.Device{ID: "1", Name: "a"}, device.Device{ID: "2", Name: "b"})
+	s := NewStore(next, 10, time.Minute)
+
+	if _, err := s.ByID(ctx, "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	devices, err := s.ByIDs(ctx, []string{"1", "2", "3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+
+	if _, err := s.ByID(ctx, "2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("expected ByIDs to cache device 2, got %d loads", got)
+	}
+}
+
+func TestStoreCollapsesMisses(t *testing.T) {
+	next := newFakeStore(device.Device{ID: "1", Name: "a"})
+	next.block = make(chan struct{})
+	s := NewStore(next, 10, time.Minute)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.ByID(context.Background(), "1")
+			errs <- err
+		}()
+	}
+
+	// wait until every caller missed and joined the load before letting it finish
+	for s.Stats().Misses < callers {
+		runtime.Gosched()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(next.block)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("expected concurrent misses to share 1 load, got %d", got)
+	}
+}
+
+func TestStoreCachesDuringOtherWrites(t *testing.T) {
+	ctx := context.Background()
+	next := newFakeStore(device.Device{ID: "1", Name: "a"}, device.Device{ID: "2", Name: "b"})
+	next.block = make(chan struct{})
+	s := NewStore(next, 10, time.Minute)
+
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := s.ByID(ctx, "1")
+		loaded <- err
+	}()
+	for next.calls.Load() == 0 {
+		runtime.Gosched()
+	}
+
+	// a write to another device while 1 is loaded must not keep it out of the cache
+	name := "c"
+	if err := s.Update(ctx, "2", device.UpdateDevice{Name: &name}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(next.block)
+	if err := <-loaded; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := s.ByID(ctx, "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 to be served from the cache, got %d loads", got)
+	}
+	if len(s.loading) != 0 {
+		t.Fatalf("expected no load in flight, got %d", len(s.loading))
+	}
+}
+
+func TestStoreConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	next := newFakeStore(device.Device{ID: "1", Name: "0"})
+	s := NewStore(next, 10, time.Minute)
+
+	const writes = 500
+	var (
+		// committed is the last version whose Update returned
+		committed atomic.Int64
+		done      = make(chan struct{})
+		wg        sync.WaitGroup
+		errs      = make(chan error, 8)
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				min := committed.Load()
+				d, err := s.ByID(ctx, "1")
+				if err != nil {
+					errs <- err
+					return
+				}
+				version, _ := strconv.ParseInt(d.Name, 10, 64)
+				if version < min {
+					t.Errorf("read version %d after version %d was committed", version, min)
+					return
+				}
+			}
+		}()
+	}
+
+	for v := int64(1); v <= writes; v++ {
+		name := strconv.FormatInt(v, 10)
+		if err := s.Update(ctx, "1", device.UpdateDevice{Name: &name}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		committed.Store(v)
+		runtime.Gosched()
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, err := s.ByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Name != strconv.Itoa(writes) {
+		t.Fatalf("expected the last version %d, got %s", writes, d.Name)
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"context"
+	"device/business/device"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of a store operation
+const (
+	resultOK       = "ok"
+	resultNotFound = "not_found"
+	resultError    = "error"
+)
+
+// Store is a device.Store that records a counter and a duration per method
+type Store struct {
+	next       device.Store
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+}
+
+var _ device.Store = (*Store)(nil)
+
+// NewStore creates a new Store instance around next and registers its metrics on reg
+func NewStore(next device.Store, reg prometheus.Registerer) *Store {
+	s := &Store{
+		next: next,
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "device_store_operations_total",
+			Help: "Number of device store operations by method and result.",
+		}, []string{"method", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "device_store_operation_duration_seconds",
+			Help:    "Duration of device store operations by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+	reg.MustRegister(s.operations, s.duration)
+	return s
+}
+
+// observe records an operation that started at start
+func (s *Store) observe(method string, start time.Time, err error) {
+	result := resultOK
+	switch {
+	case errors.Is(err, device.ErrNotFound):
+		result = resultNotFound
+	case err != nil:
+		result = resultError
+	}
+	s.operations.WithLabelValues(method, result).Inc()
+	s.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (s *Store) ByID(ctx context.Context, id string) (device.Device, error) {
+	start := time.Now()
+	d, err := s.next.ByID(ctx, id)
+	s.observe("ByID", start, err)
+	return d, err
+}
+
+func (s *Store) ByIDs(ctx context.Context, ids []string) ([]device.Device, error) {
+	start := time.Now()
+	ds, err := s.next.ByIDs(ctx, ids)
+	s.observe("ByIDs", start, err)
+	return ds, err
+}
+
+func (s *Store) Create(ctx context.Context, d device.Device) error {
+	start := time.Now()
+	err := s.next.Create(ctx, d)
+	s.observe("Create", start, err)
+	return err
+}
+
+func (s *Store) Update(ctx context.Context, id string, data device.UpdateDevice) error {
+	start := time.Now()
+	err := s.next.Update(ctx, id, data)
+	s.observe("Update", start, err)
+	return err
+}
+
+func (s *Store) GetAll(ctx context.Context, offset, limit int) ([]device.Device, error) {
+	start := time.Now()
+	ds, err := s.next.GetAll(ctx, offset, limit)
+	s.observe("GetAll", start, err)
+	return ds, err
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.next.Delete(ctx, id)
+	s.observe("Delete", start, err)
+	return err
+}
+
+func (s *Store) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error) {
+	start := time.Now()
+	ds, err := s.next.SearchByBrand(ctx, brand, offset, limit)
+	s.observe("SearchByBrand", start, err)
+	return ds, err
+}
+
+func (s *Store) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	start := time.Now()
+	ds, err := s.next.Search(ctx, f, offset, limit)
+	s.observe("Search", start, err)
+	return ds, err
+}
+
+func (s *Store) RecordHeartbeat(ctx context.Context, id string, hb device.Heartbeat, at time.Time) (device.Status, error) {
+	start := time.Now()
+	previous, err := s.next.RecordHeartbeat(ctx, id, hb, at)
+	s.observe("RecordHeartbeat", start, err)
+	return previous, err
+}
+
+func (s *Store) MarkOffline(ctx context.Context, seenBefore time.Time, limit int) ([]device.Device, error) {
+	start := time.Now()
+	ds, err := s.next.MarkOffline(ctx, seenBefore, limit)
+	s.observe("MarkOffline", start, err)
+	return ds, err
+}
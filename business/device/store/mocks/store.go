@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"device/business/device"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -19,6 +20,11 @@ func (s *Store) ByID(ctx context.Context, id string) (device.Device, error) {
 	return args.Get(0).(device.Device), args.Error(1)
 }
 
+func (s *Store) ByIDs(ctx context.Context, ids []string) ([]device.Device, error) {
+	args := s.Called(ctx, ids)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
 func (s *Store) Create(ctx context.Context, d device.Device) error {
 	args := s.Called(ctx, d)
 	return args.Error(0)
@@ -43,3 +49,18 @@ func (s *Store) SearchByBrand(ctx context.Context, brand string, offset, limit i
 	args := s.Called(ctx, brand, offset, limit)
 	return args.Get(0).([]device.Device), args.Error(1)
 }
+
+func (s *Store) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	args := s.Called(ctx, f, offset, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
+
+func (s *Store) RecordHeartbeat(ctx context.Context, id string, hb device.Heartbeat, at time.Time) (device.Status, error) {
+	args := s.Called(ctx, id, hb, at)
+	return args.Get(0).(device.Status), args.Error(1)
+}
+
+func (s *Store) MarkOffline(ctx context.Context, seenBefore time.Time, limit int) ([]device.Device, error) {
+	args := s.Called(ctx, seenBefore, limit)
+	return args.Get(0).([]device.Device), args.Error(1)
+}
@@ -11,6 +11,14 @@ type Device struct {
 	Name      string    `gorm:"column:name"`          // Custom column name
 	Brand     string    `gorm:"column:brand"`         // Custom column name
 	CreatedAt time.Time `gorm:"column:created_at"`    // Explicit column name
+	// the status evaluator looks up online devices by last heartbeat
+	Status        string     `gorm:"column:status;not null;default:unknown;index:idx_devices_status_last_seen_at,priority:1"`
+	LastSeenAt    *time.Time `gorm:"column:last_seen_at;index:idx_devices_status_last_seen_at,priority:2"`
+	IP            string     `gorm:"column:ip"`
+	Firmware      string     `gorm:"column:firmware"`
+	UptimeSeconds int64      `gorm:"column:uptime_seconds"`
+	// labels are matched with @>, which the GIN index serves
+	Labels map[string]string `gorm:"column:labels;type:jsonb;serializer:json;index:idx_devices_labels,type:gin"`
 }
 
 // TableName overrides the default table name (from "devices" to "custom_devices").
@@ -20,12 +28,23 @@ func (Device) TableName() string {
 
 // toBusinessDevice converts a Device to a device.Device
 func toBusinessDevice(d Device) device.Device {
-	return device.Device{
-		ID:        d.ID,
-		Name:      d.Name,
-		Brand:     d.Brand,
-		CreatedAt: d.CreatedAt,
+	bd := device.Device{
+		ID:         d.ID,
+		Name:       d.Name,
+		Brand:      d.Brand,
+		CreatedAt:  d.CreatedAt,
+		Status:     device.Status(d.Status),
+		LastSeenAt: d.LastSeenAt,
+		Labels:     d.Labels,
 	}
+	if d.LastSeenAt != nil {
+		bd.Heartbeat = &device.Heartbeat{
+			IP:            d.IP,
+			Firmware:      d.Firmware,
+			UptimeSeconds: d.UptimeSeconds,
+		}
+	}
+	return bd
 }
 
 // toBusinessDevices converts a slice of Device to a slice of device.Device
@@ -39,10 +58,25 @@ func toBusinessDevices(ds []Device) []device.Device {
 
 // fromBusinessDevice converts a device.Device to a Device
 func fromBusinessDevice(d device.Device) Device {
-	return Device{
-		ID:        d.ID,
-		Name:      d.Name,
-		Brand:     d.Brand,
-		CreatedAt: d.CreatedAt,
+	pd := Device{
+		ID:         d.ID,
+		Name:       d.Name,
+		Brand:      d.Brand,
+		CreatedAt:  d.CreatedAt,
+		Status:     string(d.Status),
+		LastSeenAt: d.LastSeenAt,
+		Labels:     d.Labels,
+	}
+	if pd.Status == "" {
+		pd.Status = string(device.StatusUnknown)
+	}
+	if pd.Labels == nil {
+		pd.Labels = map[string]string{}
+	}
+	if d.Heartbeat != nil {
+		pd.IP = d.Heartbeat.IP
+		pd.Firmware = d.Heartbeat.Firmware
+		pd.UptimeSeconds = d.Heartbeat.UptimeSeconds
 	}
+	return pd
 }
@@ -3,29 +3,58 @@ package postgres
 import (
 	"context"
 	"device/business/device"
+	"device/pkg/database"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Store is a postgres implementation of the device.Store
 type Store struct {
-	db *gorm.DB
+	db       *gorm.DB
+	replicas *database.Cluster
 }
 
 // this is a compile time check to ensure Store implements device.Store
 var _ device.Store = (*Store)(nil)
 
+// Option configures a Store
+type Option func(*Store)
+
+// WithReplicas sends the reads that are not part of a transaction to the
+// replicas of c. Writes keep going to the primary db.
+func WithReplicas(c *database.Cluster) Option {
+	return func(s *Store) {
+		s.replicas = c
+	}
+}
+
 // NewStore creates a new Store instance
-func NewStore(db *gorm.DB) *Store {
-	return &Store{db: db}
+func NewStore(db *gorm.DB, opts ...Option) *Store {
+	s := &Store{db: db}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// reader returns the connection to read from: the transaction in ctx if any,
+// else a replica when they are configured, else the primary
+func (s *Store) reader(ctx context.Context) *gorm.DB {
+	if s.replicas == nil {
+		return database.Conn(ctx, s.db)
+	}
+	return database.Conn(ctx, s.replicas.Reader(ctx))
 }
 
 // ByID returns a device by its ID
 func (s *Store) ByID(ctx context.Context, id string) (device.Device, error) {
 	var d Device
-	result := s.db.WithContext(ctx).First(&d, "id = ?", id)
+	result := s.reader(ctx).First(&d, "id = ?", id)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return device.Device{}, device.ErrNotFound
 	}
@@ -36,10 +65,24 @@ func (s *Store) ByID(ctx context.Context, id string) (device.Device, error) {
 	return toBusinessDevice(d), nil
 }
 
+// ByIDs returns the devices with the given IDs
+func (s *Store) ByIDs(ctx context.Context, ids []string) ([]device.Device, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var devices []Device
+	result := s.reader(ctx).Where("id IN ?", ids).Find(&devices)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessDevices(devices), nil
+}
+
 // Create creates a new device
 func (s *Store) Create(ctx context.Context, d device.Device) error {
 	createData := fromBusinessDevice(d)
-	result := s.db.WithContext(ctx).Create(&createData)
+	result := database.Conn(ctx, s.db).Create(&createData)
 	if result.Error != nil {
 		return fmt.Errorf("db.Create: %w", result.Error)
 	}
@@ -55,8 +98,16 @@ func (s *Store) Update(ctx context.Context, id string, data device.UpdateDevice)
 	if data.Brand != nil {
 		updates["brand"] = *data.Brand
 	}
+	if data.Labels != nil {
+		// map updates skip the serializer of the column
+		labels, err := json.Marshal(data.Labels)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %w", err)
+		}
+		updates["labels"] = string(labels)
+	}
 
-	result := s.db.WithContext(ctx).Model(&Device{}).Where("id = ?", id).Updates(updates)
+	result := database.Conn(ctx, s.db).Model(&Device{}).Where("id = ?", id).Updates(updates)
 	if result.RowsAffected == 0 {
 		return device.ErrNotFound
 	}
@@ -69,7 +120,7 @@ func (s *Store) Update(ctx context.Context, id string, data device.UpdateDevice)
 // GetAll returns all devices
 func (s *Store) GetAll(ctx context.Context, offset, limit int) ([]device.Device, error) {
 	var devices []Device
-	result := s.db.WithContext(ctx).Offset(offset).Limit(limit).Find(&devices)
+	result := s.reader(ctx).Offset(offset).Limit(limit).Find(&devices)
 	if result.Error != nil {
 		return nil, fmt.Errorf("db.Find: %w", result.Error)
 	}
@@ -78,7 +129,7 @@ func (s *Store) GetAll(ctx context.Context, offset, limit int) ([]device.Device,
 
 // Delete deletes a device
 func (s *Store) Delete(ctx context.Context, id string) error {
-	result := s.db.WithContext(ctx).Delete(&Device{ID: id}, "id = ?", id)
+	result := database.Conn(ctx, s.db).Delete(&Device{ID: id}, "id = ?", id)
 	if result.Error != nil {
 		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
 	}
@@ -91,9 +142,106 @@ func (s *Store) Delete(ctx context.Context, id string) error {
 // SearchByBrand searches devices by brand
 func (s *Store) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error) {
 	var devices []Device
-	result := s.db.WithContext(ctx).Where("brand = ?", brand).Offset(offset).Limit(limit).Find(&devices)
+	result := s.reader(ctx).Where("brand = ?", brand).Offset(offset).Limit(limit).Find(&devices)
 	if result.Error != nil {
 		return nil, fmt.Errorf("db.Find: %w", result.Error)
 	}
 	return toBusinessDevices(devices), nil
 }
+
+// Search returns the devices that match f
+func (s *Store) Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	q := s.reader(ctx)
+	if f.Brand != "" {
+		q = q.Where("brand = ?", f.Brand)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", string(f.Status))
+	}
+	if f.LastSeenAfter != nil {
+		q = q.Where("last_seen_at >= ?", *f.LastSeenAfter)
+	}
+	if f.LastSeenBefore != nil {
+		q = q.Where("last_seen_at < ?", *f.LastSeenBefore)
+	}
+	if len(f.Labels) > 0 {
+		labels, err := json.Marshal(f.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal: %w", err)
+		}
+		q = q.Where("labels @> ?::jsonb", string(labels))
+	}
+
+	var devices []Device
+	result := q.Offset(offset).Limit(limit).Find(&devices)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessDevices(devices), nil
+}
+
+// RecordHeartbeat marks a device online and records the heartbeat. The row
+// stays locked until the transaction in ctx ends, so concurrent heartbeats
+// and the status evaluator see each other's status.
+func (s *Store) RecordHeartbeat(ctx context.Context, id string, hb device.Heartbeat, at time.Time) (device.Status, error) {
+	conn := database.Conn(ctx, s.db)
+
+	var d Device
+	result := conn.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&d, "id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return "", device.ErrNotFound
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+
+	updates := map[string]interface{}{
+		"status":       string(device.StatusOnline),
+		"last_seen_at": at,
+	}
+	if hb.IP != "" {
+		updates["ip"] = hb.IP
+	}
+	if hb.Firmware != "" {
+		updates["firmware"] = hb.Firmware
+	}
+	if hb.UptimeSeconds != 0 {
+		updates["uptime_seconds"] = hb.UptimeSeconds
+	}
+	result = conn.Model(&Device{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return "", fmt.Errorf("db.Updates[%s]: %w", id, result.Error)
+	}
+	return device.Status(d.Status), nil
+}
+
+// MarkOffline marks online devices last seen before seenBefore offline. The
+// devices locked by a heartbeat or another evaluator are skipped.
+func (s *Store) MarkOffline(ctx context.Context, seenBefore time.Time, limit int) ([]device.Device, error) {
+	conn := database.Conn(ctx, s.db)
+
+	var devices []Device
+	result := conn.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND last_seen_at < ?", string(device.StatusOnline), seenBefore).
+		Order("last_seen_at").
+		Limit(limit).
+		Find(&devices)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(devices))
+	for i := range devices {
+		ids[i] = devices[i].ID
+		devices[i].Status = string(device.StatusOffline)
+	}
+	result = conn.Model(&Device{}).Where("id IN ?", ids).Update("status", string(device.StatusOffline))
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Update: %w", result.Error)
+	}
+	return toBusinessDevices(devices), nil
+}
@@ -0,0 +1,155 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// Broadcaster fans events out to in-process subscribers and keeps the most
+// recent events in a bounded buffer so subscribers can resume after a disconnect.
+// Publishing never blocks: a subscriber whose buffer is full is dropped and
+// its channel closed once the events it holds are read, and it is expected to
+// resubscribe from the last event it saw.
+type Broadcaster struct {
+	mu         sync.Mutex
+	replay     []Event
+	next       int
+	full       bool
+	subs       map[*Subscriber]struct{}
+	bufferSize int
+}
+
+// this is a compile time check to ensure Broadcaster implements Publisher
+var _ Publisher = (*Broadcaster)(nil)
+
+// Subscriber receives events from a Broadcaster. Its events are queued in
+// the order they were published and filtered by a goroutine of its own, so
+// a slow filter holds up neither publishers nor other subscribers.
+type Subscriber struct {
+	ch     chan Event
+	queue  chan Event
+	filter func(Event) bool
+	// done stops the delivery once the subscriber is unsubscribed
+	done chan struct{}
+	stop sync.Once
+}
+
+// deliver filters the queued events and sends the matching ones on ch, which
+// it closes once the queue is closed and drained or the subscriber stopped
+func (s *Subscriber) deliver() {
+	defer close(s.ch)
+	for e := range s.queue {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscriber is dropped or unsubscribed.
+func (s *Subscriber) Events() <-chan Event {
+	return s.ch
+}
+
+// NewBroadcaster creates a new Broadcaster that keeps replaySize events for
+// resuming and buffers up to bufferSize events per subscriber
+func NewBroadcaster(replaySize, bufferSize int) *Broadcaster {
+	return &Broadcaster{
+		replay:     make([]Event, replaySize),
+		subs:       map[*Subscriber]struct{}{},
+		bufferSize: bufferSize,
+	}
+}
+
+// Publish queues the event for every subscriber, in the order it is added to
+// the replay buffer. A subscriber whose queue is full is dropped.
+func (b *Broadcaster) Publish(ctx context.Context, e Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.replay) > 0 {
+		b.replay[b.next] = e
+		b.next = (b.next + 1) % len(b.replay)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+	for s := range b.subs {
+		select {
+		case s.queue <- e:
+		default:
+			b.remove(s)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber that receives the events matching filter.
+// A nil filter matches every event. When lastEventID is set, the buffered
+// events published after it are returned so the caller can send them before
+// reading from the subscriber. If lastEventID is no longer buffered, the
+// whole buffer is returned.
+func (b *Broadcaster) Subscribe(lastEventID string, filter func(Event) bool) (*Subscriber, []Event) {
+	b.mu.Lock()
+	s := &Subscriber{
+		ch:     make(chan Event),
+		queue:  make(chan Event, b.bufferSize),
+		filter: filter,
+		done:   make(chan struct{}),
+	}
+	b.subs[s] = struct{}{}
+	go s.deliver()
+
+	if lastEventID == "" {
+		b.mu.Unlock()
+		return s, nil
+	}
+	events := b.buffered()
+	b.mu.Unlock()
+
+	for i, e := range events {
+		if e.ID == lastEventID {
+			events = events[i+1:]
+			break
+		}
+	}
+
+	var missed []Event
+	for _, e := range events {
+		if filter == nil || filter(e) {
+			missed = append(missed, e)
+		}
+	}
+	return s, missed
+}
+
+// Unsubscribe removes the subscriber and closes its channel, dropping the
+// events still queued
+func (b *Broadcaster) Unsubscribe(s *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+	s.stop.Do(func() { close(s.done) })
+}
+
+// remove removes a subscriber, whose channel is closed once the events
+// already queued are delivered. The caller must hold the lock.
+func (b *Broadcaster) remove(s *Subscriber) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	close(s.queue)
+}
+
+// buffered returns the replay buffer oldest first, the caller must hold the lock
+func (b *Broadcaster) buffered() []Event {
+	if !b.full {
+		return append([]Event(nil), b.replay[:b.next]...)
+	}
+	return append(append([]Event(nil), b.replay[b.next:]...), b.replay[:b.next]...)
+}
@@ -0,0 +1,151 @@
+package event_test
+
+import (
+	"context"
+	"device/business/event"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ids(events []event.Event) []string {
+	var result []string
+	for _, e := range events {
+		result = append(result, e.ID)
+	}
+	return result
+}
+
+func TestSubscribe(t *testing.T) {
+	testTable := map[string]struct {
+		lastEventID    string
+		filter         func(event.Event) bool
+		expectedMissed []string
+	}{
+		"no last event": {
+			lastEventID: "",
+		},
+		"resume": {
+			lastEventID:    "3",
+			expectedMissed: []string{"4", "5"},
+		},
+		"resume with filter": {
+			lastEventID:    "2",
+			filter:         func(e event.Event) bool { return e.Type == "odd" },
+			expectedMissed: []string{"3", "5"},
+		},
+		"evicted": {
+			lastEventID:    "1",
+			expectedMissed: []string{"3", "4", "5"},
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			b := event.NewBroadcaster(3, 10)
+			for i, id := range []string{"1", "2", "3", "4", "5"} {
+				typ := "odd"
+				if i%2 == 1 {
+					typ = "even"
+				}
+				b.Publish(context.Background(), event.Event{ID: id, Type: typ})
+			}
+
+			_, missed := b.Subscribe(tc.lastEventID, tc.filter)
+			if !reflect.DeepEqual(ids(missed), tc.expectedMissed) {
+				t.Fatalf("expected %v, got %v", tc.expectedMissed, ids(missed))
+			}
+		})
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := event.NewBroadcaster(10, 1)
+	slow, _ := b.Subscribe("", nil)
+	fast, _ := b.Subscribe("", nil)
+
+	// the slow subscriber holds at most one event besides its buffer
+	for _, id := range []string{"1", "2", "3"} {
+		b.Publish(context.Background(), event.Event{ID: id})
+		if e := <-fast.Events(); e.ID != id {
+			t.Fatalf("expected event %s, got %v", id, e.ID)
+		}
+	}
+
+	var received []string
+	for e := range slow.Events() {
+		received = append(received, e.ID)
+	}
+	if len(received) == 0 || len(received) == 3 || !reflect.DeepEqual(received, []string{"1", "2"}[:len(received)]) {
+		t.Fatalf("expected the slow subscriber to be dropped after the first events, got %v", received)
+	}
+}
+
+func TestSlowFilter(t *testing.T) {
+	b := event.NewBroadcaster(10, 10)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s, _ := b.Subscribe("", func(e event.Event) bool {
+		if e.ID == "1" {
+			close(entered)
+			<-release
+		}
+		return true
+	})
+
+	done := make(chan struct{})
+	go func() {
+		b.Publish(context.Background(), event.Event{ID: "1"})
+		close(done)
+	}()
+	<-entered
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(context.Background(), event.Event{ID: "2"})
+		other, _ := b.Subscribe("", nil)
+		b.Unsubscribe(other)
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatalf("expected publishing not to wait for a slow filter")
+	}
+
+	close(release)
+	<-done
+	// the events arrive in the order of the replay buffer
+	if e := <-s.Events(); e.ID != "1" {
+		t.Fatalf("expected event 1, got %v", e.ID)
+	}
+	if e := <-s.Events(); e.ID != "2" {
+		t.Fatalf("expected event 2, got %v", e.ID)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := event.NewBroadcaster(10, 10)
+	s, _ := b.Subscribe("", nil)
+	b.Publish(context.Background(), event.Event{ID: "1"})
+	b.Unsubscribe(s)
+
+	// the delivery stops even though the event was never read
+	select {
+	case <-drained(s):
+	case <-time.After(time.Second):
+		t.Fatalf("expected the channel to be closed")
+	}
+}
+
+// drained is closed once the channel of s is
+func drained(s *event.Subscriber) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range s.Events() {
+		}
+		close(done)
+	}()
+	return done
+}
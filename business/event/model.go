@@ -0,0 +1,40 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event represents a domain event
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"`
+	Data        json.RawMessage `json:"data"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// New creates a new event with the given type, aggregate ID and data
+func New(typ, aggregateID string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	return Event{
+		ID:          uuid.NewString(),
+		Type:        typ,
+		AggregateID: aggregateID,
+		Data:        raw,
+		OccurredAt:  time.Now(),
+	}, nil
+}
+
+// Publisher delivers events to an external system
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
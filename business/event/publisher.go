@@ -0,0 +1,24 @@
+package event
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogPublisher is a Publisher that writes events to the log
+type LogPublisher struct{}
+
+// this is a compile time check to ensure LogPublisher implements Publisher
+var _ Publisher = LogPublisher{}
+
+// Publish logs the event
+func (LogPublisher) Publish(ctx context.Context, e Event) error {
+	logrus.WithFields(logrus.Fields{
+		"event_id":     e.ID,
+		"event_type":   e.Type,
+		"aggregate_id": e.AggregateID,
+		"data":         string(e.Data),
+	}).Info("event published")
+	return nil
+}
@@ -0,0 +1,23 @@
+package event
+
+import (
+	"context"
+	"errors"
+)
+
+// Publishers fans an event out to several publishers
+type Publishers []Publisher
+
+// this is a compile time check to ensure Publishers implements Publisher
+var _ Publisher = Publishers(nil)
+
+// Publish publishes the event to every publisher and joins their errors
+func (ps Publishers) Publish(ctx context.Context, e Event) error {
+	var errs []error
+	for _, p := range ps {
+		if err := p.Publish(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
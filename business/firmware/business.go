@@ -0,0 +1,359 @@
+package firmware
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/tracing"
+	"fmt"
+	"time"
+)
+
+// targetPageSize is the number of devices read at a time when resolving the target of a rollout
+const targetPageSize = 500
+
+// Store is an interface to interact with the database
+type Store interface {
+	// CreateFirmware fails with ErrVersionExists if the version is registered
+	CreateFirmware(ctx context.Context, f Firmware) error
+	FirmwareByID(ctx context.Context, id string) (Firmware, error)
+	// ListFirmware returns the firmware compatible with brand, or all of it
+	// if brand is empty, newest first
+	ListFirmware(ctx context.Context, brand string, offset, limit int) ([]Firmware, error)
+	// DeleteFirmware fails with ErrInUse if a rollout installs the firmware
+	DeleteFirmware(ctx context.Context, id string) error
+
+	// CreateRollout stores r along with the progress of its devices
+	CreateRollout(ctx context.Context, r Rollout, devices []DeviceProgress) error
+	RolloutByID(ctx context.Context, id string) (Rollout, error)
+	// ListRollouts returns the rollouts with status, or all of them if
+	// status is empty, newest first
+	ListRollouts(ctx context.Context, status RolloutStatus, offset, limit int) ([]Rollout, error)
+	// UpdateRollout applies update to the rollout id and saves it, unless
+	// update fails. Concurrent updates of the rollout wait for each other.
+	UpdateRollout(ctx context.Context, id string, update func(r *Rollout) error) (Rollout, error)
+	// StageCounts counts the devices of the rollout id by stage and status
+	StageCounts(ctx context.Context, id string) ([]StageCount, error)
+	// RolloutDevices returns the progress of the devices of the rollout id
+	// with status, or of all of them if status is empty
+	RolloutDevices(ctx context.Context, id string, status DeviceStatus, offset, limit int) ([]DeviceProgress, error)
+	// PendingUpdate returns the progress of the update the device has yet to
+	// finish in the newest running rollout whose released stages include it.
+	// It fails with ErrNoUpdate if there is none.
+	PendingUpdate(ctx context.Context, deviceID string) (DeviceProgress, error)
+	// Report applies update to the progress of the device in the rollout and
+	// saves it, unless update fails. It fails with ErrNotAssigned if the
+	// device is not part of the rollout.
+	Report(ctx context.Context, deviceID, rolloutID string, update func(p *DeviceProgress, r Rollout) error) (DeviceProgress, error)
+}
+
+// Devices looks up the devices firmware is installed on
+type Devices interface {
+	GetByID(ctx context.Context, id string) (device.Device, error)
+	Search(ctx context.Context, f device.Filter, offset, limit int) ([]device.Device, error)
+}
+
+// Business is the business logic for firmware and its rollouts
+type Business struct {
+	store   Store
+	devices Devices
+	now     func() time.Time
+}
+
+// Option configures the Business
+type Option func(*Business)
+
+// WithClock makes the Business, and the engines running its rollouts, tell
+// the time with now instead of the system clock
+func WithClock(now func() time.Time) Option {
+	return func(b *Business) {
+		b.now = now
+	}
+}
+
+// NewBusiness creates a new business logic for firmware
+func NewBusiness(store Store, devices Devices, opts ...Option) *Business {
+	b := &Business{
+		store:   store,
+		devices: devices,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// CreateFirmware registers a valid firmware
+func (b *Business) CreateFirmware(ctx context.Context, cf CreateFirmware) (_ Firmware, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.CreateFirmware")
+	defer func() { tracing.End(span, err) }()
+
+	f := cf.toFirmware(b.now().UTC())
+	if err := b.store.CreateFirmware(ctx, f); err != nil {
+		return Firmware{}, fmt.Errorf("store.CreateFirmware: %w", err)
+	}
+	return f, nil
+}
+
+// GetFirmware returns a firmware by its ID
+func (b *Business) GetFirmware(ctx context.Context, id string) (_ Firmware, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.GetFirmware")
+	defer func() { tracing.End(span, err) }()
+
+	f, err := b.store.FirmwareByID(ctx, id)
+	if err != nil {
+		return Firmware{}, fmt.Errorf("store.FirmwareByID: %w", err)
+	}
+	return f, nil
+}
+
+// ListFirmware returns the firmware compatible with brand, or all of it if
+// brand is empty, newest first
+func (b *Business) ListFirmware(ctx context.Context, brand string, offset, limit int) (_ []Firmware, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.ListFirmware")
+	defer func() { tracing.End(span, err) }()
+
+	fs, err := b.store.ListFirmware(ctx, brand, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.ListFirmware: %w", err)
+	}
+	return fs, nil
+}
+
+// DeleteFirmware deletes a firmware no rollout installs
+func (b *Business) DeleteFirmware(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.DeleteFirmware")
+	defer func() { tracing.End(span, err) }()
+
+	if err := b.store.DeleteFirmware(ctx, id); err != nil {
+		return fmt.Errorf("store.DeleteFirmware: %w", err)
+	}
+	return nil
+}
+
+// CreateRollout starts a valid rollout of a firmware on the compatible
+// devices of its target, and spreads them over its stages. The first stage
+// is released right away.
+func (b *Business) CreateRollout(ctx context.Context, cr CreateRollout) (_ Rollout, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.CreateRollout")
+	defer func() { tracing.End(span, err) }()
+
+	f, err := b.store.FirmwareByID(ctx, cr.FirmwareID)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("store.FirmwareByID: %w", err)
+	}
+	if cr.Target.Brand != "" && !f.Compatible(device.Device{Brand: cr.Target.Brand}) {
+		return Rollout{}, fmt.Errorf("%w: %s", ErrIncompatible, cr.Target.Brand)
+	}
+
+	var ids []string
+	for offset := 0; ; offset += targetPageSize {
+		devices, err := b.devices.Search(ctx, cr.Target.filter(), offset, targetPageSize)
+		if err != nil {
+			return Rollout{}, fmt.Errorf("devices.Search: %w", err)
+		}
+		for _, d := range devices {
+			if f.Compatible(d) {
+				ids = append(ids, d.ID)
+			}
+		}
+		if len(devices) < targetPageSize {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return Rollout{}, ErrNoDevices
+	}
+
+	r := cr.toRollout(len(ids), b.now().UTC())
+	if err := b.store.CreateRollout(ctx, r, assign(r, ids)); err != nil {
+		return Rollout{}, fmt.Errorf("store.CreateRollout: %w", err)
+	}
+	return b.withProgress(ctx, r)
+}
+
+// GetRollout returns a rollout by its ID, with its progress
+func (b *Business) GetRollout(ctx context.Context, id string) (_ Rollout, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.GetRollout")
+	defer func() { tracing.End(span, err) }()
+
+	r, err := b.store.RolloutByID(ctx, id)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("store.RolloutByID: %w", err)
+	}
+	return b.withProgress(ctx, r)
+}
+
+// ListRollouts returns the rollouts with status, or all of them if status
+// is empty, newest first
+func (b *Business) ListRollouts(ctx context.Context, status RolloutStatus, offset, limit int) (_ []Rollout, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.ListRollouts")
+	defer func() { tracing.End(span, err) }()
+
+	rs, err := b.store.ListRollouts(ctx, status, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.ListRollouts: %w", err)
+	}
+	return rs, nil
+}
+
+// PauseRollout pauses a running rollout. Its devices stop getting the
+// update, except the ones already installing it.
+func (b *Business) PauseRollout(ctx context.Context, id string) (_ Rollout, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.PauseRollout")
+	defer func() { tracing.End(span, err) }()
+
+	return b.transition(ctx, id, RolloutPaused)
+}
+
+// ResumeRollout resumes a paused rollout. The failures so far are accepted
+// and no longer count toward the failure rate, and the current stage starts
+// over.
+func (b *Business) ResumeRollout(ctx context.Context, id string) (_ Rollout, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.ResumeRollout")
+	defer func() { tracing.End(span, err) }()
+
+	return b.transition(ctx, id, RolloutRunning)
+}
+
+// CancelRollout cancels a running or paused rollout for good
+func (b *Business) CancelRollout(ctx context.Context, id string) (_ Rollout, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.CancelRollout")
+	defer func() { tracing.End(span, err) }()
+
+	return b.transition(ctx, id, RolloutCancelled)
+}
+
+// transition moves the rollout id to status
+func (b *Business) transition(ctx context.Context, id string, status RolloutStatus) (Rollout, error) {
+	counts, err := b.store.StageCounts(ctx, id)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("store.StageCounts: %w", err)
+	}
+
+	r, err := b.store.UpdateRollout(ctx, id, func(r *Rollout) error {
+		return r.transition(status, progress(counts, r.Stage), b.now().UTC())
+	})
+	if err != nil {
+		return Rollout{}, fmt.Errorf("store.UpdateRollout: %w", err)
+	}
+	return b.withProgress(ctx, r)
+}
+
+// RolloutDevices returns the progress of the devices of the rollout id with
+// status, or of all of them if status is empty
+func (b *Business) RolloutDevices(ctx context.Context, id string, status DeviceStatus, offset, limit int) (_ []DeviceProgress, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.RolloutDevices")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.store.RolloutByID(ctx, id); err != nil {
+		return nil, fmt.Errorf("store.RolloutByID: %w", err)
+	}
+	devices, err := b.store.RolloutDevices(ctx, id, status, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.RolloutDevices: %w", err)
+	}
+	return devices, nil
+}
+
+// Evaluate moves the running rollouts along: it pauses the ones whose
+// failure rate crossed their threshold, releases their next stage once the
+// current one ran for long enough, and completes the ones every device
+// reported on. It returns how many rollouts changed.
+func (b *Business) Evaluate(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.Evaluate")
+	defer func() { tracing.End(span, err) }()
+
+	// rollouts leave the running ones as they are evaluated, so they are all listed first
+	var ids []string
+	for offset := 0; ; offset += targetPageSize {
+		rs, err := b.store.ListRollouts(ctx, RolloutRunning, offset, targetPageSize)
+		if err != nil {
+			return 0, fmt.Errorf("store.ListRollouts: %w", err)
+		}
+		for _, r := range rs {
+			ids = append(ids, r.ID)
+		}
+		if len(rs) < targetPageSize {
+			break
+		}
+	}
+
+	var changed int
+	for _, id := range ids {
+		ok, err := b.evaluate(ctx, id)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// evaluate moves the rollout id along and reports whether it changed
+func (b *Business) evaluate(ctx context.Context, id string) (bool, error) {
+	counts, err := b.store.StageCounts(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("store.StageCounts: %w", err)
+	}
+
+	var changed bool
+	_, err = b.store.UpdateRollout(ctx, id, func(r *Rollout) error {
+		changed = r.evaluate(counts, b.now().UTC())
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("store.UpdateRollout[%s]: %w", id, err)
+	}
+	return changed, nil
+}
+
+// PendingUpdate returns the firmware the device id has to install, if any
+func (b *Business) PendingUpdate(ctx context.Context, id string) (_ DeviceUpdate, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.PendingUpdate")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return DeviceUpdate{}, fmt.Errorf("devices.GetByID: %w", err)
+	}
+	p, err := b.store.PendingUpdate(ctx, id)
+	if err != nil {
+		return DeviceUpdate{}, fmt.Errorf("store.PendingUpdate: %w", err)
+	}
+	r, err := b.store.RolloutByID(ctx, p.RolloutID)
+	if err != nil {
+		return DeviceUpdate{}, fmt.Errorf("store.RolloutByID: %w", err)
+	}
+	f, err := b.store.FirmwareByID(ctx, r.FirmwareID)
+	if err != nil {
+		return DeviceUpdate{}, fmt.Errorf("store.FirmwareByID: %w", err)
+	}
+	return DeviceUpdate{RolloutID: r.ID, Status: p.Status, Firmware: f}, nil
+}
+
+// Report records the progress the device id reports on its update in a rollout
+func (b *Business) Report(ctx context.Context, id string, rp Report) (_ DeviceProgress, err error) {
+	ctx, span := tracing.Start(ctx, "firmware.Business.Report")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := b.store.Report(ctx, id, rp.RolloutID, func(p *DeviceProgress, r Rollout) error {
+		return rp.apply(p, r, b.now().UTC())
+	})
+	if err != nil {
+		return DeviceProgress{}, fmt.Errorf("store.Report: %w", err)
+	}
+	return p, nil
+}
+
+// withProgress sets the progress of r
+func (b *Business) withProgress(ctx context.Context, r Rollout) (Rollout, error) {
+	counts, err := b.store.StageCounts(ctx, r.ID)
+	if err != nil {
+		return Rollout{}, fmt.Errorf("store.StageCounts: %w", err)
+	}
+	p := progress(counts, r.Stage)
+	r.Progress = &p
+	return r, nil
+}
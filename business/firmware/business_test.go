@@ -0,0 +1,474 @@
+package firmware_test
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/firmware"
+	"device/business/firmware/store/mocks"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	firmwareID = "5c0f3d2a-8b7e-4f6a-9d1c-2e3b4a5f6071"
+	rolloutID  = "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d"
+)
+
+// fakeClock is a clock the tests move forward by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+// devicesMock searches its devices in order
+type devicesMock []device.Device
+
+func (d devicesMock) GetByID(_ context.Context, id string) (device.Device, error) {
+	for _, dev := range d {
+		if dev.ID == id {
+			return dev, nil
+		}
+	}
+	return device.Device{}, device.ErrNotFound
+}
+
+func (d devicesMock) Search(_ context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	var devices []device.Device
+	for _, dev := range d {
+		if f.Matches(dev) {
+			devices = append(devices, dev)
+		}
+	}
+	if offset > len(devices) {
+		offset = len(devices)
+	}
+	return devices[offset:min(offset+limit, len(devices))], nil
+}
+
+func TestValidate(t *testing.T) {
+	threshold := func(v float64) *float64 { return &v }
+	checksum := "sha256:" + strings.Repeat("ab", 32)
+
+	testTable := map[string]struct {
+		validate    func() error
+		expectedErr []string
+	}{
+		"firmware": {
+			validate: firmware.CreateFirmware{Version: "1.4.2", Brands: []string{"acme"}, Checksum: checksum, ArtifactURL: "https://cdn.example.com/fw/1.4.2.bin"}.Validate,
+		},
+		"invalid firmware": {
+			validate: firmware.CreateFirmware{Version: "1.4 beta", Checksum: "md5:abc", ArtifactURL: "ftp://cdn.example.com/fw.bin"}.Validate,
+			expectedErr: []string{
+				"version must be at most 64 letters",
+				"brands must list between 1 and 32 brands",
+				"checksum must be sha256:",
+				"artifact_url must be an http or https URL",
+			},
+		},
+		"rollout": {
+			validate: firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Labels: map[string]string{"region": "eu"}}, Stages: []int{1, 10, 100}, FailureThreshold: threshold(0)}.Validate,
+		},
+		"rollout with defaults": {
+			validate: firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Brand: "acme"}}.Validate,
+		},
+		"invalid rollout": {
+			validate: firmware.CreateRollout{FirmwareID: "abc", Stages: []int{50, 10, 100}, FailureThreshold: threshold(1.5), StageDurationSeconds: -1}.Validate,
+			expectedErr: []string{
+				"firmware_id must be a UUID",
+				"target must set a brand or labels",
+				"stages must be at most 10 increasing percentages ending at 100",
+				"failure_threshold must be between 0 and 1",
+				"stage_duration_seconds must not be negative",
+			},
+		},
+		"stages not ending at 100": {
+			validate:    firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Brand: "acme"}, Stages: []int{10, 50}}.Validate,
+			expectedErr: []string{"stages must be at most 10 increasing percentages ending at 100"},
+		},
+		"report": {
+			validate: firmware.Report{RolloutID: rolloutID, Status: firmware.DeviceFailed, Error: "checksum mismatch"}.Validate,
+		},
+		"invalid report": {
+			validate:    firmware.Report{RolloutID: "abc", Status: firmware.DevicePending}.Validate,
+			expectedErr: []string{"rollout_id must be a UUID", "status must be installing, succeeded or failed"},
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			err := tc.validate()
+			if (err != nil) != (len(tc.expectedErr) > 0) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			for _, msg := range tc.expectedErr {
+				if !strings.Contains(err.Error(), msg) {
+					t.Fatalf("expected %q in %v", msg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateRollout(t *testing.T) {
+	fw := firmware.Firmware{ID: firmwareID, Version: "2.0.0", Brands: []string{"acme", "globex"}}
+
+	var devices devicesMock
+	for i := 0; i < 20; i++ {
+		devices = append(devices, device.Device{ID: fmt.Sprintf("acme-%02d", i), Brand: "acme", Labels: map[string]string{"region": "eu"}})
+	}
+	devices = append(devices,
+		device.Device{ID: "initech-eu", Brand: "initech", Labels: map[string]string{"region": "eu"}},
+		device.Device{ID: "globex-us", Brand: "globex", Labels: map[string]string{"region": "us"}},
+	)
+
+	testTable := map[string]struct {
+		request        firmware.CreateRollout
+		firmwareErr    error
+		expectedStages []int
+		expectedErr    error
+	}{
+		"by brand": {
+			request:        firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Brand: "acme"}, Stages: []int{10, 50, 100}},
+			expectedStages: []int{2, 8, 10},
+		},
+		"by label leaves out incompatible devices": {
+			request:        firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Labels: map[string]string{"region": "eu"}}},
+			expectedStages: []int{1, 4, 15},
+		},
+		"incompatible brand": {
+			request:     firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Brand: "initech"}},
+			expectedErr: firmware.ErrIncompatible,
+		},
+		"no devices": {
+			request:     firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Brand: "globex", Labels: map[string]string{"region": "eu"}}},
+			expectedErr: firmware.ErrNoDevices,
+		},
+		"unknown firmware": {
+			request:     firmware.CreateRollout{FirmwareID: firmwareID, Target: firmware.Target{Brand: "acme"}},
+			firmwareErr: firmware.ErrNotFound,
+			expectedErr: firmware.ErrNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			clock := newClock()
+			var assigned []firmware.DeviceProgress
+			s := mocks.Store{}
+			s.On("FirmwareByID", mock.Anything, firmwareID).Return(fw, tc.firmwareErr)
+			s.On("CreateRollout", mock.Anything, mock.AnythingOfType("firmware.Rollout"), mock.Anything).
+				Run(func(args mock.Arguments) { assigned = args.Get(2).([]firmware.DeviceProgress) }).
+				Return(nil)
+			s.On("StageCounts", mock.Anything, mock.Anything).Return([]firmware.StageCount{}, nil)
+			b := firmware.NewBusiness(&s, devices, firmware.WithClock(clock.Now))
+
+			r, err := b.CreateRollout(context.Background(), tc.request)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr != nil {
+				s.AssertNotCalled(t, "CreateRollout", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			if r.Status != firmware.RolloutRunning || r.Stage != 0 || !r.StageStartedAt.Equal(clock.now) || r.Devices != len(assigned) {
+				t.Fatalf("expected a running rollout at its first stage, got %+v", r)
+			}
+			perStage := make([]int, len(r.Stages))
+			for _, d := range assigned {
+				if !strings.HasPrefix(d.DeviceID, "acme-") && d.DeviceID != "globex-us" || d.Status != firmware.DevicePending {
+					t.Fatalf("unexpected device %+v", d)
+				}
+				perStage[d.Stage]++
+			}
+			if fmt.Sprint(perStage) != fmt.Sprint(tc.expectedStages) {
+				t.Fatalf("expected %v devices per stage, got %v", tc.expectedStages, perStage)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	counts := func(stage int, pending, succeeded, failed int) []firmware.StageCount {
+		return []firmware.StageCount{
+			{Stage: stage, Status: firmware.DevicePending, Count: pending},
+			{Stage: stage, Status: firmware.DeviceSucceeded, Count: succeeded},
+			{Stage: stage, Status: firmware.DeviceFailed, Count: failed},
+			{Stage: stage + 1, Status: firmware.DevicePending, Count: 10},
+		}
+	}
+
+	testTable := map[string]struct {
+		stage            int
+		acceptedFailures int
+		elapsed          time.Duration
+		counts           []firmware.StageCount
+		expectedStatus   firmware.RolloutStatus
+		expectedStage    int
+		expectedChanged  int
+	}{
+		"stage still running": {
+			elapsed:        59 * time.Minute,
+			counts:         counts(0, 2, 8, 0),
+			expectedStatus: firmware.RolloutRunning,
+		},
+		"next stage": {
+			elapsed:         time.Hour,
+			counts:          counts(0, 2, 8, 0),
+			expectedStatus:  firmware.RolloutRunning,
+			expectedStage:   1,
+			expectedChanged: 1,
+		},
+		"stage without outcomes": {
+			elapsed:        2 * time.Hour,
+			counts:         counts(0, 10, 0, 0),
+			expectedStatus: firmware.RolloutRunning,
+		},
+		"too few outcomes": {
+			elapsed:        2 * time.Hour,
+			counts:         counts(0, 3, 7, 0),
+			expectedStatus: firmware.RolloutRunning,
+		},
+		"single early failure": {
+			elapsed:        10 * time.Minute,
+			counts:         counts(0, 9, 0, 1),
+			expectedStatus: firmware.RolloutRunning,
+		},
+		"failures past the minimum sample": {
+			elapsed:         10 * time.Minute,
+			counts:          counts(0, 5, 8, 2),
+			expectedStatus:  firmware.RolloutPaused,
+			expectedChanged: 1,
+		},
+		"too many failures": {
+			elapsed:         2 * time.Hour,
+			counts:          counts(0, 0, 8, 2),
+			expectedStatus:  firmware.RolloutPaused,
+			expectedChanged: 1,
+		},
+		"failures within the threshold": {
+			elapsed:         time.Hour,
+			counts:          counts(0, 0, 9, 1),
+			expectedStatus:  firmware.RolloutRunning,
+			expectedStage:   1,
+			expectedChanged: 1,
+		},
+		"accepted failures": {
+			acceptedFailures: 2,
+			elapsed:          time.Hour,
+			counts:           counts(0, 0, 8, 2),
+			expectedStatus:   firmware.RolloutRunning,
+			expectedStage:    1,
+			expectedChanged:  1,
+		},
+		"last stage waiting for reports": {
+			stage:          2,
+			elapsed:        48 * time.Hour,
+			counts:         counts(1, 1, 19, 0),
+			expectedStatus: firmware.RolloutRunning,
+			expectedStage:  2,
+		},
+		"completed": {
+			stage:           2,
+			counts:          counts(1, 0, 20, 0)[:3],
+			expectedStatus:  firmware.RolloutCompleted,
+			expectedStage:   2,
+			expectedChanged: 1,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			clock := newClock()
+			r := &firmware.Rollout{
+				ID:                   rolloutID,
+				Stages:               []int{10, 50, 100},
+				FailureThreshold:     0.1,
+				StageDurationSeconds: 3600,
+				Status:               firmware.RolloutRunning,
+				Stage:                tc.stage,
+				AcceptedFailures:     tc.acceptedFailures,
+				StageStartedAt:       clock.now,
+			}
+			clock.Advance(tc.elapsed)
+
+			s := mocks.Store{}
+			s.On("ListRollouts", mock.Anything, firmware.RolloutRunning, 0, mock.Anything).Return([]firmware.Rollout{*r}, nil)
+			s.On("StageCounts", mock.Anything, rolloutID).Return(tc.counts, nil)
+			s.On("UpdateRollout", mock.Anything, rolloutID).Return(r, nil)
+			b := firmware.NewBusiness(&s, devicesMock{}, firmware.WithClock(clock.Now))
+
+			changed, err := b.Evaluate(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed != tc.expectedChanged || r.Status != tc.expectedStatus || r.Stage != tc.expectedStage {
+				t.Fatalf("expected %d change to %s at stage %d, got %d to %s at stage %d", tc.expectedChanged, tc.expectedStatus, tc.expectedStage, changed, r.Status, r.Stage)
+			}
+			if tc.expectedStatus == firmware.RolloutPaused && !strings.Contains(r.PauseReason, "failure rate 20.0% is above the threshold of 10.0%") {
+				t.Fatalf("expected the failure rate as the reason, got %q", r.PauseReason)
+			}
+			if tc.expectedChanged > 0 && !r.UpdatedAt.Equal(clock.now) {
+				t.Fatalf("expected the rollout to be updated at %v, got %v", clock.now, r.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	testTable := map[string]struct {
+		from           firmware.RolloutStatus
+		transition     func(b *firmware.Business) (firmware.Rollout, error)
+		expectedStatus firmware.RolloutStatus
+		expectedErr    error
+	}{
+		"pause": {
+			from: firmware.RolloutRunning,
+			transition: func(b *firmware.Business) (firmware.Rollout, error) {
+				return b.PauseRollout(context.Background(), rolloutID)
+			},
+			expectedStatus: firmware.RolloutPaused,
+		},
+		"resume": {
+			from: firmware.RolloutPaused,
+			transition: func(b *firmware.Business) (firmware.Rollout, error) {
+				return b.ResumeRollout(context.Background(), rolloutID)
+			},
+			expectedStatus: firmware.RolloutRunning,
+		},
+		"cancel": {
+			from: firmware.RolloutPaused,
+			transition: func(b *firmware.Business) (firmware.Rollout, error) {
+				return b.CancelRollout(context.Background(), rolloutID)
+			},
+			expectedStatus: firmware.RolloutCancelled,
+		},
+		"resume a running rollout": {
+			from: firmware.RolloutRunning,
+			transition: func(b *firmware.Business) (firmware.Rollout, error) {
+				return b.ResumeRollout(context.Background(), rolloutID)
+			},
+			expectedErr: firmware.ErrInvalidTransition,
+		},
+		"cancel a completed rollout": {
+			from: firmware.RolloutCompleted,
+			transition: func(b *firmware.Business) (firmware.Rollout, error) {
+				return b.CancelRollout(context.Background(), rolloutID)
+			},
+			expectedErr: firmware.ErrInvalidTransition,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			clock := newClock()
+			started := clock.now
+			clock.Advance(time.Hour)
+			r := &firmware.Rollout{ID: rolloutID, Stages: []int{100}, Status: tc.from, StageStartedAt: started}
+
+			s := mocks.Store{}
+			s.On("StageCounts", mock.Anything, rolloutID).Return([]firmware.StageCount{
+				{Stage: 0, Status: firmware.DeviceFailed, Count: 3},
+				{Stage: 0, Status: firmware.DeviceSucceeded, Count: 7},
+			}, nil)
+			s.On("UpdateRollout", mock.Anything, rolloutID).Return(r, nil)
+			b := firmware.NewBusiness(&s, devicesMock{}, firmware.WithClock(clock.Now))
+
+			got, err := tc.transition(b)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr != nil {
+				return
+			}
+			if got.Status != tc.expectedStatus || got.Progress == nil || got.Progress.Failed != 3 {
+				t.Fatalf("expected a %s rollout with its progress, got %+v", tc.expectedStatus, got)
+			}
+			if tc.expectedStatus == firmware.RolloutRunning && (got.AcceptedFailures != 3 || !got.StageStartedAt.Equal(clock.now)) {
+				t.Fatalf("expected the resumed rollout to accept its failures and restart its stage, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	testTable := map[string]struct {
+		deviceStage    int
+		deviceStatus   firmware.DeviceStatus
+		rolloutStatus  firmware.RolloutStatus
+		report         firmware.Report
+		expectedStatus firmware.DeviceStatus
+		expectedErr    error
+	}{
+		"installing": {
+			deviceStatus:   firmware.DevicePending,
+			rolloutStatus:  firmware.RolloutRunning,
+			report:         firmware.Report{RolloutID: rolloutID, Status: firmware.DeviceInstalling},
+			expectedStatus: firmware.DeviceInstalling,
+		},
+		"failed while paused": {
+			deviceStatus:   firmware.DeviceInstalling,
+			rolloutStatus:  firmware.RolloutPaused,
+			report:         firmware.Report{RolloutID: rolloutID, Status: firmware.DeviceFailed, Error: "checksum mismatch"},
+			expectedStatus: firmware.DeviceFailed,
+		},
+		"stage not released": {
+			deviceStage:   1,
+			deviceStatus:  firmware.DevicePending,
+			rolloutStatus: firmware.RolloutRunning,
+			report:        firmware.Report{RolloutID: rolloutID, Status: firmware.DeviceSucceeded},
+			expectedErr:   firmware.ErrNotAssigned,
+		},
+		"cancelled rollout": {
+			deviceStatus:  firmware.DeviceInstalling,
+			rolloutStatus: firmware.RolloutCancelled,
+			report:        firmware.Report{RolloutID: rolloutID, Status: firmware.DeviceSucceeded},
+			expectedErr:   firmware.ErrNotAssigned,
+		},
+		"already reported": {
+			deviceStatus:  firmware.DeviceSucceeded,
+			rolloutStatus: firmware.RolloutRunning,
+			report:        firmware.Report{RolloutID: rolloutID, Status: firmware.DeviceFailed},
+			expectedErr:   firmware.ErrAlreadyReported,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			clock := newClock()
+			p := &firmware.DeviceProgress{RolloutID: rolloutID, DeviceID: "dev", Stage: tc.deviceStage, Status: tc.deviceStatus}
+			r := firmware.Rollout{ID: rolloutID, Status: tc.rolloutStatus}
+
+			s := mocks.Store{}
+			s.On("Report", mock.Anything, "dev", rolloutID).Return(p, r, nil)
+			b := firmware.NewBusiness(&s, devicesMock{}, firmware.WithClock(clock.Now))
+
+			got, err := b.Report(context.Background(), "dev", tc.report)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr != nil {
+				return
+			}
+			if got.Status != tc.expectedStatus || got.Error != tc.report.Error || !got.UpdatedAt.Equal(clock.now) {
+				t.Fatalf("expected the device to be %s, got %+v", tc.expectedStatus, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Engine runs the rollouts: every interval it pauses the ones failing too
+// often, releases their next stages and completes the finished ones
+type Engine struct {
+	business *Business
+	interval time.Duration
+}
+
+// NewEngine creates a new Engine instance that evaluates the running
+// rollouts every interval, at the time of the clock of b
+func NewEngine(b *Business, interval time.Duration) *Engine {
+	return &Engine{
+		business: b,
+		interval: interval,
+	}
+}
+
+// Run evaluates the rollouts until ctx is cancelled
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.business.Evaluate(ctx); err != nil {
+			logrus.WithError(fmt.Errorf("business.Evaluate: %w", err)).Error("unable to evaluate rollouts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package firmware
+
+import (
+	"device/business/device"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxVersionLength matches the longest firmware a device can report in a heartbeat
+	maxVersionLength = 64
+	// maxBrands is the number of brands a firmware may be compatible with
+	maxBrands = 32
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrVersionExists is returned when registering a version twice
+	ErrVersionExists = errors.New("firmware version already exists")
+	// ErrInUse is returned when deleting a firmware a rollout installs
+	ErrInUse = errors.New("firmware in use")
+)
+
+var (
+	// version is the format of firmware versions, e.g. 1.4.2 or 2.0.0-rc.1
+	version = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z.+_-]*$`)
+	// checksum is the format of artifact checksums
+	checksum = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+// Firmware is a version of the software of devices, installable on the
+// devices of the brands it is compatible with
+type Firmware struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	// Brands are the brands of the devices the firmware can be installed on
+	Brands []string `json:"brands"`
+	// Checksum is the digest of the artifact, e.g. sha256:9f86d0...
+	Checksum string `json:"checksum"`
+	// ArtifactURL is where devices download the firmware from
+	ArtifactURL string    `json:"artifact_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Compatible reports whether the firmware can be installed on d
+func (f Firmware) Compatible(d device.Device) bool {
+	for _, b := range f.Brands {
+		if b == d.Brand {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateFirmware represents the data needed to register a firmware
+type CreateFirmware struct {
+	Version     string   `json:"version"`
+	Brands      []string `json:"brands"`
+	Checksum    string   `json:"checksum"`
+	ArtifactURL string   `json:"artifact_url"`
+}
+
+// Validate validates the CreateFirmware fields
+func (cf CreateFirmware) Validate() error {
+	var errs []error
+	if len(cf.Version) > maxVersionLength || !version.MatchString(cf.Version) {
+		errs = append(errs, fmt.Errorf("version must be at most %d letters, digits, dots, dashes, underscores and pluses", maxVersionLength))
+	}
+	if len(cf.Brands) == 0 || len(cf.Brands) > maxBrands {
+		errs = append(errs, fmt.Errorf("brands must list between 1 and %d brands", maxBrands))
+	}
+	for _, b := range cf.Brands {
+		if b == "" {
+			errs = append(errs, fmt.Errorf("brands must not be empty"))
+			break
+		}
+	}
+	if !checksum.MatchString(cf.Checksum) {
+		errs = append(errs, fmt.Errorf("checksum must be sha256: followed by 64 lowercase hex digits"))
+	}
+	if u, err := url.Parse(cf.ArtifactURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("artifact_url must be an http or https URL"))
+	}
+	return errors.Join(errs...)
+}
+
+// toFirmware converts a CreateFirmware to a Firmware created at now
+func (cf CreateFirmware) toFirmware(now time.Time) Firmware {
+	return Firmware{
+		ID:          uuid.NewString(),
+		Version:     cf.Version,
+		Brands:      cf.Brands,
+		Checksum:    cf.Checksum,
+		ArtifactURL: cf.ArtifactURL,
+		CreatedAt:   now,
+	}
+}
@@ -0,0 +1,457 @@
+package firmware
+
+import (
+	"crypto/sha256"
+	"device/business/device"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxStages is the number of stages a rollout may have
+	maxStages = 10
+	// maxErrorLength bounds the error a device reports with a failure
+	maxErrorLength = 512
+)
+
+// DefaultStages are the stages of a rollout that sets none
+var DefaultStages = []int{5, 25, 100}
+
+const (
+	// DefaultFailureThreshold is the failure threshold of a rollout that sets none
+	DefaultFailureThreshold = 0.1
+	// DefaultStageDuration is the stage duration of a rollout that sets none
+	DefaultStageDuration = time.Hour
+	// MinStageReported is the share of the devices of a stage that must have
+	// reported the outcome of their update before the next stage is released
+	MinStageReported = 0.8
+	// MinFailureSample is the number of outcomes the failure rate needs before
+	// it can pause a rollout, unless every released device already reported
+	MinFailureSample = 10
+)
+
+var (
+	ErrRolloutNotFound = errors.New("rollout not found")
+	// ErrIncompatible is returned when a rollout targets a brand its firmware
+	// is not compatible with
+	ErrIncompatible = errors.New("firmware not compatible with target")
+	// ErrNoDevices is returned when no compatible device matches the target of a rollout
+	ErrNoDevices = errors.New("no device matches the target")
+	// ErrInvalidTransition is returned when pausing, resuming or cancelling a
+	// rollout in a status that does not allow it
+	ErrInvalidTransition = errors.New("invalid rollout transition")
+	// ErrNoUpdate is returned when a device has no firmware to install
+	ErrNoUpdate = errors.New("no firmware update")
+	// ErrNotAssigned is returned when a device reports on a rollout it is not
+	// part of, or whose current stages do not include it yet
+	ErrNotAssigned = errors.New("device not assigned to rollout")
+	// ErrAlreadyReported is returned when a device reports on an update it
+	// already reported the outcome of
+	ErrAlreadyReported = errors.New("outcome already reported")
+)
+
+// RolloutStatus is the stage of the lifecycle of a rollout: running until it
+// completes or is cancelled, and paused in between when the failure rate of
+// its devices crosses the threshold or an operator pauses it
+type RolloutStatus string
+
+// Rollout statuses
+const (
+	RolloutRunning   RolloutStatus = "running"
+	RolloutPaused    RolloutStatus = "paused"
+	RolloutCompleted RolloutStatus = "completed"
+	RolloutCancelled RolloutStatus = "cancelled"
+)
+
+// Valid reports whether s is a known status
+func (s RolloutStatus) Valid() bool {
+	switch s {
+	case RolloutRunning, RolloutPaused, RolloutCompleted, RolloutCancelled:
+		return true
+	}
+	return false
+}
+
+// DeviceStatus is the progress of the update of a device: pending until
+// the device reports it is installing the firmware, then succeeded or failed
+type DeviceStatus string
+
+// Device statuses
+const (
+	DevicePending    DeviceStatus = "pending"
+	DeviceInstalling DeviceStatus = "installing"
+	DeviceSucceeded  DeviceStatus = "succeeded"
+	DeviceFailed     DeviceStatus = "failed"
+)
+
+// Valid reports whether s is a known status
+func (s DeviceStatus) Valid() bool {
+	switch s {
+	case DevicePending, DeviceInstalling, DeviceSucceeded, DeviceFailed:
+		return true
+	}
+	return false
+}
+
+// done reports whether the device reported the outcome of its update
+func (s DeviceStatus) done() bool {
+	return s == DeviceSucceeded || s == DeviceFailed
+}
+
+// Target selects the devices of a rollout. Both fields narrow it, and the
+// devices a firmware is not compatible with are always left out.
+type Target struct {
+	Brand  string            `json:"brand,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// filter returns the device filter of the target
+func (t Target) filter() device.Filter {
+	return device.Filter{Brand: t.Brand, Labels: t.Labels}
+}
+
+// Rollout installs a firmware on the devices of a target in stages. Each
+// stage releases the update to a larger share of the devices, once the
+// previous one has run for the stage duration with a failure rate within
+// the threshold.
+type Rollout struct {
+	ID         string `json:"id"`
+	FirmwareID string `json:"firmware_id"`
+	Target     Target `json:"target"`
+	// Stages are the cumulative percentages of the devices each stage releases the update to
+	Stages []int `json:"stages"`
+	// FailureThreshold is the share of failed updates, from 0 to 1, that pauses the rollout
+	FailureThreshold float64 `json:"failure_threshold"`
+	// StageDurationSeconds is how long a stage runs before the next one starts
+	StageDurationSeconds int           `json:"stage_duration_seconds"`
+	Status               RolloutStatus `json:"status"`
+	// Stage is the index of the last stage released
+	Stage       int    `json:"stage"`
+	PauseReason string `json:"pause_reason,omitempty"`
+	// AcceptedFailures is the number of failures an operator accepted by
+	// resuming the rollout, which no longer count toward the failure rate
+	AcceptedFailures int `json:"accepted_failures"`
+	// Devices is the number of devices the rollout targets
+	Devices        int        `json:"devices"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	StageStartedAt time.Time  `json:"stage_started_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	// Progress counts the devices by status. It is left out of lists.
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// stageDuration returns the duration of the stages of the rollout
+func (r Rollout) stageDuration() time.Duration {
+	return time.Duration(r.StageDurationSeconds) * time.Second
+}
+
+// Progress counts the devices of a rollout by the status of their update.
+// Devices of stages not released yet are scheduled.
+type Progress struct {
+	Scheduled  int `json:"scheduled"`
+	Pending    int `json:"pending"`
+	Installing int `json:"installing"`
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+}
+
+// FailureRate returns the share of failed updates among the updates whose
+// outcome is known, leaving out accepted failures
+func (p Progress) FailureRate(accepted int) float64 {
+	failed := p.Failed - accepted
+	done := p.Succeeded + failed
+	if failed <= 0 || done <= 0 {
+		return 0
+	}
+	return float64(failed) / float64(done)
+}
+
+// reported returns the number of devices that reported the outcome of their update
+func (p Progress) reported() int {
+	return p.Succeeded + p.Failed
+}
+
+// released returns the number of devices the update was released to
+func (p Progress) released() int {
+	return p.Pending + p.Installing + p.reported()
+}
+
+// StageCount is the number of devices of a stage of a rollout with a status
+type StageCount struct {
+	Stage  int
+	Status DeviceStatus
+	Count  int
+}
+
+// progress sums counts into the progress of a rollout at stage
+func progress(counts []StageCount, stage int) Progress {
+	var p Progress
+	for _, c := range counts {
+		if c.Stage > stage {
+			p.Scheduled += c.Count
+			continue
+		}
+		switch c.Status {
+		case DevicePending:
+			p.Pending += c.Count
+		case DeviceInstalling:
+			p.Installing += c.Count
+		case DeviceSucceeded:
+			p.Succeeded += c.Count
+		case DeviceFailed:
+			p.Failed += c.Count
+		}
+	}
+	return p
+}
+
+// stageProgress sums the counts of the devices of stage alone
+func stageProgress(counts []StageCount, stage int) Progress {
+	var current []StageCount
+	for _, c := range counts {
+		if c.Stage == stage {
+			current = append(current, c)
+		}
+	}
+	return progress(current, stage)
+}
+
+// evaluate moves the running rollout r along given the counts of its devices
+// at now: it pauses it when the failure rate crosses the threshold, releases
+// the next stage once the current one has run for the stage duration and
+// enough of its devices reported, and completes it once every device
+// reported the outcome of its update. It reports whether r changed.
+func (r *Rollout) evaluate(counts []StageCount, now time.Time) bool {
+	if r.Status != RolloutRunning {
+		return false
+	}
+
+	// a few early outcomes say little about the failure rate
+	p := progress(counts, r.Stage)
+	sampled := p.reported()-r.AcceptedFailures >= MinFailureSample || p.Pending+p.Installing == 0
+	if rate := p.FailureRate(r.AcceptedFailures); sampled && rate > r.FailureThreshold {
+		r.Status = RolloutPaused
+		r.PauseReason = fmt.Sprintf("failure rate %.1f%% is above the threshold of %.1f%%", rate*100, r.FailureThreshold*100)
+		r.UpdatedAt = now
+		return true
+	}
+
+	if r.Stage < len(r.Stages)-1 {
+		if now.Sub(r.StageStartedAt) < r.stageDuration() {
+			return false
+		}
+		// devices that have not reported, e.g. offline ones, are no evidence for a larger stage
+		if current := stageProgress(counts, r.Stage); float64(current.reported()) < MinStageReported*float64(current.released()) {
+			return false
+		}
+		r.Stage++
+		r.StageStartedAt = now
+		r.UpdatedAt = now
+		return true
+	}
+
+	if p.Pending > 0 || p.Installing > 0 || p.Scheduled > 0 {
+		return false
+	}
+	r.Status = RolloutCompleted
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+	return true
+}
+
+// transition moves r to status at now, if its current status allows it
+func (r *Rollout) transition(to RolloutStatus, p Progress, now time.Time) error {
+	switch {
+	case to == RolloutPaused && r.Status == RolloutRunning:
+		r.PauseReason = "paused by an operator"
+	case to == RolloutRunning && r.Status == RolloutPaused:
+		// resuming accepts the failures so far, and restarts the stage
+		r.PauseReason = ""
+		r.AcceptedFailures = p.Failed
+		r.StageStartedAt = now
+	case to == RolloutCancelled && (r.Status == RolloutRunning || r.Status == RolloutPaused):
+		r.PauseReason = ""
+		r.CompletedAt = &now
+	default:
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, r.Status, to)
+	}
+	r.Status = to
+	r.UpdatedAt = now
+	return nil
+}
+
+// CreateRollout represents the data needed to start a rollout. Stages,
+// FailureThreshold and StageDurationSeconds are optional.
+type CreateRollout struct {
+	FirmwareID string `json:"firmware_id"`
+	Target     Target `json:"target"`
+	// Stages are increasing cumulative percentages ending at 100, e.g. [5, 25, 100]
+	Stages               []int    `json:"stages,omitempty"`
+	FailureThreshold     *float64 `json:"failure_threshold,omitempty"`
+	StageDurationSeconds int      `json:"stage_duration_seconds,omitempty"`
+}
+
+// Validate validates the CreateRollout fields
+func (cr CreateRollout) Validate() error {
+	var errs []error
+	if _, err := uuid.Parse(cr.FirmwareID); err != nil {
+		errs = append(errs, fmt.Errorf("firmware_id must be a UUID"))
+	}
+	if cr.Target.Brand == "" && len(cr.Target.Labels) == 0 {
+		errs = append(errs, fmt.Errorf("target must set a brand or labels"))
+	}
+	if err := device.ValidateLabels(cr.Target.Labels); err != nil {
+		errs = append(errs, fmt.Errorf("target: %w", err))
+	}
+	if cr.Stages != nil {
+		if err := validateStages(cr.Stages); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cr.FailureThreshold != nil && (*cr.FailureThreshold < 0 || *cr.FailureThreshold > 1 || math.IsNaN(*cr.FailureThreshold)) {
+		errs = append(errs, fmt.Errorf("failure_threshold must be between 0 and 1"))
+	}
+	if cr.StageDurationSeconds < 0 {
+		errs = append(errs, fmt.Errorf("stage_duration_seconds must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateStages reports an error unless stages are increasing percentages ending at 100
+func validateStages(stages []int) error {
+	err := fmt.Errorf("stages must be at most %d increasing percentages ending at 100", maxStages)
+	if len(stages) == 0 || len(stages) > maxStages || stages[len(stages)-1] != 100 {
+		return err
+	}
+	for i, s := range stages {
+		if s <= 0 || i > 0 && s <= stages[i-1] {
+			return err
+		}
+	}
+	return nil
+}
+
+// toRollout converts a CreateRollout to a Rollout of n devices started at now
+func (cr CreateRollout) toRollout(n int, now time.Time) Rollout {
+	r := Rollout{
+		ID:                   uuid.NewString(),
+		FirmwareID:           cr.FirmwareID,
+		Target:               cr.Target,
+		Stages:               cr.Stages,
+		FailureThreshold:     DefaultFailureThreshold,
+		StageDurationSeconds: int(DefaultStageDuration / time.Second),
+		Status:               RolloutRunning,
+		Devices:              n,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+		StageStartedAt:       now,
+	}
+	if r.Stages == nil {
+		r.Stages = DefaultStages
+	}
+	if cr.FailureThreshold != nil {
+		r.FailureThreshold = *cr.FailureThreshold
+	}
+	if cr.StageDurationSeconds > 0 {
+		r.StageDurationSeconds = cr.StageDurationSeconds
+	}
+	return r
+}
+
+// DeviceProgress is the progress of the update of a device in a rollout
+type DeviceProgress struct {
+	RolloutID string `json:"rollout_id"`
+	DeviceID  string `json:"device_id"`
+	// Stage is the index of the stage that releases the update to the device
+	Stage     int          `json:"stage"`
+	Status    DeviceStatus `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// assign spreads the device ids over the stages of r. The order of the
+// devices is random but stable, so a stage does not favour old devices.
+func assign(r Rollout, ids []string) []DeviceProgress {
+	type ranked struct {
+		id  string
+		key [sha256.Size]byte
+	}
+	rs := make([]ranked, len(ids))
+	for i, id := range ids {
+		rs[i] = ranked{id: id, key: sha256.Sum256([]byte(r.ID + "/" + id))}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return string(rs[i].key[:]) < string(rs[j].key[:])
+	})
+
+	devices := make([]DeviceProgress, len(rs))
+	stage := 0
+	for i, d := range rs {
+		// the devices of a stage are the ones past the share of the previous stages
+		for i >= int(math.Ceil(float64(r.Stages[stage])*float64(len(rs))/100)) {
+			stage++
+		}
+		devices[i] = DeviceProgress{
+			RolloutID: r.ID,
+			DeviceID:  d.id,
+			Stage:     stage,
+			Status:    DevicePending,
+			UpdatedAt: r.CreatedAt,
+		}
+	}
+	return devices
+}
+
+// DeviceUpdate is the firmware a device has to install
+type DeviceUpdate struct {
+	RolloutID string       `json:"rollout_id"`
+	Status    DeviceStatus `json:"status"`
+	Firmware  Firmware     `json:"firmware"`
+}
+
+// Report is the progress a device reports on its update
+type Report struct {
+	RolloutID string `json:"rollout_id"`
+	// Status is installing, succeeded or failed
+	Status DeviceStatus `json:"status"`
+	// Error optionally tells why the update failed
+	Error string `json:"error,omitempty"`
+}
+
+// Validate validates the Report fields
+func (rp Report) Validate() error {
+	var errs []error
+	if _, err := uuid.Parse(rp.RolloutID); err != nil {
+		errs = append(errs, fmt.Errorf("rollout_id must be a UUID"))
+	}
+	if rp.Status != DeviceInstalling && rp.Status != DeviceSucceeded && rp.Status != DeviceFailed {
+		errs = append(errs, fmt.Errorf("status must be installing, succeeded or failed"))
+	}
+	if len(rp.Error) > maxErrorLength {
+		errs = append(errs, fmt.Errorf("error must be at most %d characters", maxErrorLength))
+	}
+	return errors.Join(errs...)
+}
+
+// apply records the report on the progress p of a device in the rollout r at now
+func (rp Report) apply(p *DeviceProgress, r Rollout, now time.Time) error {
+	if p.Stage > r.Stage || r.Status == RolloutCancelled {
+		return ErrNotAssigned
+	}
+	if p.Status.done() {
+		return ErrAlreadyReported
+	}
+	p.Status = rp.Status
+	p.Error = ""
+	if rp.Status == DeviceFailed {
+		p.Error = rp.Error
+	}
+	p.UpdatedAt = now
+	return nil
+}
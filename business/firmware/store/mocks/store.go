@@ -0,0 +1,93 @@
+package mocks
+
+import (
+	"context"
+	"device/business/firmware"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the firmware store
+type Store struct {
+	mock.Mock
+}
+
+var _ firmware.Store = (*Store)(nil)
+
+func (s *Store) CreateFirmware(ctx context.Context, f firmware.Firmware) error {
+	args := s.Called(ctx, f)
+	return args.Error(0)
+}
+
+func (s *Store) FirmwareByID(ctx context.Context, id string) (firmware.Firmware, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(firmware.Firmware), args.Error(1)
+}
+
+func (s *Store) ListFirmware(ctx context.Context, brand string, offset, limit int) ([]firmware.Firmware, error) {
+	args := s.Called(ctx, brand, offset, limit)
+	return args.Get(0).([]firmware.Firmware), args.Error(1)
+}
+
+func (s *Store) DeleteFirmware(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *Store) CreateRollout(ctx context.Context, r firmware.Rollout, devices []firmware.DeviceProgress) error {
+	args := s.Called(ctx, r, devices)
+	return args.Error(0)
+}
+
+func (s *Store) RolloutByID(ctx context.Context, id string) (firmware.Rollout, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(firmware.Rollout), args.Error(1)
+}
+
+func (s *Store) ListRollouts(ctx context.Context, status firmware.RolloutStatus, offset, limit int) ([]firmware.Rollout, error) {
+	args := s.Called(ctx, status, offset, limit)
+	return args.Get(0).([]firmware.Rollout), args.Error(1)
+}
+
+// UpdateRollout applies update to the rollout the mock returns a pointer
+// to, so tests see the updated rollout
+func (s *Store) UpdateRollout(ctx context.Context, id string, update func(r *firmware.Rollout) error) (firmware.Rollout, error) {
+	args := s.Called(ctx, id)
+	if err := args.Error(1); err != nil {
+		return firmware.Rollout{}, err
+	}
+	r := args.Get(0).(*firmware.Rollout)
+	if err := update(r); err != nil {
+		return firmware.Rollout{}, err
+	}
+	return *r, nil
+}
+
+func (s *Store) StageCounts(ctx context.Context, id string) ([]firmware.StageCount, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).([]firmware.StageCount), args.Error(1)
+}
+
+func (s *Store) RolloutDevices(ctx context.Context, id string, status firmware.DeviceStatus, offset, limit int) ([]firmware.DeviceProgress, error) {
+	args := s.Called(ctx, id, status, offset, limit)
+	return args.Get(0).([]firmware.DeviceProgress), args.Error(1)
+}
+
+func (s *Store) PendingUpdate(ctx context.Context, deviceID string) (firmware.DeviceProgress, error) {
+	args := s.Called(ctx, deviceID)
+	return args.Get(0).(firmware.DeviceProgress), args.Error(1)
+}
+
+// Report applies update to the progress the mock returns a pointer to, in
+// the rollout it returns
+func (s *Store) Report(ctx context.Context, deviceID, rolloutID string, update func(p *firmware.DeviceProgress, r firmware.Rollout) error) (firmware.DeviceProgress, error) {
+	args := s.Called(ctx, deviceID, rolloutID)
+	if err := args.Error(2); err != nil {
+		return firmware.DeviceProgress{}, err
+	}
+	p := args.Get(0).(*firmware.DeviceProgress)
+	if err := update(p, args.Get(1).(firmware.Rollout)); err != nil {
+		return firmware.DeviceProgress{}, err
+	}
+	return *p, nil
+}
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"device/business/firmware"
+	"time"
+)
+
+// Firmware represents a firmware of the catalog
+type Firmware struct {
+	ID          string    `gorm:"primaryKey;column:id"`
+	Version     string    `gorm:"column:version;uniqueIndex:idx_firmware_version"`
+	Brands      []string  `gorm:"column:brands;type:jsonb;serializer:json"`
+	Checksum    string    `gorm:"column:checksum"`
+	ArtifactURL string    `gorm:"column:artifact_url"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+}
+
+// TableName overrides the default table name
+func (Firmware) TableName() string {
+	return "firmware"
+}
+
+// Rollout represents a firmware rollout
+type Rollout struct {
+	ID                   string          `gorm:"primaryKey;column:id"`
+	FirmwareID           string          `gorm:"column:firmware_id;index:idx_firmware_rollouts_firmware"`
+	Target               firmware.Target `gorm:"column:target;type:jsonb;serializer:json"`
+	Stages               []int           `gorm:"column:stages;type:jsonb;serializer:json"`
+	FailureThreshold     float64         `gorm:"column:failure_threshold"`
+	StageDurationSeconds int             `gorm:"column:stage_duration_seconds"`
+	Status               string          `gorm:"column:status;index:idx_firmware_rollouts_status"`
+	Stage                int             `gorm:"column:stage"`
+	PauseReason          string          `gorm:"column:pause_reason"`
+	AcceptedFailures     int             `gorm:"column:accepted_failures"`
+	Devices              int             `gorm:"column:devices"`
+	CreatedAt            time.Time       `gorm:"column:created_at"`
+	UpdatedAt            time.Time       `gorm:"column:updated_at"`
+	StageStartedAt       time.Time       `gorm:"column:stage_started_at"`
+	CompletedAt          *time.Time      `gorm:"column:completed_at"`
+}
+
+// TableName overrides the default table name
+func (Rollout) TableName() string {
+	return "firmware_rollouts"
+}
+
+// RolloutDevice represents the progress of a device in a rollout
+type RolloutDevice struct {
+	RolloutID string `gorm:"primaryKey;column:rollout_id"`
+	// devices look up their pending update by device
+	DeviceID  string    `gorm:"primaryKey;column:device_id;index:idx_firmware_rollout_devices_device"`
+	Stage     int       `gorm:"column:stage"`
+	Status    string    `gorm:"column:status"`
+	Error     string    `gorm:"column:error"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+// TableName overrides the default table name
+func (RolloutDevice) TableName() string {
+	return "firmware_rollout_devices"
+}
+
+// toBusinessFirmware converts a Firmware to a firmware.Firmware
+func toBusinessFirmware(f Firmware) firmware.Firmware {
+	return firmware.Firmware{
+		ID:          f.ID,
+		Version:     f.Version,
+		Brands:      f.Brands,
+		Checksum:    f.Checksum,
+		ArtifactURL: f.ArtifactURL,
+		CreatedAt:   f.CreatedAt,
+	}
+}
+
+// fromBusinessFirmware converts a firmware.Firmware to a Firmware
+func fromBusinessFirmware(f firmware.Firmware) Firmware {
+	return Firmware{
+		ID:          f.ID,
+		Version:     f.Version,
+		Brands:      f.Brands,
+		Checksum:    f.Checksum,
+		ArtifactURL: f.ArtifactURL,
+		CreatedAt:   f.CreatedAt,
+	}
+}
+
+// toBusinessRollout converts a Rollout to a firmware.Rollout
+func toBusinessRollout(r Rollout) firmware.Rollout {
+	return firmware.Rollout{
+		ID:                   r.ID,
+		FirmwareID:           r.FirmwareID,
+		Target:               r.Target,
+		Stages:               r.Stages,
+		FailureThreshold:     r.FailureThreshold,
+		StageDurationSeconds: r.StageDurationSeconds,
+		Status:               firmware.RolloutStatus(r.Status),
+		Stage:                r.Stage,
+		PauseReason:          r.PauseReason,
+		AcceptedFailures:     r.AcceptedFailures,
+		Devices:              r.Devices,
+		CreatedAt:            r.CreatedAt,
+		UpdatedAt:            r.UpdatedAt,
+		StageStartedAt:       r.StageStartedAt,
+		CompletedAt:          r.CompletedAt,
+	}
+}
+
+// fromBusinessRollout converts a firmware.Rollout to a Rollout
+func fromBusinessRollout(r firmware.Rollout) Rollout {
+	return Rollout{
+		ID:                   r.ID,
+		FirmwareID:           r.FirmwareID,
+		Target:               r.Target,
+		Stages:               r.Stages,
+		FailureThreshold:     r.FailureThreshold,
+		StageDurationSeconds: r.StageDurationSeconds,
+		Status:               string(r.Status),
+		Stage:                r.Stage,
+		PauseReason:          r.PauseReason,
+		AcceptedFailures:     r.AcceptedFailures,
+		Devices:              r.Devices,
+		CreatedAt:            r.CreatedAt,
+		UpdatedAt:            r.UpdatedAt,
+		StageStartedAt:       r.StageStartedAt,
+		CompletedAt:          r.CompletedAt,
+	}
+}
+
+// toBusinessProgress converts a RolloutDevice to a firmware.DeviceProgress
+func toBusinessProgress(d RolloutDevice) firmware.DeviceProgress {
+	return firmware.DeviceProgress{
+		RolloutID: d.RolloutID,
+		DeviceID:  d.DeviceID,
+		Stage:     d.Stage,
+		Status:    firmware.DeviceStatus(d.Status),
+		Error:     d.Error,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
+
+// fromBusinessProgress converts a firmware.DeviceProgress to a RolloutDevice
+func fromBusinessProgress(p firmware.DeviceProgress) RolloutDevice {
+	return RolloutDevice{
+		RolloutID: p.RolloutID,
+		DeviceID:  p.DeviceID,
+		Stage:     p.Stage,
+		Status:    string(p.Status),
+		Error:     p.Error,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
@@ -0,0 +1,317 @@
+package postgres
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/firmware"
+	"device/pkg/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createBatchSize is the number of rollout devices inserted per statement
+const createBatchSize = 1000
+
+// Store is a postgres implementation of the firmware.Store
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements firmware.Store and device.Dependent
+var (
+	_ firmware.Store   = (*Store)(nil)
+	_ device.Dependent = (*Store)(nil)
+)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// CreateFirmware creates a firmware, unless its version exists
+func (s *Store) CreateFirmware(ctx context.Context, f firmware.Firmware) error {
+	row := fromBusinessFirmware(f)
+	result := database.Conn(ctx, s.db).Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return firmware.ErrVersionExists
+	}
+	return nil
+}
+
+// FirmwareByID returns a firmware by its ID
+func (s *Store) FirmwareByID(ctx context.Context, id string) (firmware.Firmware, error) {
+	var f Firmware
+	result := database.Conn(ctx, s.db).First(&f, "id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return firmware.Firmware{}, firmware.ErrNotFound
+	}
+	if result.Error != nil {
+		return firmware.Firmware{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessFirmware(f), nil
+}
+
+// ListFirmware returns the firmware compatible with brand, or all of it if
+// brand is empty, newest first
+func (s *Store) ListFirmware(ctx context.Context, brand string, offset, limit int) ([]firmware.Firmware, error) {
+	q := database.Conn(ctx, s.db)
+	if brand != "" {
+		brands, err := json.Marshal([]string{brand})
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal: %w", err)
+		}
+		q = q.Where("brands @> ?::jsonb", string(brands))
+	}
+
+	var rows []Firmware
+	result := q.Order("created_at DESC").Offset(offset).Limit(limit).Find(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	fs := make([]firmware.Firmware, len(rows))
+	for i, f := range rows {
+		fs[i] = toBusinessFirmware(f)
+	}
+	return fs, nil
+}
+
+// DeleteFirmware deletes a firmware no rollout installs
+func (s *Store) DeleteFirmware(ctx context.Context, id string) error {
+	return database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		// the lock keeps rollouts from being created for the firmware meanwhile
+		var f Firmware
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&f, "id = ?", id)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return firmware.ErrNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+
+		var rollouts int64
+		if result := tx.Model(&Rollout{}).Where("firmware_id = ?", id).Count(&rollouts); result.Error != nil {
+			return fmt.Errorf("db.Count[%s]: %w", id, result.Error)
+		}
+		if rollouts > 0 {
+			return firmware.ErrInUse
+		}
+
+		if result := tx.Delete(&Firmware{}, "id = ?", id); result.Error != nil {
+			return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+}
+
+// CreateRollout creates a rollout along with the progress of its devices
+func (s *Store) CreateRollout(ctx context.Context, r firmware.Rollout, devices []firmware.DeviceProgress) error {
+	return database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		// the firmware must not be deleted meanwhile
+		var f Firmware
+		result := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&f, "id = ?", r.FirmwareID)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return firmware.ErrNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", r.FirmwareID, result.Error)
+		}
+
+		row := fromBusinessRollout(r)
+		if result := tx.Create(&row); result.Error != nil {
+			return fmt.Errorf("db.Create: %w", result.Error)
+		}
+
+		rows := make([]RolloutDevice, len(devices))
+		for i, d := range devices {
+			rows[i] = fromBusinessProgress(d)
+		}
+		if result := tx.CreateInBatches(&rows, createBatchSize); result.Error != nil {
+			return fmt.Errorf("db.CreateInBatches: %w", result.Error)
+		}
+		return nil
+	})
+}
+
+// RolloutByID returns a rollout by its ID
+func (s *Store) RolloutByID(ctx context.Context, id string) (firmware.Rollout, error) {
+	var r Rollout
+	result := database.Conn(ctx, s.db).First(&r, "id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return firmware.Rollout{}, firmware.ErrRolloutNotFound
+	}
+	if result.Error != nil {
+		return firmware.Rollout{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessRollout(r), nil
+}
+
+// ListRollouts returns the rollouts with status, or all of them if status
+// is empty, newest first
+func (s *Store) ListRollouts(ctx context.Context, status firmware.RolloutStatus, offset, limit int) ([]firmware.Rollout, error) {
+	q := database.Conn(ctx, s.db)
+	if status != "" {
+		q = q.Where("status = ?", string(status))
+	}
+
+	var rows []Rollout
+	result := q.Order("created_at DESC").Offset(offset).Limit(limit).Find(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	rs := make([]firmware.Rollout, len(rows))
+	for i, r := range rows {
+		rs[i] = toBusinessRollout(r)
+	}
+	return rs, nil
+}
+
+// UpdateRollout applies update to the rollout id, locked until it is saved
+func (s *Store) UpdateRollout(ctx context.Context, id string, update func(r *firmware.Rollout) error) (firmware.Rollout, error) {
+	var r firmware.Rollout
+	err := database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		var row Rollout
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "id = ?", id)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return firmware.ErrRolloutNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+
+		r = toBusinessRollout(row)
+		if err := update(&r); err != nil {
+			return err
+		}
+		row = fromBusinessRollout(r)
+		if result := tx.Save(&row); result.Error != nil {
+			return fmt.Errorf("db.Save[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return firmware.Rollout{}, err
+	}
+	return r, nil
+}
+
+// StageCounts counts the devices of the rollout id by stage and status
+func (s *Store) StageCounts(ctx context.Context, id string) ([]firmware.StageCount, error) {
+	var rows []struct {
+		Stage  int
+		Status string
+		Count  int
+	}
+	result := database.Conn(ctx, s.db).Model(&RolloutDevice{}).
+		Select("stage, status, count(*) AS count").
+		Where("rollout_id = ?", id).
+		Group("stage, status").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Scan[%s]: %w", id, result.Error)
+	}
+
+	counts := make([]firmware.StageCount, len(rows))
+	for i, r := range rows {
+		counts[i] = firmware.StageCount{Stage: r.Stage, Status: firmware.DeviceStatus(r.Status), Count: r.Count}
+	}
+	return counts, nil
+}
+
+// RolloutDevices returns the progress of the devices of the rollout id with
+// status, or of all of them if status is empty, by stage
+func (s *Store) RolloutDevices(ctx context.Context, id string, status firmware.DeviceStatus, offset, limit int) ([]firmware.DeviceProgress, error) {
+	q := database.Conn(ctx, s.db).Where("rollout_id = ?", id)
+	if status != "" {
+		q = q.Where("status = ?", string(status))
+	}
+
+	var rows []RolloutDevice
+	result := q.Order("stage, device_id").Offset(offset).Limit(limit).Find(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find[%s]: %w", id, result.Error)
+	}
+	ps := make([]firmware.DeviceProgress, len(rows))
+	for i, d := range rows {
+		ps[i] = toBusinessProgress(d)
+	}
+	return ps, nil
+}
+
+// PendingUpdate returns the progress of the update the device has yet to
+// finish in the newest running rollout whose released stages include it.
+// Devices already installing the update of a paused rollout keep getting it.
+func (s *Store) PendingUpdate(ctx context.Context, deviceID string) (firmware.DeviceProgress, error) {
+	var row RolloutDevice
+	result := database.Conn(ctx, s.db).
+		Table("firmware_rollout_devices AS d").
+		Select("d.*").
+		Joins("JOIN firmware_rollouts AS r ON r.id = d.rollout_id").
+		Where("d.device_id = ? AND d.stage <= r.stage", deviceID).
+		Where("(r.status = ? AND d.status IN ?) OR (r.status = ? AND d.status = ?)",
+			string(firmware.RolloutRunning), []string{string(firmware.DevicePending), string(firmware.DeviceInstalling)},
+			string(firmware.RolloutPaused), string(firmware.DeviceInstalling),
+		).
+		Order("r.created_at DESC").
+		Take(&row)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return firmware.DeviceProgress{}, firmware.ErrNoUpdate
+	}
+	if result.Error != nil {
+		return firmware.DeviceProgress{}, fmt.Errorf("db.Take[%s]: %w", deviceID, result.Error)
+	}
+	return toBusinessProgress(row), nil
+}
+
+// Report applies update to the progress of the device in the rollout,
+// locked until it is saved
+func (s *Store) Report(ctx context.Context, deviceID, rolloutID string, update func(p *firmware.DeviceProgress, r firmware.Rollout) error) (firmware.DeviceProgress, error) {
+	var p firmware.DeviceProgress
+	err := database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		var row RolloutDevice
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "rollout_id = ? AND device_id = ?", rolloutID, deviceID)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return firmware.ErrNotAssigned
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", rolloutID, result.Error)
+		}
+
+		var r Rollout
+		if result := tx.First(&r, "id = ?", rolloutID); result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", rolloutID, result.Error)
+		}
+
+		p = toBusinessProgress(row)
+		if err := update(&p, toBusinessRollout(r)); err != nil {
+			return err
+		}
+		row = fromBusinessProgress(p)
+		result = tx.Model(&row).Where("rollout_id = ? AND device_id = ?", rolloutID, deviceID).
+			Select("status", "error", "updated_at").
+			Updates(&row)
+		if result.Error != nil {
+			return fmt.Errorf("db.Updates[%s]: %w", rolloutID, result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return firmware.DeviceProgress{}, err
+	}
+	return p, nil
+}
+
+// DeleteDevice deletes the progress of the device id in every rollout
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	result := database.Conn(ctx, s.db).Delete(&RolloutDevice{}, "device_id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,590 @@
+package group
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/pkg/logging"
+	"device/pkg/tracing"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// operationPageSize is the number of devices an operation runs on at a time
+const operationPageSize = 500
+
+// Tree reads the groups a change of the nesting of groups is checked
+// against. The store serializes these changes, so the groups it reads stay
+// nested as they are until the change is saved.
+type Tree interface {
+	ByID(ctx context.Context, id string) (Group, error)
+	// Subgroups returns the groups nested in the group id, at any depth
+	Subgroups(ctx context.Context, id string) ([]Group, error)
+}
+
+// Store is an interface to interact with the database
+type Store interface {
+	Tree
+
+	// Create stores g along with its first members, unless check fails on
+	// the groups as they are when g is nested in its parent
+	Create(ctx context.Context, g Group, deviceIDs []string, check func(tree Tree) error) error
+	// List returns the groups nested in parentID, or the top-level groups if
+	// parentID is empty, by name
+	List(ctx context.Context, parentID string, offset, limit int) ([]Group, error)
+	// Update applies update to the group id and saves it, unless update
+	// fails. Concurrent updates of the group wait for each other, and update
+	// reads the groups it moves the group among from tree.
+	Update(ctx context.Context, id string, update func(g *Group, tree Tree) error) (Group, error)
+	// Delete deletes a group along with its members list. It fails with
+	// ErrHasSubgroups if groups are nested in it.
+	Delete(ctx context.Context, id string) error
+	// AddMembers adds the devices to the group id, skipping its members
+	AddMembers(ctx context.Context, id string, deviceIDs []string) error
+	// RemoveMember fails with ErrNotMember if the device is not a member of
+	// the group id
+	RemoveMember(ctx context.Context, id, deviceID string) error
+	// DeviceIDs returns a page of the IDs of the devices of m, each once, by
+	// ID. Only the devices sorting after the ID after count, if set.
+	DeviceIDs(ctx context.Context, m Membership, after string, offset, limit int) ([]string, error)
+
+	CreateOperation(ctx context.Context, op Operation) error
+	OperationByID(ctx context.Context, id string) (Operation, error)
+	// ListOperations returns the operations with status, oldest first
+	ListOperations(ctx context.Context, status OperationStatus, offset, limit int) ([]Operation, error)
+	// UpdateOperation applies update to the operation id and saves it,
+	// unless update fails. update runs in the transaction saving the
+	// operation, which the stores reached with its ctx take part in.
+	// Concurrent updates of the operation wait for each other.
+	UpdateOperation(ctx context.Context, id string, update func(ctx context.Context, op *Operation) error) (Operation, error)
+}
+
+// Devices looks up and updates the devices of groups
+type Devices interface {
+	GetByIDs(ctx context.Context, ids []string) ([]device.Device, error)
+	Update(ctx context.Context, id string, data device.UpdateDevice) error
+}
+
+// Commands enqueues commands for the devices of groups
+type Commands interface {
+	Enqueue(ctx context.Context, id string, cc command.CreateCommand) (command.Command, error)
+}
+
+// Business is the business logic for device groups
+type Business struct {
+	store    Store
+	devices  Devices
+	commands Commands
+	now      func() time.Time
+}
+
+// Option configures the Business
+type Option func(*Business)
+
+// WithClock makes the Business tell the time with now instead of the system clock
+func WithClock(now func() time.Time) Option {
+	return func(b *Business) {
+		b.now = now
+	}
+}
+
+// NewBusiness creates a new business logic for device groups
+func NewBusiness(store Store, devices Devices, commands Commands, opts ...Option) *Business {
+	b := &Business{
+		store:    store,
+		devices:  devices,
+		commands: commands,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Create creates a valid group, nested in its parent if it has one. The
+// first members of a static group must exist.
+func (b *Business) Create(ctx context.Context, cg CreateGroup) (_ Group, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.Create")
+	defer func() { tracing.End(span, err) }()
+
+	ids := unique(cg.DeviceIDs)
+	if err := b.checkDevices(ctx, ids); err != nil {
+		return Group{}, err
+	}
+
+	g := cg.toGroup(b.now().UTC())
+	err = b.store.Create(ctx, g, ids, func(tree Tree) error {
+		if g.ParentID == "" {
+			return nil
+		}
+		ancestors, err := ancestors(ctx, tree, g.ParentID)
+		if err != nil {
+			return err
+		}
+		if len(ancestors)+1 > MaxDepth {
+			return ErrTooDeep
+		}
+		return nil
+	})
+	if err != nil {
+		return Group{}, fmt.Errorf("store.Create: %w", err)
+	}
+	return g, nil
+}
+
+// Get returns a group by its ID
+func (b *Business) Get(ctx context.Context, id string) (_ Group, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.Get")
+	defer func() { tracing.End(span, err) }()
+
+	g, err := b.store.ByID(ctx, id)
+	if err != nil {
+		return Group{}, fmt.Errorf("store.ByID: %w", err)
+	}
+	return g, nil
+}
+
+// List returns the groups nested in parentID, or the top-level groups if
+// parentID is empty, by name
+func (b *Business) List(ctx context.Context, parentID string, offset, limit int) (_ []Group, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.List")
+	defer func() { tracing.End(span, err) }()
+
+	gs, err := b.store.List(ctx, parentID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.List: %w", err)
+	}
+	return gs, nil
+}
+
+// Update applies a valid update to a group. Moving the group to another
+// parent moves its subgroups along, and fails with ErrCycle if the parent is
+// one of them.
+func (b *Business) Update(ctx context.Context, id string, ug UpdateGroup) (_ Group, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.Update")
+	defer func() { tracing.End(span, err) }()
+
+	g, err := b.store.Update(ctx, id, func(g *Group, tree Tree) error {
+		// the check runs with the group locked, so concurrent moves cannot
+		// each nest a group in the other
+		if ug.ParentID != nil && *ug.ParentID != "" && *ug.ParentID != g.ParentID {
+			if err := checkMove(ctx, tree, id, *ug.ParentID); err != nil {
+				return err
+			}
+		}
+		return ug.apply(g, b.now().UTC())
+	})
+	if err != nil {
+		return Group{}, fmt.Errorf("store.Update: %w", err)
+	}
+	return g, nil
+}
+
+// Delete deletes a group without subgroups. Its devices are left as they are.
+func (b *Business) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.Delete")
+	defer func() { tracing.End(span, err) }()
+
+	if err := b.store.Delete(ctx, id); err != nil {
+		return fmt.Errorf("store.Delete: %w", err)
+	}
+	return nil
+}
+
+// Devices returns the devices of a group, its subgroups included, by ID
+func (b *Business) Devices(ctx context.Context, id string, offset, limit int) (_ []device.Device, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.Devices")
+	defer func() { tracing.End(span, err) }()
+
+	m, err := b.membership(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := b.store.DeviceIDs(ctx, m, "", offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.DeviceIDs: %w", err)
+	}
+	return b.getDevices(ctx, ids)
+}
+
+// AddMembers adds existing devices to a static group. The devices already
+// members of the group are skipped.
+func (b *Business) AddMembers(ctx context.Context, id string, m Members) (err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.AddMembers")
+	defer func() { tracing.End(span, err) }()
+
+	if err := b.checkStatic(ctx, id); err != nil {
+		return err
+	}
+	ids := unique(m.DeviceIDs)
+	if err := b.checkDevices(ctx, ids); err != nil {
+		return err
+	}
+	if err := b.store.AddMembers(ctx, id, ids); err != nil {
+		return fmt.Errorf("store.AddMembers: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember removes a device from a static group
+func (b *Business) RemoveMember(ctx context.Context, id, deviceID string) (err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.RemoveMember")
+	defer func() { tracing.End(span, err) }()
+
+	if err := b.checkStatic(ctx, id); err != nil {
+		return err
+	}
+	if err := b.store.RemoveMember(ctx, id, deviceID); err != nil {
+		return fmt.Errorf("store.RemoveMember: %w", err)
+	}
+	return nil
+}
+
+// UpdateLabels starts an operation applying a valid label change to every
+// device of a group, its subgroups included. The devices whose labels it
+// does not change are not updated, and count as succeeded.
+func (b *Business) UpdateLabels(ctx context.Context, id string, lc LabelChange) (_ Operation, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.UpdateLabels")
+	defer func() { tracing.End(span, err) }()
+
+	op := newOperation(id, OperationLabels, b.now().UTC())
+	op.Labels = &lc
+	return b.startOperation(ctx, op)
+}
+
+// SendCommand starts an operation enqueuing a valid command for every
+// device of a group, its subgroups included
+func (b *Business) SendCommand(ctx context.Context, id string, cc command.CreateCommand) (_ Operation, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.SendCommand")
+	defer func() { tracing.End(span, err) }()
+
+	op := newOperation(id, OperationCommand, b.now().UTC())
+	op.Command = &cc
+	return b.startOperation(ctx, op)
+}
+
+// Operation returns an operation of a group by its ID
+func (b *Business) Operation(ctx context.Context, id, operationID string) (_ Operation, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.Operation")
+	defer func() { tracing.End(span, err) }()
+
+	op, err := b.store.OperationByID(ctx, operationID)
+	if err != nil {
+		return Operation{}, fmt.Errorf("store.OperationByID: %w", err)
+	}
+	if op.GroupID != id {
+		return Operation{}, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+// RunOperations runs the running operations a page of devices at a time
+// until they complete or ctx is done. It returns how many completed.
+func (b *Business) RunOperations(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "group.Business.RunOperations")
+	defer func() { tracing.End(span, err) }()
+
+	// operations leave the running ones as they complete, so they are all listed first
+	var ids []string
+	for offset := 0; ; offset += operationPageSize {
+		ops, err := b.store.ListOperations(ctx, OperationRunning, offset, operationPageSize)
+		if err != nil {
+			return 0, fmt.Errorf("store.ListOperations: %w", err)
+		}
+		for _, op := range ops {
+			ids = append(ids, op.ID)
+		}
+		if len(ops) < operationPageSize {
+			break
+		}
+	}
+
+	var completed int
+	for _, id := range ids {
+		for {
+			op, err := b.runPage(ctx, id)
+			if err != nil {
+				return completed, err
+			}
+			if op.Status == OperationCompleted {
+				completed++
+				break
+			}
+		}
+	}
+	return completed, nil
+}
+
+// startOperation stores op, which starts on the next run, unless its group
+// does not exist
+func (b *Business) startOperation(ctx context.Context, op Operation) (Operation, error) {
+	if _, err := b.store.ByID(ctx, op.GroupID); err != nil {
+		return Operation{}, fmt.Errorf("store.ByID: %w", err)
+	}
+	if err := b.store.CreateOperation(ctx, op); err != nil {
+		return Operation{}, fmt.Errorf("store.CreateOperation: %w", err)
+	}
+	return op, nil
+}
+
+// runPage runs the operation id on the next page of the devices of its
+// group. The operation stays locked meanwhile, so that other instances
+// wait for the page instead of running it again. The changes to the devices
+// commit along with the progress of the operation: a page interrupted, or
+// failing on the database, is rolled back and runs again from the start.
+func (b *Business) runPage(ctx context.Context, id string) (Operation, error) {
+	op, err := b.store.UpdateOperation(ctx, id, func(ctx context.Context, op *Operation) error {
+		if op.Status != OperationRunning {
+			return nil
+		}
+		now := b.now().UTC()
+		op.UpdatedAt = now
+
+		m, err := b.membership(ctx, op.GroupID)
+		if errors.Is(err, ErrNotFound) {
+			// deleted meanwhile, there are no more devices
+			op.complete(now)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ids, err := b.store.DeviceIDs(ctx, m, op.Cursor, 0, operationPageSize)
+		if err != nil {
+			return fmt.Errorf("store.DeviceIDs: %w", err)
+		}
+		devices, err := b.getDevices(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range devices {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := b.operate(ctx, *op, d)
+			op.record(d.ID, err == nil, failureMessage(ctx, d.ID, err))
+		}
+		if len(ids) > 0 {
+			op.Cursor = ids[len(ids)-1]
+		}
+		if len(ids) < operationPageSize {
+			op.complete(now)
+		}
+		return nil
+	})
+	if err != nil {
+		return Operation{}, fmt.Errorf("store.UpdateOperation[%s]: %w", id, err)
+	}
+	return op, nil
+}
+
+// operate runs op on the device d
+func (b *Business) operate(ctx context.Context, op Operation, d device.Device) error {
+	switch op.Kind {
+	case OperationLabels:
+		labels, changed := op.Labels.apply(d.Labels)
+		if !changed {
+			return nil
+		}
+		if err := device.ValidateLabels(labels); err != nil {
+			return rejectedError{err: err}
+		}
+		if err := b.devices.Update(ctx, d.ID, device.UpdateDevice{Labels: labels}); err != nil {
+			return fmt.Errorf("devices.Update: %w", err)
+		}
+	case OperationCommand:
+		if _, err := b.commands.Enqueue(ctx, d.ID, *op.Command); err != nil {
+			return fmt.Errorf("commands.Enqueue: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown operation kind %q", op.Kind)
+	}
+	return nil
+}
+
+// rejectedError is returned by an operation on a device that rejects it,
+// the error telling why
+type rejectedError struct {
+	err error
+}
+
+func (e rejectedError) Error() string {
+	return e.err.Error()
+}
+
+// failureMessage returns what an operation failing with err on the device
+// id reports, or "" if err is nil
+func failureMessage(ctx context.Context, id string, err error) string {
+	var rejected rejectedError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &rejected):
+		return rejected.Error()
+	case errors.Is(err, device.ErrNotFound):
+		// deleted meanwhile
+		return ErrUnknownDevice.Error()
+	default:
+		logging.FromContext(ctx).WithError(err).WithField("device_id", id).Error("unable to operate on a device of a group")
+		return "internal error"
+	}
+}
+
+// membership returns the membership of the devices of the group id, its
+// subgroups included
+func (b *Business) membership(ctx context.Context, id string) (Membership, error) {
+	g, err := b.store.ByID(ctx, id)
+	if err != nil {
+		return Membership{}, fmt.Errorf("store.ByID: %w", err)
+	}
+	subgroups, err := b.store.Subgroups(ctx, id)
+	if err != nil {
+		return Membership{}, fmt.Errorf("store.Subgroups: %w", err)
+	}
+
+	var m Membership
+	for _, g := range append([]Group{g}, subgroups...) {
+		switch {
+		case g.Kind == KindStatic:
+			m.GroupIDs = append(m.GroupIDs, g.ID)
+		case g.Filter != nil:
+			m.Filters = append(m.Filters, *g.Filter)
+		}
+	}
+	return m, nil
+}
+
+// getDevices returns the devices with ids in the same order, skipping the
+// ones that do not exist
+func (b *Business) getDevices(ctx context.Context, ids []string) ([]device.Device, error) {
+	devices, err := b.devices.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("devices.GetByIDs: %w", err)
+	}
+	byID := make(map[string]device.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+	ordered := make([]device.Device, 0, len(devices))
+	for _, id := range ids {
+		if d, ok := byID[id]; ok {
+			ordered = append(ordered, d)
+		}
+	}
+	return ordered, nil
+}
+
+// checkDevices fails with ErrUnknownDevice unless the devices with ids exist
+func (b *Business) checkDevices(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	devices, err := b.devices.GetByIDs(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("devices.GetByIDs: %w", err)
+	}
+	found := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		found[d.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return fmt.Errorf("%w: %s", ErrUnknownDevice, id)
+		}
+	}
+	return nil
+}
+
+// checkStatic fails with ErrNotStatic unless the group id is static
+func (b *Business) checkStatic(ctx context.Context, id string) error {
+	g, err := b.store.ByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("store.ByID: %w", err)
+	}
+	if g.Kind != KindStatic {
+		return ErrNotStatic
+	}
+	return nil
+}
+
+// checkMove fails unless the group id, with its subgroups, can be nested in
+// the group parentID of tree
+func checkMove(ctx context.Context, tree Tree, id, parentID string) error {
+	if parentID == id {
+		return ErrCycle
+	}
+	ancestors, err := ancestors(ctx, tree, parentID)
+	if err != nil {
+		return err
+	}
+	for _, a := range ancestors {
+		if a.ID == id {
+			return ErrCycle
+		}
+	}
+
+	subgroups, err := tree.Subgroups(ctx, id)
+	if err != nil {
+		return fmt.Errorf("tree.Subgroups: %w", err)
+	}
+	if len(ancestors)+1+height(id, subgroups) > MaxDepth {
+		return ErrTooDeep
+	}
+	return nil
+}
+
+// ancestors returns the group id of tree followed by the groups it is nested
+// in, up to its top-level group. It fails with ErrParentNotFound if the group
+// id does not exist.
+func ancestors(ctx context.Context, tree Tree, id string) ([]Group, error) {
+	var ancestors []Group
+	for id != "" && len(ancestors) <= MaxDepth {
+		g, err := tree.ByID(ctx, id)
+		if errors.Is(err, ErrNotFound) && len(ancestors) == 0 {
+			return nil, ErrParentNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tree.ByID: %w", err)
+		}
+		ancestors = append(ancestors, g)
+		id = g.ParentID
+	}
+	return ancestors, nil
+}
+
+// height returns the number of levels of subgroups nested in the group id
+func height(id string, subgroups []Group) int {
+	children := map[string][]string{}
+	for _, g := range subgroups {
+		children[g.ParentID] = append(children[g.ParentID], g.ID)
+	}
+	var levels func(id string, depth int) int
+	levels = func(id string, depth int) int {
+		deepest := 0
+		// depth guards against a cycle left in the database
+		if depth > MaxDepth {
+			return deepest
+		}
+		for _, child := range children[id] {
+			deepest = max(deepest, 1+levels(child, depth+1))
+		}
+		return deepest
+	}
+	return levels(id, 0)
+}
+
+// unique returns ids without duplicates, in order
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	var u []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			u = append(u, id)
+		}
+	}
+	return u
+}
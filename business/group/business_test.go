@@ -0,0 +1,708 @@
+package group_test
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/business/group"
+	"device/business/group/store/mocks"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	groupID  = "5c0f3d2a-8b7e-4f6a-9d1c-2e3b4a5f6071"
+	parentID = "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d"
+	deviceID = "2f1a6a4e-58c4-4a43-9f7c-0b6f5a4d6f10"
+
+	operationID = "7d4e2b1c-3a5f-4c6d-8e9f-0a1b2c3d4e5f"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// devicesMock looks up its devices in order, and records the updates and
+// the commands of each
+type devicesMock struct {
+	devices  []device.Device
+	updates  map[string]device.UpdateDevice
+	commands map[string]string
+	// failing makes the updates and commands of the device fail
+	failing string
+	// outside lists the devices written to outside of an operation transaction
+	outside []string
+}
+
+// txKey marks the context of the transaction of an operation
+type txKey struct{}
+
+// txStore passes the update of an operation a context marked with txKey
+type txStore struct {
+	*mocks.Store
+}
+
+func (s txStore) UpdateOperation(ctx context.Context, id string, update func(ctx context.Context, op *group.Operation) error) (group.Operation, error) {
+	return s.Store.UpdateOperation(ctx, id, func(ctx context.Context, op *group.Operation) error {
+		return update(context.WithValue(ctx, txKey{}, true), op)
+	})
+}
+
+func newDevicesMock(devices ...device.Device) *devicesMock {
+	return &devicesMock{devices: devices, updates: map[string]device.UpdateDevice{}, commands: map[string]string{}}
+}
+
+func (d *devicesMock) GetByIDs(_ context.Context, ids []string) ([]device.Device, error) {
+	var devices []device.Device
+	for _, dev := range d.devices {
+		for _, id := range ids {
+			if dev.ID == id {
+				devices = append(devices, dev)
+			}
+		}
+	}
+	return devices, nil
+}
+
+func (d *devicesMock) Update(ctx context.Context, id string, data device.UpdateDevice) error {
+	if ctx.Value(txKey{}) == nil {
+		d.outside = append(d.outside, id)
+	}
+	if id == d.failing {
+		return errors.New("connection refused")
+	}
+	d.updates[id] = data
+	return nil
+}
+
+func (d *devicesMock) Enqueue(ctx context.Context, id string, cc command.CreateCommand) (command.Command, error) {
+	if ctx.Value(txKey{}) == nil {
+		d.outside = append(d.outside, id)
+	}
+	if id == d.failing {
+		return command.Command{}, fmt.Errorf("devices.GetByID: %w", device.ErrNotFound)
+	}
+	d.commands[id] = cc.Name
+	return command.Command{DeviceID: id, Name: cc.Name}, nil
+}
+
+func newBusiness(store group.Store, devices *devicesMock) *group.Business {
+	return group.NewBusiness(store, devices, devices, group.WithClock(func() time.Time { return now }))
+}
+
+func TestValidate(t *testing.T) {
+	testTable := map[string]struct {
+		validate    func() error
+		expectedErr []string
+	}{
+		"static group": {
+			validate: group.CreateGroup{Name: "lobby", Kind: group.KindStatic, ParentID: parentID, DeviceIDs: []string{deviceID}}.Validate,
+		},
+		"dynamic group": {
+			validate: group.CreateGroup{Name: "eu sensors", Kind: group.KindDynamic, Filter: &group.Filter{Brand: "acme", Labels: map[string]string{"region": "eu"}}}.Validate,
+		},
+		"invalid group": {
+			validate:    group.CreateGroup{Description: strings.Repeat("a", 1001), Kind: "smart", ParentID: "abc"}.Validate,
+			expectedErr: []string{"name is required", "description must be at most 1000 characters", "parent_id must be a UUID", "kind must be static or dynamic"},
+		},
+		"static group with a filter": {
+			validate:    group.CreateGroup{Name: "lobby", Kind: group.KindStatic, Filter: &group.Filter{Brand: "acme"}, DeviceIDs: []string{"abc"}}.Validate,
+			expectedErr: []string{"filter is only for dynamic groups", `device_ids must be UUIDs, got "abc"`},
+		},
+		"dynamic group without a filter": {
+			validate:    group.CreateGroup{Name: "eu sensors", Kind: group.KindDynamic, DeviceIDs: []string{deviceID}}.Validate,
+			expectedErr: []string{"filter is required for dynamic groups", "device_ids is only for static groups"},
+		},
+		"empty filter": {
+			validate:    group.CreateGroup{Name: "eu sensors", Kind: group.KindDynamic, Filter: &group.Filter{}}.Validate,
+			expectedErr: []string{"filter must set a brand or labels"},
+		},
+		"update": {
+			validate: group.UpdateGroup{Name: ptr("hall"), ParentID: ptr("")}.Validate,
+		},
+		"invalid update": {
+			validate:    group.UpdateGroup{Name: ptr(""), ParentID: ptr("abc"), Filter: &group.Filter{Labels: map[string]string{"Region": "eu"}}}.Validate,
+			expectedErr: []string{"name is required", "parent_id must be a UUID", "filter: "},
+		},
+		"members": {
+			validate:    group.Members{}.Validate,
+			expectedErr: []string{"device_ids is required"},
+		},
+		"label change": {
+			validate: group.LabelChange{Set: map[string]string{"env": "prod"}, Remove: []string{"beta"}}.Validate,
+		},
+		"empty label change": {
+			validate:    group.LabelChange{}.Validate,
+			expectedErr: []string{"set or remove is required"},
+		},
+		"label both set and removed": {
+			validate:    group.LabelChange{Set: map[string]string{"env": "prod"}, Remove: []string{"env"}}.Validate,
+			expectedErr: []string{`label "env" cannot be both set and removed`},
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			err := tc.validate()
+			if (err != nil) != (len(tc.expectedErr) > 0) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			for _, msg := range tc.expectedErr {
+				if !strings.Contains(err.Error(), msg) {
+					t.Fatalf("expected %q in %v", msg, err)
+				}
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCreate(t *testing.T) {
+	devices := newDevicesMock(device.Device{ID: deviceID})
+
+	testTable := map[string]struct {
+		create      group.CreateGroup
+		ancestors   int
+		expectedErr error
+	}{
+		"top-level group": {
+			create: group.CreateGroup{Name: "lobby", Kind: group.KindStatic, DeviceIDs: []string{deviceID, deviceID}},
+		},
+		"nested group": {
+			create:    group.CreateGroup{Name: "lobby", Kind: group.KindStatic, ParentID: parentID},
+			ancestors: group.MaxDepth - 1,
+		},
+		"nested too deep": {
+			create:      group.CreateGroup{Name: "lobby", Kind: group.KindStatic, ParentID: parentID},
+			ancestors:   group.MaxDepth,
+			expectedErr: group.ErrTooDeep,
+		},
+		"unknown parent": {
+			create:      group.CreateGroup{Name: "lobby", Kind: group.KindStatic, ParentID: parentID},
+			expectedErr: group.ErrParentNotFound,
+		},
+		"unknown device": {
+			create:      group.CreateGroup{Name: "lobby", Kind: group.KindStatic, DeviceIDs: []string{deviceID, groupID}},
+			expectedErr: group.ErrUnknownDevice,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			store := &mocks.Store{}
+			// the parent is nested in a chain of ancestors
+			id := parentID
+			for i := 0; i < tc.ancestors; i++ {
+				next := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+				if i == tc.ancestors-1 {
+					next = ""
+				}
+				store.On("ByID", mock.Anything, id).Return(group.Group{ID: id, ParentID: next}, nil)
+				id = next
+			}
+			store.On("ByID", mock.Anything, parentID).Return(group.Group{}, group.ErrNotFound)
+			store.On("Create", mock.Anything, mock.AnythingOfType("group.Group"), []string(nil)).Return(nil)
+			store.On("Create", mock.Anything, mock.AnythingOfType("group.Group"), []string{deviceID}).Return(nil)
+
+			g, err := newBusiness(store, devices).Create(context.Background(), tc.create)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if g.ID == "" || g.Name != tc.create.Name || g.ParentID != tc.create.ParentID || !g.CreatedAt.Equal(now) {
+				t.Fatalf("unexpected group %+v", g)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	// groupID has a child, which has a grandchild
+	child := group.Group{ID: "c0000000-0000-0000-0000-000000000001", ParentID: groupID, Kind: group.KindStatic}
+	grandchild := group.Group{ID: "c0000000-0000-0000-0000-000000000002", ParentID: child.ID, Kind: group.KindStatic}
+
+	testTable := map[string]struct {
+		kind        group.Kind
+		update      group.UpdateGroup
+		parentDepth int
+		expectedErr error
+	}{
+		"rename": {
+			kind:   group.KindStatic,
+			update: group.UpdateGroup{Name: ptr("hall")},
+		},
+		"move": {
+			kind:        group.KindStatic,
+			update:      group.UpdateGroup{ParentID: ptr(parentID)},
+			parentDepth: group.MaxDepth - 3,
+		},
+		"move too deep": {
+			kind:        group.KindStatic,
+			update:      group.UpdateGroup{ParentID: ptr(parentID)},
+			parentDepth: group.MaxDepth - 2,
+			expectedErr: group.ErrTooDeep,
+		},
+		"move into itself": {
+			kind:        group.KindStatic,
+			update:      group.UpdateGroup{ParentID: ptr(groupID)},
+			expectedErr: group.ErrCycle,
+		},
+		"move into a subgroup": {
+			kind:        group.KindStatic,
+			update:      group.UpdateGroup{ParentID: ptr(grandchild.ID)},
+			expectedErr: group.ErrCycle,
+		},
+		"move to the top level": {
+			kind:   group.KindStatic,
+			update: group.UpdateGroup{ParentID: ptr("")},
+		},
+		"filter of a dynamic group": {
+			kind:   group.KindDynamic,
+			update: group.UpdateGroup{Filter: &group.Filter{Brand: "globex"}},
+		},
+		"filter of a static group": {
+			kind:        group.KindStatic,
+			update:      group.UpdateGroup{Filter: &group.Filter{Brand: "globex"}},
+			expectedErr: group.ErrNotDynamic,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			store := &mocks.Store{}
+			// the parent is nested parentDepth levels deep
+			id := parentID
+			for i := 0; i < tc.parentDepth; i++ {
+				next := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+				if i == tc.parentDepth-1 {
+					next = ""
+				}
+				store.On("ByID", mock.Anything, id).Return(group.Group{ID: id, ParentID: next}, nil)
+				id = next
+			}
+			store.On("ByID", mock.Anything, child.ID).Return(child, nil)
+			store.On("ByID", mock.Anything, grandchild.ID).Return(grandchild, nil)
+			store.On("ByID", mock.Anything, groupID).Return(group.Group{ID: groupID}, nil)
+			store.On("Subgroups", mock.Anything, groupID).Return([]group.Group{grandchild, child}, nil)
+			store.On("Update", mock.Anything, groupID).Return(&group.Group{ID: groupID, Name: "lobby", Kind: tc.kind}, nil)
+
+			g, err := newBusiness(store, newDevicesMock()).Update(context.Background(), groupID, tc.update)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !g.UpdatedAt.Equal(now) {
+				t.Fatalf("unexpected group %+v", g)
+			}
+			if tc.update.ParentID != nil && g.ParentID != *tc.update.ParentID {
+				t.Fatalf("expected parent %q, got %q", *tc.update.ParentID, g.ParentID)
+			}
+		})
+	}
+}
+
+// nestingStore is a group.Store keeping the nesting of groups, whose updates
+// hold the nesting lock like the postgres store
+type nestingStore struct {
+	group.Store
+
+	nesting sync.Mutex
+	mu      sync.Mutex
+	parents map[string]string
+}
+
+func (s *nestingStore) ByID(_ context.Context, id string) (group.Group, error) {
+	// slow reads let the checks of concurrent moves overlap
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parentID, ok := s.parents[id]
+	if !ok {
+		return group.Group{}, group.ErrNotFound
+	}
+	return group.Group{ID: id, ParentID: parentID, Kind: group.KindStatic}, nil
+}
+
+func (s *nestingStore) Subgroups(_ context.Context, id string) ([]group.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var subgroups []group.Group
+	nested := map[string]bool{id: true}
+	for found := true; found; {
+		found = false
+		for child, parentID := range s.parents {
+			if nested[parentID] && !nested[child] {
+				nested[child] = true
+				subgroups = append(subgroups, group.Group{ID: child, ParentID: parentID, Kind: group.KindStatic})
+				found = true
+			}
+		}
+	}
+	return subgroups, nil
+}
+
+func (s *nestingStore) Update(ctx context.Context, id string, update func(g *group.Group, tree group.Tree) error) (group.Group, error) {
+	s.nesting.Lock()
+	defer s.nesting.Unlock()
+	g, err := s.ByID(ctx, id)
+	if err != nil {
+		return group.Group{}, err
+	}
+	if err := update(&g, s); err != nil {
+		return group.Group{}, err
+	}
+	s.mu.Lock()
+	s.parents[id] = g.ParentID
+	s.mu.Unlock()
+	return g, nil
+}
+
+func TestConcurrentMoves(t *testing.T) {
+	a, b := groupID, parentID
+	for i := 0; i < 20; i++ {
+		store := &nestingStore{parents: map[string]string{a: "", b: ""}}
+		bs := newBusiness(store, newDevicesMock())
+
+		// each group is moved into the other at once, one of the moves must
+		// see the other
+		errs := make(chan error, 2)
+		start := make(chan struct{})
+		for _, move := range [][2]string{{a, b}, {b, a}} {
+			go func(id, parentID string) {
+				<-start
+				_, err := bs.Update(context.Background(), id, group.UpdateGroup{ParentID: &parentID})
+				errs <- err
+			}(move[0], move[1])
+		}
+		close(start)
+
+		var cycles int
+		for j := 0; j < 2; j++ {
+			err := <-errs
+			switch {
+			case errors.Is(err, group.ErrCycle):
+				cycles++
+			case err != nil:
+				t.Fatalf("expected nil or %v, got %v", group.ErrCycle, err)
+			}
+		}
+		if cycles != 1 {
+			t.Fatalf("expected one move to fail with a cycle, got %d with parents %v", cycles, store.parents)
+		}
+	}
+}
+
+// groupTree is a static group with a static subgroup, which has a dynamic
+// subgroup of its own
+type groupTree struct {
+	root, child, dynamic group.Group
+}
+
+func newGroupTree(store *mocks.Store) groupTree {
+	tree := groupTree{
+		root:    group.Group{ID: groupID, Kind: group.KindStatic},
+		child:   group.Group{ID: "c0000000-0000-0000-0000-000000000001", ParentID: groupID, Kind: group.KindStatic},
+		dynamic: group.Group{ID: "c0000000-0000-0000-0000-000000000002", ParentID: "c0000000-0000-0000-0000-000000000001", Kind: group.KindDynamic, Filter: &group.Filter{Labels: map[string]string{"region": "eu"}}},
+	}
+	store.On("ByID", mock.Anything, tree.root.ID).Return(tree.root, nil)
+	store.On("ByID", mock.Anything, tree.dynamic.ID).Return(tree.dynamic, nil)
+	store.On("Subgroups", mock.Anything, tree.root.ID).Return([]group.Group{tree.child, tree.dynamic}, nil)
+	store.On("Subgroups", mock.Anything, tree.dynamic.ID).Return([]group.Group{}, nil)
+	return tree
+}
+
+// membership is the membership of the group tree.root
+func (tree groupTree) membership() group.Membership {
+	return group.Membership{GroupIDs: []string{tree.root.ID, tree.child.ID}, Filters: []group.Filter{*tree.dynamic.Filter}}
+}
+
+func TestDevices(t *testing.T) {
+	devices := newDevicesMock(
+		device.Device{ID: "d1"},
+		device.Device{ID: "d2", Labels: map[string]string{"region": "eu"}},
+		device.Device{ID: "d3", Labels: map[string]string{"region": "eu"}},
+	)
+
+	testTable := map[string]struct {
+		group      func(groupTree) string
+		membership func(groupTree) group.Membership
+		offset     int
+		limit      int
+		ids        []string
+		expected   []string
+	}{
+		"members and subgroups": {
+			group:      func(tree groupTree) string { return tree.root.ID },
+			membership: groupTree.membership,
+			offset:     1,
+			limit:      10,
+			// d9 was deleted and is skipped
+			ids:      []string{"d1", "d3", "d9", "d2"},
+			expected: []string{"d1", "d3", "d2"},
+		},
+		"dynamic group": {
+			group: func(tree groupTree) string { return tree.dynamic.ID },
+			membership: func(tree groupTree) group.Membership {
+				return group.Membership{Filters: []group.Filter{*tree.dynamic.Filter}}
+			},
+			limit:    10,
+			ids:      []string{"d2", "d3"},
+			expected: []string{"d2", "d3"},
+		},
+		"past the end": {
+			group:      func(tree groupTree) string { return tree.root.ID },
+			membership: groupTree.membership,
+			offset:     10,
+			limit:      10,
+			ids:        []string{},
+			expected:   []string{},
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			store := &mocks.Store{}
+			tree := newGroupTree(store)
+			store.On("DeviceIDs", mock.Anything, tc.membership(tree), "", tc.offset, tc.limit).Return(tc.ids, nil)
+
+			got, err := newBusiness(store, devices).Devices(context.Background(), tc.group(tree), tc.offset, tc.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, d := range got {
+				ids = append(ids, d.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, ids)
+			}
+		})
+	}
+}
+
+func TestMembers(t *testing.T) {
+	store := &mocks.Store{}
+	tree := newGroupTree(store)
+	store.On("AddMembers", mock.Anything, tree.root.ID, []string{deviceID}).Return(nil)
+	store.On("RemoveMember", mock.Anything, tree.root.ID, deviceID).Return(nil)
+	b := newBusiness(store, newDevicesMock(device.Device{ID: deviceID}))
+	ctx := context.Background()
+
+	if err := b.AddMembers(ctx, tree.root.ID, group.Members{DeviceIDs: []string{deviceID, deviceID}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddMembers(ctx, tree.root.ID, group.Members{DeviceIDs: []string{groupID}}); !errors.Is(err, group.ErrUnknownDevice) {
+		t.Fatalf("expected ErrUnknownDevice, got %v", err)
+	}
+	if err := b.RemoveMember(ctx, tree.root.ID, deviceID); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddMembers(ctx, tree.dynamic.ID, group.Members{DeviceIDs: []string{deviceID}}); !errors.Is(err, group.ErrNotStatic) {
+		t.Fatalf("expected ErrNotStatic, got %v", err)
+	}
+	if err := b.RemoveMember(ctx, tree.dynamic.ID, deviceID); !errors.Is(err, group.ErrNotStatic) {
+		t.Fatalf("expected ErrNotStatic, got %v", err)
+	}
+}
+
+func TestStartOperation(t *testing.T) {
+	store := &mocks.Store{}
+	tree := newGroupTree(store)
+	store.On("ByID", mock.Anything, "unknown").Return(group.Group{}, group.ErrNotFound)
+	store.On("CreateOperation", mock.Anything, mock.Anything).Return(nil)
+	b := newBusiness(store, newDevicesMock())
+	ctx := context.Background()
+
+	lc := group.LabelChange{Set: map[string]string{"env": "prod"}}
+	op, err := b.UpdateLabels(ctx, tree.root.ID, lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.ID == "" || op.GroupID != tree.root.ID || op.Kind != group.OperationLabels || op.Status != group.OperationRunning || !reflect.DeepEqual(op.Labels, &lc) || !op.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+	store.AssertCalled(t, "CreateOperation", mock.Anything, op)
+
+	op, err = b.SendCommand(ctx, tree.root.ID, command.CreateCommand{Name: "reboot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Kind != group.OperationCommand || op.Command == nil || op.Command.Name != "reboot" || op.Devices != 0 {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+
+	if _, err := b.SendCommand(ctx, "unknown", command.CreateCommand{Name: "reboot"}); !errors.Is(err, group.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := b.UpdateLabels(ctx, "unknown", lc); !errors.Is(err, group.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	store := &mocks.Store{}
+	store.On("OperationByID", mock.Anything, operationID).Return(group.Operation{ID: operationID, GroupID: groupID}, nil)
+	store.On("OperationByID", mock.Anything, "unknown").Return(group.Operation{}, group.ErrOperationNotFound)
+	b := newBusiness(store, newDevicesMock())
+	ctx := context.Background()
+
+	if op, err := b.Operation(ctx, groupID, operationID); err != nil || op.ID != operationID {
+		t.Fatalf("unexpected operation %+v, %v", op, err)
+	}
+	// the operation of another group
+	if _, err := b.Operation(ctx, parentID, operationID); !errors.Is(err, group.ErrOperationNotFound) {
+		t.Fatalf("expected ErrOperationNotFound, got %v", err)
+	}
+	if _, err := b.Operation(ctx, groupID, "unknown"); !errors.Is(err, group.ErrOperationNotFound) {
+		t.Fatalf("expected ErrOperationNotFound, got %v", err)
+	}
+}
+
+func TestRunOperations(t *testing.T) {
+	// a full page of devices, and one more
+	ids := make([]string, 501)
+	var pages []device.Device
+	for i := range ids {
+		ids[i] = fmt.Sprintf("d%03d", i)
+		pages = append(pages, device.Device{ID: ids[i]})
+	}
+	completedAt := now
+
+	testTable := map[string]struct {
+		operation group.Operation
+		devices   *devicesMock
+		pages     [][]string
+		expected  func(op group.Operation) group.Operation
+	}{
+		"labels": {
+			operation: group.Operation{Kind: group.OperationLabels, Labels: &group.LabelChange{Set: map[string]string{"env": "prod"}, Remove: []string{"beta"}}},
+			devices: func() *devicesMock {
+				d := newDevicesMock(
+					// d1 already has the labels
+					device.Device{ID: "d1", Labels: map[string]string{"env": "prod"}},
+					device.Device{ID: "d2", Labels: map[string]string{"region": "eu", "beta": "true"}},
+					device.Device{ID: "d3", Labels: map[string]string{"region": "eu"}},
+					device.Device{ID: "d4", Labels: map[string]string{"region": "eu"}},
+				)
+				d.failing = "d4"
+				return d
+			}(),
+			// d9 was deleted and is skipped
+			pages: [][]string{{"d1", "d2", "d3", "d4", "d9"}},
+			expected: func(op group.Operation) group.Operation {
+				op.Devices, op.Succeeded, op.Failed = 4, 3, 1
+				op.Failures = []group.Failure{{DeviceID: "d4", Error: "internal error"}}
+				op.Cursor = "d9"
+				return op
+			},
+		},
+		"command on pages": {
+			operation: group.Operation{Kind: group.OperationCommand, Command: &command.CreateCommand{Name: "reboot"}},
+			devices: func() *devicesMock {
+				d := newDevicesMock(pages...)
+				d.failing = "d500"
+				return d
+			}(),
+			pages: [][]string{ids[:500], ids[500:]},
+			expected: func(op group.Operation) group.Operation {
+				op.Devices, op.Succeeded, op.Failed = 501, 500, 1
+				op.Failures = []group.Failure{{DeviceID: "d500", Error: "device not found"}}
+				op.Cursor = "d500"
+				return op
+			},
+		},
+		"no devices": {
+			operation: group.Operation{Kind: group.OperationCommand, Command: &command.CreateCommand{Name: "reboot"}},
+			devices:   newDevicesMock(),
+			pages:     [][]string{{}},
+			expected:  func(op group.Operation) group.Operation { return op },
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			store := &mocks.Store{}
+			tree := newGroupTree(store)
+			op := tc.operation
+			op.ID, op.GroupID, op.Status = operationID, tree.root.ID, group.OperationRunning
+			store.On("ListOperations", mock.Anything, group.OperationRunning, 0, 500).Return([]group.Operation{op}, nil)
+			stored := op
+			store.On("UpdateOperation", mock.Anything, operationID).Return(&stored, nil)
+			after := ""
+			for _, page := range tc.pages {
+				store.On("DeviceIDs", mock.Anything, tree.membership(), after, 0, 500).Return(page, nil).Once()
+				if len(page) > 0 {
+					after = page[len(page)-1]
+				}
+			}
+
+			completed, err := newBusiness(txStore{store}, tc.devices).RunOperations(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if completed != 1 {
+				t.Fatalf("expected 1 completed operation, got %d", completed)
+			}
+			expected := tc.expected(op)
+			expected.Status, expected.UpdatedAt, expected.CompletedAt = group.OperationCompleted, now, &completedAt
+			if !reflect.DeepEqual(stored, expected) {
+				t.Fatalf("expected %+v, got %+v", expected, stored)
+			}
+			store.AssertNumberOfCalls(t, "DeviceIDs", len(tc.pages))
+			if len(tc.devices.outside) > 0 {
+				t.Fatalf("expected the devices written to in the operation transaction, got %v outside of it", tc.devices.outside)
+			}
+		})
+	}
+
+	t.Run("labels changed", func(t *testing.T) {
+		store := &mocks.Store{}
+		tree := newGroupTree(store)
+		stored := group.Operation{ID: operationID, GroupID: tree.root.ID, Kind: group.OperationLabels, Status: group.OperationRunning, Labels: &group.LabelChange{Set: map[string]string{"env": "prod"}, Remove: []string{"beta"}}}
+		store.On("ListOperations", mock.Anything, group.OperationRunning, 0, 500).Return([]group.Operation{stored}, nil)
+		store.On("UpdateOperation", mock.Anything, operationID).Return(&stored, nil)
+		store.On("DeviceIDs", mock.Anything, tree.membership(), "", 0, 500).Return([]string{"d1", "d2"}, nil)
+		devices := newDevicesMock(
+			device.Device{ID: "d1", Labels: map[string]string{"env": "prod"}},
+			device.Device{ID: "d2", Labels: map[string]string{"region": "eu", "beta": "true"}},
+		)
+
+		if _, err := newBusiness(store, devices).RunOperations(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := devices.updates["d1"]; ok {
+			t.Fatal("unchanged device updated")
+		}
+		if labels := devices.updates["d2"].Labels; !reflect.DeepEqual(labels, map[string]string{"region": "eu", "env": "prod"}) {
+			t.Fatalf("unexpected labels %v", labels)
+		}
+	})
+
+	t.Run("group deleted", func(t *testing.T) {
+		store := &mocks.Store{}
+		stored := group.Operation{ID: operationID, GroupID: "unknown", Kind: group.OperationCommand, Status: group.OperationRunning, Command: &command.CreateCommand{Name: "reboot"}}
+		store.On("ListOperations", mock.Anything, group.OperationRunning, 0, 500).Return([]group.Operation{stored}, nil)
+		store.On("UpdateOperation", mock.Anything, operationID).Return(&stored, nil)
+		store.On("ByID", mock.Anything, "unknown").Return(group.Group{}, group.ErrNotFound)
+
+		if _, err := newBusiness(store, newDevicesMock()).RunOperations(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != group.OperationCompleted || stored.Devices != 0 {
+			t.Fatalf("unexpected operation %+v", stored)
+		}
+		store.AssertNotCalled(t, "DeviceIDs", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
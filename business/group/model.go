@@ -0,0 +1,300 @@
+package group
+
+import (
+	"device/business/device"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxNameLength bounds the names of groups
+	maxNameLength = 100
+	// maxDescriptionLength bounds the descriptions of groups
+	maxDescriptionLength = 1000
+	// MaxDepth is the number of levels groups may be nested on, the
+	// top-level groups included
+	MaxDepth = 8
+	// MaxMembersPerRequest is the number of devices a request may add to a static group
+	MaxMembersPerRequest = 1000
+)
+
+var (
+	ErrNotFound = errors.New("group not found")
+	// ErrParentNotFound is returned when a group is nested in a group that does not exist
+	ErrParentNotFound = errors.New("parent group not found")
+	// ErrCycle is returned when a group would be nested in itself or one of its subgroups
+	ErrCycle = errors.New("a group cannot be nested in itself or its subgroups")
+	// ErrTooDeep is returned when nesting a group would exceed MaxDepth levels
+	ErrTooDeep = errors.New("groups nested too deep")
+	// ErrHasSubgroups is returned when deleting a group that has subgroups
+	ErrHasSubgroups = errors.New("group has subgroups")
+	// ErrNotStatic is returned when managing the members of a dynamic group
+	ErrNotStatic = errors.New("group is not static")
+	// ErrNotDynamic is returned when setting the filter of a static group
+	ErrNotDynamic = errors.New("group is not dynamic")
+	// ErrUnknownDevice is returned when adding a device that does not exist to a group
+	ErrUnknownDevice = errors.New("device not found")
+	// ErrNotMember is returned when removing a device that is not a member of a group
+	ErrNotMember = errors.New("device is not a member of the group")
+)
+
+// Kind tells how the members of a group are chosen: listed one by one in a
+// static group, or selected by the filter of a dynamic group
+type Kind string
+
+// Group kinds
+const (
+	KindStatic  Kind = "static"
+	KindDynamic Kind = "dynamic"
+)
+
+// Valid reports whether k is a known kind
+func (k Kind) Valid() bool {
+	return k == KindStatic || k == KindDynamic
+}
+
+// Filter selects the members of a dynamic group. Both fields narrow it.
+type Filter struct {
+	Brand  string            `json:"brand,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Validate validates the Filter fields
+func (f Filter) Validate() error {
+	if f.Brand == "" && len(f.Labels) == 0 {
+		return fmt.Errorf("filter must set a brand or labels")
+	}
+	if err := device.ValidateLabels(f.Labels); err != nil {
+		return fmt.Errorf("filter: %w", err)
+	}
+	return nil
+}
+
+// Membership selects the devices of groups: the members of static groups
+// and the devices matching the filters of dynamic ones
+type Membership struct {
+	// GroupIDs are the static groups
+	GroupIDs []string
+	// Filters are the filters of the dynamic groups
+	Filters []Filter
+}
+
+// Group is a set of devices operated on together. Groups nest: the devices
+// of a group are its own members along with the devices of its subgroups.
+type Group struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Kind        Kind   `json:"kind"`
+	// ParentID is the group the group is nested in, empty for a top-level group
+	ParentID string `json:"parent_id,omitempty"`
+	// Filter selects the members of a dynamic group
+	Filter    *Filter   `json:"filter,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateGroup represents the data needed to create a group
+type CreateGroup struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Kind        Kind   `json:"kind"`
+	ParentID    string `json:"parent_id,omitempty"`
+	// Filter is required for a dynamic group
+	Filter *Filter `json:"filter,omitempty"`
+	// DeviceIDs are the first members of a static group
+	DeviceIDs []string `json:"device_ids,omitempty"`
+}
+
+// Validate validates the CreateGroup fields
+func (cg CreateGroup) Validate() error {
+	var errs []error
+	errs = append(errs, validateName(cg.Name), validateDescription(cg.Description))
+	if cg.ParentID != "" {
+		if _, err := uuid.Parse(cg.ParentID); err != nil {
+			errs = append(errs, fmt.Errorf("parent_id must be a UUID"))
+		}
+	}
+
+	switch cg.Kind {
+	case KindStatic:
+		if cg.Filter != nil {
+			errs = append(errs, fmt.Errorf("filter is only for dynamic groups"))
+		}
+		if len(cg.DeviceIDs) > 0 {
+			errs = append(errs, validateDeviceIDs(cg.DeviceIDs))
+		}
+	case KindDynamic:
+		if cg.Filter == nil {
+			errs = append(errs, fmt.Errorf("filter is required for dynamic groups"))
+		} else {
+			errs = append(errs, cg.Filter.Validate())
+		}
+		if len(cg.DeviceIDs) > 0 {
+			errs = append(errs, fmt.Errorf("device_ids is only for static groups"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("kind must be static or dynamic"))
+	}
+	return errors.Join(errs...)
+}
+
+// toGroup converts a CreateGroup to a Group created at now
+func (cg CreateGroup) toGroup(now time.Time) Group {
+	return Group{
+		ID:          uuid.NewString(),
+		Name:        cg.Name,
+		Description: cg.Description,
+		Kind:        cg.Kind,
+		ParentID:    cg.ParentID,
+		Filter:      cg.Filter,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// UpdateGroup represents the data needed to update a group. Its kind cannot change.
+type UpdateGroup struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// ParentID, if set, nests the group in another one; an empty string
+	// makes it a top-level group
+	ParentID *string `json:"parent_id,omitempty"`
+	// Filter, if set, replaces the filter of a dynamic group
+	Filter *Filter `json:"filter,omitempty"`
+}
+
+// Validate validates the UpdateGroup fields
+func (ug UpdateGroup) Validate() error {
+	var errs []error
+	if ug.Name != nil {
+		errs = append(errs, validateName(*ug.Name))
+	}
+	if ug.Description != nil {
+		errs = append(errs, validateDescription(*ug.Description))
+	}
+	if ug.ParentID != nil && *ug.ParentID != "" {
+		if _, err := uuid.Parse(*ug.ParentID); err != nil {
+			errs = append(errs, fmt.Errorf("parent_id must be a UUID"))
+		}
+	}
+	if ug.Filter != nil {
+		errs = append(errs, ug.Filter.Validate())
+	}
+	return errors.Join(errs...)
+}
+
+// apply applies ug to g at now
+func (ug UpdateGroup) apply(g *Group, now time.Time) error {
+	if ug.Filter != nil && g.Kind != KindDynamic {
+		return ErrNotDynamic
+	}
+	if ug.Name != nil {
+		g.Name = *ug.Name
+	}
+	if ug.Description != nil {
+		g.Description = *ug.Description
+	}
+	if ug.ParentID != nil {
+		g.ParentID = *ug.ParentID
+	}
+	if ug.Filter != nil {
+		g.Filter = ug.Filter
+	}
+	g.UpdatedAt = now
+	return nil
+}
+
+// Members represents the devices to add to a static group
+type Members struct {
+	DeviceIDs []string `json:"device_ids"`
+}
+
+// Validate validates the Members fields
+func (m Members) Validate() error {
+	if len(m.DeviceIDs) == 0 {
+		return fmt.Errorf("device_ids is required")
+	}
+	return validateDeviceIDs(m.DeviceIDs)
+}
+
+// LabelChange represents labels to set on, and remove from, every device of a group
+type LabelChange struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// Validate validates the LabelChange fields
+func (lc LabelChange) Validate() error {
+	if len(lc.Set) == 0 && len(lc.Remove) == 0 {
+		return fmt.Errorf("set or remove is required")
+	}
+	var errs []error
+	if err := device.ValidateLabels(lc.Set); err != nil {
+		errs = append(errs, fmt.Errorf("set: %w", err))
+	}
+	for _, k := range lc.Remove {
+		if _, ok := lc.Set[k]; ok {
+			errs = append(errs, fmt.Errorf("label %q cannot be both set and removed", k))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply returns labels changed by lc, and whether they changed
+func (lc LabelChange) apply(labels map[string]string) (map[string]string, bool) {
+	changed := map[string]string{}
+	for k, v := range labels {
+		changed[k] = v
+	}
+	var modified bool
+	for _, k := range lc.Remove {
+		if _, ok := changed[k]; ok {
+			delete(changed, k)
+			modified = true
+		}
+	}
+	for k, v := range lc.Set {
+		if l, ok := changed[k]; !ok || l != v {
+			changed[k] = v
+			modified = true
+		}
+	}
+	return changed, modified
+}
+
+// validateName reports an error unless name is a valid group name
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxNameLength)
+	}
+	return nil
+}
+
+// validateDescription reports an error unless description is a valid group description
+func validateDescription(description string) error {
+	if len(description) > maxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxDescriptionLength)
+	}
+	return nil
+}
+
+// validateDeviceIDs reports an error unless ids are at most
+// MaxMembersPerRequest device IDs
+func validateDeviceIDs(ids []string) error {
+	if len(ids) > MaxMembersPerRequest {
+		return fmt.Errorf("device_ids must list at most %d devices", MaxMembersPerRequest)
+	}
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("device_ids must be UUIDs, got %q", id)
+		}
+	}
+	return nil
+}
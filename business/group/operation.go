@@ -0,0 +1,100 @@
+package group
+
+import (
+	"device/business/command"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxRecordedFailures is the number of devices an operation lists among the
+// ones it failed on
+const MaxRecordedFailures = 100
+
+// ErrOperationNotFound is returned when a group has no such operation
+var ErrOperationNotFound = errors.New("operation not found")
+
+// OperationKind tells what an operation does to the devices of a group
+type OperationKind string
+
+// Operation kinds
+const (
+	OperationLabels  OperationKind = "labels"
+	OperationCommand OperationKind = "command"
+)
+
+// OperationStatus is the stage an operation is at
+type OperationStatus string
+
+// Operation statuses
+const (
+	// OperationRunning operations are run a page of devices at a time
+	OperationRunning OperationStatus = "running"
+	// OperationCompleted operations went through every device of their group
+	OperationCompleted OperationStatus = "completed"
+)
+
+// Operation changes the labels of, or enqueues a command for, every device
+// of a group, its subgroups included. It runs in the background over the
+// devices by ID, so the devices joining the group meanwhile are operated on
+// as long as they sort after the devices done.
+type Operation struct {
+	ID      string        `json:"id"`
+	GroupID string        `json:"group_id"`
+	Kind    OperationKind `json:"kind"`
+	// Labels is the change of a labels operation
+	Labels *LabelChange `json:"labels,omitempty"`
+	// Command is the command of a command operation
+	Command *command.CreateCommand `json:"command,omitempty"`
+	Status  OperationStatus        `json:"status"`
+	// Devices is the number of devices operated on so far
+	Devices   int `json:"devices"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Failures lists the first MaxRecordedFailures devices the operation failed on
+	Failures []Failure `json:"failures,omitempty"`
+	// Cursor is the ID of the last device operated on
+	Cursor      string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Failure is the error an operation failed with on a device
+type Failure struct {
+	DeviceID string `json:"device_id"`
+	Error    string `json:"error"`
+}
+
+// newOperation returns a running operation of kind on the group id, created at now
+func newOperation(id string, kind OperationKind, now time.Time) Operation {
+	return Operation{
+		ID:        uuid.NewString(),
+		GroupID:   id,
+		Kind:      kind,
+		Status:    OperationRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// record counts the outcome of the operation on the device id, msg telling
+// why it failed if it did
+func (op *Operation) record(id string, ok bool, msg string) {
+	op.Devices++
+	if ok {
+		op.Succeeded++
+		return
+	}
+	op.Failed++
+	if len(op.Failures) < MaxRecordedFailures {
+		op.Failures = append(op.Failures, Failure{DeviceID: id, Error: msg})
+	}
+}
+
+// complete marks the operation completed at now
+func (op *Operation) complete(now time.Time) {
+	op.Status = OperationCompleted
+	op.CompletedAt = &now
+}
@@ -0,0 +1,43 @@
+package group
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Runner runs the operations on the devices of groups: every interval it
+// takes the running operations through the devices of their groups
+type Runner struct {
+	business *Business
+	interval time.Duration
+}
+
+// NewRunner creates a new Runner instance that runs the operations of b
+// every interval
+func NewRunner(b *Business, interval time.Duration) *Runner {
+	return &Runner{
+		business: b,
+		interval: interval,
+	}
+}
+
+// Run runs the operations until ctx is cancelled
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.business.RunOperations(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(fmt.Errorf("business.RunOperations: %w", err)).Error("unable to run group operations")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
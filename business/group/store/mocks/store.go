@@ -0,0 +1,105 @@
+package mocks
+
+import (
+	"context"
+	"device/business/group"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the group store
+type Store struct {
+	mock.Mock
+}
+
+var _ group.Store = (*Store)(nil)
+
+// Create checks a nested group against the groups the mock returns, as the
+// store does before saving it
+func (s *Store) Create(ctx context.Context, g group.Group, deviceIDs []string, check func(tree group.Tree) error) error {
+	if g.ParentID != "" {
+		if err := check(s); err != nil {
+			return err
+		}
+	}
+	args := s.Called(ctx, g, deviceIDs)
+	return args.Error(0)
+}
+
+func (s *Store) ByID(ctx context.Context, id string) (group.Group, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(group.Group), args.Error(1)
+}
+
+func (s *Store) List(ctx context.Context, parentID string, offset, limit int) ([]group.Group, error) {
+	args := s.Called(ctx, parentID, offset, limit)
+	return args.Get(0).([]group.Group), args.Error(1)
+}
+
+// Update applies update to the group the mock returns a pointer to, so
+// tests see the updated group, reading the groups the mock returns
+func (s *Store) Update(ctx context.Context, id string, update func(g *group.Group, tree group.Tree) error) (group.Group, error) {
+	args := s.Called(ctx, id)
+	if err := args.Error(1); err != nil {
+		return group.Group{}, err
+	}
+	g := args.Get(0).(*group.Group)
+	if err := update(g, s); err != nil {
+		return group.Group{}, err
+	}
+	return *g, nil
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *Store) Subgroups(ctx context.Context, id string) ([]group.Group, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).([]group.Group), args.Error(1)
+}
+
+func (s *Store) AddMembers(ctx context.Context, id string, deviceIDs []string) error {
+	args := s.Called(ctx, id, deviceIDs)
+	return args.Error(0)
+}
+
+func (s *Store) RemoveMember(ctx context.Context, id, deviceID string) error {
+	args := s.Called(ctx, id, deviceID)
+	return args.Error(0)
+}
+
+func (s *Store) DeviceIDs(ctx context.Context, m group.Membership, after string, offset, limit int) ([]string, error) {
+	args := s.Called(ctx, m, after, offset, limit)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (s *Store) CreateOperation(ctx context.Context, op group.Operation) error {
+	args := s.Called(ctx, op)
+	return args.Error(0)
+}
+
+func (s *Store) OperationByID(ctx context.Context, id string) (group.Operation, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(group.Operation), args.Error(1)
+}
+
+func (s *Store) ListOperations(ctx context.Context, status group.OperationStatus, offset, limit int) ([]group.Operation, error) {
+	args := s.Called(ctx, status, offset, limit)
+	return args.Get(0).([]group.Operation), args.Error(1)
+}
+
+// UpdateOperation applies update to the operation the mock returns a
+// pointer to, so tests see the updated operation
+func (s *Store) UpdateOperation(ctx context.Context, id string, update func(ctx context.Context, op *group.Operation) error) (group.Operation, error) {
+	args := s.Called(ctx, id)
+	if err := args.Error(1); err != nil {
+		return group.Operation{}, err
+	}
+	op := args.Get(0).(*group.Operation)
+	if err := update(ctx, op); err != nil {
+		return group.Operation{}, err
+	}
+	return *op, nil
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"device/business/command"
+	"device/business/group"
+	"time"
+)
+
+// Group represents a group of devices
+type Group struct {
+	ID          string `gorm:"primaryKey;column:id"`
+	Name        string `gorm:"column:name"`
+	Description string `gorm:"column:description"`
+	Kind        string `gorm:"column:kind"`
+	// ParentID is NULL for a top-level group
+	ParentID  *string       `gorm:"column:parent_id;index:idx_device_groups_parent"`
+	Filter    *group.Filter `gorm:"column:filter;type:jsonb;serializer:json"`
+	CreatedAt time.Time     `gorm:"column:created_at"`
+	UpdatedAt time.Time     `gorm:"column:updated_at"`
+}
+
+// TableName overrides the default table name
+func (Group) TableName() string {
+	return "device_groups"
+}
+
+// Member represents a device listed by a static group
+type Member struct {
+	GroupID string `gorm:"primaryKey;column:group_id"`
+	// deleted devices are removed from groups by device
+	DeviceID string `gorm:"primaryKey;column:device_id;index:idx_device_group_members_device"`
+}
+
+// TableName overrides the default table name
+func (Member) TableName() string {
+	return "device_group_members"
+}
+
+// Operation represents an operation on the devices of a group
+type Operation struct {
+	ID      string                 `gorm:"primaryKey;column:id"`
+	GroupID string                 `gorm:"column:group_id"`
+	Kind    string                 `gorm:"column:kind"`
+	Labels  *group.LabelChange     `gorm:"column:labels;type:jsonb;serializer:json"`
+	Command *command.CreateCommand `gorm:"column:command;type:jsonb;serializer:json"`
+	// the runner looks up the running operations
+	Status      string          `gorm:"column:status;index:idx_device_group_operations_status"`
+	Devices     int             `gorm:"column:devices"`
+	Succeeded   int             `gorm:"column:succeeded"`
+	Failed      int             `gorm:"column:failed"`
+	Failures    []group.Failure `gorm:"column:failures;type:jsonb;serializer:json"`
+	Cursor      string          `gorm:"column:last_device_id"`
+	CreatedAt   time.Time       `gorm:"column:created_at"`
+	UpdatedAt   time.Time       `gorm:"column:updated_at"`
+	CompletedAt *time.Time      `gorm:"column:completed_at"`
+}
+
+// TableName overrides the default table name
+func (Operation) TableName() string {
+	return "device_group_operations"
+}
+
+// toBusinessGroup converts a Group to a group.Group
+func toBusinessGroup(g Group) group.Group {
+	var parentID string
+	if g.ParentID != nil {
+		parentID = *g.ParentID
+	}
+	return group.Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		Kind:        group.Kind(g.Kind),
+		ParentID:    parentID,
+		Filter:      g.Filter,
+		CreatedAt:   g.CreatedAt,
+		UpdatedAt:   g.UpdatedAt,
+	}
+}
+
+// fromBusinessGroup converts a group.Group to a Group
+func fromBusinessGroup(g group.Group) Group {
+	var parentID *string
+	if g.ParentID != "" {
+		parentID = &g.ParentID
+	}
+	return Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		Kind:        string(g.Kind),
+		ParentID:    parentID,
+		Filter:      g.Filter,
+		CreatedAt:   g.CreatedAt,
+		UpdatedAt:   g.UpdatedAt,
+	}
+}
+
+// toBusinessOperation converts an Operation to a group.Operation
+func toBusinessOperation(op Operation) group.Operation {
+	return group.Operation{
+		ID:          op.ID,
+		GroupID:     op.GroupID,
+		Kind:        group.OperationKind(op.Kind),
+		Labels:      op.Labels,
+		Command:     op.Command,
+		Status:      group.OperationStatus(op.Status),
+		Devices:     op.Devices,
+		Succeeded:   op.Succeeded,
+		Failed:      op.Failed,
+		Failures:    op.Failures,
+		Cursor:      op.Cursor,
+		CreatedAt:   op.CreatedAt,
+		UpdatedAt:   op.UpdatedAt,
+		CompletedAt: op.CompletedAt,
+	}
+}
+
+// fromBusinessOperation converts a group.Operation to an Operation
+func fromBusinessOperation(op group.Operation) Operation {
+	return Operation{
+		ID:          op.ID,
+		GroupID:     op.GroupID,
+		Kind:        string(op.Kind),
+		Labels:      op.Labels,
+		Command:     op.Command,
+		Status:      string(op.Status),
+		Devices:     op.Devices,
+		Succeeded:   op.Succeeded,
+		Failed:      op.Failed,
+		Failures:    op.Failures,
+		Cursor:      op.Cursor,
+		CreatedAt:   op.CreatedAt,
+		UpdatedAt:   op.UpdatedAt,
+		CompletedAt: op.CompletedAt,
+	}
+}
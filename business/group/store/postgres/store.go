@@ -0,0 +1,414 @@
+package postgres
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/group"
+	"device/pkg/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// createBatchSize is the number of members inserted per statement
+	createBatchSize = 1000
+	// nestingLockKey identifies the advisory lock serializing the changes of
+	// the nesting of groups
+	nestingLockKey = 0x67726f757073
+)
+
+// Store is a postgres implementation of the group.Store
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements group.Store and device.Dependent
+var (
+	_ group.Store      = (*Store)(nil)
+	_ device.Dependent = (*Store)(nil)
+)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create creates a group along with its first members, unless check fails
+func (s *Store) Create(ctx context.Context, g group.Group, deviceIDs []string, check func(tree group.Tree) error) error {
+	return database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if g.ParentID != "" {
+			if err := lockNesting(tx); err != nil {
+				return err
+			}
+			if err := check(tree{tx: tx}); err != nil {
+				return err
+			}
+		}
+		if err := lockParent(tx, g.ParentID); err != nil {
+			return err
+		}
+
+		row := fromBusinessGroup(g)
+		if result := tx.Create(&row); result.Error != nil {
+			return fmt.Errorf("db.Create: %w", result.Error)
+		}
+		return addMembers(tx, g.ID, deviceIDs)
+	})
+}
+
+// ByID returns a group by its ID
+func (s *Store) ByID(ctx context.Context, id string) (group.Group, error) {
+	return byID(database.Conn(ctx, s.db), id)
+}
+
+// byID returns a group by its ID
+func byID(db *gorm.DB, id string) (group.Group, error) {
+	var g Group
+	result := db.First(&g, "id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return group.Group{}, group.ErrNotFound
+	}
+	if result.Error != nil {
+		return group.Group{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessGroup(g), nil
+}
+
+// List returns the groups nested in parentID, or the top-level groups if
+// parentID is empty, by name
+func (s *Store) List(ctx context.Context, parentID string, offset, limit int) ([]group.Group, error) {
+	q := database.Conn(ctx, s.db)
+	if parentID != "" {
+		q = q.Where("parent_id = ?", parentID)
+	} else {
+		q = q.Where("parent_id IS NULL")
+	}
+
+	var rows []Group
+	result := q.Order("name, id").Offset(offset).Limit(limit).Find(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	gs := make([]group.Group, len(rows))
+	for i, g := range rows {
+		gs[i] = toBusinessGroup(g)
+	}
+	return gs, nil
+}
+
+// Update applies update to the group id, locked until it is saved. Any
+// update may move the group, so it takes the nesting lock first, and update
+// reads the groups of the transaction.
+func (s *Store) Update(ctx context.Context, id string, update func(g *group.Group, tree group.Tree) error) (group.Group, error) {
+	var g group.Group
+	err := database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if err := lockNesting(tx); err != nil {
+			return err
+		}
+		var row Group
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "id = ?", id)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return group.ErrNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+
+		g = toBusinessGroup(row)
+		parentID := g.ParentID
+		if err := update(&g, tree{tx: tx}); err != nil {
+			return err
+		}
+		if g.ParentID != parentID {
+			if err := lockParent(tx, g.ParentID); err != nil {
+				return err
+			}
+		}
+		row = fromBusinessGroup(g)
+		if result := tx.Save(&row); result.Error != nil {
+			return fmt.Errorf("db.Save[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return group.Group{}, err
+	}
+	return g, nil
+}
+
+// Delete deletes a group without subgroups along with its members list
+func (s *Store) Delete(ctx context.Context, id string) error {
+	return database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		// the lock keeps groups from being nested in the group meanwhile
+		var g Group
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&g, "id = ?", id)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return group.ErrNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+
+		var subgroups int64
+		if result := tx.Model(&Group{}).Where("parent_id = ?", id).Count(&subgroups); result.Error != nil {
+			return fmt.Errorf("db.Count[%s]: %w", id, result.Error)
+		}
+		if subgroups > 0 {
+			return group.ErrHasSubgroups
+		}
+
+		if result := tx.Delete(&Member{}, "group_id = ?", id); result.Error != nil {
+			return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+		}
+		if result := tx.Delete(&Group{}, "id = ?", id); result.Error != nil {
+			return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+}
+
+// Subgroups returns the groups nested in the group id, at any depth
+func (s *Store) Subgroups(ctx context.Context, id string) ([]group.Group, error) {
+	return subgroups(database.Conn(ctx, s.db), id)
+}
+
+// subgroups returns the groups nested in the group id, at any depth
+func subgroups(db *gorm.DB, id string) ([]group.Group, error) {
+	var rows []Group
+	// UNION rather than UNION ALL ends the recursion should a cycle exist
+	result := db.Raw(`WITH RECURSIVE subgroups AS (
+		SELECT id, parent_id FROM device_groups WHERE parent_id = ?
+		UNION
+		SELECT g.id, g.parent_id FROM device_groups g JOIN subgroups s ON g.parent_id = s.id
+	)
+	SELECT * FROM device_groups WHERE id IN (SELECT id FROM subgroups)`, id).Scan(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Raw[%s]: %w", id, result.Error)
+	}
+	gs := make([]group.Group, len(rows))
+	for i, g := range rows {
+		gs[i] = toBusinessGroup(g)
+	}
+	return gs, nil
+}
+
+// AddMembers adds the devices to the group id, skipping its members
+func (s *Store) AddMembers(ctx context.Context, id string, deviceIDs []string) error {
+	return database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		// the group must not be deleted meanwhile
+		var g Group
+		result := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&g, "id = ?", id)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return group.ErrNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+		return addMembers(tx, id, deviceIDs)
+	})
+}
+
+// RemoveMember removes a device from the group id
+func (s *Store) RemoveMember(ctx context.Context, id, deviceID string) error {
+	result := database.Conn(ctx, s.db).Delete(&Member{}, "group_id = ? AND device_id = ?", id, deviceID)
+	if result.Error != nil {
+		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return group.ErrNotMember
+	}
+	return nil
+}
+
+// DeviceIDs returns a page of the IDs of the devices of m, each once, by ID.
+// The members of the static groups and the devices matching each filter
+// are selected by a query of their own, which the indexes serve, and merged.
+func (s *Store) DeviceIDs(ctx context.Context, m group.Membership, after string, offset, limit int) ([]string, error) {
+	var (
+		selects []string
+		args    []interface{}
+	)
+	if len(m.GroupIDs) > 0 {
+		selects = append(selects, "SELECT device_id AS id FROM device_group_members WHERE group_id IN ?")
+		args = append(args, m.GroupIDs)
+	}
+	for _, f := range m.Filters {
+		var conds []string
+		if f.Brand != "" {
+			conds = append(conds, "brand = ?")
+			args = append(args, f.Brand)
+		}
+		if len(f.Labels) > 0 {
+			labels, err := json.Marshal(f.Labels)
+			if err != nil {
+				return nil, fmt.Errorf("json.Marshal: %w", err)
+			}
+			conds = append(conds, "labels @> ?::jsonb")
+			args = append(args, string(labels))
+		}
+		if len(conds) == 0 {
+			// an empty filter selects no devices rather than all of them
+			continue
+		}
+		selects = append(selects, "SELECT id FROM devices WHERE "+strings.Join(conds, " AND "))
+	}
+
+	deviceIDs := []string{}
+	if len(selects) == 0 {
+		return deviceIDs, nil
+	}
+	query := "SELECT id FROM (" + strings.Join(selects, " UNION ") + ") AS members WHERE id > ? ORDER BY id OFFSET ? LIMIT ?"
+	args = append(args, after, offset, limit)
+	result := database.Conn(ctx, s.db).Raw(query, args...).Scan(&deviceIDs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Raw: %w", result.Error)
+	}
+	return deviceIDs, nil
+}
+
+// CreateOperation creates an operation
+func (s *Store) CreateOperation(ctx context.Context, op group.Operation) error {
+	row := fromBusinessOperation(op)
+	if result := database.Conn(ctx, s.db).Create(&row); result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	return nil
+}
+
+// OperationByID returns an operation by its ID
+func (s *Store) OperationByID(ctx context.Context, id string) (group.Operation, error) {
+	var op Operation
+	result := database.Conn(ctx, s.db).First(&op, "id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return group.Operation{}, group.ErrOperationNotFound
+	}
+	if result.Error != nil {
+		return group.Operation{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessOperation(op), nil
+}
+
+// ListOperations returns the operations with status, oldest first
+func (s *Store) ListOperations(ctx context.Context, status group.OperationStatus, offset, limit int) ([]group.Operation, error) {
+	var rows []Operation
+	result := database.Conn(ctx, s.db).
+		Where("status = ?", string(status)).
+		Order("created_at, id").
+		Offset(offset).Limit(limit).
+		Find(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	ops := make([]group.Operation, len(rows))
+	for i, op := range rows {
+		ops[i] = toBusinessOperation(op)
+	}
+	return ops, nil
+}
+
+// UpdateOperation applies update to the operation id, locked until it is
+// saved. The stores update reaches through its ctx write in the same
+// transaction.
+func (s *Store) UpdateOperation(ctx context.Context, id string, update func(ctx context.Context, op *group.Operation) error) (group.Operation, error) {
+	var op group.Operation
+	err := database.NewTransactor(s.db).WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, s.db)
+		var row Operation
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "id = ?", id)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return group.ErrOperationNotFound
+		}
+		if result.Error != nil {
+			return fmt.Errorf("db.First[%s]: %w", id, result.Error)
+		}
+
+		op = toBusinessOperation(row)
+		if err := update(ctx, &op); err != nil {
+			return err
+		}
+		row = fromBusinessOperation(op)
+		if result := tx.Save(&row); result.Error != nil {
+			return fmt.Errorf("db.Save[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return group.Operation{}, err
+	}
+	return op, nil
+}
+
+// DeleteDevice removes the device id from every group
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	result := database.Conn(ctx, s.db).Delete(&Member{}, "device_id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+	}
+	return nil
+}
+
+// tree is the group.Tree of a transaction holding the nesting lock
+type tree struct {
+	tx *gorm.DB
+}
+
+// ByID returns a group by its ID
+func (t tree) ByID(_ context.Context, id string) (group.Group, error) {
+	return byID(t.tx, id)
+}
+
+// Subgroups returns the groups nested in the group id, at any depth
+func (t tree) Subgroups(_ context.Context, id string) ([]group.Group, error) {
+	return subgroups(t.tx, id)
+}
+
+// lockNesting takes the lock serializing the changes of the nesting of
+// groups, held until the transaction ends, so that two of them cannot both
+// pass their checks and together nest groups too deep or in each other. It
+// is taken before any row lock, so that the transactions taking both wait
+// for each other in the same order.
+func lockNesting(tx *gorm.DB) error {
+	if result := tx.Exec("SELECT pg_advisory_xact_lock(?)", nestingLockKey); result.Error != nil {
+		return fmt.Errorf("db.Exec: %w", result.Error)
+	}
+	return nil
+}
+
+// lockParent locks the group parentID, if set, so it is not deleted until
+// the transaction ends. It fails with group.ErrParentNotFound if the group
+// does not exist.
+func lockParent(tx *gorm.DB, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	var parent Group
+	result := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&parent, "id = ?", parentID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return group.ErrParentNotFound
+	}
+	if result.Error != nil {
+		return fmt.Errorf("db.First[%s]: %w", parentID, result.Error)
+	}
+	return nil
+}
+
+// addMembers adds the devices to the group id, skipping its members
+func addMembers(tx *gorm.DB, id string, deviceIDs []string) error {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	rows := make([]Member, len(deviceIDs))
+	for i, deviceID := range deviceIDs {
+		rows[i] = Member{GroupID: id, DeviceID: deviceID}
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&rows, createBatchSize)
+	if result.Error != nil {
+		return fmt.Errorf("db.CreateInBatches: %w", result.Error)
+	}
+	return nil
+}
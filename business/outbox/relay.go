@@ -0,0 +1,205 @@
+package outbox
+
+import (
+	"context"
+	"device/business/event"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultMaxAttempts  = 10
+	// staleFlushes is how many poll intervals may pass without a successful
+	// flush before the relay reports itself stale
+	staleFlushes = 30
+)
+
+// Store is an interface to interact with the outbox table
+type Store interface {
+	Add(ctx context.Context, events ...event.Event) error
+	Pending(ctx context.Context, limit int) ([]event.Event, error)
+	MarkPublished(ctx context.Context, ids ...string) error
+	MarkFailed(ctx context.Context, id string, reason error) (int, error)
+	MarkDead(ctx context.Context, id string) error
+}
+
+// Transactor runs a function inside a database transaction
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Relay delivers the events stored in the outbox to a publisher.
+// An event is marked as published only after the publisher accepted it,
+// so delivery is at least once. An event that keeps failing is marked dead
+// after maxAttempts so it no longer blocks the events behind it.
+type Relay struct {
+	store        Store
+	tx           Transactor
+	publisher    event.Publisher
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	now          func() time.Time
+	started      time.Time
+	lastFlush    atomic.Int64
+	// oldestPending is when the oldest event left pending by the last flush
+	// occurred, in unix nanoseconds, or 0 when the relay caught up
+	oldestPending atomic.Int64
+}
+
+// Option configures the Relay
+type Option func(*Relay)
+
+// WithClock makes the Relay tell the time with now instead of the system clock
+func WithClock(now func() time.Time) Option {
+	return func(r *Relay) {
+		r.now = now
+	}
+}
+
+// NewRelay creates a new Relay instance
+func NewRelay(store Store, tx Transactor, publisher event.Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:        store,
+		tx:           tx,
+		publisher:    publisher,
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+		maxAttempts:  defaultMaxAttempts,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.started = r.now()
+	return r
+}
+
+// Register registers the backlog gauges of the relay on reg
+func (r *Relay) Register(reg prometheus.Registerer) {
+	reg.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "outbox_last_flush_age_seconds",
+			Help: "Seconds since the relay last flushed the outbox, or since it started if it never did.",
+		}, func() float64 { return r.now().Sub(r.lastFlushed()).Seconds() }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "outbox_backlog_age_seconds",
+			Help: "Age of the oldest outbox event the relay left pending, 0 when it caught up.",
+		}, func() float64 {
+			oldest := r.oldestPending.Load()
+			if oldest == 0 {
+				return 0
+			}
+			return r.now().Sub(time.Unix(0, oldest)).Seconds()
+		}),
+	)
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.Flush(ctx)
+			if err != nil {
+				logrus.WithError(fmt.Errorf("relay.Flush: %w", err)).Error("unable to relay outbox events")
+				break
+			}
+			if n < r.batchSize {
+				break
+			}
+		}
+		if err := r.Check(ctx); err != nil {
+			logrus.WithError(err).Warn("outbox relay is falling behind")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes one batch of pending events and returns how many were published.
+// Delivery stops at the first failure so events keep their order, unless the
+// failing event ran out of attempts: it is then marked dead and skipped.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	var (
+		published  int
+		publishErr error
+		oldest     int64
+	)
+	err := r.tx.WithinTx(ctx, func(ctx context.Context) error {
+		events, err := r.store.Pending(ctx, r.batchSize)
+		if err != nil {
+			return fmt.Errorf("store.Pending: %w", err)
+		}
+
+		ids := make([]string, 0, len(events))
+		for _, e := range events {
+			err := r.publisher.Publish(ctx, e)
+			if err == nil {
+				ids = append(ids, e.ID)
+				continue
+			}
+
+			attempts, markErr := r.store.MarkFailed(ctx, e.ID, err)
+			if markErr != nil {
+				return fmt.Errorf("store.MarkFailed[%s]: %w", e.ID, markErr)
+			}
+			if attempts < r.maxAttempts {
+				publishErr = err
+				oldest = e.OccurredAt.UnixNano()
+				break
+			}
+			if err := r.store.MarkDead(ctx, e.ID); err != nil {
+				return fmt.Errorf("store.MarkDead[%s]: %w", e.ID, err)
+			}
+			logrus.WithError(err).WithField("event_id", e.ID).Error("outbox event dead after too many attempts")
+		}
+
+		if len(ids) > 0 {
+			if err := r.store.MarkPublished(ctx, ids...); err != nil {
+				return fmt.Errorf("store.MarkPublished: %w", err)
+			}
+		}
+		published = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.oldestPending.Store(oldest)
+	if publishErr != nil {
+		return published, fmt.Errorf("publisher.Publish: %w", publishErr)
+	}
+	r.lastFlush.Store(r.now().UnixNano())
+	return published, nil
+}
+
+// Check reports an error when the relay has not flushed the outbox for a while,
+// which means events are piling up. A relay that never flushed since it started
+// counts as stale once the same time has passed.
+func (r *Relay) Check(ctx context.Context) error {
+	if since := r.now().Sub(r.lastFlushed()); since > staleFlushes*r.pollInterval {
+		return fmt.Errorf("outbox not flushed for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+// lastFlushed returns when the relay last flushed the outbox, or when it started
+func (r *Relay) lastFlushed() time.Time {
+	if last := r.lastFlush.Load(); last != 0 {
+		return time.Unix(0, last)
+	}
+	return r.started
+}
@@ -0,0 +1,160 @@
+package outbox_test
+
+import (
+	"context"
+	"device/business/event"
+	"device/business/outbox"
+	"device/business/outbox/store/mocks"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+)
+
+type txMock struct{}
+
+func (txMock) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type publisherMock struct {
+	published []string
+	failOn    string
+}
+
+func (p *publisherMock) Publish(ctx context.Context, e event.Event) error {
+	if e.ID == p.failOn {
+		return fmt.Errorf("publish err")
+	}
+	p.published = append(p.published, e.ID)
+	return nil
+}
+
+func TestFlush(t *testing.T) {
+	pending := []event.Event{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	testTable := map[string]struct {
+		failOn            string
+		expectedPublished []string
+		expectedFailed    string
+		attempts          int
+		expectedDead      bool
+		expectedErr       error
+	}{
+		"ok": {
+			expectedPublished: []string{"1", "2", "3"},
+		},
+		"publish error": {
+			failOn:            "2",
+			expectedPublished: []string{"1"},
+			expectedFailed:    "2",
+			attempts:          1,
+			expectedErr:       fmt.Errorf("publisher.Publish: publish err"),
+		},
+		"dead event is skipped": {
+			failOn:            "2",
+			expectedPublished: []string{"1", "3"},
+			expectedFailed:    "2",
+			attempts:          10,
+			expectedDead:      true,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			s := mocks.Store{}
+			s.On("Pending", mock.Anything, mock.AnythingOfType("int")).Return(pending, nil)
+			s.On("MarkPublished", mock.Anything, tc.expectedPublished).Return(nil)
+			if tc.expectedFailed != "" {
+				s.On("MarkFailed", mock.Anything, tc.expectedFailed, mock.Anything).Return(tc.attempts, nil)
+			}
+			if tc.expectedDead {
+				s.On("MarkDead", mock.Anything, tc.expectedFailed).Return(nil)
+			}
+
+			p := publisherMock{failOn: tc.failOn}
+			r := outbox.NewRelay(&s, txMock{}, &p)
+			n, err := r.Flush(context.Background())
+			if (err == nil && tc.expectedErr != nil) || (err != nil && tc.expectedErr == nil) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil && err.Error() != tc.expectedErr.Error() {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+
+			if n != len(tc.expectedPublished) {
+				t.Fatalf("expected %d published, got %d", len(tc.expectedPublished), n)
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+
+	s := mocks.Store{}
+	s.On("Pending", mock.Anything, mock.AnythingOfType("int")).Return([]event.Event{}, nil)
+	r := outbox.NewRelay(&s, txMock{}, &publisherMock{}, outbox.WithClock(clock))
+
+	if err := r.Check(context.Background()); err != nil {
+		t.Fatalf("expected a relay that just started to be healthy, got %v", err)
+	}
+
+	now = start.Add(time.Minute)
+	if err := r.Check(context.Background()); err == nil {
+		t.Fatalf("expected a relay that never flushed to be stale")
+	}
+
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := r.Check(context.Background()); err != nil {
+		t.Fatalf("expected a relay that just flushed to be healthy, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := r.Check(context.Background()); err == nil {
+		t.Fatalf("expected a relay that stopped flushing to be stale")
+	}
+}
+
+func TestBacklogMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+
+	pending := []event.Event{{ID: "1", OccurredAt: start.Add(-time.Minute)}, {ID: "2", OccurredAt: start}}
+	s := mocks.Store{}
+	s.On("Pending", mock.Anything, mock.AnythingOfType("int")).Return(pending, nil)
+	s.On("MarkPublished", mock.Anything, []string{"1"}).Return(nil)
+	s.On("MarkFailed", mock.Anything, "2", mock.Anything).Return(1, nil)
+
+	reg := prometheus.NewRegistry()
+	r := outbox.NewRelay(&s, txMock{}, &publisherMock{failOn: "2"}, outbox.WithClock(clock))
+	r.Register(reg)
+
+	now = start.Add(10 * time.Second)
+	if _, err := r.Flush(context.Background()); err == nil {
+		t.Fatalf("expected a publish error")
+	}
+	now = start.Add(30 * time.Second)
+
+	expected := `
+# HELP outbox_backlog_age_seconds Age of the oldest outbox event the relay left pending, 0 when it caught up.
+# TYPE outbox_backlog_age_seconds gauge
+outbox_backlog_age_seconds 30
+# HELP outbox_last_flush_age_seconds Seconds since the relay last flushed the outbox, or since it started if it never did.
+# TYPE outbox_last_flush_age_seconds gauge
+outbox_last_flush_age_seconds 30
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
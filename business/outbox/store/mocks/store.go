@@ -0,0 +1,41 @@
+package mocks
+
+import (
+	"context"
+	"device/business/event"
+	"device/business/outbox"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the outbox store
+type Store struct {
+	mock.Mock
+}
+
+var _ outbox.Store = (*Store)(nil)
+
+func (s *Store) Add(ctx context.Context, events ...event.Event) error {
+	args := s.Called(ctx, events)
+	return args.Error(0)
+}
+
+func (s *Store) Pending(ctx context.Context, limit int) ([]event.Event, error) {
+	args := s.Called(ctx, limit)
+	return args.Get(0).([]event.Event), args.Error(1)
+}
+
+func (s *Store) MarkPublished(ctx context.Context, ids ...string) error {
+	args := s.Called(ctx, ids)
+	return args.Error(0)
+}
+
+func (s *Store) MarkFailed(ctx context.Context, id string, reason error) (int, error) {
+	args := s.Called(ctx, id, reason)
+	return args.Int(0), args.Error(1)
+}
+
+func (s *Store) MarkDead(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
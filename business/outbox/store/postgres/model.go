@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"device/business/event"
+	"time"
+)
+
+// Event represents an outbox event
+type Event struct {
+	ID          string     `gorm:"primaryKey;column:id"`
+	Type        string     `gorm:"column:type"`
+	AggregateID string     `gorm:"column:aggregate_id;index"`
+	Data        []byte     `gorm:"column:data;type:jsonb"`
+	OccurredAt  time.Time  `gorm:"column:occurred_at;index"`
+	PublishedAt *time.Time `gorm:"column:published_at;index"`
+	Attempts    int        `gorm:"column:attempts"`
+	LastError   string     `gorm:"column:last_error"`
+	DeadAt      *time.Time `gorm:"column:dead_at"`
+}
+
+// TableName overrides the default table name
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// toBusinessEvent converts an Event to an event.Event
+func toBusinessEvent(e Event) event.Event {
+	return event.Event{
+		ID:          e.ID,
+		Type:        e.Type,
+		AggregateID: e.AggregateID,
+		Data:        e.Data,
+		OccurredAt:  e.OccurredAt,
+	}
+}
+
+// toBusinessEvents converts a slice of Event to a slice of event.Event
+func toBusinessEvents(es []Event) []event.Event {
+	events := make([]event.Event, len(es))
+	for i, e := range es {
+		events[i] = toBusinessEvent(e)
+	}
+	return events
+}
+
+// fromBusinessEvent converts an event.Event to an Event
+func fromBusinessEvent(e event.Event) Event {
+	return Event{
+		ID:          e.ID,
+		Type:        e.Type,
+		AggregateID: e.AggregateID,
+		Data:        e.Data,
+		OccurredAt:  e.OccurredAt,
+	}
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"device/business/event"
+	"device/business/outbox"
+	"device/pkg/database"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is a postgres implementation of the outbox.Store
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements outbox.Store
+var _ outbox.Store = (*Store)(nil)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// Add inserts events into the outbox
+func (s *Store) Add(ctx context.Context, events ...event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	rows := make([]Event, len(events))
+	for i, e := range events {
+		rows[i] = fromBusinessEvent(e)
+	}
+
+	result := database.Conn(ctx, s.db).Create(&rows)
+	if result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	return nil
+}
+
+// Pending returns the oldest unpublished events that are not dead. The rows stay locked until
+// the surrounding transaction ends, and rows locked by another relay are skipped.
+func (s *Store) Pending(ctx context.Context, limit int) ([]event.Event, error) {
+	var events []Event
+	result := database.Conn(ctx, s.db).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("published_at IS NULL AND dead_at IS NULL").
+		Order("occurred_at").
+		Limit(limit).
+		Find(&events)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessEvents(events), nil
+}
+
+// MarkPublished marks events as published
+func (s *Store) MarkPublished(ctx context.Context, ids ...string) error {
+	result := database.Conn(ctx, s.db).Model(&Event{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"published_at": time.Now(),
+		"last_error":   "",
+	})
+	if result.Error != nil {
+		return fmt.Errorf("db.Updates: %w", result.Error)
+	}
+	return nil
+}
+
+// MarkFailed records a failed delivery attempt and returns the attempts made so far
+func (s *Store) MarkFailed(ctx context.Context, id string, reason error) (int, error) {
+	var e Event
+	result := database.Conn(ctx, s.db).Model(&e).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "attempts"}}}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": reason.Error(),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("db.Updates[%s]: %w", id, result.Error)
+	}
+	return e.Attempts, nil
+}
+
+// MarkDead takes an event out of the pending queue for good
+func (s *Store) MarkDead(ctx context.Context, id string) error {
+	result := database.Conn(ctx, s.db).Model(&Event{}).Where("id = ?", id).Update("dead_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("db.Update[%s]: %w", id, result.Error)
+	}
+	return nil
+}
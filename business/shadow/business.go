@@ -0,0 +1,132 @@
+package shadow
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/tracing"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxAttempts is how many times an update without a version is tried when
+// concurrent updates conflict with it
+const maxAttempts = 3
+
+// Store is an interface to interact with the database
+type Store interface {
+	// ByDeviceID returns the shadow of the device id, at version 0 if it has none
+	ByDeviceID(ctx context.Context, id string) (Shadow, error)
+	// Save stores s if the stored shadow is at the version before s.Version,
+	// else it fails with ErrVersionConflict
+	Save(ctx context.Context, s Shadow) error
+}
+
+// Devices looks up the devices shadows belong to
+type Devices interface {
+	GetByID(ctx context.Context, id string) (device.Device, error)
+}
+
+// section selects the part of a shadow an update applies to
+type section string
+
+const (
+	sectionDesired  section = "desired"
+	sectionReported section = "reported"
+)
+
+// Business is the business logic for device shadows
+type Business struct {
+	store   Store
+	devices Devices
+	now     func() time.Time
+}
+
+// NewBusiness creates a new business logic for device shadows
+func NewBusiness(store Store, devices Devices) *Business {
+	return &Business{
+		store:   store,
+		devices: devices,
+		now:     time.Now,
+	}
+}
+
+// Get returns the shadow of the device id
+func (b *Business) Get(ctx context.Context, id string) (_ Shadow, err error) {
+	ctx, span := tracing.Start(ctx, "shadow.Business.Get")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return Shadow{}, fmt.Errorf("devices.GetByID: %w", err)
+	}
+	return b.byDeviceID(ctx, id)
+}
+
+// UpdateDesired merges a valid update into the desired state of the device id
+func (b *Business) UpdateDesired(ctx context.Context, id string, u UpdateState) (_ Shadow, err error) {
+	ctx, span := tracing.Start(ctx, "shadow.Business.UpdateDesired")
+	defer func() { tracing.End(span, err) }()
+
+	return b.update(ctx, id, sectionDesired, u)
+}
+
+// UpdateReported merges a valid update into the reported state of the device id
+func (b *Business) UpdateReported(ctx context.Context, id string, u UpdateState) (_ Shadow, err error) {
+	ctx, span := tracing.Start(ctx, "shadow.Business.UpdateReported")
+	defer func() { tracing.End(span, err) }()
+
+	return b.update(ctx, id, sectionReported, u)
+}
+
+// update merges u into a section of the shadow of the device id. Updates
+// without a version are retried when they conflict with concurrent ones.
+func (b *Business) update(ctx context.Context, id string, sec section, u UpdateState) (Shadow, error) {
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return Shadow{}, fmt.Errorf("devices.GetByID: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		s, err := b.byDeviceID(ctx, id)
+		if err != nil {
+			return Shadow{}, err
+		}
+		if u.Version != nil && *u.Version != s.Version {
+			return Shadow{}, fmt.Errorf("%w: the shadow is at version %d, not %d", ErrVersionConflict, s.Version, *u.Version)
+		}
+
+		state := &s.Desired
+		if sec == sectionReported {
+			state = &s.Reported
+		}
+		*state = merge(*state, u.State)
+		if err := checkSize(string(sec), *state); err != nil {
+			return Shadow{}, err
+		}
+		s.Version++
+		s.UpdatedAt = b.now().UTC()
+
+		err = b.store.Save(ctx, s)
+		if err == nil {
+			return s.withDelta(), nil
+		}
+		if !errors.Is(err, ErrVersionConflict) || u.Version != nil || attempt == maxAttempts {
+			return Shadow{}, fmt.Errorf("store.Save: %w", err)
+		}
+	}
+}
+
+// byDeviceID returns the shadow of the device id, with empty sections when it has none
+func (b *Business) byDeviceID(ctx context.Context, id string) (Shadow, error) {
+	s, err := b.store.ByDeviceID(ctx, id)
+	if err != nil {
+		return Shadow{}, fmt.Errorf("store.ByDeviceID: %w", err)
+	}
+	if s.Desired == nil {
+		s.Desired = State{}
+	}
+	if s.Reported == nil {
+		s.Reported = State{}
+	}
+	s.DeviceID = id
+	return s.withDelta(), nil
+}
@@ -0,0 +1,222 @@
+package shadow_test
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/shadow"
+	"device/business/shadow/store/mocks"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// devicesMock knows the devices of its set
+type devicesMock map[string]bool
+
+func (d devicesMock) GetByID(_ context.Context, id string) (device.Device, error) {
+	if !d[id] {
+		return device.Device{}, device.ErrNotFound
+	}
+	return device.Device{ID: id}, nil
+}
+
+// state decodes a JSON object, the way the handlers receive states
+func state(t *testing.T, s string) shadow.State {
+	t.Helper()
+	var st shadow.State
+	if err := json.Unmarshal([]byte(s), &st); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return st
+}
+
+// encode encodes v as JSON, to compare states
+func encode(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(b)
+}
+
+func TestGet(t *testing.T) {
+	testTable := map[string]struct {
+		id            string
+		stored        shadow.Shadow
+		expectedDelta string
+		expectedErr   error
+	}{
+		"no shadow yet": {
+			id:            "1",
+			stored:        shadow.Shadow{DeviceID: "1"},
+			expectedDelta: `{}`,
+		},
+		"pending changes": {
+			id: "1",
+			stored: shadow.Shadow{
+				DeviceID: "1",
+				Desired:  state(t, `{"mode": "eco", "led": {"color": "red", "on": true}, "interval": 60}`),
+				Reported: state(t, `{"mode": "eco", "led": {"color": "blue", "on": true}, "fw": "1.0"}`),
+				Version:  4,
+			},
+			expectedDelta: `{"interval":60,"led":{"color":"red"}}`,
+		},
+		"unknown device": {
+			id:          "2",
+			expectedErr: device.ErrNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			m.On("ByDeviceID", mock.Anything, tc.id).Return(tc.stored, nil)
+
+			b := shadow.NewBusiness(&m, devicesMock{"1": true})
+			s, err := b.Get(context.Background(), tc.id)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if s.Desired == nil || s.Reported == nil {
+				t.Fatalf("expected empty sections rather than nil, got %+v", s)
+			}
+			if got := encode(t, s.Delta); got != tc.expectedDelta {
+				t.Fatalf("expected delta %s, got %s", tc.expectedDelta, got)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	version := func(v int64) *int64 { return &v }
+	stored := func(t *testing.T) shadow.Shadow {
+		return shadow.Shadow{
+			DeviceID: "1",
+			Desired:  state(t, `{"mode": "eco", "led": {"color": "red", "on": true}}`),
+			Reported: state(t, `{"mode": "eco", "led": {"color": "blue", "on": true}}`),
+			Version:  3,
+		}
+	}
+
+	testTable := map[string]struct {
+		reported         bool
+		update           string
+		version          *int64
+		saveErrs         []error
+		expectedDesired  string
+		expectedReported string
+		expectedDelta    string
+		expectedVersion  int64
+		expectedErr      error
+	}{
+		"desired state merged": {
+			update:           `{"led": {"color": "green", "on": null}, "interval": 30}`,
+			expectedDesired:  `{"interval":30,"led":{"color":"green"},"mode":"eco"}`,
+			expectedReported: `{"led":{"color":"blue","on":true},"mode":"eco"}`,
+			expectedDelta:    `{"interval":30,"led":{"color":"green"}}`,
+			expectedVersion:  4,
+		},
+		"reported state clears the delta": {
+			reported:         true,
+			update:           `{"led": {"color": "red"}}`,
+			version:          version(3),
+			expectedDesired:  `{"led":{"color":"red","on":true},"mode":"eco"}`,
+			expectedReported: `{"led":{"color":"red","on":true},"mode":"eco"}`,
+			expectedDelta:    `{}`,
+			expectedVersion:  4,
+		},
+		"stale version": {
+			update:      `{"mode": "turbo"}`,
+			version:     version(2),
+			expectedErr: shadow.ErrVersionConflict,
+		},
+		"concurrent update retried": {
+			update:           `{"mode": "turbo"}`,
+			saveErrs:         []error{shadow.ErrVersionConflict},
+			expectedDesired:  `{"led":{"color":"red","on":true},"mode":"turbo"}`,
+			expectedReported: `{"led":{"color":"blue","on":true},"mode":"eco"}`,
+			expectedDelta:    `{"led":{"color":"red"},"mode":"turbo"}`,
+			expectedVersion:  4,
+		},
+		"concurrent update of an expected version": {
+			update:      `{"mode": "turbo"}`,
+			version:     version(3),
+			saveErrs:    []error{shadow.ErrVersionConflict},
+			expectedErr: shadow.ErrVersionConflict,
+		},
+		"conflicts keep happening": {
+			update:      `{"mode": "turbo"}`,
+			saveErrs:    []error{shadow.ErrVersionConflict, shadow.ErrVersionConflict, shadow.ErrVersionConflict},
+			expectedErr: shadow.ErrVersionConflict,
+		},
+		"too large": {
+			update:      fmt.Sprintf(`{"blob": %q}`, strings.Repeat("a", 9000)),
+			expectedErr: shadow.ErrTooLarge,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			current := stored(t)
+			m := mocks.Store{}
+			m.On("ByDeviceID", mock.Anything, "1").Return(current, nil)
+			for _, err := range tc.saveErrs {
+				m.On("Save", mock.Anything, mock.Anything).Return(err).Once()
+			}
+			var saved shadow.Shadow
+			m.On("Save", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				saved = args.Get(1).(shadow.Shadow)
+			}).Return(nil)
+
+			b := shadow.NewBusiness(&m, devicesMock{"1": true})
+			update := b.UpdateDesired
+			if tc.reported {
+				update = b.UpdateReported
+			}
+			s, err := update(context.Background(), "1", shadow.UpdateState{State: state(t, tc.update), Version: tc.version})
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if saved.Version != tc.expectedVersion || s.Version != tc.expectedVersion {
+				t.Fatalf("expected version %d, got %d saved and %d returned", tc.expectedVersion, saved.Version, s.Version)
+			}
+			if saved.UpdatedAt.IsZero() {
+				t.Fatalf("expected the update time to be set")
+			}
+			for name, c := range map[string][2]string{
+				"desired":  {tc.expectedDesired, encode(t, s.Desired)},
+				"reported": {tc.expectedReported, encode(t, s.Reported)},
+				"delta":    {tc.expectedDelta, encode(t, s.Delta)},
+			} {
+				if c[0] != c[1] {
+					t.Fatalf("expected %s %s, got %s", name, c[0], c[1])
+				}
+			}
+			if encode(t, current) != encode(t, stored(t)) {
+				t.Fatalf("expected the stored state to be left untouched")
+			}
+		})
+	}
+}
+
+func TestUpdateUnknownDevice(t *testing.T) {
+	m := mocks.Store{}
+	b := shadow.NewBusiness(&m, devicesMock{})
+	_, err := b.UpdateReported(context.Background(), "1", shadow.UpdateState{State: shadow.State{"mode": "eco"}})
+	if !errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", device.ErrNotFound, err)
+	}
+	m.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,113 @@
+package shadow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// maxDocumentSize is the largest size of the JSON encoding of a section of a shadow
+const maxDocumentSize = 8 << 10
+
+var (
+	// ErrVersionConflict is returned when a shadow changed since the version an update expects
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrTooLarge is returned when an update makes a section of a shadow larger than maxDocumentSize
+	ErrTooLarge = errors.New("document too large")
+)
+
+// State is a JSON object describing the state of a device
+type State map[string]interface{}
+
+// Shadow is the state of a device as desired by its operators and as reported
+// by the device. Delta holds the desired state the device has yet to report.
+type Shadow struct {
+	DeviceID  string    `json:"device_id"`
+	Desired   State     `json:"desired"`
+	Reported  State     `json:"reported"`
+	Delta     State     `json:"delta"`
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// withDelta returns s with its delta computed
+func (s Shadow) withDelta() Shadow {
+	s.Delta = delta(s.Desired, s.Reported)
+	return s
+}
+
+// UpdateState is the data needed to update a section of a shadow. State is
+// merged into the section: objects are merged key by key, a null removes its
+// key and any other value replaces the previous one. When Version is set, the
+// update fails unless the shadow is still at that version.
+type UpdateState struct {
+	State   State  `json:"state"`
+	Version *int64 `json:"version,omitempty"`
+}
+
+// Validate validates the UpdateState fields
+func (u UpdateState) Validate() error {
+	var errs []error
+	if u.State == nil {
+		errs = append(errs, fmt.Errorf("state is required"))
+	}
+	if u.Version != nil && *u.Version < 0 {
+		errs = append(errs, fmt.Errorf("version must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// merge returns a copy of dst with patch merged into it
+func merge(dst, patch State) State {
+	merged := make(State, len(dst)+len(patch))
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(merged, k)
+		case map[string]interface{}:
+			prev, _ := merged[k].(map[string]interface{})
+			merged[k] = map[string]interface{}(merge(prev, v))
+		default:
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// delta returns the keys of desired whose value differs from the one of
+// reported, recursing into the objects both have
+func delta(desired, reported State) State {
+	d := State{}
+	for k, want := range desired {
+		have, ok := reported[k]
+		wantObj, wantIsObj := want.(map[string]interface{})
+		haveObj, haveIsObj := have.(map[string]interface{})
+		switch {
+		case wantIsObj && haveIsObj:
+			if sub := delta(wantObj, haveObj); len(sub) > 0 {
+				d[k] = map[string]interface{}(sub)
+			}
+		case !ok || !reflect.DeepEqual(want, have):
+			d[k] = want
+		}
+	}
+	return d
+}
+
+// checkSize reports an error wrapping ErrTooLarge when the JSON encoding of s
+// is larger than maxDocumentSize
+func checkSize(section string, s State) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	if len(b) > maxDocumentSize {
+		return fmt.Errorf("%w: %s would be %d bytes, at most %d are allowed", ErrTooLarge, section, len(b), maxDocumentSize)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"context"
+	"device/business/shadow"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the shadow store
+type Store struct {
+	mock.Mock
+}
+
+var _ shadow.Store = (*Store)(nil)
+
+func (s *Store) ByDeviceID(ctx context.Context, id string) (shadow.Shadow, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(shadow.Shadow), args.Error(1)
+}
+
+func (s *Store) Save(ctx context.Context, sh shadow.Shadow) error {
+	args := s.Called(ctx, sh)
+	return args.Error(0)
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"device/business/shadow"
+	"time"
+)
+
+// Shadow represents the shadow of a device
+type Shadow struct {
+	DeviceID  string       `gorm:"primaryKey;column:device_id"`
+	Desired   shadow.State `gorm:"column:desired;type:jsonb;serializer:json"`
+	Reported  shadow.State `gorm:"column:reported;type:jsonb;serializer:json"`
+	Version   int64        `gorm:"column:version"`
+	UpdatedAt time.Time    `gorm:"column:updated_at"`
+}
+
+// TableName overrides the default table name
+func (Shadow) TableName() string {
+	return "device_shadows"
+}
+
+// toBusinessShadow converts a Shadow to a shadow.Shadow
+func toBusinessShadow(s Shadow) shadow.Shadow {
+	return shadow.Shadow{
+		DeviceID:  s.DeviceID,
+		Desired:   s.Desired,
+		Reported:  s.Reported,
+		Version:   s.Version,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// fromBusinessShadow converts a shadow.Shadow to a Shadow
+func fromBusinessShadow(s shadow.Shadow) Shadow {
+	return Shadow{
+		DeviceID:  s.DeviceID,
+		Desired:   s.Desired,
+		Reported:  s.Reported,
+		Version:   s.Version,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/shadow"
+	"device/pkg/database"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is a postgres implementation of the shadow.Store
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements shadow.Store and device.Dependent
+var (
+	_ shadow.Store     = (*Store)(nil)
+	_ device.Dependent = (*Store)(nil)
+)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// ByDeviceID returns the shadow of the device id, at version 0 if it has none
+func (s *Store) ByDeviceID(ctx context.Context, id string) (shadow.Shadow, error) {
+	var sh Shadow
+	result := database.Conn(ctx, s.db).First(&sh, "device_id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return shadow.Shadow{DeviceID: id}, nil
+	}
+	if result.Error != nil {
+		return shadow.Shadow{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessShadow(sh), nil
+}
+
+// Save stores sh if the stored shadow is at the version before sh.Version.
+// The first version is inserted, the next ones update the row still at the
+// previous version, so concurrent updates of the same version conflict.
+func (s *Store) Save(ctx context.Context, sh shadow.Shadow) error {
+	row := fromBusinessShadow(sh)
+	conn := database.Conn(ctx, s.db)
+
+	var result *gorm.DB
+	if sh.Version == 1 {
+		result = conn.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	} else {
+		// a struct, unlike a map, goes through the json serializer of the sections
+		result = conn.Model(&row).
+			Where("version = ?", sh.Version-1).
+			Select("desired", "reported", "version", "updated_at").
+			Updates(&row)
+	}
+	if result.Error != nil {
+		return fmt.Errorf("db.Save[%s]: %w", sh.DeviceID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return shadow.ErrVersionConflict
+	}
+	return nil
+}
+
+// DeleteDevice deletes the shadow of the device id
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	result := database.Conn(ctx, s.db).Delete(&Shadow{}, "device_id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+	}
+	return nil
+}
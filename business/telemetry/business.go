@@ -0,0 +1,102 @@
+package telemetry
+
+import (
+	"context"
+	"device/business/device"
+	"device/pkg/tracing"
+	"fmt"
+	"time"
+)
+
+// Store is an interface to interact with the database
+type Store interface {
+	// Add stores samples, replacing the ones of the same device, metric and time
+	Add(ctx context.Context, samples []Sample) error
+	// Points returns at most limit points of q, oldest first
+	Points(ctx context.Context, q Query, limit int) ([]Point, error)
+}
+
+// Devices looks up the devices samples belong to
+type Devices interface {
+	GetByID(ctx context.Context, id string) (device.Device, error)
+}
+
+// Business is the business logic for telemetry
+type Business struct {
+	store     Store
+	devices   Devices
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewBusiness creates a new business logic for telemetry. Samples older than
+// retention are rejected.
+func NewBusiness(store Store, devices Devices, retention time.Duration) *Business {
+	return &Business{
+		store:     store,
+		devices:   devices,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Ingest stores a valid batch of samples of the device id
+func (b *Business) Ingest(ctx context.Context, id string, batch Batch) (_ IngestResult, err error) {
+	ctx, span := tracing.Start(ctx, "telemetry.Business.Ingest")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, id); err != nil {
+		return IngestResult{}, fmt.Errorf("devices.GetByID: %w", err)
+	}
+
+	now := b.now()
+	samples := batch.toSamples(id, now)
+	oldest, newest := now.Add(-b.retention), now.Add(maxClockSkew)
+	for i, s := range samples {
+		if s.Time.Before(oldest) {
+			return IngestResult{}, fmt.Errorf("%w: samples[%d].time is older than the retention of %s", ErrInvalidSample, i, b.retention)
+		}
+		if s.Time.After(newest) {
+			return IngestResult{}, fmt.Errorf("%w: samples[%d].time is in the future", ErrInvalidSample, i)
+		}
+	}
+
+	if err := b.store.Add(ctx, samples); err != nil {
+		return IngestResult{}, fmt.Errorf("store.Add: %w", err)
+	}
+	return IngestResult{Samples: len(samples)}, nil
+}
+
+// Query returns the points of a valid query of the samples of a device
+func (b *Business) Query(ctx context.Context, q Query) (_ Series, err error) {
+	ctx, span := tracing.Start(ctx, "telemetry.Business.Query")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := b.devices.GetByID(ctx, q.DeviceID); err != nil {
+		return Series{}, fmt.Errorf("devices.GetByID: %w", err)
+	}
+
+	points, err := b.store.Points(ctx, q, MaxPoints+1)
+	if err != nil {
+		return Series{}, fmt.Errorf("store.Points: %w", err)
+	}
+	if len(points) > MaxPoints {
+		return Series{}, fmt.Errorf("%w: more than %d samples match, set a step", ErrTooManyPoints, MaxPoints)
+	}
+
+	s := Series{
+		DeviceID: q.DeviceID,
+		Metric:   q.Metric,
+		From:     q.From,
+		To:       q.To,
+		Points:   points,
+	}
+	if s.Points == nil {
+		s.Points = []Point{}
+	}
+	if q.Step > 0 {
+		s.Step = q.Step.String()
+		s.Aggregation = q.Aggregation
+	}
+	return s, nil
+}
@@ -0,0 +1,317 @@
+package telemetry_test
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/telemetry"
+	"device/business/telemetry/store/mocks"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// devicesMock knows the devices of its set
+type devicesMock map[string]bool
+
+func (d devicesMock) GetByID(_ context.Context, id string) (device.Device, error) {
+	if !d[id] {
+		return device.Device{}, device.ErrNotFound
+	}
+	return device.Device{ID: id}, nil
+}
+
+func TestBatchValidate(t *testing.T) {
+	sample := func(metric, value string) telemetry.IngestSample {
+		return telemetry.IngestSample{Metric: metric, Value: json.RawMessage(value)}
+	}
+
+	testTable := map[string]struct {
+		batch       telemetry.Batch
+		expectedErr []string
+	}{
+		"numbers and booleans": {
+			batch: telemetry.Batch{Samples: []telemetry.IngestSample{
+				sample("battery", "87.5"),
+				sample("signal.rssi", "-71"),
+				sample("door_open", "true"),
+			}},
+		},
+		"empty": {
+			batch:       telemetry.Batch{},
+			expectedErr: []string{"samples is required"},
+		},
+		"too many samples": {
+			batch:       telemetry.Batch{Samples: make([]telemetry.IngestSample, telemetry.MaxBatchSize+1)},
+			expectedErr: []string{"samples must hold at most 1000 samples"},
+		},
+		"invalid samples": {
+			batch: telemetry.Batch{Samples: []telemetry.IngestSample{
+				sample("Battery", "1"),
+				sample("signal..rssi", "1"),
+				sample("mode", `"eco"`),
+				sample("battery", "null"),
+				{Metric: "battery"},
+			}},
+			expectedErr: []string{
+				"samples[0].metric must be",
+				"samples[1].metric must be",
+				"samples[2].value must be a number or a boolean",
+				"samples[3].value is required",
+				"samples[4].value is required",
+			},
+		},
+		"metric too long": {
+			batch:       telemetry.Batch{Samples: []telemetry.IngestSample{sample(strings.Repeat("a", 65), "1")}},
+			expectedErr: []string{"samples[0].metric must be at most 64"},
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			err := tc.batch.Validate()
+			if (err != nil) != (len(tc.expectedErr) > 0) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			for _, msg := range tc.expectedErr {
+				if !strings.Contains(err.Error(), msg) {
+					t.Fatalf("expected %q in %v", msg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	to := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testTable := map[string]struct {
+		query       telemetry.Query
+		expectedErr string
+	}{
+		"raw": {
+			query: telemetry.Query{Metric: "battery", From: to.Add(-time.Hour), To: to},
+		},
+		"downsampled": {
+			query: telemetry.Query{Metric: "battery", From: to.Add(-time.Hour), To: to, Step: time.Minute, Aggregation: telemetry.AggregationLast},
+		},
+		"invalid metric": {
+			query:       telemetry.Query{Metric: "1battery", From: to.Add(-time.Hour), To: to},
+			expectedErr: "metric must be",
+		},
+		"from after to": {
+			query:       telemetry.Query{Metric: "battery", From: to, To: to},
+			expectedErr: "from must be before to",
+		},
+		"fractional step": {
+			query:       telemetry.Query{Metric: "battery", From: to.Add(-time.Hour), To: to, Step: 1500 * time.Millisecond, Aggregation: telemetry.AggregationAvg},
+			expectedErr: "step must be a whole number of seconds",
+		},
+		"unknown aggregation": {
+			query:       telemetry.Query{Metric: "battery", From: to.Add(-time.Hour), To: to, Step: time.Minute, Aggregation: "sum"},
+			expectedErr: "aggregation must be one of",
+		},
+		"too many steps": {
+			query:       telemetry.Query{Metric: "battery", From: to.Add(-30 * 24 * time.Hour), To: to, Step: time.Second, Aggregation: telemetry.AggregationAvg},
+			expectedErr: "at most 10000 are allowed",
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			err := tc.query.Validate()
+			if tc.expectedErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectedErr)) {
+				t.Fatalf("expected %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestIngest(t *testing.T) {
+	at := func(d time.Duration) *time.Time {
+		t := time.Now().Add(d)
+		return &t
+	}
+
+	testTable := map[string]struct {
+		id          string
+		samples     []telemetry.IngestSample
+		storeErr    error
+		expected    []float64
+		expectedErr error
+	}{
+		"ok": {
+			id: "1",
+			samples: []telemetry.IngestSample{
+				{Metric: "battery", Value: json.RawMessage("87.5"), Time: at(-time.Hour)},
+				{Metric: "door_open", Value: json.RawMessage("true")},
+				{Metric: "door_open", Value: json.RawMessage("false"), Time: at(time.Minute)},
+			},
+			expected: []float64{87.5, 1, 0},
+		},
+		"unknown device": {
+			id:          "2",
+			samples:     []telemetry.IngestSample{{Metric: "battery", Value: json.RawMessage("1")}},
+			expectedErr: device.ErrNotFound,
+		},
+		"older than the retention": {
+			id:          "1",
+			samples:     []telemetry.IngestSample{{Metric: "battery", Value: json.RawMessage("1"), Time: at(-25 * time.Hour)}},
+			expectedErr: telemetry.ErrInvalidSample,
+		},
+		"in the future": {
+			id:          "1",
+			samples:     []telemetry.IngestSample{{Metric: "battery", Value: json.RawMessage("1"), Time: at(time.Hour)}},
+			expectedErr: telemetry.ErrInvalidSample,
+		},
+		"store error": {
+			id:          "1",
+			samples:     []telemetry.IngestSample{{Metric: "battery", Value: json.RawMessage("1")}},
+			storeErr:    fmt.Errorf("db err"),
+			expectedErr: fmt.Errorf("db err"),
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			var stored []telemetry.Sample
+			m := mocks.Store{}
+			m.On("Add", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				stored = args.Get(1).([]telemetry.Sample)
+			}).Return(tc.storeErr)
+
+			b := telemetry.NewBusiness(&m, devicesMock{"1": true}, 24*time.Hour)
+			result, err := b.Ingest(context.Background(), tc.id, telemetry.Batch{Samples: tc.samples})
+			if tc.expectedErr != nil {
+				if err == nil || (!errors.Is(err, tc.expectedErr) && !strings.HasSuffix(err.Error(), tc.expectedErr.Error())) {
+					t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+				}
+				if tc.storeErr == nil {
+					m.AssertNotCalled(t, "Add", mock.Anything, mock.Anything)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if result.Samples != len(tc.expected) || len(stored) != len(tc.expected) {
+				t.Fatalf("expected %d samples, got %d ingested and %d stored", len(tc.expected), result.Samples, len(stored))
+			}
+			for i, s := range stored {
+				if s.DeviceID != tc.id || s.Metric != tc.samples[i].Metric || s.Value != tc.expected[i] || s.Time.IsZero() {
+					t.Fatalf("unexpected sample %d: %+v", i, s)
+				}
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	to := time.Now().UTC().Truncate(time.Minute)
+	points := []telemetry.Point{{Time: to.Add(-2 * time.Minute), Value: 1}, {Time: to.Add(-time.Minute), Value: 2}}
+
+	testTable := map[string]struct {
+		query       telemetry.Query
+		points      []telemetry.Point
+		expected    telemetry.Series
+		expectedErr error
+	}{
+		"raw": {
+			query:  telemetry.Query{DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to},
+			points: points,
+			expected: telemetry.Series{
+				DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to, Points: points,
+			},
+		},
+		"downsampled": {
+			query:  telemetry.Query{DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to, Step: time.Minute, Aggregation: telemetry.AggregationMax},
+			points: points,
+			expected: telemetry.Series{
+				DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to, Step: "1m0s", Aggregation: telemetry.AggregationMax, Points: points,
+			},
+		},
+		"no samples": {
+			query: telemetry.Query{DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to},
+			expected: telemetry.Series{
+				DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to, Points: []telemetry.Point{},
+			},
+		},
+		"too many points": {
+			query:       telemetry.Query{DeviceID: "1", Metric: "battery", From: to.Add(-time.Hour), To: to},
+			points:      make([]telemetry.Point, telemetry.MaxPoints+1),
+			expectedErr: telemetry.ErrTooManyPoints,
+		},
+		"unknown device": {
+			query:       telemetry.Query{DeviceID: "2", Metric: "battery", From: to.Add(-time.Hour), To: to},
+			expectedErr: device.ErrNotFound,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			m.On("Points", mock.Anything, tc.query, telemetry.MaxPoints+1).Return(tc.points, nil)
+
+			b := telemetry.NewBusiness(&m, devicesMock{"1": true}, 24*time.Hour)
+			result, err := b.Query(context.Background(), tc.query)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			got, _ := json.Marshal(result)
+			expected, _ := json.Marshal(tc.expected)
+			if string(got) != string(expected) {
+				t.Fatalf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestRetention(t *testing.T) {
+	retention := 72 * time.Hour
+	isAgo := func(d time.Duration) interface{} {
+		return mock.MatchedBy(func(at time.Time) bool {
+			return time.Since(at)-d >= 0 && time.Since(at)-d < time.Minute
+		})
+	}
+
+	testTable := map[string]struct {
+		ensureErr   error
+		dropErr     error
+		expectedErr bool
+	}{
+		"ok":           {},
+		"ensure error": {ensureErr: fmt.Errorf("db err"), expectedErr: true},
+		"drop error":   {dropErr: fmt.Errorf("db err"), expectedErr: true},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			m := mocks.Store{}
+			// partitions are kept from the retention to two days ahead
+			m.On("EnsurePartitions", mock.Anything, isAgo(retention), isAgo(-48*time.Hour)).Return(tc.ensureErr)
+			m.On("DropPartitions", mock.Anything, isAgo(retention)).Return(2, tc.dropErr)
+
+			err := telemetry.NewRetention(&m, retention).Apply(context.Background())
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if tc.ensureErr != nil {
+				m.AssertNotCalled(t, "DropPartitions", mock.Anything, mock.Anything)
+				return
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+const (
+	// MaxBatchSize is the largest number of samples accepted in one batch
+	MaxBatchSize = 1000
+	// MaxPoints is the largest number of points a query returns
+	MaxPoints = 10000
+	// maxClockSkew is how far in the future a sample may be, to allow for device clocks running ahead
+	maxClockSkew = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidSample is returned for samples that must not be stored, such as
+	// samples older than the retention
+	ErrInvalidSample = errors.New("invalid sample")
+	// ErrTooManyPoints is returned for queries without a step matching more than MaxPoints samples
+	ErrTooManyPoints = errors.New("too many points")
+)
+
+// metricName is the format of metric names, e.g. battery or signal.rssi
+var metricName = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z][a-z0-9_]*)*$`)
+
+// maxMetricLength is the longest metric name
+const maxMetricLength = 64
+
+// Sample is a value of a metric of a device at a point in time
+type Sample struct {
+	DeviceID string    `json:"device_id"`
+	Metric   string    `json:"metric"`
+	Value    float64   `json:"value"`
+	Time     time.Time `json:"time"`
+}
+
+// Batch is the data needed to ingest samples of a device
+type Batch struct {
+	Samples []IngestSample `json:"samples"`
+}
+
+// IngestSample is a sample as reported by a device. Value is a number, or a
+// boolean stored as 1 or 0. Time defaults to the time of the ingestion.
+type IngestSample struct {
+	Metric string          `json:"metric"`
+	Value  json.RawMessage `json:"value"`
+	Time   *time.Time      `json:"time,omitempty"`
+}
+
+// Validate validates the Batch fields
+func (b Batch) Validate() error {
+	if len(b.Samples) == 0 {
+		return fmt.Errorf("samples is required")
+	}
+	if len(b.Samples) > MaxBatchSize {
+		return fmt.Errorf("samples must hold at most %d samples, got %d", MaxBatchSize, len(b.Samples))
+	}
+
+	var errs []error
+	for i, s := range b.Samples {
+		if err := validateMetric(s.Metric); err != nil {
+			errs = append(errs, fmt.Errorf("samples[%d].%w", i, err))
+		}
+		if _, err := s.value(); err != nil {
+			errs = append(errs, fmt.Errorf("samples[%d].%w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// toSamples converts a valid Batch to the samples of the device id, taken at
+// now unless they have a time
+func (b Batch) toSamples(deviceID string, now time.Time) []Sample {
+	samples := make([]Sample, len(b.Samples))
+	for i, s := range b.Samples {
+		value, _ := s.value()
+		samples[i] = Sample{
+			DeviceID: deviceID,
+			Metric:   s.Metric,
+			Value:    value,
+			Time:     now,
+		}
+		if s.Time != nil {
+			samples[i].Time = *s.Time
+		}
+	}
+	return samples
+}
+
+// value decodes the value of the sample
+func (s IngestSample) value() (float64, error) {
+	raw := bytes.TrimSpace(s.Value)
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+		return 0, fmt.Errorf("value is required")
+	case bytes.Equal(raw, []byte("true")):
+		return 1, nil
+	case bytes.Equal(raw, []byte("false")):
+		return 0, nil
+	}
+
+	var v float64
+	if err := json.Unmarshal(raw, &v); err != nil || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("value must be a number or a boolean")
+	}
+	return v, nil
+}
+
+// validateMetric reports an error when name is not a metric name
+func validateMetric(name string) error {
+	if name == "" {
+		return fmt.Errorf("metric is required")
+	}
+	if len(name) > maxMetricLength || !metricName.MatchString(name) {
+		return fmt.Errorf("metric must be at most %d lowercase letters, digits and underscores, in dot separated parts starting with a letter", maxMetricLength)
+	}
+	return nil
+}
+
+// Aggregation combines the samples of a step into one point
+type Aggregation string
+
+// Aggregations
+const (
+	AggregationAvg  Aggregation = "avg"
+	AggregationMin  Aggregation = "min"
+	AggregationMax  Aggregation = "max"
+	AggregationLast Aggregation = "last"
+)
+
+// Valid reports whether a is a known aggregation
+func (a Aggregation) Valid() bool {
+	switch a {
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationLast:
+		return true
+	}
+	return false
+}
+
+// Query selects the samples of a metric of a device. Without a step every
+// sample is returned, else the samples are aggregated per step.
+type Query struct {
+	DeviceID    string
+	Metric      string
+	From        time.Time
+	To          time.Time
+	Step        time.Duration
+	Aggregation Aggregation
+}
+
+// Validate validates the Query fields
+func (q Query) Validate() error {
+	if err := validateMetric(q.Metric); err != nil {
+		return err
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	if q.Step == 0 {
+		return nil
+	}
+
+	if q.Step < time.Second || q.Step%time.Second != 0 {
+		return fmt.Errorf("step must be a whole number of seconds")
+	}
+	if !q.Aggregation.Valid() {
+		return fmt.Errorf("aggregation must be one of avg, min, max or last")
+	}
+	if buckets := q.To.Sub(q.From) / q.Step; buckets > MaxPoints {
+		return fmt.Errorf("from and to span %d steps, at most %d are allowed", buckets, MaxPoints)
+	}
+	return nil
+}
+
+// Point is a sample, or the aggregation of the samples of a step starting at Time
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Series is the result of a Query
+type Series struct {
+	DeviceID    string      `json:"device_id"`
+	Metric      string      `json:"metric"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Step        string      `json:"step,omitempty"`
+	Aggregation Aggregation `json:"aggregation,omitempty"`
+	Points      []Point     `json:"points"`
+}
+
+// IngestResult is the outcome of the ingestion of a batch
+type IngestResult struct {
+	Samples int `json:"samples"`
+}
@@ -0,0 +1,82 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRetentionInterval is how often the retention is applied
+	defaultRetentionInterval = time.Hour
+	// partitionsAhead is how far ahead partitions are created, so that
+	// ingestion never waits for the next run of the retention
+	partitionsAhead = 48 * time.Hour
+)
+
+// Partitions manages the time partitions samples are stored in
+type Partitions interface {
+	// EnsurePartitions creates the missing partitions of the samples between from and to
+	EnsurePartitions(ctx context.Context, from, to time.Time) error
+	// DropPartitions drops the partitions that only hold samples older than
+	// before and returns how many it dropped
+	DropPartitions(ctx context.Context, before time.Time) (int, error)
+}
+
+// Retention creates the partitions of the samples to come and drops the
+// partitions of the samples older than the retention
+type Retention struct {
+	partitions Partitions
+	retention  time.Duration
+	interval   time.Duration
+	now        func() time.Time
+}
+
+// NewRetention creates a new Retention instance
+func NewRetention(p Partitions, retention time.Duration) *Retention {
+	return &Retention{
+		partitions: p,
+		retention:  retention,
+		interval:   defaultRetentionInterval,
+		now:        time.Now,
+	}
+}
+
+// Run applies the retention until ctx is cancelled
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Apply(ctx); err != nil {
+			logrus.WithError(fmt.Errorf("retention.Apply: %w", err)).Error("unable to apply the telemetry retention")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Apply creates the partitions from the retention to a bit ahead of now and
+// drops the expired ones
+func (r *Retention) Apply(ctx context.Context) error {
+	now := r.now()
+	oldest := now.Add(-r.retention)
+	if err := r.partitions.EnsurePartitions(ctx, oldest, now.Add(partitionsAhead)); err != nil {
+		return fmt.Errorf("partitions.EnsurePartitions: %w", err)
+	}
+
+	dropped, err := r.partitions.DropPartitions(ctx, oldest)
+	if err != nil {
+		return fmt.Errorf("partitions.DropPartitions: %w", err)
+	}
+	if dropped > 0 {
+		logrus.WithField("partitions", dropped).Info("dropped expired telemetry partitions")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"context"
+	"device/business/telemetry"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the telemetry store
+type Store struct {
+	mock.Mock
+}
+
+var (
+	_ telemetry.Store      = (*Store)(nil)
+	_ telemetry.Partitions = (*Store)(nil)
+)
+
+func (s *Store) Add(ctx context.Context, samples []telemetry.Sample) error {
+	args := s.Called(ctx, samples)
+	return args.Error(0)
+}
+
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *Store) Points(ctx context.Context, q telemetry.Query, limit int) ([]telemetry.Point, error) {
+	args := s.Called(ctx, q, limit)
+	return args.Get(0).([]telemetry.Point), args.Error(1)
+}
+
+func (s *Store) EnsurePartitions(ctx context.Context, from, to time.Time) error {
+	args := s.Called(ctx, from, to)
+	return args.Error(0)
+}
+
+func (s *Store) DropPartitions(ctx context.Context, before time.Time) (int, error) {
+	args := s.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
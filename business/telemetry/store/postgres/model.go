@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"device/business/telemetry"
+	"time"
+)
+
+// Sample is the database model for a telemetry sample
+type Sample struct {
+	DeviceID string    `gorm:"primaryKey"`
+	Metric   string    `gorm:"primaryKey"`
+	Time     time.Time `gorm:"primaryKey"`
+	Value    float64
+}
+
+// TableName returns the name of the partitioned table samples are stored in
+func (Sample) TableName() string {
+	return table
+}
+
+// fromBusinessSample converts a telemetry.Sample to a Sample
+func fromBusinessSample(s telemetry.Sample) Sample {
+	return Sample{
+		DeviceID: s.DeviceID,
+		Metric:   s.Metric,
+		Time:     s.Time.UTC(),
+		Value:    s.Value,
+	}
+}
+
+// Point is the database model for a telemetry point
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// toBusinessPoints converts Points to telemetry.Points
+func toBusinessPoints(points []Point) []telemetry.Point {
+	result := make([]telemetry.Point, len(points))
+	for i, p := range points {
+		result[i] = telemetry.Point{Time: p.Time.UTC(), Value: p.Value}
+	}
+	return result
+}
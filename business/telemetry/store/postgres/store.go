@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/telemetry"
+	"device/pkg/database"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// table is the partitioned table samples are stored in
+	table = "telemetry_samples"
+	// partitionPrefix prefixes the names of the daily partitions, followed by their day
+	partitionPrefix = table + "_p"
+	// partitionLayout is the layout of the day in the name of a partition
+	partitionLayout = "20060102"
+	// day is the time range of a partition
+	day = 24 * time.Hour
+)
+
+// Store is a postgres implementation of the telemetry.Store, storing samples
+// in a table partitioned by day
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements telemetry.Store, telemetry.Partitions and device.Dependent
+var (
+	_ telemetry.Store      = (*Store)(nil)
+	_ telemetry.Partitions = (*Store)(nil)
+	_ device.Dependent     = (*Store)(nil)
+)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// Migrate creates the partitioned table. AutoMigrate can't declare partitioning,
+// and the partitions themselves are created by EnsurePartitions.
+func (s *Store) Migrate(ctx context.Context) error {
+	result := s.db.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		device_id text NOT NULL,
+		metric text NOT NULL,
+		time timestamptz NOT NULL,
+		value double precision NOT NULL,
+		PRIMARY KEY (device_id, metric, time)
+	) PARTITION BY RANGE (time)`)
+	if result.Error != nil {
+		return fmt.Errorf("db.Exec: %w", result.Error)
+	}
+	return nil
+}
+
+// Add stores samples, replacing the ones of the same device, metric and time
+func (s *Store) Add(ctx context.Context, samples []telemetry.Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	rows := make([]Sample, len(samples))
+	for i, sample := range samples {
+		rows[i] = fromBusinessSample(sample)
+	}
+
+	result := database.Conn(ctx, s.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}, {Name: "metric"}, {Name: "time"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value"}),
+	}).Create(&rows)
+	if result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	return nil
+}
+
+// DeleteDevice deletes the samples of the device id
+func (s *Store) DeleteDevice(ctx context.Context, id string) error {
+	result := database.Conn(ctx, s.db).Delete(&Sample{}, "device_id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+	}
+	return nil
+}
+
+// aggregations maps the aggregations to their SQL expression
+var aggregations = map[telemetry.Aggregation]string{
+	telemetry.AggregationAvg:  "avg(value)",
+	telemetry.AggregationMin:  "min(value)",
+	telemetry.AggregationMax:  "max(value)",
+	telemetry.AggregationLast: "(array_agg(value ORDER BY time DESC))[1]",
+}
+
+// Points returns at most limit points of q, oldest first. With a step, the
+// samples are aggregated per step, the steps being aligned on the Unix epoch.
+func (s *Store) Points(ctx context.Context, q telemetry.Query, limit int) ([]telemetry.Point, error) {
+	tx := database.Conn(ctx, s.db).Model(&Sample{}).
+		Where("device_id = ? AND metric = ? AND time >= ? AND time < ?", q.DeviceID, q.Metric, q.From, q.To)
+
+	if q.Step > 0 {
+		agg, ok := aggregations[q.Aggregation]
+		if !ok {
+			return nil, fmt.Errorf("unknown aggregation %q", q.Aggregation)
+		}
+		step := int64(q.Step / time.Second)
+		// grouped by position, as a name would resolve to the time column rather than to the step
+		tx = tx.Select(fmt.Sprintf("to_timestamp(floor(extract(epoch FROM time) / %d) * %d) AS time, %s AS value", step, step, agg)).
+			Clauses(clause.GroupBy{Columns: []clause.Column{{Name: "1", Raw: true}}})
+	} else {
+		tx = tx.Select("time, value")
+	}
+
+	var points []Point
+	result := tx.Order("1").Limit(limit).Scan(&points)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Scan: %w", result.Error)
+	}
+	return toBusinessPoints(points), nil
+}
+
+// EnsurePartitions creates the missing daily partitions between from and to
+func (s *Store) EnsurePartitions(ctx context.Context, from, to time.Time) error {
+	for d := from.UTC().Truncate(day); d.Before(to); d = d.Add(day) {
+		result := s.db.WithContext(ctx).Exec(fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			partitionName(d), table, d.Format(time.RFC3339), d.Add(day).Format(time.RFC3339),
+		))
+		if result.Error != nil {
+			return fmt.Errorf("db.Exec[%s]: %w", partitionName(d), result.Error)
+		}
+	}
+	return nil
+}
+
+// DropPartitions drops the daily partitions ending before before
+func (s *Store) DropPartitions(ctx context.Context, before time.Time) (int, error) {
+	var names []string
+	result := s.db.WithContext(ctx).Raw(
+		`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = ?`, table,
+	).Scan(&names)
+	if result.Error != nil {
+		return 0, fmt.Errorf("db.Scan: %w", result.Error)
+	}
+
+	dropped := 0
+	for _, name := range names {
+		start, ok := partitionDay(name)
+		if !ok || start.Add(day).After(before) {
+			continue
+		}
+		if result := s.db.WithContext(ctx).Exec("DROP TABLE IF EXISTS " + name); result.Error != nil {
+			return dropped, fmt.Errorf("db.Exec[%s]: %w", name, result.Error)
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// partitionName returns the name of the partition of the day d
+func partitionName(d time.Time) string {
+	return partitionPrefix + d.Format(partitionLayout)
+}
+
+// partitionDay returns the day of the partition name, if it is a daily partition
+func partitionDay(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, partitionPrefix) {
+		return time.Time{}, false
+	}
+	d, err := time.Parse(partitionLayout, strings.TrimPrefix(name, partitionPrefix))
+	return d, err == nil
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"context"
+	"device/business/event"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+)
+
+// Store is an interface to interact with the database
+type Store interface {
+	CreateSubscription(ctx context.Context, s Subscription) error
+	SubscriptionByID(ctx context.Context, id string) (Subscription, error)
+	UpdateSubscription(ctx context.Context, id string, data UpdateSubscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	Subscriptions(ctx context.Context, offset, limit int) ([]Subscription, error)
+	ActiveSubscriptions(ctx context.Context) ([]Subscription, error)
+	CreateDeliveries(ctx context.Context, ds ...Delivery) error
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	UpdateDelivery(ctx context.Context, d Delivery) error
+	Deliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]Delivery, error)
+}
+
+// Business is the business logic for webhooks
+type Business struct {
+	store Store
+}
+
+// this is a compile time check to ensure Business implements event.Publisher
+var _ event.Publisher = (*Business)(nil)
+
+// NewBusiness creates a new business logic for webhooks
+func NewBusiness(store Store) *Business {
+	return &Business{
+		store: store,
+	}
+}
+
+// Create creates a subscription
+func (b *Business) Create(ctx context.Context, cs CreateSubscription) (Subscription, error) {
+	s, err := cs.toSubscription()
+	if err != nil {
+		return Subscription{}, fmt.Errorf("toSubscription: %w", err)
+	}
+	if err := b.store.CreateSubscription(ctx, s); err != nil {
+		return Subscription{}, fmt.Errorf("store.CreateSubscription: %w", err)
+	}
+	return s, nil
+}
+
+// Update updates a subscription
+func (b *Business) Update(ctx context.Context, id string, data UpdateSubscription) error {
+	if err := b.store.UpdateSubscription(ctx, id, data); err != nil {
+		return fmt.Errorf("store.UpdateSubscription: %w", err)
+	}
+	return nil
+}
+
+// GetByID returns a subscription by its ID
+func (b *Business) GetByID(ctx context.Context, id string) (Subscription, error) {
+	s, err := b.store.SubscriptionByID(ctx, id)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("store.SubscriptionByID: %w", err)
+	}
+	return s, nil
+}
+
+// GetAll returns all subscriptions
+func (b *Business) GetAll(ctx context.Context, offset, limit int) ([]Subscription, error) {
+	subs, err := b.store.Subscriptions(ctx, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.Subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// Delete deletes a subscription
+func (b *Business) Delete(ctx context.Context, id string) error {
+	if err := b.store.DeleteSubscription(ctx, id); err != nil {
+		return fmt.Errorf("store.DeleteSubscription: %w", err)
+	}
+	return nil
+}
+
+// Deliveries returns the delivery log of a subscription
+func (b *Business) Deliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]Delivery, error) {
+	if _, err := b.store.SubscriptionByID(ctx, subscriptionID); err != nil {
+		return nil, fmt.Errorf("store.SubscriptionByID: %w", err)
+	}
+
+	ds, err := b.store.Deliveries(ctx, subscriptionID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store.Deliveries: %w", err)
+	}
+	return ds, nil
+}
+
+// Publish queues a delivery of the event for every matching subscription
+func (b *Business) Publish(ctx context.Context, e event.Event) error {
+	subs, err := b.store.ActiveSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("store.ActiveSubscriptions: %w", err)
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	now := time.Now()
+	var ds []Delivery
+	for _, s := range subs {
+		if !s.Matches(e.Type) {
+			continue
+		}
+		ds = append(ds, Delivery{
+			ID:             uuid.NewString(),
+			SubscriptionID: s.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Payload:        payload,
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	if len(ds) == 0 {
+		return nil
+	}
+
+	if err := b.store.CreateDeliveries(ctx, ds...); err != nil {
+		return fmt.Errorf("store.CreateDeliveries: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"device/business/device"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// Subscription represents a webhook subscription
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the subscription wants events of the given type.
+// A subscription without event filters receives every event.
+func (s Subscription) Matches(eventType string) bool {
+	if !s.Active {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSubscription represents the data needed to create a subscription
+type CreateSubscription struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Validate validates the CreateSubscription fields
+func (cs CreateSubscription) Validate() error {
+	if cs.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if err := validateURL(cs.URL); err != nil {
+		return err
+	}
+	return validateEvents(cs.Events)
+}
+
+// toSubscription converts a CreateSubscription to a Subscription
+func (cs CreateSubscription) toSubscription() (Subscription, error) {
+	secret := cs.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Subscription{}, fmt.Errorf("rand.Read: %w", err)
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	return Subscription{
+		ID:        uuid.NewString(),
+		URL:       cs.URL,
+		Secret:    secret,
+		Events:    cs.Events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// UpdateSubscription represents the data needed to update a subscription
+type UpdateSubscription struct {
+	URL    *string   `json:"url,omitempty"`
+	Secret *string   `json:"secret,omitempty"`
+	Events *[]string `json:"events,omitempty"`
+	Active *bool     `json:"active,omitempty"`
+}
+
+// Validate validates the UpdateSubscription fields
+func (us UpdateSubscription) Validate() error {
+	if us.URL != nil {
+		if err := validateURL(*us.URL); err != nil {
+			return err
+		}
+	}
+	if us.Events != nil {
+		return validateEvents(*us.Events)
+	}
+	return nil
+}
+
+// validateURL checks that u is an absolute http(s) URL
+func validateURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// validateEvents checks that every event filter is "*" or a known event type
+func validateEvents(events []string) error {
+	for _, e := range events {
+		if e != "*" && !slices.Contains(device.EventTypes, e) {
+			return fmt.Errorf("unknown event type %q", e)
+		}
+	}
+	return nil
+}
+
+// Delivery represents the delivery of one event to one subscription
+type Delivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	Payload        []byte    `json:"-"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	NextAttemptAt  time.Time `json:"next_attempt_at"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
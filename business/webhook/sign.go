@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook request headers
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+// Sign returns the signature header value for a payload sent at ts.
+// The format is "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">".
+func Sign(secret string, ts time.Time, payload []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, computeMAC(secret, t, payload))
+}
+
+// Verify checks a signature header value against the payload.
+// Signatures older than tolerance are rejected; a zero tolerance disables the check.
+func Verify(secret, header string, payload []byte, tolerance time.Duration) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			v1 = v
+		}
+	}
+	if t == "" || v1 == "" {
+		return fmt.Errorf("malformed signature")
+	}
+
+	sec, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed signature timestamp")
+	}
+	if tolerance > 0 && time.Since(time.Unix(sec, 0)) > tolerance {
+		return fmt.Errorf("signature expired")
+	}
+
+	if !hmac.Equal([]byte(v1), []byte(computeMAC(secret, t, payload))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// computeMAC computes the hex HMAC-SHA256 of "<t>.<payload>"
+func computeMAC(secret, t string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package mocks
+
+import (
+	"context"
+	"device/business/webhook"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Store is a mock type for the webhook store
+type Store struct {
+	mock.Mock
+}
+
+var _ webhook.Store = (*Store)(nil)
+
+func (s *Store) CreateSubscription(ctx context.Context, sub webhook.Subscription) error {
+	args := s.Called(ctx, sub)
+	return args.Error(0)
+}
+
+func (s *Store) SubscriptionByID(ctx context.Context, id string) (webhook.Subscription, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(webhook.Subscription), args.Error(1)
+}
+
+func (s *Store) UpdateSubscription(ctx context.Context, id string, data webhook.UpdateSubscription) error {
+	args := s.Called(ctx, id, data)
+	return args.Error(0)
+}
+
+func (s *Store) DeleteSubscription(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *Store) Subscriptions(ctx context.Context, offset, limit int) ([]webhook.Subscription, error) {
+	args := s.Called(ctx, offset, limit)
+	return args.Get(0).([]webhook.Subscription), args.Error(1)
+}
+
+func (s *Store) ActiveSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	args := s.Called(ctx)
+	return args.Get(0).([]webhook.Subscription), args.Error(1)
+}
+
+func (s *Store) CreateDeliveries(ctx context.Context, ds ...webhook.Delivery) error {
+	args := s.Called(ctx, ds)
+	return args.Error(0)
+}
+
+func (s *Store) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]webhook.Delivery, error) {
+	args := s.Called(ctx, now, lease, limit)
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
+
+func (s *Store) UpdateDelivery(ctx context.Context, d webhook.Delivery) error {
+	args := s.Called(ctx, d)
+	return args.Error(0)
+}
+
+func (s *Store) Deliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]webhook.Delivery, error) {
+	args := s.Called(ctx, subscriptionID, offset, limit)
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"device/business/webhook"
+	"time"
+)
+
+// Subscription represents a webhook subscription
+type Subscription struct {
+	ID        string    `gorm:"primaryKey;column:id"`
+	URL       string    `gorm:"column:url"`
+	Secret    string    `gorm:"column:secret"`
+	Events    []string  `gorm:"column:events;serializer:json"`
+	Active    bool      `gorm:"column:active;index"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName overrides the default table name
+func (Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// Delivery represents a webhook delivery
+type Delivery struct {
+	ID             string    `gorm:"primaryKey;column:id"`
+	SubscriptionID string    `gorm:"column:subscription_id;index"`
+	EventID        string    `gorm:"column:event_id"`
+	EventType      string    `gorm:"column:event_type"`
+	Payload        []byte    `gorm:"column:payload;type:jsonb"`
+	Status         string    `gorm:"column:status;index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int       `gorm:"column:attempts"`
+	NextAttemptAt  time.Time `gorm:"column:next_attempt_at;index:idx_webhook_deliveries_due,priority:2"`
+	ResponseStatus int       `gorm:"column:response_status"`
+	LastError      string    `gorm:"column:last_error"`
+	CreatedAt      time.Time `gorm:"column:created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at"`
+}
+
+// TableName overrides the default table name
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// toBusinessSubscription converts a Subscription to a webhook.Subscription
+func toBusinessSubscription(s Subscription) webhook.Subscription {
+	return webhook.Subscription{
+		ID:        s.ID,
+		URL:       s.URL,
+		Secret:    s.Secret,
+		Events:    s.Events,
+		Active:    s.Active,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+// toBusinessSubscriptions converts a slice of Subscription to a slice of webhook.Subscription
+func toBusinessSubscriptions(ss []Subscription) []webhook.Subscription {
+	subs := make([]webhook.Subscription, len(ss))
+	for i, s := range ss {
+		subs[i] = toBusinessSubscription(s)
+	}
+	return subs
+}
+
+// fromBusinessSubscription converts a webhook.Subscription to a Subscription
+func fromBusinessSubscription(s webhook.Subscription) Subscription {
+	return Subscription{
+		ID:        s.ID,
+		URL:       s.URL,
+		Secret:    s.Secret,
+		Events:    s.Events,
+		Active:    s.Active,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+// toBusinessDelivery converts a Delivery to a webhook.Delivery
+func toBusinessDelivery(d Delivery) webhook.Delivery {
+	return webhook.Delivery{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
+
+// toBusinessDeliveries converts a slice of Delivery to a slice of webhook.Delivery
+func toBusinessDeliveries(ds []Delivery) []webhook.Delivery {
+	deliveries := make([]webhook.Delivery, len(ds))
+	for i, d := range ds {
+		deliveries[i] = toBusinessDelivery(d)
+	}
+	return deliveries
+}
+
+// fromBusinessDelivery converts a webhook.Delivery to a Delivery
+func fromBusinessDelivery(d webhook.Delivery) Delivery {
+	return Delivery{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
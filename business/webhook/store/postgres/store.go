@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"device/business/webhook"
+	"device/pkg/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is a postgres implementation of the webhook.Store
+type Store struct {
+	db *gorm.DB
+}
+
+// this is a compile time check to ensure Store implements webhook.Store
+var _ webhook.Store = (*Store)(nil)
+
+// NewStore creates a new Store instance
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// CreateSubscription creates a new subscription
+func (s *Store) CreateSubscription(ctx context.Context, sub webhook.Subscription) error {
+	createData := fromBusinessSubscription(sub)
+	result := database.Conn(ctx, s.db).Create(&createData)
+	if result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	return nil
+}
+
+// SubscriptionByID returns a subscription by its ID
+func (s *Store) SubscriptionByID(ctx context.Context, id string) (webhook.Subscription, error) {
+	var sub Subscription
+	result := database.Conn(ctx, s.db).First(&sub, "id = ?", id)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return webhook.Subscription{}, webhook.ErrNotFound
+	}
+	if result.Error != nil {
+		return webhook.Subscription{}, fmt.Errorf("db.First[%s]: %w", id, result.Error)
+	}
+	return toBusinessSubscription(sub), nil
+}
+
+// UpdateSubscription updates a subscription
+func (s *Store) UpdateSubscription(ctx context.Context, id string, data webhook.UpdateSubscription) error {
+	updates := map[string]interface{}{}
+	if data.URL != nil {
+		updates["url"] = *data.URL
+	}
+	if data.Secret != nil {
+		updates["secret"] = *data.Secret
+	}
+	if data.Events != nil {
+		// map updates bypass the json serializer of the column
+		events, err := json.Marshal(*data.Events)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %w", err)
+		}
+		updates["events"] = string(events)
+	}
+	if data.Active != nil {
+		updates["active"] = *data.Active
+	}
+
+	result := database.Conn(ctx, s.db).Model(&Subscription{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("db.Updates[%s]: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return webhook.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSubscription deletes a subscription and its deliveries
+func (s *Store) DeleteSubscription(ctx context.Context, id string) error {
+	return database.NewTransactor(s.db).WithinTx(ctx, func(ctx context.Context) error {
+		result := database.Conn(ctx, s.db).Delete(&Subscription{ID: id}, "id = ?", id)
+		if result.Error != nil {
+			return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return webhook.ErrNotFound
+		}
+
+		result = database.Conn(ctx, s.db).Where("subscription_id = ?", id).Delete(&Delivery{})
+		if result.Error != nil {
+			return fmt.Errorf("db.Delete[%s]: %w", id, result.Error)
+		}
+		return nil
+	})
+}
+
+// Subscriptions returns all subscriptions
+func (s *Store) Subscriptions(ctx context.Context, offset, limit int) ([]webhook.Subscription, error) {
+	var subs []Subscription
+	result := database.Conn(ctx, s.db).Order("created_at").Offset(offset).Limit(limit).Find(&subs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessSubscriptions(subs), nil
+}
+
+// ActiveSubscriptions returns all active subscriptions
+func (s *Store) ActiveSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	var subs []Subscription
+	result := database.Conn(ctx, s.db).Where("active = ?", true).Find(&subs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessSubscriptions(subs), nil
+}
+
+// CreateDeliveries creates new deliveries
+func (s *Store) CreateDeliveries(ctx context.Context, ds ...webhook.Delivery) error {
+	rows := make([]Delivery, len(ds))
+	for i, d := range ds {
+		rows[i] = fromBusinessDelivery(d)
+	}
+
+	result := database.Conn(ctx, s.db).Create(&rows)
+	if result.Error != nil {
+		return fmt.Errorf("db.Create: %w", result.Error)
+	}
+	return nil
+}
+
+// ClaimDeliveries returns at most limit pending deliveries whose next attempt
+// is due at now and pushes that attempt back by lease, so other workers skip
+// them while they are sent. Rows locked by a concurrent claim are skipped.
+func (s *Store) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]webhook.Delivery, error) {
+	var ds []Delivery
+	err := database.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", webhook.StatusPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&ds)
+		if result.Error != nil {
+			return fmt.Errorf("db.Find: %w", result.Error)
+		}
+		if len(ds) == 0 {
+			return nil
+		}
+
+		leased := now.Add(lease)
+		ids := make([]string, len(ds))
+		for i := range ds {
+			ids[i] = ds[i].ID
+			ds[i].NextAttemptAt = leased
+		}
+		result = tx.Model(&Delivery{}).Where("id IN ?", ids).Update("next_attempt_at", leased)
+		if result.Error != nil {
+			return fmt.Errorf("db.Update: %w", result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toBusinessDeliveries(ds), nil
+}
+
+// UpdateDelivery saves the state of a delivery
+func (s *Store) UpdateDelivery(ctx context.Context, d webhook.Delivery) error {
+	result := database.Conn(ctx, s.db).Model(&Delivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"next_attempt_at": d.NextAttemptAt,
+		"response_status": d.ResponseStatus,
+		"last_error":      d.LastError,
+		"updated_at":      d.UpdatedAt,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("db.Updates[%s]: %w", d.ID, result.Error)
+	}
+	return nil
+}
+
+// Deliveries returns the deliveries of a subscription, newest first
+func (s *Store) Deliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]webhook.Delivery, error) {
+	var ds []Delivery
+	result := database.Conn(ctx, s.db).
+		Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&ds)
+	if result.Error != nil {
+		return nil, fmt.Errorf("db.Find: %w", result.Error)
+	}
+	return toBusinessDeliveries(ds), nil
+}
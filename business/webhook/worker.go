@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 50
+	defaultMaxAttempts  = 8
+	defaultBaseBackoff  = 10 * time.Second
+	defaultMaxBackoff   = time.Hour
+	defaultTimeout      = 10 * time.Second
+	defaultConcurrency  = 16
+	// defaultLease is how long claimed deliveries are hidden from other
+	// workers. It outlasts a batch sent one at a time to a slow subscription.
+	defaultLease = 10 * time.Minute
+)
+
+// Worker delivers queued webhook deliveries. Failed deliveries are retried
+// with exponential backoff until they run out of attempts and are marked dead.
+// Deliveries are claimed before they are sent, so workers of several replicas
+// don't send the same ones.
+type Worker struct {
+	store        Store
+	client       *http.Client
+	now          func() time.Time
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	concurrency  int
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+}
+
+// NewWorker creates a new Worker instance. A nil client uses a client with a default timeout.
+func NewWorker(store Store, client *http.Client) *Worker {
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Worker{
+		store:        store,
+		client:       client,
+		now:          time.Now,
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+		lease:        defaultLease,
+		concurrency:  defaultConcurrency,
+		maxAttempts:  defaultMaxAttempts,
+		baseBackoff:  defaultBaseBackoff,
+		maxBackoff:   defaultMaxBackoff,
+	}
+}
+
+// Run delivers due deliveries until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Flush(ctx); err != nil {
+			logrus.WithError(fmt.Errorf("worker.Flush: %w", err)).Error("unable to deliver webhooks")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush claims a batch of due deliveries, sends them and returns how many were
+// claimed. Subscriptions are served concurrently, at most concurrency at once,
+// and the deliveries of each are sent in order, one at a time. A delivery that
+// cannot be recorded is logged and left for a later flush so it does not hold
+// back the rest of the batch.
+func (w *Worker) Flush(ctx context.Context) (int, error) {
+	ds, err := w.store.ClaimDeliveries(ctx, w.now(), w.lease, w.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("store.ClaimDeliveries: %w", err)
+	}
+
+	var order []string
+	bySubscription := make(map[string][]Delivery)
+	for _, d := range ds {
+		if _, ok := bySubscription[d.SubscriptionID]; !ok {
+			order = append(order, d.SubscriptionID)
+		}
+		bySubscription[d.SubscriptionID] = append(bySubscription[d.SubscriptionID], d)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, w.concurrency)
+	for _, id := range order {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(ds []Delivery) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			w.deliverAll(ctx, ds)
+		}(bySubscription[id])
+	}
+	wg.Wait()
+	return len(ds), nil
+}
+
+// deliverAll sends the deliveries of one subscription in order. It stops at
+// the first one that fails, since the endpoint is likely down, and the others
+// are retried along with it.
+func (w *Worker) deliverAll(ctx context.Context, ds []Delivery) {
+	for i, d := range ds {
+		recorded, err := w.deliver(ctx, d)
+		if err != nil {
+			logrus.WithError(err).WithField("delivery_id", d.ID).Error("unable to deliver webhook")
+		}
+		if recorded.Status != StatusPending {
+			continue
+		}
+
+		for _, d := range ds[i+1:] {
+			d.NextAttemptAt = recorded.NextAttemptAt
+			d.UpdatedAt = w.now()
+			if err := w.store.UpdateDelivery(ctx, d); err != nil {
+				logrus.WithError(fmt.Errorf("store.UpdateDelivery[%s]: %w", d.ID, err)).Error("unable to postpone webhook delivery")
+			}
+		}
+		return
+	}
+}
+
+// deliver sends one delivery, records the outcome and returns the delivery
+// as recorded. The delivery is left pending when it is to be retried.
+func (w *Worker) deliver(ctx context.Context, d Delivery) (Delivery, error) {
+	s, err := w.store.SubscriptionByID(ctx, d.SubscriptionID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		d.Status = StatusDead
+		d.LastError = "subscription not found"
+	case err != nil:
+		return d, fmt.Errorf("store.SubscriptionByID[%s]: %w", d.SubscriptionID, err)
+	default:
+		d.Attempts++
+		d.ResponseStatus, err = w.send(ctx, s, d)
+		if err == nil {
+			d.Status = StatusSucceeded
+			d.LastError = ""
+			break
+		}
+
+		d.LastError = err.Error()
+		if d.Attempts >= w.maxAttempts {
+			d.Status = StatusDead
+			break
+		}
+		d.NextAttemptAt = w.now().Add(w.backoff(d.Attempts))
+	}
+
+	d.UpdatedAt = w.now()
+	if err := w.store.UpdateDelivery(ctx, d); err != nil {
+		return d, fmt.Errorf("store.UpdateDelivery[%s]: %w", d.ID, err)
+	}
+	return d, nil
+}
+
+// send posts the signed payload to the subscription URL
+func (w *Worker) send(ctx context.Context, s Subscription, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("http.NewRequest: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderSignature, Sign(s.Secret, w.now(), d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("client.Do: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.baseBackoff
+	for i := 1; i < attempts && d < w.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.maxBackoff {
+		d = w.maxBackoff
+	}
+	return d
+}
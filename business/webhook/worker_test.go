@@ -0,0 +1,208 @@
+package webhook_test
+
+import (
+	"context"
+	"device/business/event"
+	"device/business/webhook"
+	"device/business/webhook/store/mocks"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFlush(t *testing.T) {
+	testTable := map[string]struct {
+		receiverStatus   int
+		attempts         int
+		expectedStatus   string
+		expectedAttempts int
+		expectRetry      bool
+	}{
+		"success": {
+			receiverStatus:   http.StatusOK,
+			expectedStatus:   webhook.StatusSucceeded,
+			expectedAttempts: 1,
+		},
+		"retry": {
+			receiverStatus:   http.StatusInternalServerError,
+			expectedStatus:   webhook.StatusPending,
+			expectedAttempts: 1,
+			expectRetry:      true,
+		},
+		"dead letter": {
+			receiverStatus:   http.StatusInternalServerError,
+			attempts:         7,
+			expectedStatus:   webhook.StatusDead,
+			expectedAttempts: 8,
+		},
+	}
+
+	for tn, tc := range testTable {
+		t.Run(tn, func(t *testing.T) {
+			payload := []byte(`{"type":"device.created"}`)
+			var received bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if err := webhook.Verify("secret", r.Header.Get(webhook.HeaderSignature), body, time.Minute); err != nil {
+					t.Errorf("invalid signature: %v", err)
+				}
+				if r.Header.Get(webhook.HeaderEvent) != "device.created" {
+					t.Errorf("expected event header, got %q", r.Header.Get(webhook.HeaderEvent))
+				}
+				received = true
+				w.WriteHeader(tc.receiverStatus)
+			}))
+			defer srv.Close()
+
+			d := webhook.Delivery{
+				ID:             "d1",
+				SubscriptionID: "s1",
+				EventType:      "device.created",
+				Payload:        payload,
+				Status:         webhook.StatusPending,
+				Attempts:       tc.attempts,
+			}
+
+			start := time.Now()
+			s := mocks.Store{}
+			s.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.AnythingOfType("int")).Return([]webhook.Delivery{d}, nil)
+			s.On("SubscriptionByID", mock.Anything, "s1").Return(webhook.Subscription{ID: "s1", URL: srv.URL, Secret: "secret", Active: true}, nil)
+			s.On("UpdateDelivery", mock.Anything, mock.MatchedBy(func(got webhook.Delivery) bool {
+				if got.Status != tc.expectedStatus || got.Attempts != tc.expectedAttempts || got.ResponseStatus != tc.receiverStatus {
+					return false
+				}
+				return !tc.expectRetry || got.NextAttemptAt.After(start)
+			})).Return(nil)
+
+			w := webhook.NewWorker(&s, srv.Client())
+			n, err := w.Flush(context.Background())
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if n != 1 {
+				t.Fatalf("expected 1 delivery, got %d", n)
+			}
+			if !received {
+				t.Fatalf("expected the receiver to be called")
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFlushContinuesAfterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ds := []webhook.Delivery{
+		{ID: "d1", SubscriptionID: "broken", Status: webhook.StatusPending},
+		{ID: "d2", SubscriptionID: "s1", Status: webhook.StatusPending},
+		{ID: "d3", SubscriptionID: "s1", Status: webhook.StatusPending},
+	}
+
+	s := mocks.Store{}
+	s.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.AnythingOfType("int")).Return(ds, nil)
+	s.On("SubscriptionByID", mock.Anything, "broken").Return(webhook.Subscription{}, fmt.Errorf("db err"))
+	s.On("SubscriptionByID", mock.Anything, "s1").Return(webhook.Subscription{ID: "s1", URL: srv.URL, Secret: "secret", Active: true}, nil)
+	s.On("UpdateDelivery", mock.Anything, mock.MatchedBy(func(d webhook.Delivery) bool { return d.ID == "d2" })).Return(fmt.Errorf("db err"))
+	s.On("UpdateDelivery", mock.Anything, mock.MatchedBy(func(d webhook.Delivery) bool {
+		return d.ID == "d3" && d.Status == webhook.StatusSucceeded
+	})).Return(nil)
+
+	w := webhook.NewWorker(&s, srv.Client())
+	n, err := w.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 deliveries, got %d", n)
+	}
+	s.AssertExpectations(t)
+}
+
+func TestFlushSendsSubscriptionsConcurrently(t *testing.T) {
+	// each receiver answers once both were called, so sending one subscription
+	// after the other would time out
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	var mu sync.Mutex
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get(webhook.HeaderDelivery))
+		mu.Unlock()
+		if r.URL.Path == "/s1" {
+			arrived.Done()
+		}
+		if r.URL.Path == "/s2" {
+			arrived.Done()
+			arrived.Wait()
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		arrived.Wait()
+	}))
+	defer srv.Close()
+
+	ds := []webhook.Delivery{
+		{ID: "d1", SubscriptionID: "s1", Status: webhook.StatusPending},
+		{ID: "d2", SubscriptionID: "s2", Status: webhook.StatusPending},
+		{ID: "d3", SubscriptionID: "s2", Status: webhook.StatusPending},
+	}
+
+	s := mocks.Store{}
+	s.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.AnythingOfType("int")).Return(ds, nil)
+	s.On("SubscriptionByID", mock.Anything, "s1").Return(webhook.Subscription{ID: "s1", URL: srv.URL + "/s1", Secret: "secret", Active: true}, nil)
+	s.On("SubscriptionByID", mock.Anything, "s2").Return(webhook.Subscription{ID: "s2", URL: srv.URL + "/s2", Secret: "secret", Active: true}, nil)
+	s.On("UpdateDelivery", mock.Anything, mock.MatchedBy(func(d webhook.Delivery) bool {
+		return d.ID == "d1" && d.Status == webhook.StatusSucceeded
+	})).Return(nil)
+	var retry time.Time
+	s.On("UpdateDelivery", mock.Anything, mock.MatchedBy(func(d webhook.Delivery) bool {
+		return d.ID == "d2" && d.Status == webhook.StatusPending && d.Attempts == 1
+	})).Run(func(args mock.Arguments) { retry = args.Get(1).(webhook.Delivery).NextAttemptAt }).Return(nil)
+	s.On("UpdateDelivery", mock.Anything, mock.MatchedBy(func(d webhook.Delivery) bool {
+		return d.ID == "d3" && d.Status == webhook.StatusPending && d.Attempts == 0 && d.NextAttemptAt.Equal(retry)
+	})).Return(nil)
+
+	client := srv.Client()
+	client.Timeout = 5 * time.Second
+	w := webhook.NewWorker(&s, client)
+	if _, err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	s.AssertExpectations(t)
+
+	// d3 is retried along with d2, since the endpoint of s2 just failed
+	if len(received) != 2 {
+		t.Fatalf("expected d1 and d2 to be sent, got %v", received)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	subs := []webhook.Subscription{
+		{ID: "all", Active: true},
+		{ID: "created", Active: true, Events: []string{"device.created"}},
+		{ID: "deleted", Active: true, Events: []string{"device.deleted"}},
+	}
+
+	s := mocks.Store{}
+	s.On("ActiveSubscriptions", mock.Anything).Return(subs, nil)
+	s.On("CreateDeliveries", mock.Anything, mock.MatchedBy(func(ds []webhook.Delivery) bool {
+		return len(ds) == 2 && ds[0].SubscriptionID == "all" && ds[1].SubscriptionID == "created"
+	})).Return(nil)
+
+	b := webhook.NewBusiness(&s)
+	if err := b.Publish(context.Background(), event.Event{ID: "e1", Type: "device.created"}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	s.AssertExpectations(t)
+}
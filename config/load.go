@@ -0,0 +1,318 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the config file when the -config flag is not given
+const ConfigFileEnv = "CONFIG_FILE"
+
+// secretFileSuffix suffixes the variables naming a file that holds the value,
+// e.g. DB_PASSWORD_FILE=/run/secrets/db_password
+const secretFileSuffix = "_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a leaf of the configuration
+type field struct {
+	// path is the dotted file path of the field, e.g. server.port, also used as the flag name
+	path   string
+	value  reflect.Value
+	tag    reflect.StructTag
+	secret bool
+}
+
+// fieldsOf returns the leaves of the struct v points to, in declaration order
+func fieldsOf(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			fields = append(fields, fieldsOf(fv, path+".")...)
+			continue
+		}
+		fields = append(fields, field{
+			path:   path,
+			value:  fv,
+			tag:    sf.Tag,
+			secret: sf.Tag.Get("secret") == "true",
+		})
+	}
+	return fields
+}
+
+// Load loads the configuration from, in increasing precedence, the default
+// tags, the config file named by -config or CONFIG_FILE, the environment
+// (including an optional .env file) and the flags in args.
+// A configuration that doesn't validate is returned along with every problem.
+func Load(args []string) (App, error) {
+	var app App
+	fields := fieldsOf(reflect.ValueOf(&app).Elem(), "")
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	configFile := fs.String("config", "", fmt.Sprintf("YAML or TOML config file (env %s)", ConfigFileEnv))
+	flags := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		flags[f.path] = fs.String(f.path, "", usage(f))
+	}
+	if err := fs.Parse(args); err != nil {
+		return app, err
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return app, fmt.Errorf("godotenv.Load: %w", err)
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := set(f.value, def); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid default: %w", f.path, err))
+			}
+		}
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv(ConfigFileEnv)
+	}
+	if *configFile != "" {
+		if err := loadFile(*configFile, &app); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, f := range fields {
+		value, source, ok, err := lookupEnv(f.tag.Get("env"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.path, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := set(f.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value from %s: %w", f.path, source, err))
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		f, ok := fieldByPath(fields, fl.Name)
+		if !ok {
+			return
+		}
+		if err := set(f.value, *flags[fl.Name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value from flag -%s: %w", f.path, fl.Name, err))
+		}
+	})
+
+	errs = append(errs, app.Validate())
+	return app, errors.Join(errs...)
+}
+
+// MustLoad loads the configuration from the environment and the command line
+// flags, and exits listing every problem if it is invalid
+func MustLoad() App {
+	app, err := Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	return app
+}
+
+// usage describes the flag of f
+func usage(f field) string {
+	var parts []string
+	if env := f.tag.Get("env"); env != "" {
+		parts = append(parts, fmt.Sprintf("env %s", env))
+	}
+	if def, ok := f.tag.Lookup("default"); ok {
+		parts = append(parts, fmt.Sprintf("default %q", def))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fieldByPath returns the field at path
+func fieldByPath(fields []field, path string) (field, bool) {
+	for _, f := range fields {
+		if f.path == path {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// lookupEnv reads the variable key, or the file named by key_FILE.
+// It returns where the value came from for error messages.
+func lookupEnv(key string) (value, source string, ok bool, err error) {
+	if key == "" {
+		return "", "", false, nil
+	}
+	if path := os.Getenv(key + secretFileSuffix); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", false, fmt.Errorf("os.ReadFile[%s]: %w", key+secretFileSuffix, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), key + secretFileSuffix, true, nil
+	}
+	value, ok = os.LookupEnv(key)
+	return value, key, ok, nil
+}
+
+// loadFile overlays the fields set in the YAML or TOML file at path on app.
+// Only the keys present in the file are changed, so maps replace their
+// defaults instead of merging with them.
+func loadFile(path string, app *App) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var (
+		fromFile App
+		present  map[string]interface{}
+	)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&fromFile); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, &present); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &fromFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			sort.Strings(keys)
+			return fmt.Errorf("%s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+		if _, err := toml.Decode(string(data), &present); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config file extension %q, expected .yaml, .yml or .toml", path, ext)
+	}
+
+	dst := fieldsOf(reflect.ValueOf(app).Elem(), "")
+	src := fieldsOf(reflect.ValueOf(&fromFile).Elem(), "")
+	for i, f := range dst {
+		if isPresent(present, f.path) {
+			f.value.Set(src[i].value)
+		}
+	}
+	return nil
+}
+
+// isPresent reports whether the dotted path is a key of the decoded document m
+func isPresent(m map[string]interface{}, path string) bool {
+	head, rest, nested := strings.Cut(path, ".")
+	v, ok := m[head]
+	if !ok {
+		return false
+	}
+	if !nested {
+		return true
+	}
+	sub, ok := v.(map[string]interface{})
+	return ok && isPresent(sub, rest)
+}
+
+// set parses s into v according to its type
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		m := map[string]string{}
+		for _, entry := range strings.Split(s, ";") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, expected key=value", entry)
+			}
+			m[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
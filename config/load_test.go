@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setValidEnv sets the variables without a default, so a load validates
+func setValidEnv(t *testing.T) {
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("DB_USER", "admin")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("unable to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	setValidEnv(t)
+
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  port: "8081"
+  grpc_port: "9091"
+  read_timeout: 20s
+rate_limit:
+  routes:
+    GET /api/v1/devices: 50/1s
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[server]
+port = "8081"
+grpc_port = "9091"
+read_timeout = "20s"
+
+[rate_limit.routes]
+"GET /api/v1/devices" = "50/1s"
+`)
+
+	for name, file := range map[string]string{"yaml": yamlFile, "toml": tomlFile} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(ConfigFileEnv, file)
+			t.Setenv("GRPC_PORT", "9092")
+			t.Setenv("SERVER_IDLE_TIMEOUT", "2m")
+
+			cfg, err := Load([]string{"-server.idle_timeout", "3m", "-database.host", "db"})
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+
+			// the file overrides the defaults
+			if cfg.Server.Port != "8081" || cfg.Server.ReadTimeout != 20*time.Second {
+				t.Errorf("expected the file values, got %+v", cfg.Server)
+			}
+			// the environment overrides the file
+			if cfg.Server.GRPCPort != "9092" {
+				t.Errorf("expected grpc port 9092 from the environment, got %s", cfg.Server.GRPCPort)
+			}
+			// flags override the environment
+			if cfg.Server.IdleTimeout != 3*time.Minute || cfg.Database.Host != "db" {
+				t.Errorf("expected the flag values, got %s and %s", cfg.Server.IdleTimeout, cfg.Database.Host)
+			}
+			// defaults fill the rest
+			if cfg.Server.WriteTimeout != 30*time.Second || cfg.Database.Port != "5432" {
+				t.Errorf("expected the defaults, got %s and %s", cfg.Server.WriteTimeout, cfg.Database.Port)
+			}
+			// maps from the file replace the default instead of merging with it
+			if len(cfg.RateLimit.Routes) != 1 || cfg.RateLimit.Routes["GET /api/v1/devices"] != "50/1s" {
+				t.Errorf("expected the routes of the file only, got %v", cfg.RateLimit.Routes)
+			}
+		})
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("DB_PASSWORD", "from-env")
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db_password", "from-file\n"))
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if cfg.Database.Password != "from-file" {
+		t.Fatalf("expected the password from the file, got %q", cfg.Database.Password)
+	}
+
+	t.Setenv("DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "DB_PASSWORD_FILE") {
+		t.Fatalf("expected an error naming DB_PASSWORD_FILE, got %v", err)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("SERVER_PORT", "")
+	t.Setenv("SERVER_READ_TIMEOUT", "soon")
+	t.Setenv("TRACING_EXPORTER", "jaeger")
+	t.Setenv("RATE_LIMIT_KEY_BY", "ip,cookie")
+	t.Setenv("RATE_LIMIT_ROUTES", "POST /api/v1/devices=fast")
+	t.Setenv("CACHE_ENABLED", "true")
+	t.Setenv("CACHE_SIZE", "0")
+	t.Setenv("STATUS_CHECK_INTERVAL", "0s")
+	t.Setenv("TELEMETRY_RETENTION", "1h")
+	t.Setenv("COMMANDS_DEFAULT_TTL", "240h")
+	t.Setenv("FIRMWARE_ROLLOUT_INTERVAL", "-1s")
+	t.Setenv("GROUPS_OPERATION_INTERVAL", "0s")
+	t.Setenv("MQTT_ENABLED", "true")
+	t.Setenv("MQTT_BROKER", "udp://localhost:1883")
+	t.Setenv("MQTT_TOPIC_PREFIX", "devices/#")
+
+	_, err := Load(nil)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for _, problem := range []string{
+		"server.port: is required",
+		"server.read_timeout: invalid value from SERVER_READ_TIMEOUT",
+		"database.name: is required",
+		"database.user: is required",
+		"tracing.exporter: must be one of",
+		`rate_limit.key_by: must be one of ip, got "cookie"`,
+		"rate_limit.routes[POST /api/v1/devices]",
+		"cache.size: must be positive, got 0",
+		"status.check_interval: must be positive, got 0s",
+		"telemetry.retention: must be at least 24h, got 1h0m0s",
+		"commands.default_ttl: must be between 1s and 168h, got 240h0m0s",
+		"firmware.rollout_interval: must be positive, got -1s",
+		"groups.operation_interval: must be positive, got 0s",
+		`mqtt.broker: must be a URL with a scheme among tcp, mqtt, ssl, tls, mqtts, ws, wss, got "udp://localhost:1883"`,
+		`mqtt.topic_prefix: must be a topic without wildcards, got "devices/#"`,
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected %q in:\n%v", problem, err)
+		}
+	}
+}
+
+func TestLoadUnknownFileKey(t *testing.T) {
+	setValidEnv(t)
+
+	testTable := map[string]string{
+		"config.yaml": "server:\n  prot: \"8080\"\n",
+		"config.toml": "[server]\nprot = \"8080\"\n",
+		"config.json": "{}",
+	}
+
+	for name, content := range testTable {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load([]string{"-config", writeFile(t, name, content)})
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("DB_PASSWORD", "hunter2")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Print(&buf, cfg); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if strings.Contains(buf.String(), "hunter2") || !strings.Contains(buf.String(), redacted) {
+		t.Fatalf("expected the password to be redacted, got:\n%s", buf.String())
+	}
+	if cfg.Database.Password != "hunter2" {
+		t.Fatalf("expected the configuration itself to keep the password")
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the value of secrets when printing the configuration
+const redacted = "******"
+
+// Redacted returns a copy of a with its secrets replaced
+func (a App) Redacted() App {
+	fields := fieldsOf(reflect.ValueOf(&a).Elem(), "")
+	for _, f := range fields {
+		if !f.secret {
+			continue
+		}
+		switch f.value.Kind() {
+		case reflect.String:
+			if f.value.String() != "" {
+				f.value.SetString(redacted)
+			}
+		case reflect.Slice:
+			// a copy, since the slice is shared with the original
+			values := make([]string, f.value.Len())
+			for i := range values {
+				values[i] = redacted
+			}
+			f.value.Set(reflect.ValueOf(values))
+		}
+	}
+	return a
+}
+
+// Print writes a as YAML with its secrets redacted
+func Print(w io.Writer, a App) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(a.Redacted()); err != nil {
+		return fmt.Errorf("enc.Encode: %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,110 @@
+package storetest
+
+import (
+	"context"
+	"device/business/command"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Commands is an in-memory command.Store, deleting the commands of deleted devices
+type Commands struct {
+	mu       sync.Mutex
+	commands []command.Command
+}
+
+var _ command.Store = (*Commands)(nil)
+
+// NewCommands creates an empty Commands store
+func NewCommands() *Commands {
+	return &Commands{}
+}
+
+func (m *Commands) Create(_ context.Context, c command.Command) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, c)
+	return nil
+}
+
+func (m *Commands) ByID(_ context.Context, deviceID, id string) (command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.commands {
+		if c.ID == id && c.DeviceID == deviceID {
+			return c, nil
+		}
+	}
+	return command.Command{}, command.ErrNotFound
+}
+
+func (m *Commands) Deliver(_ context.Context, deviceIDs []string, now time.Time, limit int) ([]command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var delivered []command.Command
+	for i, c := range m.commands {
+		if len(delivered) == limit {
+			break
+		}
+		if slices.Contains(deviceIDs, c.DeviceID) && c.Status == command.StatusQueued && c.ExpiresAt.After(now) {
+			m.commands[i].Status, m.commands[i].DeliveredAt = command.StatusDelivered, &now
+			delivered = append(delivered, m.commands[i])
+		}
+	}
+	return delivered, nil
+}
+
+func (m *Commands) Complete(_ context.Context, deviceID, id string, ack command.Ack, at time.Time) (command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.commands {
+		if c.ID != id || c.DeviceID != deviceID {
+			continue
+		}
+		if c.Status != command.StatusDelivered || !c.ExpiresAt.After(at) {
+			return command.Command{}, command.ErrNotDelivered
+		}
+		m.commands[i].Status, m.commands[i].Result, m.commands[i].CompletedAt = ack.Status, ack.Result, &at
+		return m.commands[i], nil
+	}
+	return command.Command{}, command.ErrNotFound
+}
+
+func (m *Commands) History(_ context.Context, deviceID string, offset, limit int) ([]command.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var history []command.Command
+	for i := len(m.commands) - 1; i >= 0; i-- {
+		if m.commands[i].DeviceID == deviceID {
+			history = append(history, m.commands[i])
+		}
+	}
+	return page(history, offset, limit), nil
+}
+
+func (m *Commands) Expire(_ context.Context, now time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for i, c := range m.commands {
+		if n < limit && (c.Status == command.StatusQueued || c.Status == command.StatusDelivered) && !c.ExpiresAt.After(now) {
+			m.commands[i].Status = command.StatusExpired
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Commands) DeleteDevice(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.commands[:0]
+	for _, c := range m.commands {
+		if c.DeviceID != id {
+			kept = append(kept, c)
+		}
+	}
+	m.commands = kept
+	return nil
+}
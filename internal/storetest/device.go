@@ -0,0 +1,133 @@
+package storetest
+
+import (
+	"context"
+	"device/business/device"
+	"sync"
+	"time"
+)
+
+// Devices is an in-memory device.Store keeping devices in creation order
+type Devices struct {
+	mu      sync.Mutex
+	devices []device.Device
+}
+
+var _ device.Store = (*Devices)(nil)
+
+// NewDevices creates an empty Devices store
+func NewDevices() *Devices {
+	return &Devices{}
+}
+
+func (s *Devices) find(id string) int {
+	for i, d := range s.devices {
+		if d.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Devices) ByID(_ context.Context, id string) (device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.find(id); i >= 0 {
+		return s.devices[i], nil
+	}
+	return device.Device{}, device.ErrNotFound
+}
+
+func (s *Devices) ByIDs(ctx context.Context, ids []string) ([]device.Device, error) {
+	var devices []device.Device
+	for _, id := range ids {
+		if d, err := s.ByID(ctx, id); err == nil {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (s *Devices) Create(_ context.Context, d device.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = append(s.devices, d)
+	return nil
+}
+
+func (s *Devices) Update(_ context.Context, id string, data device.UpdateDevice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(id)
+	if i < 0 {
+		return device.ErrNotFound
+	}
+	if data.Name != nil {
+		s.devices[i].Name = *data.Name
+	}
+	if data.Brand != nil {
+		s.devices[i].Brand = *data.Brand
+	}
+	if data.Labels != nil {
+		s.devices[i].Labels = data.Labels
+	}
+	return nil
+}
+
+func (s *Devices) GetAll(ctx context.Context, offset, limit int) ([]device.Device, error) {
+	return s.SearchByBrand(ctx, "", offset, limit)
+}
+
+func (s *Devices) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(id)
+	if i < 0 {
+		return device.ErrNotFound
+	}
+	s.devices = append(s.devices[:i], s.devices[i+1:]...)
+	return nil
+}
+
+func (s *Devices) SearchByBrand(ctx context.Context, brand string, offset, limit int) ([]device.Device, error) {
+	return s.Search(ctx, device.Filter{Brand: brand}, offset, limit)
+}
+
+func (s *Devices) Search(_ context.Context, f device.Filter, offset, limit int) ([]device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := []device.Device{}
+	for _, d := range s.devices {
+		if f.Matches(d) {
+			devices = append(devices, d)
+		}
+	}
+	return page(devices, offset, limit), nil
+}
+
+func (s *Devices) RecordHeartbeat(_ context.Context, id string, hb device.Heartbeat, at time.Time) (device.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(id)
+	if i < 0 {
+		return "", device.ErrNotFound
+	}
+	previous := s.devices[i].Status
+	s.devices[i].Status = device.StatusOnline
+	s.devices[i].LastSeenAt = &at
+	s.devices[i].Heartbeat = &hb
+	return previous, nil
+}
+
+func (s *Devices) MarkOffline(_ context.Context, seenBefore time.Time, limit int) ([]device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []device.Device
+	for i, d := range s.devices {
+		if len(devices) < limit && d.Status == device.StatusOnline && d.LastSeenAt.Before(seenBefore) {
+			s.devices[i].Status = device.StatusOffline
+			devices = append(devices, s.devices[i])
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,200 @@
+package storetest
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/firmware"
+	"sort"
+	"sync"
+)
+
+// Firmware is an in-memory firmware.Store, newest first where it lists
+type Firmware struct {
+	mu       sync.Mutex
+	firmware []firmware.Firmware
+	rollouts []firmware.Rollout
+	devices  []firmware.DeviceProgress
+}
+
+var _ firmware.Store = (*Firmware)(nil)
+
+// NewFirmware creates an empty Firmware store
+func NewFirmware() *Firmware {
+	return &Firmware{}
+}
+
+func (m *Firmware) CreateFirmware(_ context.Context, f firmware.Firmware) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.firmware {
+		if existing.Version == f.Version {
+			return firmware.ErrVersionExists
+		}
+	}
+	m.firmware = append([]firmware.Firmware{f}, m.firmware...)
+	return nil
+}
+
+func (m *Firmware) FirmwareByID(_ context.Context, id string) (firmware.Firmware, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.firmware {
+		if f.ID == id {
+			return f, nil
+		}
+	}
+	return firmware.Firmware{}, firmware.ErrNotFound
+}
+
+func (m *Firmware) ListFirmware(_ context.Context, brand string, offset, limit int) ([]firmware.Firmware, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fs := []firmware.Firmware{}
+	for _, f := range m.firmware {
+		if brand == "" || f.Compatible(device.Device{Brand: brand}) {
+			fs = append(fs, f)
+		}
+	}
+	return page(fs, offset, limit), nil
+}
+
+func (m *Firmware) DeleteFirmware(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rollouts {
+		if r.FirmwareID == id {
+			return firmware.ErrInUse
+		}
+	}
+	for i, f := range m.firmware {
+		if f.ID == id {
+			m.firmware = append(m.firmware[:i], m.firmware[i+1:]...)
+			return nil
+		}
+	}
+	return firmware.ErrNotFound
+}
+
+func (m *Firmware) CreateRollout(_ context.Context, r firmware.Rollout, devices []firmware.DeviceProgress) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollouts = append([]firmware.Rollout{r}, m.rollouts...)
+	m.devices = append(m.devices, devices...)
+	return nil
+}
+
+func (m *Firmware) RolloutByID(_ context.Context, id string) (firmware.Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rollouts {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return firmware.Rollout{}, firmware.ErrRolloutNotFound
+}
+
+func (m *Firmware) ListRollouts(_ context.Context, status firmware.RolloutStatus, offset, limit int) ([]firmware.Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rs := []firmware.Rollout{}
+	for _, r := range m.rollouts {
+		if status == "" || r.Status == status {
+			rs = append(rs, r)
+		}
+	}
+	return page(rs, offset, limit), nil
+}
+
+func (m *Firmware) UpdateRollout(_ context.Context, id string, update func(r *firmware.Rollout) error) (firmware.Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rollouts {
+		if r.ID != id {
+			continue
+		}
+		if err := update(&r); err != nil {
+			return firmware.Rollout{}, err
+		}
+		m.rollouts[i] = r
+		return r, nil
+	}
+	return firmware.Rollout{}, firmware.ErrRolloutNotFound
+}
+
+func (m *Firmware) StageCounts(_ context.Context, id string) ([]firmware.StageCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var counts []firmware.StageCount
+	for _, d := range m.devices {
+		if d.RolloutID != id {
+			continue
+		}
+		counts = append(counts, firmware.StageCount{Stage: d.Stage, Status: d.Status, Count: 1})
+	}
+	return counts, nil
+}
+
+func (m *Firmware) RolloutDevices(_ context.Context, id string, status firmware.DeviceStatus, offset, limit int) ([]firmware.DeviceProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps := []firmware.DeviceProgress{}
+	for _, d := range m.devices {
+		if d.RolloutID == id && (status == "" || d.Status == status) {
+			ps = append(ps, d)
+		}
+	}
+	sort.SliceStable(ps, func(i, j int) bool { return ps[i].Stage < ps[j].Stage })
+	return page(ps, offset, limit), nil
+}
+
+func (m *Firmware) PendingUpdate(_ context.Context, deviceID string) (firmware.DeviceProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rollouts {
+		for _, d := range m.devices {
+			if d.RolloutID != r.ID || d.DeviceID != deviceID || d.Stage > r.Stage {
+				continue
+			}
+			running := r.Status == firmware.RolloutRunning && (d.Status == firmware.DevicePending || d.Status == firmware.DeviceInstalling)
+			if running || r.Status == firmware.RolloutPaused && d.Status == firmware.DeviceInstalling {
+				return d, nil
+			}
+		}
+	}
+	return firmware.DeviceProgress{}, firmware.ErrNoUpdate
+}
+
+func (m *Firmware) Report(_ context.Context, deviceID, rolloutID string, update func(p *firmware.DeviceProgress, r firmware.Rollout) error) (firmware.DeviceProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, d := range m.devices {
+		if d.RolloutID != rolloutID || d.DeviceID != deviceID {
+			continue
+		}
+		for _, r := range m.rollouts {
+			if r.ID != rolloutID {
+				continue
+			}
+			if err := update(&d, r); err != nil {
+				return firmware.DeviceProgress{}, err
+			}
+			m.devices[i] = d
+			return d, nil
+		}
+	}
+	return firmware.DeviceProgress{}, firmware.ErrNotAssigned
+}
+
+func (m *Firmware) DeleteDevice(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.devices[:0]
+	for _, d := range m.devices {
+		if d.DeviceID != id {
+			kept = append(kept, d)
+		}
+	}
+	m.devices = kept
+	return nil
+}
@@ -0,0 +1,255 @@
+package storetest
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/group"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Groups is an in-memory group.Store, by name where it lists, matching
+// the dynamic groups against devices
+type Groups struct {
+	mu         sync.Mutex
+	groups     []group.Group
+	members    map[string]map[string]bool
+	operations []group.Operation
+	devices    *Devices
+}
+
+var _ group.Store = (*Groups)(nil)
+
+// NewGroups creates an empty Groups store, whose dynamic groups select
+// among devices
+func NewGroups(devices *Devices) *Groups {
+	return &Groups{members: map[string]map[string]bool{}, devices: devices}
+}
+
+func (m *Groups) Create(ctx context.Context, g group.Group, deviceIDs []string, check func(tree group.Tree) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if g.ParentID != "" {
+		if err := check(tree{m}); err != nil {
+			return err
+		}
+		if m.find(g.ParentID) < 0 {
+			return group.ErrParentNotFound
+		}
+	}
+	m.groups = append(m.groups, g)
+	sort.SliceStable(m.groups, func(i, j int) bool { return m.groups[i].Name < m.groups[j].Name })
+	m.members[g.ID] = map[string]bool{}
+	for _, id := range deviceIDs {
+		m.members[g.ID][id] = true
+	}
+	return nil
+}
+
+func (m *Groups) find(id string) int {
+	for i, g := range m.groups {
+		if g.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Groups) ByID(ctx context.Context, id string) (group.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return tree{m}.ByID(ctx, id)
+}
+
+// tree reads the groups of a Groups whose lock is held
+type tree struct {
+	m *Groups
+}
+
+func (t tree) ByID(_ context.Context, id string) (group.Group, error) {
+	m := t.m
+	if i := m.find(id); i >= 0 {
+		return m.groups[i], nil
+	}
+	return group.Group{}, group.ErrNotFound
+}
+
+func (m *Groups) List(_ context.Context, parentID string, offset, limit int) ([]group.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gs := []group.Group{}
+	for _, g := range m.groups {
+		if g.ParentID == parentID {
+			gs = append(gs, g)
+		}
+	}
+	return page(gs, offset, limit), nil
+}
+
+func (m *Groups) Update(_ context.Context, id string, update func(g *group.Group, tree group.Tree) error) (group.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(id)
+	if i < 0 {
+		return group.Group{}, group.ErrNotFound
+	}
+	g := m.groups[i]
+	if err := update(&g, tree{m}); err != nil {
+		return group.Group{}, err
+	}
+	if g.ParentID != "" && m.find(g.ParentID) < 0 {
+		return group.Group{}, group.ErrParentNotFound
+	}
+	m.groups[i] = g
+	return g, nil
+}
+
+func (m *Groups) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(id)
+	if i < 0 {
+		return group.ErrNotFound
+	}
+	for _, g := range m.groups {
+		if g.ParentID == id {
+			return group.ErrHasSubgroups
+		}
+	}
+	m.groups = append(m.groups[:i], m.groups[i+1:]...)
+	delete(m.members, id)
+	return nil
+}
+
+func (m *Groups) Subgroups(ctx context.Context, id string) ([]group.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return tree{m}.Subgroups(ctx, id)
+}
+
+func (t tree) Subgroups(_ context.Context, id string) ([]group.Group, error) {
+	m := t.m
+	var subgroups []group.Group
+	parents := map[string]bool{id: true}
+	for found := true; found; {
+		found = false
+		for _, g := range m.groups {
+			if parents[g.ParentID] && !parents[g.ID] {
+				parents[g.ID] = true
+				subgroups = append(subgroups, g)
+				found = true
+			}
+		}
+	}
+	return subgroups, nil
+}
+
+func (m *Groups) AddMembers(_ context.Context, id string, deviceIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.find(id) < 0 {
+		return group.ErrNotFound
+	}
+	for _, deviceID := range deviceIDs {
+		m.members[id][deviceID] = true
+	}
+	return nil
+}
+
+func (m *Groups) RemoveMember(_ context.Context, id, deviceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.members[id][deviceID] {
+		return group.ErrNotMember
+	}
+	delete(m.members[id], deviceID)
+	return nil
+}
+
+func (m *Groups) DeviceIDs(ctx context.Context, ms group.Membership, after string, offset, limit int) ([]string, error) {
+	m.mu.Lock()
+	set := map[string]bool{}
+	for _, id := range ms.GroupIDs {
+		for deviceID := range m.members[id] {
+			set[deviceID] = true
+		}
+	}
+	m.mu.Unlock()
+	for _, f := range ms.Filters {
+		devices, err := m.devices.Search(ctx, device.Filter{Brand: f.Brand, Labels: f.Labels}, 0, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			set[d.ID] = true
+		}
+	}
+	ids := []string{}
+	for id := range set {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return page(ids, offset, limit), nil
+}
+
+func (m *Groups) CreateOperation(_ context.Context, op group.Operation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.operations = append(m.operations, op)
+	return nil
+}
+
+func (m *Groups) OperationByID(_ context.Context, id string) (group.Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range m.operations {
+		if op.ID == id {
+			return op, nil
+		}
+	}
+	return group.Operation{}, group.ErrOperationNotFound
+}
+
+func (m *Groups) ListOperations(_ context.Context, status group.OperationStatus, offset, limit int) ([]group.Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ops := []group.Operation{}
+	for _, op := range m.operations {
+		if op.Status == status {
+			ops = append(ops, op)
+		}
+	}
+	return page(ops, offset, limit), nil
+}
+
+// UpdateOperation does not hold the lock while updating, as the update
+// reads the groups
+func (m *Groups) UpdateOperation(ctx context.Context, id string, update func(ctx context.Context, op *group.Operation) error) (group.Operation, error) {
+	op, err := m.OperationByID(ctx, id)
+	if err != nil {
+		return group.Operation{}, err
+	}
+	if err := update(ctx, &op); err != nil {
+		return group.Operation{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.operations {
+		if m.operations[i].ID == id {
+			m.operations[i] = op
+		}
+	}
+	return op, nil
+}
+
+func (m *Groups) DeleteDevice(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, members := range m.members {
+		delete(members, id)
+	}
+	return nil
+}
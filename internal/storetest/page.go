@@ -0,0 +1,10 @@
+package storetest
+
+// page returns the items from offset, at most limit of them, as a store
+// paging with OFFSET and LIMIT does
+func page[T any](items []T, offset, limit int) []T {
+	if offset > len(items) {
+		offset = len(items)
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
@@ -0,0 +1,43 @@
+package storetest
+
+import (
+	"context"
+	"device/business/shadow"
+	"sync"
+)
+
+// Shadows is an in-memory shadow.Store, deleting the shadows of deleted devices
+type Shadows struct {
+	mu      sync.Mutex
+	shadows map[string]shadow.Shadow
+}
+
+var _ shadow.Store = (*Shadows)(nil)
+
+// NewShadows creates an empty Shadows store
+func NewShadows() *Shadows {
+	return &Shadows{shadows: map[string]shadow.Shadow{}}
+}
+
+func (m *Shadows) ByDeviceID(_ context.Context, id string) (shadow.Shadow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.shadows[id], nil
+}
+
+func (m *Shadows) Save(_ context.Context, s shadow.Shadow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.shadows[s.DeviceID].Version != s.Version-1 {
+		return shadow.ErrVersionConflict
+	}
+	m.shadows[s.DeviceID] = s
+	return nil
+}
+
+func (m *Shadows) DeleteDevice(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.shadows, id)
+	return nil
+}
@@ -0,0 +1,78 @@
+package storetest
+
+import (
+	"context"
+	"device/business/telemetry"
+	"sort"
+	"sync"
+)
+
+// Samples is an in-memory telemetry.Store
+type Samples struct {
+	mu      sync.Mutex
+	samples []telemetry.Sample
+}
+
+var _ telemetry.Store = (*Samples)(nil)
+
+// NewSamples creates an empty Samples store
+func NewSamples() *Samples {
+	return &Samples{}
+}
+
+func (m *Samples) Add(_ context.Context, samples []telemetry.Sample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, samples...)
+	return nil
+}
+
+func (m *Samples) DeleteDevice(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := m.samples[:0]
+	for _, s := range m.samples {
+		if s.DeviceID != id {
+			samples = append(samples, s)
+		}
+	}
+	m.samples = samples
+	return nil
+}
+
+func (m *Samples) Points(_ context.Context, q telemetry.Query, limit int) ([]telemetry.Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var samples []telemetry.Sample
+	for _, s := range m.samples {
+		if s.DeviceID == q.DeviceID && s.Metric == q.Metric && !s.Time.Before(q.From) && s.Time.Before(q.To) {
+			samples = append(samples, s)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+
+	points := []telemetry.Point{}
+	var count int
+	for _, s := range samples {
+		p := telemetry.Point{Time: s.Time.UTC(), Value: s.Value}
+		if q.Step > 0 {
+			p.Time = p.Time.Truncate(q.Step)
+		}
+		last := len(points) - 1
+		if q.Step == 0 || last < 0 || !points[last].Time.Equal(p.Time) {
+			points, count = append(points, p), 1
+			continue
+		}
+		switch count++; q.Aggregation {
+		case telemetry.AggregationAvg:
+			points[last].Value += (p.Value - points[last].Value) / float64(count)
+		case telemetry.AggregationMin:
+			points[last].Value = min(points[last].Value, p.Value)
+		case telemetry.AggregationMax:
+			points[last].Value = max(points[last].Value, p.Value)
+		case telemetry.AggregationLast:
+			points[last].Value = p.Value
+		}
+	}
+	return points[:min(limit, len(points))], nil
+}
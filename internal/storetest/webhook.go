@@ -0,0 +1,156 @@
+package storetest
+
+import (
+	"context"
+	"device/business/webhook"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Webhooks is an in-memory webhook.Store, newest first where it lists
+// deliveries
+type Webhooks struct {
+	mu         sync.Mutex
+	subs       []webhook.Subscription
+	deliveries []webhook.Delivery
+}
+
+var _ webhook.Store = (*Webhooks)(nil)
+
+// NewWebhooks creates an empty Webhooks store
+func NewWebhooks() *Webhooks {
+	return &Webhooks{}
+}
+
+func (m *Webhooks) find(id string) int {
+	for i, s := range m.subs {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Webhooks) CreateSubscription(_ context.Context, s webhook.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs = append(m.subs, s)
+	return nil
+}
+
+func (m *Webhooks) SubscriptionByID(_ context.Context, id string) (webhook.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.find(id); i >= 0 {
+		return m.subs[i], nil
+	}
+	return webhook.Subscription{}, webhook.ErrNotFound
+}
+
+func (m *Webhooks) UpdateSubscription(_ context.Context, id string, data webhook.UpdateSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(id)
+	if i < 0 {
+		return webhook.ErrNotFound
+	}
+	if data.URL != nil {
+		m.subs[i].URL = *data.URL
+	}
+	if data.Secret != nil {
+		m.subs[i].Secret = *data.Secret
+	}
+	if data.Events != nil {
+		m.subs[i].Events = *data.Events
+	}
+	if data.Active != nil {
+		m.subs[i].Active = *data.Active
+	}
+	return nil
+}
+
+func (m *Webhooks) DeleteSubscription(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(id)
+	if i < 0 {
+		return webhook.ErrNotFound
+	}
+	m.subs = append(m.subs[:i], m.subs[i+1:]...)
+	kept := m.deliveries[:0]
+	for _, d := range m.deliveries {
+		if d.SubscriptionID != id {
+			kept = append(kept, d)
+		}
+	}
+	m.deliveries = kept
+	return nil
+}
+
+func (m *Webhooks) Subscriptions(_ context.Context, offset, limit int) ([]webhook.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return page(append([]webhook.Subscription{}, m.subs...), offset, limit), nil
+}
+
+func (m *Webhooks) ActiveSubscriptions(context.Context) ([]webhook.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subs []webhook.Subscription
+	for _, s := range m.subs {
+		if s.Active {
+			subs = append(subs, s)
+		}
+	}
+	return subs, nil
+}
+
+func (m *Webhooks) CreateDeliveries(_ context.Context, ds ...webhook.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, ds...)
+	return nil
+}
+
+func (m *Webhooks) ClaimDeliveries(_ context.Context, now time.Time, lease time.Duration, limit int) ([]webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*webhook.Delivery
+	for i := range m.deliveries {
+		if d := &m.deliveries[i]; d.Status == webhook.StatusPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+
+	ds := make([]webhook.Delivery, 0, len(due))
+	for _, d := range page(due, 0, limit) {
+		d.NextAttemptAt = now.Add(lease)
+		ds = append(ds, *d)
+	}
+	return ds, nil
+}
+
+func (m *Webhooks) UpdateDelivery(_ context.Context, d webhook.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == d.ID {
+			m.deliveries[i] = d
+		}
+	}
+	return nil
+}
+
+func (m *Webhooks) Deliveries(_ context.Context, subscriptionID string, offset, limit int) ([]webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ds := []webhook.Delivery{}
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if m.deliveries[i].SubscriptionID == subscriptionID {
+			ds = append(ds, m.deliveries[i])
+		}
+	}
+	return page(ds, offset, limit), nil
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Health is the body of the health endpoints
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the outcome of the check of one dependency
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Live checks that the API is serving
+func (c *Client) Live(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodGet, path: "/healthz", noRetry: true}, nil)
+}
+
+// Ready returns the readiness of the API and its checks. An API that is not
+// ready returns its checks along with an error matching ErrUnavailable.
+func (c *Client) Ready(ctx context.Context) (Health, error) {
+	var h Health
+	err := c.do(ctx, request{method: http.MethodGet, path: "/readyz", noRetry: true}, &h)
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+		_ = json.Unmarshal(apiErr.body, &h)
+	}
+	return h, err
+}
+
+// Metrics returns the metrics of the API in the Prometheus text format
+func (c *Client) Metrics(ctx context.Context) ([]byte, error) {
+	var b []byte
+	err := c.do(ctx, request{method: http.MethodGet, path: "/metrics", accept: "text/plain"}, &b)
+	return b, err
+}
+
+// OpenAPI returns the OpenAPI document of the API
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var b []byte
+	err := c.do(ctx, request{method: http.MethodGet, path: "/openapi.json"}, &b)
+	return b, err
+}
+
+// GraphQLError is an error of a GraphQL response
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// GraphQLErrors are the errors of a GraphQL response
+type GraphQLErrors []GraphQLError
+
+func (es GraphQLErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Message
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// GraphQL runs query with variables and decodes the data of the response into
+// out. It fails with GraphQLErrors if the response has errors, in which case
+// out may still hold partial data.
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors GraphQLErrors   `json:"errors"`
+	}
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/graphql",
+		body: map[string]interface{}{
+			"query":     query,
+			"variables": variables,
+		},
+	}, &resp)
+	if err != nil {
+		return err
+	}
+
+	if out != nil && len(resp.Data) > 0 && string(resp.Data) != "null" {
+		if err := json.Unmarshal(resp.Data, out); err != nil {
+			return fmt.Errorf("json.Unmarshal: %w", err)
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+	return nil
+}
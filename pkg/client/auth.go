@@ -0,0 +1,38 @@
+package client
+
+import "net/http"
+
+// APIKeyHeader carries the API key of the client
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator adds credentials to a request before it is sent
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthFunc adapts a function to an Authenticator, e.g. one that fetches a
+// short-lived token
+type AuthFunc func(req *http.Request) error
+
+// Authenticate calls f
+func (f AuthFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// APIKey is an Authenticator sending the key in the X-API-Key header
+type APIKey string
+
+// Authenticate sets the X-API-Key header
+func (k APIKey) Authenticate(req *http.Request) error {
+	req.Header.Set(APIKeyHeader, string(k))
+	return nil
+}
+
+// BearerToken is an Authenticator sending the token in the Authorization header
+type BearerToken string
+
+// Authenticate sets the Authorization header
+func (t BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
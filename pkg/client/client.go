@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a request when no http.Client is given
+const defaultTimeout = 30 * time.Second
+
+// Client calls the device API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	auth       Authenticator
+	retry      RetryPolicy
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with hc
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithAuth authenticates every request with a
+func WithAuth(a Authenticator) Option {
+	return func(c *Client) {
+		c.auth = a
+	}
+}
+
+// WithAPIKey sends key in the X-API-Key header of every request
+func WithAPIKey(key string) Option {
+	return WithAuth(APIKey(key))
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// New creates a new Client of the API served at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL %q must start with http:// or https://", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request is a call to the API
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// body is encoded as JSON if not nil
+	body interface{}
+	// notFound is the error a 404 response matches, if any
+	notFound error
+	accept   string
+	header   http.Header
+	// stream responses are read for longer than the timeout of the http.Client
+	stream  bool
+	noRetry bool
+}
+
+// do sends req, retrying it according to the retry policy, and decodes the
+// JSON response into out, if not nil
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		if *raw, err = io.ReadAll(resp.Body); err != nil {
+			return fmt.Errorf("io.ReadAll: %w", err)
+		}
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("json.Decode: %w", err)
+	}
+	return nil
+}
+
+// send sends req until it succeeds or may not be retried. The caller closes
+// the body of the returned response, which is always successful.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("json.Marshal: %w", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, req, body)
+		if err == nil {
+			return resp, nil
+		}
+
+		wait, retry := c.retry.next(attempt, req.method, err)
+		if !retry || req.noRetry || ctx.Err() != nil {
+			return nil, err
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends req once
+func (c *Client) attempt(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), reader)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest: %w", err)
+	}
+	accept := req.accept
+	if accept == "" {
+		accept = "application/json"
+	}
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	httpReq.Header.Set("Accept", accept)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.auth != nil {
+		if err := c.auth.Authenticate(httpReq); err != nil {
+			return nil, fmt.Errorf("auth.Authenticate: %w", err)
+		}
+	}
+
+	hc := c.httpClient
+	if req.stream && hc.Timeout > 0 {
+		streaming := *hc
+		streaming.Timeout = 0
+		hc = &streaming
+	}
+	resp, err := hc.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient.Do: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeError(resp, req.notFound)
+	}
+	return resp, nil
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
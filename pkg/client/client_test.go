@@ -0,0 +1,1004 @@
+package client_test
+
+import (
+	"context"
+	"device/app/api/gql"
+	"device/app/api/handler"
+	"device/app/api/handler/health"
+	"device/app/api/handler/stream"
+	"device/business/command"
+	"device/business/device"
+	"device/business/event"
+	"device/business/firmware"
+	"device/business/group"
+	"device/business/shadow"
+	"device/business/telemetry"
+	"device/business/webhook"
+	"device/internal/storetest"
+	"device/pkg/client"
+	"device/pkg/logging"
+	"device/pkg/metrics"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	commandHandler "device/app/api/handler/command"
+	deviceHandler "device/app/api/handler/device"
+	firmwareHandler "device/app/api/handler/firmware"
+	groupHandler "device/app/api/handler/group"
+	shadowHandler "device/app/api/handler/shadow"
+	telemetryHandler "device/app/api/handler/telemetry"
+	webhookHandler "device/app/api/handler/webhook"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// testAPI is the real router over the businesses and in-memory stores
+type testAPI struct {
+	router  http.Handler
+	url     string
+	ready   atomic.Bool
+	headers chan http.Header
+	// failures holds the statuses of the next responses, before the router is reached
+	mu       sync.Mutex
+	failures []int
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	broadcaster := event.NewBroadcaster(100, 16)
+	devices := storetest.NewDevices()
+	shadows := storetest.NewShadows()
+	commands := storetest.NewCommands()
+	fw := storetest.NewFirmware()
+	groups := storetest.NewGroups(devices)
+	samples := storetest.NewSamples()
+	business := device.NewBusiness(devices, device.WithPublisher(broadcaster), device.WithDependents(shadows, commands, fw, groups, samples))
+	commandBusiness := command.NewBusiness(commands, business, time.Hour)
+	streams := stream.NewHandler(broadcaster)
+
+	api := &testAPI{headers: make(chan http.Header, 100)}
+	api.ready.Store(true)
+	checks := health.NewHandler()
+	checks.Register("database", health.CheckFunc(func(context.Context) error {
+		if !api.ready.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}))
+
+	api.router = handler.NewRouter(handler.Handlers{
+		Device:    deviceHandler.NewHandler(business),
+		Webhook:   webhookHandler.NewHandler(webhook.NewBusiness(storetest.NewWebhooks())),
+		Stream:    streams,
+		Telemetry: telemetryHandler.NewHandler(telemetry.NewBusiness(samples, business, 24*time.Hour)),
+		Shadow:    shadowHandler.NewHandler(shadow.NewBusiness(shadows, business)),
+		Command:   commandHandler.NewHandler(commandBusiness),
+		Firmware:  firmwareHandler.NewHandler(firmware.NewBusiness(fw, business)),
+		Group:     groupHandler.NewHandler(group.NewBusiness(groups, business, commandBusiness)),
+		GraphQL:   gql.NewHandler(business),
+		Health:    checks,
+		Metrics:   metrics.Handler(metrics.NewRegistry()),
+		Middlewares: []func(http.Handler) http.Handler{
+			logging.RequestIDMiddleware,
+			api.fail,
+		},
+	})
+
+	srv := httptest.NewServer(api.router)
+	t.Cleanup(func() {
+		streams.Close()
+		srv.Close()
+	})
+	api.url = srv.URL
+	return api
+}
+
+// fail answers with the queued failures before letting requests through
+func (a *testAPI) fail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case a.headers <- r.Header.Clone():
+		default:
+		}
+
+		a.mu.Lock()
+		var status int
+		if len(a.failures) > 0 {
+			status, a.failures = a.failures[0], a.failures[1:]
+		}
+		a.mu.Unlock()
+
+		if status != 0 {
+			http.Error(w, `{"error": "try again"}`, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *testAPI) client(t *testing.T, opts ...client.Option) *client.Client {
+	opts = append([]client.Option{client.WithRetryPolicy(client.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	})}, opts...)
+	c, err := client.New(a.url, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestClientCoversEveryRoute(t *testing.T) {
+	api := newTestAPI(t)
+
+	// the methods of the client calling each route
+	covered := map[string]string{
+		"GET /api/v1/devices/events":                         "WatchDevices",
+		"GET /api/v1/devices/{id}":                           "GetDevice",
+		"PUT /api/v1/devices/{id}":                           "UpdateDevice",
+		"DELETE /api/v1/devices/{id}":                        "DeleteDevice",
+		"POST /api/v1/devices/{id}/heartbeat":                "Heartbeat",
+		"POST /api/v1/devices/{id}/telemetry":                "IngestTelemetry",
+		"GET /api/v1/devices/{id}/telemetry":                 "QueryTelemetry",
+		"GET /api/v1/devices/{id}/shadow":                    "GetShadow",
+		"PUT /api/v1/devices/{id}/shadow/desired":            "UpdateDesiredState",
+		"PUT /api/v1/devices/{id}/shadow/reported":           "UpdateReportedState",
+		"GET /api/v1/devices/{id}/commands":                  "ListCommands, Commands",
+		"POST /api/v1/devices/{id}/commands":                 "EnqueueCommand",
+		"GET /api/v1/devices/{id}/commands/pending":          "PollCommands",
+		"GET /api/v1/devices/{id}/commands/{commandID}":      "GetCommand",
+		"POST /api/v1/devices/{id}/commands/{commandID}/ack": "AckCommand",
+		"GET /api/v1/devices/{id}/firmware":                  "PendingUpdate",
+		"POST /api/v1/devices/{id}/firmware/report":          "ReportUpdate",
+		"GET /api/v1/devices/":                               "ListDevices, Devices",
+		"POST /api/v1/devices/":                              "CreateDevice",
+		"GET /api/v1/webhooks/{id}":                          "GetWebhook",
+		"PUT /api/v1/webhooks/{id}":                          "UpdateWebhook",
+		"DELETE /api/v1/webhooks/{id}":                       "DeleteWebhook",
+		"GET /api/v1/webhooks/{id}/deliveries":               "ListDeliveries, Deliveries",
+		"GET /api/v1/webhooks/":                              "ListWebhooks, Webhooks",
+		"POST /api/v1/webhooks/":                             "CreateWebhook",
+		"GET /api/v1/firmware/{id}":                          "GetFirmware",
+		"DELETE /api/v1/firmware/{id}":                       "DeleteFirmware",
+		"GET /api/v1/firmware/":                              "ListFirmware, Firmware",
+		"POST /api/v1/firmware/":                             "CreateFirmware",
+		"GET /api/v1/rollouts/{id}":                          "GetRollout",
+		"POST /api/v1/rollouts/{id}/pause":                   "PauseRollout",
+		"POST /api/v1/rollouts/{id}/resume":                  "ResumeRollout",
+		"POST /api/v1/rollouts/{id}/cancel":                  "CancelRollout",
+		"GET /api/v1/rollouts/{id}/devices":                  "ListRolloutDevices, RolloutDevices",
+		"GET /api/v1/rollouts/":                              "ListRollouts",
+		"POST /api/v1/rollouts/":                             "CreateRollout",
+		"GET /api/v1/groups/{id}":                            "GetGroup",
+		"PUT /api/v1/groups/{id}":                            "UpdateGroup",
+		"DELETE /api/v1/groups/{id}":                         "DeleteGroup",
+		"GET /api/v1/groups/{id}/devices":                    "ListGroupDevices, GroupDevices",
+		"POST /api/v1/groups/{id}/members":                   "AddGroupMembers",
+		"DELETE /api/v1/groups/{id}/members/{deviceID}":      "RemoveGroupMember",
+		"POST /api/v1/groups/{id}/labels":                    "UpdateGroupLabels",
+		"POST /api/v1/groups/{id}/commands":                  "SendGroupCommand",
+		"GET /api/v1/groups/{id}/operations/{operationID}":   "GetGroupOperation",
+		"GET /api/v1/groups/":                                "ListGroups, Groups",
+		"POST /api/v1/groups/":                               "CreateGroup",
+		"POST /graphql":                                      "GraphQL",
+		"GET /healthz":                                       "Live",
+		"GET /readyz":                                        "Ready",
+		"GET /metrics":                                       "Metrics",
+		"GET /openapi.json":                                  "OpenAPI",
+		"GET /docs":                                          "none, the page is meant for browsers",
+	}
+
+	err := chi.Walk(api.router.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if _, ok := covered[method+" "+route]; !ok {
+			t.Errorf("route %s %s has no client method", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	created, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 24; i++ {
+		if _, err := c.CreateDevice(ctx, device.CreateDevice{Name: "sensor", Brand: "other"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got, err := c.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != created.ID || got.Name != "phone" {
+		t.Fatalf("expected %+v, got %+v", created, got)
+	}
+
+	page, err := c.ListDevices(ctx, client.ListOptions{Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page) != 1 {
+		t.Fatalf("expected 1 device of brand acme, got %d", len(page))
+	}
+
+	all, err := c.Devices(client.ListOptions{Limit: 10}).All(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 25 {
+		t.Fatalf("expected to iterate over 25 devices, got %d", len(all))
+	}
+
+	name := "tablet"
+	if err := c.UpdateDevice(ctx, created.ID, device.UpdateDevice{Name: &name}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := c.GetDevice(ctx, created.ID); got.Name != name {
+		t.Fatalf("expected the name %s, got %s", name, got.Name)
+	}
+
+	if err := c.DeleteDevice(ctx, created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = c.GetDevice(ctx, created.ID)
+	if !errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected device.ErrNotFound, got %v", err)
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.RequestID == "" {
+		t.Fatalf("expected a 404 *client.Error with a request ID, got %#v", err)
+	}
+
+	if err := c.DeleteDevice(ctx, "not-a-uuid"); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+	if _, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+}
+
+func TestHeartbeats(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	alive, err := c.CreateDevice(ctx, device.CreateDevice{Name: "sensor", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.CreateDevice(ctx, device.CreateDevice{Name: "sensor", Brand: "acme"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alive.Status != device.StatusUnknown || alive.LastSeenAt != nil {
+		t.Fatalf("expected a device never seen, got %+v", alive)
+	}
+
+	before := time.Now()
+	hb := device.Heartbeat{IP: "10.0.0.7", Firmware: "1.4.2", UptimeSeconds: 3600}
+	if err := c.Heartbeat(ctx, alive.ID, hb); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := c.GetDevice(ctx, alive.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Status != device.StatusOnline || got.LastSeenAt == nil || got.Heartbeat == nil || *got.Heartbeat != hb {
+		t.Fatalf("expected an online device with the heartbeat, got %+v", got)
+	}
+
+	online, err := c.ListDevices(ctx, client.ListOptions{Status: device.StatusOnline, LastSeenAfter: before.Add(-time.Second)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(online) != 1 || online[0].ID != alive.ID {
+		t.Fatalf("expected the device that sent a heartbeat, got %+v", online)
+	}
+	unknown, err := c.Devices(client.ListOptions{Status: device.StatusUnknown}).All(ctx)
+	if err != nil || len(unknown) != 1 || unknown[0].ID == alive.ID {
+		t.Fatalf("expected the silent device, got %+v, %v", unknown, err)
+	}
+
+	if err := c.Heartbeat(ctx, uuid.NewString(), device.Heartbeat{}); !errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected device.ErrNotFound, got %v", err)
+	}
+	if err := c.Heartbeat(ctx, alive.ID, device.Heartbeat{IP: "nope"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+	if _, err := c.ListDevices(ctx, client.ListOptions{Status: "asleep"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+}
+
+func TestTelemetry(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	d, err := c.CreateDevice(ctx, device.CreateDevice{Name: "sensor", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	at := func(d time.Duration) *time.Time {
+		t := start.Add(d)
+		return &t
+	}
+	batch := telemetry.Batch{Samples: []telemetry.IngestSample{
+		{Metric: "battery", Value: []byte("90"), Time: at(0)},
+		{Metric: "battery", Value: []byte("80"), Time: at(10 * time.Minute)},
+		{Metric: "battery", Value: []byte("70"), Time: at(20 * time.Minute)},
+		{Metric: "battery", Value: []byte("60"), Time: at(30 * time.Minute)},
+		{Metric: "door_open", Value: []byte("true"), Time: at(0)},
+	}}
+	result, err := c.IngestTelemetry(ctx, d.ID, batch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Samples != 5 {
+		t.Fatalf("expected 5 samples ingested, got %d", result.Samples)
+	}
+
+	raw, err := c.QueryTelemetry(ctx, d.ID, client.TelemetryQuery{Metric: "battery", From: start, To: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(raw.Points) != 4 || raw.Points[0].Value != 90 || !raw.Points[3].Time.Equal(start.Add(30*time.Minute)) {
+		t.Fatalf("expected the 4 battery samples, got %+v", raw)
+	}
+
+	downsampled, err := c.QueryTelemetry(ctx, d.ID, client.TelemetryQuery{Metric: "battery", From: start, To: start.Add(time.Hour), Step: 20 * time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if downsampled.Aggregation != telemetry.AggregationAvg || len(downsampled.Points) != 2 ||
+		downsampled.Points[0].Value != 85 || downsampled.Points[1].Value != 65 {
+		t.Fatalf("expected 2 averaged points, got %+v", downsampled)
+	}
+
+	last, err := c.QueryTelemetry(ctx, d.ID, client.TelemetryQuery{Metric: "battery", From: start, To: start.Add(time.Hour), Step: time.Hour, Aggregation: telemetry.AggregationLast})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(last.Points) != 1 || last.Points[0].Value != 60 {
+		t.Fatalf("expected the last sample, got %+v", last)
+	}
+
+	if _, err := c.IngestTelemetry(ctx, uuid.NewString(), batch); !errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected device.ErrNotFound, got %v", err)
+	}
+	expired := telemetry.Batch{Samples: []telemetry.IngestSample{{Metric: "battery", Value: []byte("1"), Time: at(-48 * time.Hour)}}}
+	if _, err := c.IngestTelemetry(ctx, d.ID, expired); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+	if _, err := c.QueryTelemetry(ctx, d.ID, client.TelemetryQuery{Metric: "Battery"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+}
+
+func TestShadows(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	d, err := c.CreateDevice(ctx, device.CreateDevice{Name: "thermostat", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, err := c.GetShadow(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Version != 0 || len(s.Desired) != 0 || len(s.Reported) != 0 || len(s.Delta) != 0 {
+		t.Fatalf("expected an empty shadow, got %+v", s)
+	}
+
+	s, err = c.UpdateDesiredState(ctx, d.ID, shadow.UpdateState{State: shadow.State{"target": 21.5, "mode": "heat"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Version != 1 || s.Delta["target"] != 21.5 || s.Delta["mode"] != "heat" {
+		t.Fatalf("expected the desired state as delta, got %+v", s)
+	}
+
+	version := s.Version
+	s, err = c.UpdateReportedState(ctx, d.ID, shadow.UpdateState{State: shadow.State{"target": 21.5, "mode": "off"}, Version: &version})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Version != 2 || len(s.Delta) != 1 || s.Delta["mode"] != "heat" {
+		t.Fatalf("expected the mode left to apply, got %+v", s)
+	}
+
+	if _, err := c.UpdateDesiredState(ctx, d.ID, shadow.UpdateState{State: shadow.State{"mode": "cool"}, Version: &version}); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, err := c.UpdateDesiredState(ctx, d.ID, shadow.UpdateState{}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+
+	if err := c.DeleteDevice(ctx, d.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.GetShadow(ctx, d.ID); !errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected device.ErrNotFound, got %v", err)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	d, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reboot, err := c.EnqueueCommand(ctx, d.ID, command.CreateCommand{Name: "reboot", Payload: json.RawMessage(`{"delay":5}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reboot.Status != command.StatusQueued || !reboot.ExpiresAt.After(reboot.CreatedAt) {
+		t.Fatalf("expected a queued command with the default TTL, got %+v", reboot)
+	}
+
+	delivered, err := c.PollCommands(ctx, d.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(delivered) != 1 || delivered[0].ID != reboot.ID || delivered[0].Status != command.StatusDelivered {
+		t.Fatalf("expected the reboot to be delivered, got %+v", delivered)
+	}
+
+	// a long poll returns as soon as a command is queued
+	polled := make(chan []command.Command, 1)
+	go func() {
+		cmds, err := c.PollCommands(ctx, d.ID, 10*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		polled <- cmds
+	}()
+	time.Sleep(50 * time.Millisecond)
+	locate, err := c.EnqueueCommand(ctx, d.ID, command.CreateCommand{Name: "locate", TTLSeconds: 60})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case cmds := <-polled:
+		if len(cmds) != 1 || cmds[0].ID != locate.ID {
+			t.Fatalf("expected the locate command, got %+v", cmds)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the long poll to return once the command was queued")
+	}
+
+	acked, err := c.AckCommand(ctx, d.ID, reboot.ID, command.Ack{Status: command.StatusSucceeded, Result: json.RawMessage(`{"uptime":0}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if acked.Status != command.StatusSucceeded || acked.CompletedAt == nil {
+		t.Fatalf("expected the reboot to have succeeded, got %+v", acked)
+	}
+	if _, err := c.AckCommand(ctx, d.ID, reboot.ID, command.Ack{Status: command.StatusFailed}); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, err := c.AckCommand(ctx, d.ID, reboot.ID, command.Ack{Status: command.StatusExpired}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+
+	got, err := c.GetCommand(ctx, d.ID, reboot.ID)
+	if err != nil || got.Status != command.StatusSucceeded {
+		t.Fatalf("expected the succeeded reboot, got %+v: %v", got, err)
+	}
+	if _, err := c.GetCommand(ctx, d.ID, uuid.NewString()); !errors.Is(err, command.ErrNotFound) {
+		t.Fatalf("expected command.ErrNotFound, got %v", err)
+	}
+
+	history, err := c.Commands(d.ID).All(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != locate.ID || history[1].ID != reboot.ID {
+		t.Fatalf("expected the history newest first, got %+v", history)
+	}
+
+	if _, err := c.EnqueueCommand(ctx, uuid.NewString(), command.CreateCommand{Name: "reboot"}); !errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected device.ErrNotFound, got %v", err)
+	}
+}
+
+func TestFirmwareRollouts(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.CreateDevice(ctx, device.CreateDevice{Name: "sensor", Brand: "acme", Labels: map[string]string{"ring": "beta"}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	cf := firmware.CreateFirmware{
+		Version:     "2.0.0",
+		Brands:      []string{"acme"},
+		Checksum:    "sha256:" + strings.Repeat("ab", 32),
+		ArtifactURL: "https://cdn.example.com/2.0.0.bin",
+	}
+	f, err := c.CreateFirmware(ctx, cf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.CreateFirmware(ctx, cf); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if fs, err := c.Firmware("acme").All(ctx); err != nil || len(fs) != 1 || fs[0].ID != f.ID {
+		t.Fatalf("expected the firmware for acme, got %+v: %v", fs, err)
+	}
+	if got, err := c.GetFirmware(ctx, f.ID); err != nil || got.Version != f.Version {
+		t.Fatalf("expected the firmware, got %+v: %v", got, err)
+	}
+
+	if _, err := c.CreateRollout(ctx, firmware.CreateRollout{FirmwareID: f.ID, Target: firmware.Target{Brand: "globex"}}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest for an incompatible brand, got %v", err)
+	}
+	r, err := c.CreateRollout(ctx, firmware.CreateRollout{
+		FirmwareID: f.ID,
+		Target:     firmware.Target{Labels: map[string]string{"ring": "beta"}},
+		Stages:     []int{50, 100},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Devices != 4 || r.Progress == nil || r.Progress.Pending != 2 {
+		t.Fatalf("expected 2 of 4 devices released, got %+v", r)
+	}
+
+	stages := map[int][]string{}
+	devices, err := c.RolloutDevices(r.ID, "").All(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, d := range devices {
+		stages[d.Stage] = append(stages[d.Stage], d.DeviceID)
+	}
+	if len(stages[0]) != 2 || len(stages[1]) != 2 {
+		t.Fatalf("expected 2 devices in each stage, got %v", stages)
+	}
+
+	u, err := c.PendingUpdate(ctx, stages[0][0])
+	if err != nil || u.RolloutID != r.ID || u.Firmware.Version != "2.0.0" {
+		t.Fatalf("expected the update, got %+v: %v", u, err)
+	}
+	if _, err := c.PendingUpdate(ctx, stages[1][0]); !errors.Is(err, firmware.ErrNoUpdate) {
+		t.Fatalf("expected firmware.ErrNoUpdate, got %v", err)
+	}
+	if _, err := c.ReportUpdate(ctx, stages[1][0], firmware.Report{RolloutID: r.ID, Status: firmware.DeviceInstalling}); !errors.Is(err, firmware.ErrNotAssigned) {
+		t.Fatalf("expected firmware.ErrNotAssigned, got %v", err)
+	}
+	if p, err := c.ReportUpdate(ctx, stages[0][0], firmware.Report{RolloutID: r.ID, Status: firmware.DeviceSucceeded}); err != nil || p.Status != firmware.DeviceSucceeded {
+		t.Fatalf("expected the update succeeded, got %+v: %v", p, err)
+	}
+	if _, err := c.ReportUpdate(ctx, stages[0][0], firmware.Report{RolloutID: r.ID, Status: firmware.DeviceFailed}); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if ds, err := c.ListRolloutDevices(ctx, r.ID, firmware.DeviceSucceeded, 0, 10); err != nil || len(ds) != 1 || ds[0].DeviceID != stages[0][0] {
+		t.Fatalf("expected the succeeded device, got %+v: %v", ds, err)
+	}
+
+	if r, err = c.PauseRollout(ctx, r.ID); err != nil || r.Status != firmware.RolloutPaused {
+		t.Fatalf("expected the rollout paused, got %+v: %v", r, err)
+	}
+	if _, err := c.PauseRollout(ctx, r.ID); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if r, err = c.ResumeRollout(ctx, r.ID); err != nil || r.Status != firmware.RolloutRunning {
+		t.Fatalf("expected the rollout running, got %+v: %v", r, err)
+	}
+	if r, err = c.CancelRollout(ctx, r.ID); err != nil || r.Status != firmware.RolloutCancelled {
+		t.Fatalf("expected the rollout cancelled, got %+v: %v", r, err)
+	}
+	if rs, err := c.ListRollouts(ctx, firmware.RolloutCancelled, 0, 10); err != nil || len(rs) != 1 || rs[0].ID != r.ID {
+		t.Fatalf("expected the cancelled rollout, got %+v: %v", rs, err)
+	}
+	if got, err := c.GetRollout(ctx, r.ID); err != nil || got.Status != firmware.RolloutCancelled {
+		t.Fatalf("expected the cancelled rollout, got %+v: %v", got, err)
+	}
+	if _, err := c.GetRollout(ctx, uuid.NewString()); !errors.Is(err, firmware.ErrRolloutNotFound) {
+		t.Fatalf("expected firmware.ErrRolloutNotFound, got %v", err)
+	}
+
+	if err := c.DeleteFirmware(ctx, f.ID); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict for firmware in use, got %v", err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	var devices []device.Device
+	for _, cd := range []device.CreateDevice{
+		{Name: "lobby", Brand: "acme", Labels: map[string]string{"beta": "true"}},
+		{Name: "hall", Brand: "acme", Labels: map[string]string{"region": "eu"}},
+		{Name: "roof", Brand: "globex", Labels: map[string]string{"region": "eu"}},
+		{Name: "cellar", Brand: "globex", Labels: map[string]string{"region": "us"}},
+	} {
+		d, err := c.CreateDevice(ctx, cd)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		devices = append(devices, d)
+	}
+
+	building, err := c.CreateGroup(ctx, group.CreateGroup{Name: "building", Kind: group.KindStatic, DeviceIDs: []string{devices[0].ID}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eu, err := c.CreateGroup(ctx, group.CreateGroup{Name: "eu", Kind: group.KindDynamic, ParentID: building.ID, Filter: &group.Filter{Labels: map[string]string{"region": "eu"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.CreateGroup(ctx, group.CreateGroup{Name: "floor", Kind: group.KindStatic, DeviceIDs: []string{uuid.NewString()}}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest for an unknown device, got %v", err)
+	}
+	if _, err := c.GetGroup(ctx, uuid.NewString()); !errors.Is(err, group.ErrNotFound) {
+		t.Fatalf("expected group.ErrNotFound, got %v", err)
+	}
+
+	if gs, err := c.Groups("").All(ctx); err != nil || len(gs) != 1 || gs[0].ID != building.ID {
+		t.Fatalf("expected the building group at the top level, got %+v: %v", gs, err)
+	}
+	if gs, err := c.Groups(building.ID).All(ctx); err != nil || len(gs) != 1 || gs[0].ID != eu.ID {
+		t.Fatalf("expected the eu group in the building, got %+v: %v", gs, err)
+	}
+
+	// the devices of a group include the ones of its subgroups
+	members, err := c.GroupDevices(building.ID).All(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("expected 3 devices, got %+v", members)
+	}
+	if page, err := c.ListGroupDevices(ctx, building.ID, 1, 1); err != nil || len(page) != 1 || page[0].ID != members[1].ID {
+		t.Fatalf("expected the second device, got %+v: %v", page, err)
+	}
+
+	if err := c.AddGroupMembers(ctx, building.ID, group.Members{DeviceIDs: []string{devices[3].ID}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.AddGroupMembers(ctx, eu.ID, group.Members{DeviceIDs: []string{devices[3].ID}}); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict for a dynamic group, got %v", err)
+	}
+	if err := c.RemoveGroupMember(ctx, building.ID, devices[0].ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.RemoveGroupMember(ctx, building.ID, devices[0].ID); !errors.Is(err, group.ErrNotMember) {
+		t.Fatalf("expected group.ErrNotMember, got %v", err)
+	}
+
+	op, err := c.UpdateGroupLabels(ctx, building.ID, group.LabelChange{Set: map[string]string{"site": "hq"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if op.GroupID != building.ID || op.Kind != group.OperationLabels || op.Status != group.OperationRunning {
+		t.Fatalf("expected a running labels operation, got %+v", op)
+	}
+	if got, err := c.GetGroupOperation(ctx, building.ID, op.ID); err != nil || got.ID != op.ID || got.Labels == nil || got.Labels.Set["site"] != "hq" {
+		t.Fatalf("expected the labels operation, got %+v: %v", got, err)
+	}
+	cmd, err := c.SendGroupCommand(ctx, eu.ID, command.CreateCommand{Name: "reboot"})
+	if err != nil || cmd.Kind != group.OperationCommand || cmd.Command == nil || cmd.Command.Name != "reboot" {
+		t.Fatalf("expected a command operation, got %+v: %v", cmd, err)
+	}
+	if _, err := c.GetGroupOperation(ctx, building.ID, cmd.ID); !errors.Is(err, group.ErrOperationNotFound) {
+		t.Fatalf("expected group.ErrOperationNotFound for the operation of another group, got %v", err)
+	}
+	if _, err := c.SendGroupCommand(ctx, uuid.NewString(), command.CreateCommand{Name: "reboot"}); !errors.Is(err, group.ErrNotFound) {
+		t.Fatalf("expected group.ErrNotFound, got %v", err)
+	}
+
+	if _, err := c.UpdateGroup(ctx, building.ID, group.UpdateGroup{ParentID: &eu.ID}); !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest for a cycle, got %v", err)
+	}
+	if _, err := c.UpdateGroup(ctx, building.ID, group.UpdateGroup{Filter: &group.Filter{Brand: "acme"}}); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict for the filter of a static group, got %v", err)
+	}
+	if err := c.DeleteGroup(ctx, building.ID); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected ErrConflict for a group with subgroups, got %v", err)
+	}
+	top := ""
+	if g, err := c.UpdateGroup(ctx, eu.ID, group.UpdateGroup{ParentID: &top}); err != nil || g.ParentID != "" {
+		t.Fatalf("expected the eu group at the top level, got %+v: %v", g, err)
+	}
+	if err := c.DeleteGroup(ctx, building.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		s, err := c.CreateWebhook(ctx, webhook.CreateSubscription{URL: "https://example.com/hook", Events: []string{device.EventDeviceCreated}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s.Secret == "" {
+			t.Fatalf("expected the created subscription to hold its secret")
+		}
+		ids = append(ids, s.ID)
+	}
+
+	s, err := c.GetWebhook(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Secret != "" {
+		t.Fatalf("expected the secret to be redacted")
+	}
+
+	subs, err := c.Webhooks().All(ctx)
+	if err != nil || len(subs) != 3 {
+		t.Fatalf("expected 3 subscriptions, got %d: %v", len(subs), err)
+	}
+
+	active := false
+	if err := c.UpdateWebhook(ctx, ids[0], webhook.UpdateSubscription{Active: &active}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ds, err := c.Deliveries(ids[0]).All(ctx)
+	if err != nil || len(ds) != 0 {
+		t.Fatalf("expected no delivery, got %d: %v", len(ds), err)
+	}
+
+	if err := c.DeleteWebhook(ctx, ids[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.ListDeliveries(ctx, ids[0], 0, 10); !errors.Is(err, webhook.ErrNotFound) {
+		t.Fatalf("expected webhook.ErrNotFound, got %v", err)
+	}
+	if errors.Is(err, device.ErrNotFound) {
+		t.Fatalf("expected a webhook error not to match device.ErrNotFound")
+	}
+}
+
+func TestWatchDevices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := newTestAPI(t).client(t)
+
+	events, err := c.WatchDevices(ctx, client.WatchOptions{Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer events.Close()
+
+	if _, err := c.CreateDevice(ctx, device.CreateDevice{Name: "sensor", Brand: "other"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	e, err := events.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, err := device.DeviceFromEvent(e)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Type != device.EventDeviceCreated || d.ID != created.ID {
+		t.Fatalf("expected the creation of %s, got %s of %s", created.ID, e.Type, d.ID)
+	}
+	if events.LastEventID() != e.ID {
+		t.Fatalf("expected the last event ID %s, got %s", e.ID, events.LastEventID())
+	}
+
+	// a resumed stream replays what was missed
+	name := "tablet"
+	if err := c.UpdateDevice(ctx, created.ID, device.UpdateDevice{Name: &name}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resumed, err := c.WatchDevices(ctx, client.WatchOptions{Brand: "acme", LastEventID: e.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resumed.Close()
+	if e, err := resumed.Next(); err != nil || e.Type != device.EventDeviceUpdated {
+		t.Fatalf("expected the missed update, got %s: %v", e.Type, err)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	ctx := context.Background()
+	c := newTestAPI(t).client(t)
+
+	created, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone", Brand: "acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out struct {
+		Device struct {
+			Name string `json:"name"`
+		} `json:"device"`
+	}
+	err = c.GraphQL(ctx, `query($id: ID!) { device(id: $id) { name } }`, map[string]interface{}{"id": created.ID}, &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Device.Name != "phone" {
+		t.Fatalf("expected phone, got %s", out.Device.Name)
+	}
+
+	var gqlErrs client.GraphQLErrors
+	err = c.GraphQL(ctx, `{ device(id: "nope") { name } }`, nil, nil)
+	if !errors.As(err, &gqlErrs) || gqlErrs[0].Message != "id is not a valid UUID" {
+		t.Fatalf("expected a GraphQL error, got %v", err)
+	}
+}
+
+func TestHealthMetricsAndSpec(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+	c := api.client(t)
+
+	if err := c.Live(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h, err := c.Ready(ctx); err != nil || h.Status != health.StatusOK {
+		t.Fatalf("expected the API to be ready, got %+v: %v", h, err)
+	}
+
+	api.ready.Store(false)
+	h, err := c.Ready(ctx)
+	if !errors.Is(err, client.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if h.Checks["database"].Error != "connection refused" {
+		t.Fatalf("expected the failing check, got %+v", h)
+	}
+
+	if m, err := c.Metrics(ctx); err != nil || len(m) == 0 {
+		t.Fatalf("expected metrics, got %d bytes: %v", len(m), err)
+	}
+	if spec, err := c.OpenAPI(ctx); err != nil || len(spec) == 0 {
+		t.Fatalf("expected the spec, got %d bytes: %v", len(spec), err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	testTable := map[string]struct {
+		failures      []int
+		call          func(c *client.Client) error
+		expectedErr   error
+		expectedCalls int
+	}{
+		"read retried until it succeeds": {
+			failures:      []int{http.StatusServiceUnavailable, http.StatusBadGateway},
+			call:          func(c *client.Client) error { _, err := c.ListDevices(ctx, client.ListOptions{}); return err },
+			expectedCalls: 3,
+		},
+		"read gives up after the last attempt": {
+			failures:      []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			call:          func(c *client.Client) error { _, err := c.ListDevices(ctx, client.ListOptions{}); return err },
+			expectedErr:   client.ErrUnavailable,
+			expectedCalls: 3,
+		},
+		"create is not retried when the API may have processed it": {
+			failures: []int{http.StatusBadGateway},
+			call: func(c *client.Client) error {
+				_, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone", Brand: "acme"})
+				return err
+			},
+			expectedErr:   &client.Error{},
+			expectedCalls: 1,
+		},
+		"rate limited create is retried": {
+			failures: []int{http.StatusTooManyRequests},
+			call: func(c *client.Client) error {
+				_, err := c.CreateDevice(ctx, device.CreateDevice{Name: "phone", Brand: "acme"})
+				return err
+			},
+			expectedCalls: 2,
+		},
+		"client errors are not retried": {
+			failures:      []int{http.StatusBadRequest},
+			call:          func(c *client.Client) error { _, err := c.ListDevices(ctx, client.ListOptions{}); return err },
+			expectedErr:   client.ErrBadRequest,
+			expectedCalls: 1,
+		},
+	}
+
+	for name, test := range testTable {
+		t.Run(name, func(t *testing.T) {
+			api := newTestAPI(t)
+			api.failures = test.failures
+
+			err := test.call(api.client(t))
+			switch want := test.expectedErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case *client.Error:
+				if !errors.As(err, &want) {
+					t.Fatalf("expected a *client.Error, got %v", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("expected %v, got %v", want, err)
+				}
+			}
+			if calls := len(api.headers); calls != test.expectedCalls {
+				t.Fatalf("expected %d calls, got %d", test.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	testTable := map[string]struct {
+		auth           client.Option
+		expectedHeader string
+		expectedValue  string
+	}{
+		"api key": {
+			auth:           client.WithAPIKey("key"),
+			expectedHeader: client.APIKeyHeader,
+			expectedValue:  "key",
+		},
+		"bearer token": {
+			auth:           client.WithAuth(client.BearerToken("token")),
+			expectedHeader: "Authorization",
+			expectedValue:  "Bearer token",
+		},
+		"custom": {
+			auth: client.WithAuth(client.AuthFunc(func(r *http.Request) error {
+				r.Header.Set("X-Tenant-ID", "tenant")
+				return nil
+			})),
+			expectedHeader: "X-Tenant-ID",
+			expectedValue:  "tenant",
+		},
+	}
+
+	for name, test := range testTable {
+		t.Run(name, func(t *testing.T) {
+			api := newTestAPI(t)
+			if err := api.client(t, test.auth).Live(ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := (<-api.headers).Get(test.expectedHeader); got != test.expectedValue {
+				t.Fatalf("expected %s %q, got %q", test.expectedHeader, test.expectedValue, got)
+			}
+		})
+	}
+
+	api := newTestAPI(t)
+	failing := client.WithAuth(client.AuthFunc(func(*http.Request) error { return errors.New("token expired") }))
+	if _, err := api.client(t, failing).ListDevices(ctx, client.ListOptions{}); err == nil || len(api.headers) != 0 {
+		t.Fatalf("expected the request not to be sent, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// commandsPath returns the path of the commands of the device id
+func commandsPath(id string) string {
+	return devicePath(id) + "/commands"
+}
+
+// commandPath returns the path of the command commandID of the device id
+func commandPath(id, commandID string) string {
+	return commandsPath(id) + "/" + url.PathEscape(commandID)
+}
+
+// EnqueueCommand queues a command for the device id. It fails with an error
+// matching device.ErrNotFound if there is no such device.
+func (c *Client) EnqueueCommand(ctx context.Context, id string, cc command.CreateCommand) (command.Command, error) {
+	var cmd command.Command
+	err := c.do(ctx, request{method: http.MethodPost, path: commandsPath(id), body: cc, notFound: device.ErrNotFound}, &cmd)
+	return cmd, err
+}
+
+// GetCommand returns the command commandID of the device id. It fails with
+// an error matching command.ErrNotFound if there is none.
+func (c *Client) GetCommand(ctx context.Context, id, commandID string) (command.Command, error) {
+	var cmd command.Command
+	err := c.do(ctx, request{method: http.MethodGet, path: commandPath(id, commandID), notFound: command.ErrNotFound}, &cmd)
+	return cmd, err
+}
+
+// ListCommands returns a page of the commands of the device id, newest first
+func (c *Client) ListCommands(ctx context.Context, id string, offset, limit int) ([]command.Command, error) {
+	var cmds []command.Command
+	err := c.do(ctx, request{
+		method:   http.MethodGet,
+		path:     commandsPath(id),
+		query:    pageValues(offset, limit),
+		notFound: device.ErrNotFound,
+	}, &cmds)
+	return cmds, err
+}
+
+// Commands iterates over the commands of the device id, newest first
+func (c *Client) Commands(id string) *Iterator[command.Command] {
+	return newIterator(0, 0, func(ctx context.Context, offset, limit int) ([]command.Command, error) {
+		return c.ListCommands(ctx, id, offset, limit)
+	})
+}
+
+// PollCommands delivers the queued commands of the device id, waiting up to
+// wait for some when there are none. The API caps wait at command.MaxWait,
+// and an empty result means none arrived in time. The commands are delivered
+// once and have to be acknowledged with AckCommand.
+func (c *Client) PollCommands(ctx context.Context, id string, wait time.Duration) ([]command.Command, error) {
+	q := url.Values{}
+	if wait > 0 {
+		q.Set("wait", wait.String())
+	}
+
+	var cmds []command.Command
+	err := c.do(ctx, request{method: http.MethodGet, path: commandsPath(id) + "/pending", query: q, notFound: device.ErrNotFound}, &cmds)
+	return cmds, err
+}
+
+// AckCommand records the outcome of the command commandID delivered to the
+// device id and returns the completed command. It fails with an error
+// matching ErrConflict if the command is not awaiting an acknowledgement.
+func (c *Client) AckCommand(ctx context.Context, id, commandID string, ack command.Ack) (command.Command, error) {
+	var cmd command.Command
+	err := c.do(ctx, request{method: http.MethodPost, path: commandPath(id, commandID) + "/ack", body: ack, notFound: command.ErrNotFound}, &cmd)
+	return cmd, err
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"device/business/device"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const devicesPath = "/api/v1/devices"
+
+// ListOptions selects a page of devices
+type ListOptions struct {
+	// Brand, if set, only lists the devices of that brand
+	Brand string
+	// Status, if set, only lists the devices with that status
+	Status device.Status
+	// LastSeenAfter and LastSeenBefore, if set, bound the last heartbeat of
+	// the devices listed
+	LastSeenAfter  time.Time
+	LastSeenBefore time.Time
+	// Labels, if set, only lists the devices that have every one of them
+	Labels map[string]string
+	Offset int
+	// Limit is the size of the page, the API defaults to 10
+	Limit int
+}
+
+// values encodes o as query parameters
+func (o ListOptions) values() url.Values {
+	q := pageValues(o.Offset, o.Limit)
+	if o.Brand != "" {
+		q.Set("brand", o.Brand)
+	}
+	if o.Status != "" {
+		q.Set("status", string(o.Status))
+	}
+	if !o.LastSeenAfter.IsZero() {
+		q.Set("last_seen_after", o.LastSeenAfter.Format(time.RFC3339Nano))
+	}
+	if !o.LastSeenBefore.IsZero() {
+		q.Set("last_seen_before", o.LastSeenBefore.Format(time.RFC3339Nano))
+	}
+	for k, v := range o.Labels {
+		q.Add("label", k+"="+v)
+	}
+	return q
+}
+
+// pageValues encodes a page as query parameters
+func pageValues(offset, limit int) url.Values {
+	q := url.Values{}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	return q
+}
+
+// devicePath returns the path of the device id
+func devicePath(id string) string {
+	return devicesPath + "/" + url.PathEscape(id)
+}
+
+// GetDevice returns the device id. It fails with an error matching
+// device.ErrNotFound if there is none.
+func (c *Client) GetDevice(ctx context.Context, id string) (device.Device, error) {
+	var d device.Device
+	err := c.do(ctx, request{method: http.MethodGet, path: devicePath(id), notFound: device.ErrNotFound}, &d)
+	return d, err
+}
+
+// ListDevices returns a page of devices
+func (c *Client) ListDevices(ctx context.Context, opts ListOptions) ([]device.Device, error) {
+	var devices []device.Device
+	err := c.do(ctx, request{method: http.MethodGet, path: devicesPath + "/", query: opts.values()}, &devices)
+	return devices, err
+}
+
+// Devices iterates over the devices from opts.Offset on, opts.Limit at a
+// time, or 100 if it is not set
+func (c *Client) Devices(opts ListOptions) *Iterator[device.Device] {
+	return newIterator(opts.Offset, opts.Limit, func(ctx context.Context, offset, limit int) ([]device.Device, error) {
+		page := opts
+		page.Offset, page.Limit = offset, limit
+		return c.ListDevices(ctx, page)
+	})
+}
+
+// CreateDevice creates a device
+func (c *Client) CreateDevice(ctx context.Context, cd device.CreateDevice) (device.Device, error) {
+	var d device.Device
+	err := c.do(ctx, request{method: http.MethodPost, path: devicesPath + "/", body: cd}, &d)
+	return d, err
+}
+
+// UpdateDevice updates the fields of the device id that are set in data
+func (c *Client) UpdateDevice(ctx context.Context, id string, data device.UpdateDevice) error {
+	return c.do(ctx, request{method: http.MethodPut, path: devicePath(id), body: data, notFound: device.ErrNotFound}, nil)
+}
+
+// DeleteDevice deletes the device id
+func (c *Client) DeleteDevice(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: devicePath(id), notFound: device.ErrNotFound}, nil)
+}
+
+// Heartbeat records that the device id is alive, along with the metadata set
+// in hb
+func (c *Client) Heartbeat(ctx context.Context, id string, hb device.Heartbeat) error {
+	return c.do(ctx, request{method: http.MethodPost, path: devicePath(id) + "/heartbeat", body: hb, notFound: device.ErrNotFound}, nil)
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors an *Error matches with errors.Is, besides the not found error of
+// its resource, e.g. device.ErrNotFound
+var (
+	ErrBadRequest  = errors.New("bad request")
+	ErrConflict    = errors.New("conflict")
+	ErrRateLimited = errors.New("rate limited")
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// requestIDHeader is the header the API echoes the request ID in
+const requestIDHeader = "X-Request-ID"
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string
+	// RequestID identifies the request in the logs of the API
+	RequestID string
+	// RetryAfter is how long the API asked to wait before retrying, if it did
+	RetryAfter time.Duration
+
+	notFound error
+	body     []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Unwrap returns the error the status code maps to, if any
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusNotFound:
+		return e.notFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// decodeError reads the {"error": "..."} body of an error response. A 404
+// response matches notFound.
+func decodeError(resp *http.Response, notFound error) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(b, &body); err != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(b))
+	}
+
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    body.Error,
+		RequestID:  resp.Header.Get(requestIDHeader),
+		notFound:   notFound,
+		body:       b,
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
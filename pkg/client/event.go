@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"device/business/event"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WatchOptions selects the device events to stream
+type WatchOptions struct {
+	// Brand, if set, only streams the events of devices of that brand
+	Brand string
+	// LastEventID resumes a stream after the event with this ID
+	LastEventID string
+}
+
+// EventStream is a stream of device events, read with Next
+type EventStream struct {
+	body        io.ReadCloser
+	reader      *bufio.Reader
+	lastEventID string
+}
+
+// WatchDevices opens a stream of device events. The stream ends when ctx is
+// done or Close is called. Use device.DeviceFromEvent to decode the device of
+// an event.
+func (c *Client) WatchDevices(ctx context.Context, opts WatchOptions) (*EventStream, error) {
+	req := request{
+		method: http.MethodGet,
+		path:   devicesPath + "/events",
+		query:  url.Values{},
+		accept: "text/event-stream",
+		stream: true,
+	}
+	if opts.Brand != "" {
+		req.query.Set("brand", opts.Brand)
+	}
+	if opts.LastEventID != "" {
+		req.header = http.Header{"Last-Event-Id": {opts.LastEventID}}
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{
+		body:        resp.Body,
+		reader:      bufio.NewReader(resp.Body),
+		lastEventID: opts.LastEventID,
+	}, nil
+}
+
+// Next blocks until the next event. It returns io.EOF when the API ended the
+// stream, after which WatchDevices with LastEventID resumes it.
+func (s *EventStream) Next() (event.Event, error) {
+	var data strings.Builder
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return event.Event{}, io.EOF
+			}
+			return event.Event{}, fmt.Errorf("reader.ReadString: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// a blank line ends an event, a line starting with ":" is a heartbeat
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+			var e event.Event
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return event.Event{}, fmt.Errorf("json.Unmarshal: %w", err)
+			}
+			s.lastEventID = e.ID
+			return e, nil
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+}
+
+// LastEventID returns the ID of the last event read, to resume the stream from
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Close ends the stream
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"device/business/firmware"
+	"net/http"
+	"net/url"
+)
+
+const (
+	firmwarePath = "/api/v1/firmware"
+	rolloutsPath = "/api/v1/rollouts"
+)
+
+// firmwareByIDPath returns the path of the firmware id
+func firmwareByIDPath(id string) string {
+	return firmwarePath + "/" + url.PathEscape(id)
+}
+
+// rolloutPath returns the path of the rollout id
+func rolloutPath(id string) string {
+	return rolloutsPath + "/" + url.PathEscape(id)
+}
+
+// CreateFirmware registers a firmware version. It fails with an error
+// matching ErrConflict if the version exists.
+func (c *Client) CreateFirmware(ctx context.Context, cf firmware.CreateFirmware) (firmware.Firmware, error) {
+	var f firmware.Firmware
+	err := c.do(ctx, request{method: http.MethodPost, path: firmwarePath + "/", body: cf}, &f)
+	return f, err
+}
+
+// GetFirmware returns the firmware id. It fails with an error matching
+// firmware.ErrNotFound if there is none.
+func (c *Client) GetFirmware(ctx context.Context, id string) (firmware.Firmware, error) {
+	var f firmware.Firmware
+	err := c.do(ctx, request{method: http.MethodGet, path: firmwareByIDPath(id), notFound: firmware.ErrNotFound}, &f)
+	return f, err
+}
+
+// ListFirmware returns a page of the firmware compatible with brand, or of
+// all of it if brand is empty, newest first
+func (c *Client) ListFirmware(ctx context.Context, brand string, offset, limit int) ([]firmware.Firmware, error) {
+	q := pageValues(offset, limit)
+	if brand != "" {
+		q.Set("brand", brand)
+	}
+
+	var fs []firmware.Firmware
+	err := c.do(ctx, request{method: http.MethodGet, path: firmwarePath + "/", query: q}, &fs)
+	return fs, err
+}
+
+// Firmware iterates over the firmware compatible with brand, or all of it
+// if brand is empty, newest first
+func (c *Client) Firmware(brand string) *Iterator[firmware.Firmware] {
+	return newIterator(0, 0, func(ctx context.Context, offset, limit int) ([]firmware.Firmware, error) {
+		return c.ListFirmware(ctx, brand, offset, limit)
+	})
+}
+
+// DeleteFirmware deletes the firmware id. It fails with an error matching
+// ErrConflict if a rollout installs it.
+func (c *Client) DeleteFirmware(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: firmwareByIDPath(id), notFound: firmware.ErrNotFound}, nil)
+}
+
+// CreateRollout starts rolling out a firmware to the devices matching the
+// target. It fails with an error matching firmware.ErrNotFound if there is
+// no such firmware, and ErrBadRequest if it is incompatible with the
+// target or no device matches it.
+func (c *Client) CreateRollout(ctx context.Context, cr firmware.CreateRollout) (firmware.Rollout, error) {
+	var r firmware.Rollout
+	err := c.do(ctx, request{method: http.MethodPost, path: rolloutsPath + "/", body: cr, notFound: firmware.ErrNotFound}, &r)
+	return r, err
+}
+
+// GetRollout returns the rollout id along with its progress. It fails with
+// an error matching firmware.ErrRolloutNotFound if there is none.
+func (c *Client) GetRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	var r firmware.Rollout
+	err := c.do(ctx, request{method: http.MethodGet, path: rolloutPath(id), notFound: firmware.ErrRolloutNotFound}, &r)
+	return r, err
+}
+
+// ListRollouts returns a page of the rollouts with status, or of all of
+// them if status is empty, newest first
+func (c *Client) ListRollouts(ctx context.Context, status firmware.RolloutStatus, offset, limit int) ([]firmware.Rollout, error) {
+	q := pageValues(offset, limit)
+	if status != "" {
+		q.Set("status", string(status))
+	}
+
+	var rs []firmware.Rollout
+	err := c.do(ctx, request{method: http.MethodGet, path: rolloutsPath + "/", query: q}, &rs)
+	return rs, err
+}
+
+// PauseRollout pauses the running rollout id. It fails with an error
+// matching ErrConflict if the rollout is not running.
+func (c *Client) PauseRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	return c.transitionRollout(ctx, id, "pause")
+}
+
+// ResumeRollout resumes the paused rollout id, accepting the failures so
+// far. It fails with an error matching ErrConflict if the rollout is not
+// paused.
+func (c *Client) ResumeRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	return c.transitionRollout(ctx, id, "resume")
+}
+
+// CancelRollout cancels the rollout id. It fails with an error matching
+// ErrConflict if the rollout is already completed or cancelled.
+func (c *Client) CancelRollout(ctx context.Context, id string) (firmware.Rollout, error) {
+	return c.transitionRollout(ctx, id, "cancel")
+}
+
+// transitionRollout applies action to the rollout id
+func (c *Client) transitionRollout(ctx context.Context, id, action string) (firmware.Rollout, error) {
+	var r firmware.Rollout
+	err := c.do(ctx, request{method: http.MethodPost, path: rolloutPath(id) + "/" + action, notFound: firmware.ErrRolloutNotFound}, &r)
+	return r, err
+}
+
+// ListRolloutDevices returns a page of the progress of the devices of the
+// rollout id with status, or of all of them if status is empty, by stage
+func (c *Client) ListRolloutDevices(ctx context.Context, id string, status firmware.DeviceStatus, offset, limit int) ([]firmware.DeviceProgress, error) {
+	q := pageValues(offset, limit)
+	if status != "" {
+		q.Set("status", string(status))
+	}
+
+	var ps []firmware.DeviceProgress
+	err := c.do(ctx, request{method: http.MethodGet, path: rolloutPath(id) + "/devices", query: q, notFound: firmware.ErrRolloutNotFound}, &ps)
+	return ps, err
+}
+
+// RolloutDevices iterates over the progress of the devices of the rollout
+// id with status, or of all of them if status is empty, by stage
+func (c *Client) RolloutDevices(id string, status firmware.DeviceStatus) *Iterator[firmware.DeviceProgress] {
+	return newIterator(0, 0, func(ctx context.Context, offset, limit int) ([]firmware.DeviceProgress, error) {
+		return c.ListRolloutDevices(ctx, id, status, offset, limit)
+	})
+}
+
+// PendingUpdate returns the firmware update the device id should install.
+// It fails with an error matching firmware.ErrNoUpdate if there is none,
+// which includes the device not existing.
+func (c *Client) PendingUpdate(ctx context.Context, id string) (firmware.DeviceUpdate, error) {
+	var u firmware.DeviceUpdate
+	err := c.do(ctx, request{method: http.MethodGet, path: devicePath(id) + "/firmware", notFound: firmware.ErrNoUpdate}, &u)
+	return u, err
+}
+
+// ReportUpdate records the progress of a firmware update on the device id.
+// It fails with an error matching firmware.ErrNotAssigned if the device has
+// no update in the rollout, and ErrConflict if its outcome is already
+// reported.
+func (c *Client) ReportUpdate(ctx context.Context, id string, rp firmware.Report) (firmware.DeviceProgress, error) {
+	var p firmware.DeviceProgress
+	err := c.do(ctx, request{method: http.MethodPost, path: devicePath(id) + "/firmware/report", body: rp, notFound: firmware.ErrNotAssigned}, &p)
+	return p, err
+}
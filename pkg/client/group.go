@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"device/business/command"
+	"device/business/device"
+	"device/business/group"
+	"net/http"
+	"net/url"
+)
+
+const groupsPath = "/api/v1/groups"
+
+// groupPath returns the path of the group id
+func groupPath(id string) string {
+	return groupsPath + "/" + url.PathEscape(id)
+}
+
+// CreateGroup creates a static or dynamic group. It fails with an error
+// matching ErrBadRequest if its parent or one of its devices does not
+// exist, or it would be nested too deep.
+func (c *Client) CreateGroup(ctx context.Context, cg group.CreateGroup) (group.Group, error) {
+	var g group.Group
+	err := c.do(ctx, request{method: http.MethodPost, path: groupsPath + "/", body: cg}, &g)
+	return g, err
+}
+
+// GetGroup returns the group id. It fails with an error matching
+// group.ErrNotFound if there is none.
+func (c *Client) GetGroup(ctx context.Context, id string) (group.Group, error) {
+	var g group.Group
+	err := c.do(ctx, request{method: http.MethodGet, path: groupPath(id), notFound: group.ErrNotFound}, &g)
+	return g, err
+}
+
+// ListGroups returns a page of the groups nested in parentID, or of the
+// top-level groups if parentID is empty, by name
+func (c *Client) ListGroups(ctx context.Context, parentID string, offset, limit int) ([]group.Group, error) {
+	q := pageValues(offset, limit)
+	if parentID != "" {
+		q.Set("parent_id", parentID)
+	}
+
+	var gs []group.Group
+	err := c.do(ctx, request{method: http.MethodGet, path: groupsPath + "/", query: q}, &gs)
+	return gs, err
+}
+
+// Groups iterates over the groups nested in parentID, or over the top-level
+// groups if parentID is empty, by name
+func (c *Client) Groups(parentID string) *Iterator[group.Group] {
+	return newIterator(0, 0, func(ctx context.Context, offset, limit int) ([]group.Group, error) {
+		return c.ListGroups(ctx, parentID, offset, limit)
+	})
+}
+
+// UpdateGroup updates the group id. It fails with an error matching
+// group.ErrNotFound if there is none, ErrBadRequest if the new parent does
+// not exist, is one of its subgroups or nests it too deep, and ErrConflict
+// if it sets the filter of a static group.
+func (c *Client) UpdateGroup(ctx context.Context, id string, ug group.UpdateGroup) (group.Group, error) {
+	var g group.Group
+	err := c.do(ctx, request{method: http.MethodPut, path: groupPath(id), body: ug, notFound: group.ErrNotFound}, &g)
+	return g, err
+}
+
+// DeleteGroup deletes the group id. It fails with an error matching
+// ErrConflict if groups are nested in it.
+func (c *Client) DeleteGroup(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: groupPath(id), notFound: group.ErrNotFound}, nil)
+}
+
+// ListGroupDevices returns a page of the devices of the group id, its
+// subgroups included, by ID
+func (c *Client) ListGroupDevices(ctx context.Context, id string, offset, limit int) ([]device.Device, error) {
+	var devices []device.Device
+	err := c.do(ctx, request{method: http.MethodGet, path: groupPath(id) + "/devices", query: pageValues(offset, limit), notFound: group.ErrNotFound}, &devices)
+	return devices, err
+}
+
+// GroupDevices iterates over the devices of the group id, its subgroups
+// included, by ID
+func (c *Client) GroupDevices(id string) *Iterator[device.Device] {
+	return newIterator(0, 0, func(ctx context.Context, offset, limit int) ([]device.Device, error) {
+		return c.ListGroupDevices(ctx, id, offset, limit)
+	})
+}
+
+// AddGroupMembers adds devices to the static group id. It fails with an
+// error matching ErrBadRequest if one of them does not exist, and
+// ErrConflict if the group is dynamic.
+func (c *Client) AddGroupMembers(ctx context.Context, id string, m group.Members) error {
+	return c.do(ctx, request{method: http.MethodPost, path: groupPath(id) + "/members", body: m, notFound: group.ErrNotFound}, nil)
+}
+
+// RemoveGroupMember removes the device deviceID from the static group id.
+// It fails with an error matching group.ErrNotMember if the device is not
+// one of its members, which includes the group not existing, and
+// ErrConflict if the group is dynamic.
+func (c *Client) RemoveGroupMember(ctx context.Context, id, deviceID string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: groupPath(id) + "/members/" + url.PathEscape(deviceID), notFound: group.ErrNotMember}, nil)
+}
+
+// UpdateGroupLabels starts an operation setting and removing labels on
+// every device of the group id, its subgroups included. GetGroupOperation
+// follows its progress.
+func (c *Client) UpdateGroupLabels(ctx context.Context, id string, lc group.LabelChange) (group.Operation, error) {
+	var op group.Operation
+	err := c.do(ctx, request{method: http.MethodPost, path: groupPath(id) + "/labels", body: lc, notFound: group.ErrNotFound}, &op)
+	return op, err
+}
+
+// SendGroupCommand starts an operation enqueuing a command for every device
+// of the group id, its subgroups included. GetGroupOperation follows its
+// progress.
+func (c *Client) SendGroupCommand(ctx context.Context, id string, cc command.CreateCommand) (group.Operation, error) {
+	var op group.Operation
+	err := c.do(ctx, request{method: http.MethodPost, path: groupPath(id) + "/commands", body: cc, notFound: group.ErrNotFound}, &op)
+	return op, err
+}
+
+// GetGroupOperation returns the operation operationID of the group id,
+// reporting the devices it failed on so far. It fails with an error
+// matching group.ErrOperationNotFound if there is none.
+func (c *Client) GetGroupOperation(ctx context.Context, id, operationID string) (group.Operation, error) {
+	var op group.Operation
+	err := c.do(ctx, request{method: http.MethodGet, path: groupPath(id) + "/operations/" + url.PathEscape(operationID), notFound: group.ErrOperationNotFound}, &op)
+	return op, err
+}
@@ -0,0 +1,81 @@
+package client
+
+import "context"
+
+// defaultPageSize is the number of items an Iterator fetches at a time
+const defaultPageSize = 100
+
+// Iterator walks through every item of a paginated list, fetching a page at a
+// time:
+//
+//	it := c.Devices(client.ListOptions{Brand: "acme"})
+//	for it.Next(ctx) {
+//		d := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	fetch  func(ctx context.Context, offset, limit int) ([]T, error)
+	offset int
+	limit  int
+	page   []T
+	item   T
+	done   bool
+	err    error
+}
+
+// newIterator creates a new Iterator fetching limit items at a time from offset
+func newIterator[T any](offset, limit int, fetch func(ctx context.Context, offset, limit int) ([]T, error)) *Iterator[T] {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	return &Iterator[T]{fetch: fetch, offset: offset, limit: limit}
+}
+
+// Next moves to the next item, fetching the next page if needed. It returns
+// false once there are no more items or a fetch failed.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		page, err := it.fetch(ctx, it.offset, it.limit)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.offset += len(page)
+		// a short page is the last one
+		it.done = len(page) < it.limit
+		if len(page) == 0 {
+			return false
+		}
+		it.page = page
+	}
+
+	it.item, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Item returns the current item
+func (it *Iterator[T]) Item() T {
+	return it.item
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All collects the remaining items
+func (it *Iterator[T]) All(ctx context.Context) ([]T, error) {
+	var items []T
+	for it.Next(ctx) {
+		items = append(items, it.Item())
+	}
+	return items, it.Err()
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy decides how failed requests are retried.
+//
+// A request is retried when the API rate limited it, and, unless it is a
+// POST which the API may have processed, when it could not reach the API or
+// got a 502, 503 or 504 response. The wait doubles from InitialBackoff up to
+// MaxBackoff, with jitter, or is the Retry-After of the response if longer.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a request, 1 disables retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a Client
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// NoRetries sends every request once
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+// next returns how long to wait before the attempt after attempt, which
+// failed with err, and whether to make it at all
+func (p RetryPolicy) next(attempt int, method string, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !retryable(method, err) {
+		return 0, false
+	}
+
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	// wait between half and all of the backoff so clients don't retry in lockstep
+	if half := int64(backoff / 2); half > 0 {
+		backoff = time.Duration(half + rand.Int63n(half+1))
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > backoff {
+		backoff = apiErr.RetryAfter
+	}
+	return backoff, true
+}
+
+// retryable reports whether a request with method that failed with err may be retried
+func retryable(method string, err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return method != http.MethodPost
+		}
+		return false
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && method != http.MethodPost
+}
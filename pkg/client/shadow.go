@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/shadow"
+	"net/http"
+)
+
+// shadowPath returns the path of the shadow of the device id
+func shadowPath(id string) string {
+	return devicePath(id) + "/shadow"
+}
+
+// GetShadow returns the shadow of the device id. It fails with an error
+// matching device.ErrNotFound if there is no such device.
+func (c *Client) GetShadow(ctx context.Context, id string) (shadow.Shadow, error) {
+	var s shadow.Shadow
+	err := c.do(ctx, request{method: http.MethodGet, path: shadowPath(id), notFound: device.ErrNotFound}, &s)
+	return s, err
+}
+
+// UpdateDesiredState merges u into the state desired for the device id and
+// returns the updated shadow. It fails with an error matching ErrConflict if
+// u has a version the shadow is no longer at.
+func (c *Client) UpdateDesiredState(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error) {
+	var s shadow.Shadow
+	err := c.do(ctx, request{method: http.MethodPut, path: shadowPath(id) + "/desired", body: u, notFound: device.ErrNotFound}, &s)
+	return s, err
+}
+
+// UpdateReportedState merges u into the state the device id reports and
+// returns the updated shadow. It fails with an error matching ErrConflict if
+// u has a version the shadow is no longer at.
+func (c *Client) UpdateReportedState(ctx context.Context, id string, u shadow.UpdateState) (shadow.Shadow, error) {
+	var s shadow.Shadow
+	err := c.do(ctx, request{method: http.MethodPut, path: shadowPath(id) + "/reported", body: u, notFound: device.ErrNotFound}, &s)
+	return s, err
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"device/business/device"
+	"device/business/telemetry"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TelemetryQuery selects the samples of a metric of a device
+type TelemetryQuery struct {
+	Metric string
+	// From and To bound the samples, the API defaults to the last hour
+	From time.Time
+	To   time.Time
+	// Step, if set, aggregates the samples per step with Aggregation, the API
+	// defaults to avg
+	Step        time.Duration
+	Aggregation telemetry.Aggregation
+}
+
+// values encodes q as query parameters
+func (q TelemetryQuery) values() url.Values {
+	v := url.Values{}
+	v.Set("metric", q.Metric)
+	if !q.From.IsZero() {
+		v.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.Step > 0 {
+		v.Set("step", q.Step.String())
+	}
+	if q.Aggregation != "" {
+		v.Set("agg", string(q.Aggregation))
+	}
+	return v
+}
+
+// IngestTelemetry stores a batch of samples of the device id. It fails with
+// an error matching device.ErrNotFound if there is no such device.
+func (c *Client) IngestTelemetry(ctx context.Context, id string, batch telemetry.Batch) (telemetry.IngestResult, error) {
+	var result telemetry.IngestResult
+	err := c.do(ctx, request{method: http.MethodPost, path: devicePath(id) + "/telemetry", body: batch, notFound: device.ErrNotFound}, &result)
+	return result, err
+}
+
+// QueryTelemetry returns the points of a metric of the device id. Times are
+// sent with a precision of a second.
+func (c *Client) QueryTelemetry(ctx context.Context, id string, q TelemetryQuery) (telemetry.Series, error) {
+	var s telemetry.Series
+	err := c.do(ctx, request{method: http.MethodGet, path: devicePath(id) + "/telemetry", query: q.values(), notFound: device.ErrNotFound}, &s)
+	return s, err
+}
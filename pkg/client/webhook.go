@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"device/business/webhook"
+	"net/http"
+	"net/url"
+)
+
+const webhooksPath = "/api/v1/webhooks"
+
+// webhookPath returns the path of the subscription id
+func webhookPath(id string) string {
+	return webhooksPath + "/" + url.PathEscape(id)
+}
+
+// GetWebhook returns the subscription id, without its secret. It fails with
+// an error matching webhook.ErrNotFound if there is none.
+func (c *Client) GetWebhook(ctx context.Context, id string) (webhook.Subscription, error) {
+	var s webhook.Subscription
+	err := c.do(ctx, request{method: http.MethodGet, path: webhookPath(id), notFound: webhook.ErrNotFound}, &s)
+	return s, err
+}
+
+// ListWebhooks returns a page of subscriptions, without their secrets
+func (c *Client) ListWebhooks(ctx context.Context, offset, limit int) ([]webhook.Subscription, error) {
+	var subs []webhook.Subscription
+	err := c.do(ctx, request{method: http.MethodGet, path: webhooksPath + "/", query: pageValues(offset, limit)}, &subs)
+	return subs, err
+}
+
+// Webhooks iterates over every subscription
+func (c *Client) Webhooks() *Iterator[webhook.Subscription] {
+	return newIterator(0, 0, c.ListWebhooks)
+}
+
+// CreateWebhook creates a subscription. The result is the only one holding
+// the secret the deliveries are signed with.
+func (c *Client) CreateWebhook(ctx context.Context, cs webhook.CreateSubscription) (webhook.Subscription, error) {
+	var s webhook.Subscription
+	err := c.do(ctx, request{method: http.MethodPost, path: webhooksPath + "/", body: cs}, &s)
+	return s, err
+}
+
+// UpdateWebhook updates the fields of the subscription id that are set in data
+func (c *Client) UpdateWebhook(ctx context.Context, id string, data webhook.UpdateSubscription) error {
+	return c.do(ctx, request{method: http.MethodPut, path: webhookPath(id), body: data, notFound: webhook.ErrNotFound}, nil)
+}
+
+// DeleteWebhook deletes the subscription id
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: webhookPath(id), notFound: webhook.ErrNotFound}, nil)
+}
+
+// ListDeliveries returns a page of the delivery log of the subscription id
+func (c *Client) ListDeliveries(ctx context.Context, id string, offset, limit int) ([]webhook.Delivery, error) {
+	var ds []webhook.Delivery
+	err := c.do(ctx, request{
+		method:   http.MethodGet,
+		path:     webhookPath(id) + "/deliveries",
+		query:    pageValues(offset, limit),
+		notFound: webhook.ErrNotFound,
+	}, &ds)
+	return ds, err
+}
+
+// Deliveries iterates over the delivery log of the subscription id
+func (c *Client) Deliveries(id string) *Iterator[webhook.Delivery] {
+	return newIterator(0, 0, func(ctx context.Context, offset, limit int) ([]webhook.Delivery, error) {
+		return c.ListDeliveries(ctx, id, offset, limit)
+	})
+}
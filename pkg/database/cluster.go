@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ReadPrimaryHeader asks for the reads of a request to go to the primary,
+// so a client sees its own writes
+const ReadPrimaryHeader = "X-Read-Primary"
+
+// defaultCheckInterval is how often replicas are health-checked
+const defaultCheckInterval = 5 * time.Second
+
+// readPrimaryKey is the context key of the read-your-writes flag
+type readPrimaryKey struct{}
+
+// ReadPrimary returns a copy of ctx whose reads go to the primary, for
+// reads that must see the writes made just before them
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+// readsPrimary reports whether ReadPrimary was called on ctx
+func readsPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(readPrimaryKey{}).(bool)
+	return v
+}
+
+// ReadPrimaryMiddleware sends the reads of requests carrying ReadPrimaryHeader to the primary
+func ReadPrimaryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ReadPrimaryHeader) == "true" {
+			r = r.WithContext(ReadPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Replica is a named read replica
+type Replica struct {
+	Name string
+	DB   *gorm.DB
+}
+
+// replica is a read replica and whether its last health check passed
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+// Cluster routes reads to healthy read replicas, round robin, and falls back
+// to the primary when there is none. Replicas are ejected when a health check
+// fails and brought back when one passes.
+type Cluster struct {
+	primary       *gorm.DB
+	replicas      []*replica
+	next          atomic.Uint64
+	checkInterval time.Duration
+	ping          func(ctx context.Context, db *gorm.DB) error
+}
+
+// NewCluster creates a new Cluster. Replicas take reads only once their first
+// health check passed.
+func NewCluster(primary *gorm.DB, replicas ...Replica) *Cluster {
+	c := &Cluster{
+		primary:       primary,
+		checkInterval: defaultCheckInterval,
+		ping:          Ping,
+	}
+	for _, r := range replicas {
+		c.replicas = append(c.replicas, &replica{name: r.Name, db: r.DB})
+	}
+	return c
+}
+
+// SetCheckInterval sets how often replicas are health-checked
+func (c *Cluster) SetCheckInterval(d time.Duration) {
+	if d > 0 {
+		c.checkInterval = d
+	}
+}
+
+// Primary returns the primary database
+func (c *Cluster) Primary() *gorm.DB {
+	return c.primary
+}
+
+// Replicas returns the replicas of the cluster, healthy or not
+func (c *Cluster) Replicas() []Replica {
+	replicas := make([]Replica, len(c.replicas))
+	for i, r := range c.replicas {
+		replicas[i] = Replica{Name: r.name, DB: r.db}
+	}
+	return replicas
+}
+
+// Reader returns the database to read from: the primary when ctx asks for
+// it, or a healthy replica when there is one
+func (c *Cluster) Reader(ctx context.Context) *gorm.DB {
+	if len(c.replicas) == 0 || readsPrimary(ctx) {
+		return c.primary
+	}
+
+	start := c.next.Add(1)
+	for i := range c.replicas {
+		r := c.replicas[(start+uint64(i))%uint64(len(c.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return c.primary
+}
+
+// Run health-checks the replicas until ctx is cancelled
+func (c *Cluster) Run(ctx context.Context) {
+	if len(c.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckReplicas(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckReplicas pings every replica once, ejecting the ones that fail
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, c.checkInterval)
+			defer cancel()
+
+			err := c.ping(pingCtx, r.db)
+			healthy := err == nil
+			if r.healthy.Swap(healthy) == healthy {
+				return
+			}
+			if healthy {
+				logrus.WithField("replica", r.name).Info("replica is healthy, sending reads to it")
+			} else {
+				logrus.WithError(fmt.Errorf("database.Ping: %w", err)).WithField("replica", r.name).Warn("replica is unhealthy, ejecting it")
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// Healthy returns the number of replicas taking reads
+func (c *Cluster) Healthy() int {
+	n := 0
+	for _, r := range c.replicas {
+		if r.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// Close closes the replica pools. The primary is left to its owner.
+func (c *Cluster) Close() error {
+	var errs []error
+	for _, r := range c.replicas {
+		sqlDB, err := r.db.DB()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: db.DB: %w", r.name, err))
+			continue
+		}
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
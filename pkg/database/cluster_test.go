@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// fakePing fails the pings of the databases marked down
+type fakePing struct {
+	mu   sync.Mutex
+	down map[*gorm.DB]bool
+}
+
+func (p *fakePing) set(db *gorm.DB, down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down[db] = down
+}
+
+func (p *fakePing) ping(_ context.Context, db *gorm.DB) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down[db] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func newTestCluster() (*Cluster, *gorm.DB, *gorm.DB, *gorm.DB, *fakePing) {
+	primary, r1, r2 := &gorm.DB{}, &gorm.DB{}, &gorm.DB{}
+	p := &fakePing{down: map[*gorm.DB]bool{}}
+	c := NewCluster(primary, Replica{Name: "r1", DB: r1}, Replica{Name: "r2", DB: r2})
+	c.ping = p.ping
+	return c, primary, r1, r2, p
+}
+
+func TestClusterReader(t *testing.T) {
+	ctx := context.Background()
+	c, primary, r1, r2, p := newTestCluster()
+
+	if got := c.Reader(ctx); got != primary {
+		t.Fatal("expected reads to go to the primary before the first health check")
+	}
+
+	c.CheckReplicas(ctx)
+	if c.Healthy() != 2 {
+		t.Fatalf("expected 2 healthy replicas, got %d", c.Healthy())
+	}
+	seen := map[*gorm.DB]int{}
+	for i := 0; i < 4; i++ {
+		seen[c.Reader(ctx)]++
+	}
+	if seen[r1] != 2 || seen[r2] != 2 {
+		t.Fatalf("expected reads to be spread across the replicas, got r1=%d r2=%d", seen[r1], seen[r2])
+	}
+
+	if got := c.Reader(ReadPrimary(ctx)); got != primary {
+		t.Fatal("expected ReadPrimary to send reads to the primary")
+	}
+
+	p.set(r1, true)
+	c.CheckReplicas(ctx)
+	for i := 0; i < 4; i++ {
+		if got := c.Reader(ctx); got != r2 {
+			t.Fatal("expected the unhealthy replica to be ejected")
+		}
+	}
+
+	p.set(r2, true)
+	c.CheckReplicas(ctx)
+	if got := c.Reader(ctx); got != primary {
+		t.Fatal("expected reads to fall back to the primary without healthy replicas")
+	}
+
+	p.set(r1, false)
+	c.CheckReplicas(ctx)
+	if got := c.Reader(ctx); got != r1 {
+		t.Fatal("expected the recovered replica to take reads again")
+	}
+}
+
+func TestClusterWithoutReplicas(t *testing.T) {
+	primary := &gorm.DB{}
+	c := NewCluster(primary)
+
+	c.Run(context.Background())
+	if got := c.Reader(context.Background()); got != primary {
+		t.Fatal("expected reads to go to the primary")
+	}
+}
+
+func TestReadPrimaryMiddleware(t *testing.T) {
+	testTable := map[string]struct {
+		header   string
+		expected bool
+	}{
+		"header set": {
+			header:   "true",
+			expected: true,
+		},
+		"header not set": {
+			expected: false,
+		},
+		"header false": {
+			header:   "false",
+			expected: false,
+		},
+	}
+
+	for name, test := range testTable {
+		t.Run(name, func(t *testing.T) {
+			var got bool
+			h := ReadPrimaryMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = readsPrimary(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set(ReadPrimaryHeader, test.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != test.expected {
+				t.Fatalf("expected reads primary %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
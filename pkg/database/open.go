@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Config represents the connection settings of a Postgres database
+type Config struct {
+	Host             string
+	Port             string
+	Name             string
+	User             string
+	Password         string
+	SSLMode          string
+	TimeZone         string
+	StatementTimeout time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	LogLevel           string
+	SlowQueryThreshold time.Duration
+
+	ConnectTimeout      time.Duration
+	StartupTimeout      time.Duration
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+}
+
+// DSN returns the connection string of c
+func (c Config) DSN() string {
+	params := []struct{ key, value string }{
+		{"host", c.Host},
+		{"port", c.Port},
+		{"user", c.User},
+		{"password", c.Password},
+		{"dbname", c.Name},
+		{"sslmode", c.SSLMode},
+		{"TimeZone", c.TimeZone},
+	}
+	if c.ConnectTimeout > 0 {
+		// connect_timeout is in whole seconds, rounded up so it never becomes 0 (no timeout)
+		seconds := int((c.ConnectTimeout + time.Second - 1) / time.Second)
+		params = append(params, struct{ key, value string }{"connect_timeout", strconv.Itoa(seconds)})
+	}
+	if c.StatementTimeout > 0 {
+		params = append(params, struct{ key, value string }{"statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		parts = append(parts, p.key+"="+quoteDSNValue(p.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes a value of a key=value connection string when needed
+func quoteDSNValue(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// gormLogLevels maps the configured log levels to gorm's
+var gormLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// Open connects to the database described by cfg and configures its pool.
+// While the database is not reachable it retries with an exponential
+// backoff, for up to cfg.StartupTimeout.
+func Open(ctx context.Context, cfg Config) (*gorm.DB, error) {
+	gormCfg, err := newGormConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := retry(ctx, cfg, func() (*gorm.DB, error) {
+		return gorm.Open(postgres.Open(cfg.DSN()), gormCfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := configurePool(db, cfg); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenReplica connects to the read replica at dsn with the pool settings of
+// cfg. It doesn't wait for the replica, which joins the cluster once its
+// health check passes.
+func OpenReplica(cfg Config, dsn string) (*gorm.DB, error) {
+	gormCfg, err := newGormConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	gormCfg.DisableAutomaticPing = true
+
+	db, err := gorm.Open(postgres.Open(dsn), gormCfg)
+	if err != nil {
+		return nil, fmt.Errorf("gorm.Open: %w", err)
+	}
+	if err := configurePool(db, cfg); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newGormConfig returns the gorm configuration of cfg
+func newGormConfig(cfg Config) (*gorm.Config, error) {
+	level, ok := gormLogLevels[cfg.LogLevel]
+	if !ok {
+		return nil, fmt.Errorf("unknown log level %q", cfg.LogLevel)
+	}
+	return &gorm.Config{
+		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:             cfg.SlowQueryThreshold,
+			LogLevel:                  level,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		}),
+	}, nil
+}
+
+// configurePool applies the pool settings of cfg to db
+func configurePool(db *gorm.DB, cfg Config) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("db.DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return nil
+}
+
+// retry calls open until it succeeds, backing off between attempts, and
+// gives up with the last error once cfg.StartupTimeout has passed
+func retry(ctx context.Context, cfg Config, open func() (*gorm.DB, error)) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.StartupTimeout)
+	defer cancel()
+
+	backoff := cfg.RetryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := open()
+		if err == nil {
+			return db, nil
+		}
+
+		logrus.WithError(err).WithField("attempt", attempt).Warnf("database %s:%s not reachable, retrying in %s", cfg.Host, cfg.Port, backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("database %s:%s not reachable after %d attempts in %s: %w", cfg.Host, cfg.Port, attempt, cfg.StartupTimeout, err)
+			}
+			return nil, fmt.Errorf("waiting for database %s:%s: %w", cfg.Host, cfg.Port, ctx.Err())
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > cfg.RetryMaxBackoff {
+			backoff = cfg.RetryMaxBackoff
+		}
+	}
+}
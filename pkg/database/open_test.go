@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestDSN(t *testing.T) {
+	cfg := Config{
+		Host:             "db",
+		Port:             "5432",
+		Name:             "devices",
+		User:             "admin",
+		Password:         `p@ss 'word\`,
+		SSLMode:          "require",
+		TimeZone:         "UTC",
+		StatementTimeout: 1500 * time.Millisecond,
+		ConnectTimeout:   2500 * time.Millisecond,
+	}
+
+	expected := `host=db port=5432 user=admin password='p@ss \'word\\' dbname=devices sslmode=require TimeZone=UTC connect_timeout=3 statement_timeout=1500`
+	if got := cfg.DSN(); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+
+	cfg.StatementTimeout, cfg.ConnectTimeout, cfg.Password = 0, 0, ""
+	if got := cfg.DSN(); strings.Contains(got, "timeout") || strings.Contains(got, "password") {
+		t.Fatalf("expected unset options to be left out, got %s", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	cfg := Config{
+		Host:                "db",
+		Port:                "5432",
+		StartupTimeout:      200 * time.Millisecond,
+		RetryInitialBackoff: time.Millisecond,
+		RetryMaxBackoff:     4 * time.Millisecond,
+	}
+
+	testTable := map[string]struct {
+		failures         int
+		expectedAttempts int
+		expectedErr      bool
+	}{
+		"first attempt": {
+			failures:         0,
+			expectedAttempts: 1,
+		},
+		"database comes up": {
+			failures:         3,
+			expectedAttempts: 4,
+		},
+		"database never comes up": {
+			failures:    1 << 30,
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range testTable {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			db, err := retry(context.Background(), cfg, func() (*gorm.DB, error) {
+				attempts++
+				if attempts <= tt.failures {
+					return nil, fmt.Errorf("connection refused")
+				}
+				return &gorm.DB{}, nil
+			})
+
+			if tt.expectedErr {
+				if err == nil || !strings.Contains(err.Error(), "connection refused") || !strings.Contains(err.Error(), "not reachable") {
+					t.Fatalf("expected a timeout error with the last failure, got %v", err)
+				}
+				// the backoff is capped, so the attempts keep coming until the deadline
+				if attempts < 10 {
+					t.Fatalf("expected at least 10 attempts, got %d", attempts)
+				}
+				return
+			}
+			if err != nil || db == nil {
+				t.Fatalf("expected a database, got %v", err)
+			}
+			if attempts != tt.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.expectedAttempts, attempts)
+			}
+		})
+	}
+}
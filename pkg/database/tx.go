@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// txKey is the context key for the active transaction
+type txKey struct{}
+
+// afterCommitKey is the context key for the hooks of the active transaction
+type afterCommitKey struct{}
+
+// afterCommit holds the functions to call once the transaction committed
+type afterCommit struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// Transactor runs functions inside a database transaction
+type Transactor struct {
+	db *gorm.DB
+}
+
+// NewTransactor creates a new Transactor instance
+func NewTransactor(db *gorm.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// WithinTx runs fn inside a transaction. Stores that resolve their connection
+// with Conn take part in the same transaction through the returned context.
+// Nested calls reuse the outer transaction.
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+
+	hooks := &afterCommit{}
+	err := t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ctx := context.WithValue(ctx, afterCommitKey{}, hooks)
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+	if err != nil {
+		return err
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	for _, fn := range hooks.fns {
+		fn()
+	}
+	return nil
+}
+
+// InTx reports whether ctx carries a transaction
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*gorm.DB)
+	return ok
+}
+
+// AfterCommit calls fn once the transaction carried by ctx committed, or
+// right away if there is none. fn is not called if the transaction rolls back.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*afterCommit)
+	if !ok {
+		fn()
+		return
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fns = append(hooks.fns, fn)
+}
+
+// Conn returns the transaction carried by ctx, or db if there is none
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
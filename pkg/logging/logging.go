@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// contextKey is the type of the keys stored in a context by this package
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+	principalKey
+)
+
+// WithLogger returns a copy of ctx carrying entry
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey, entry)
+}
+
+// FromContext returns the logger carried by ctx, or the standard logger if there is none
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// principal holds who made a request. It is set by the rate limiter
+// deep in the handler chain and read by the access log around it.
+type principal struct {
+	name string
+}
+
+// SetPrincipal records who made the request ctx belongs to, for the access log
+func SetPrincipal(ctx context.Context, name string) {
+	if p, ok := ctx.Value(principalKey).(*principal); ok {
+		p.name = name
+	}
+}
+
+// Principal returns who made the request ctx belongs to, or "" if unknown
+func Principal(ctx context.Context) string {
+	if p, ok := ctx.Value(principalKey).(*principal); ok {
+		return p.name
+	}
+	return ""
+}
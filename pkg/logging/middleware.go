@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header that carries the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware propagates the X-Request-ID of the request, or assigns a
+// new one, echoes it in the response and puts a logger carrying it in the context
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		fields := logrus.Fields{"request_id": id}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+		}
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = WithLogger(ctx, FromContext(ctx).WithFields(fields))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether a client supplied request ID is safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog returns a middleware that writes one entry per request to logger.
+// It must run inside RequestIDMiddleware to log the request ID.
+func AccessLog(logger *logrus.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx := context.WithValue(r.Context(), principalKey, &principal{})
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+
+			entry := logger.WithFields(logrus.Fields{
+				"request_id":  RequestID(ctx),
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"route":       route,
+				"status":      status,
+				"bytes":       ww.BytesWritten(),
+				"latency_ms":  float64(time.Since(start).Microseconds()) / 1000,
+				"principal":   Principal(ctx),
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+			})
+			switch {
+			case status >= http.StatusInternalServerError:
+				entry.Error("request")
+			case status >= http.StatusBadRequest:
+				entry.Warn("request")
+			default:
+				entry.Info("request")
+			}
+		})
+	}
+}
+
+// NewAccessLogger creates a logger that writes JSON entries to the standard logger's output
+func NewAccessLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(logrus.StandardLogger().Out)
+	logger.SetFormatter(&logrus.JSONFormatter{
+		TimestampFormat: time.RFC3339Nano,
+	})
+	return logger
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	testTable := map[string]struct {
+		header      string
+		expectedNew bool
+	}{
+		"propagated": {
+			header: "abc-123",
+		},
+		"missing": {
+			expectedNew: true,
+		},
+		"too long": {
+			header:      strings.Repeat("a", maxRequestIDLength+1),
+			expectedNew: true,
+		},
+		"invalid characters": {
+			header:      "abc\n123",
+			expectedNew: true,
+		},
+	}
+
+	for name, tt := range testTable {
+		t.Run(name, func(t *testing.T) {
+			var (
+				ctxID    string
+				loggerID interface{}
+			)
+			h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = RequestID(r.Context())
+				loggerID = FromContext(r.Context()).Data["request_id"]
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" {
+				t.Fatalf("expected a request ID in the response")
+			}
+			if !tt.expectedNew && id != tt.header {
+				t.Fatalf("expected request ID %q, got %q", tt.header, id)
+			}
+			if tt.expectedNew && id == tt.header {
+				t.Fatalf("expected a new request ID")
+			}
+			if ctxID != id || loggerID != id {
+				t.Fatalf("expected the context and logger to carry %q, got %q and %v", id, ctxID, loggerID)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	r := chi.NewRouter()
+	r.Use(RequestIDMiddleware, AccessLog(logger))
+	r.Get("/api/v1/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetPrincipal(r.Context(), "ops")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/1", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON entry, got %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"request_id": "abc-123",
+		"method":     "GET",
+		"route":      "/api/v1/devices/{id}",
+		"path":       "/api/v1/devices/1",
+		"status":     float64(http.StatusNotFound),
+		"bytes":      float64(len(`{"error":"not found"}`)),
+		"principal":  "ops",
+		"level":      "warning",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["latency_ms"]; !ok {
+		t.Errorf("expected the latency to be logged")
+	}
+}
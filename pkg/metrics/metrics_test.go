@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	reg := NewRegistry()
+	h := NewHTTP(reg)
+
+	r := chi.NewRouter()
+	r.Use(h.Middleware)
+	r.Route("/api/v1/devices", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("[]"))
+		})
+	})
+
+	for _, path := range []string{"/api/v1/devices/1", "/api/v1/devices/2", "/api/v1/devices/", "/unknown"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP http_requests_total Number of HTTP requests by method, route pattern and status code.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/api/v1/devices",status="200"} 1
+http_requests_total{method="GET",route="/api/v1/devices/{id}",status="404"} 2
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "http_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	NewHTTP(reg)
+
+	w := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "go_goroutines") {
+		t.Fatalf("expected the runtime metrics to be exposed")
+	}
+}
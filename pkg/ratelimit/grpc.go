@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"device/pkg/logging"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ByPeer counts gRPC calls per client IP. Its keys are those of ByIP, so a
+// client shares its buckets between HTTP and gRPC.
+func ByPeer(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// UnaryServerInterceptor limits the gRPC calls of each client with l, the way
+// Middleware limits HTTP requests. Methods are matched by their full name, e.g.
+// "/device.v1.DeviceService/ListDevices", and calls over the limit fail with
+// RESOURCE_EXHAUSTED.
+func UnaryServerInterceptor(l Limiter, rules Rules) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		setHeader := func(md metadata.MD) error { return grpc.SetHeader(ctx, md) }
+		if err := allow(ctx, l, rules, info.FullMethod, setHeader); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor limits the streams each client opens with l, see UnaryServerInterceptor
+func StreamServerInterceptor(l Limiter, rules Rules) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), l, rules, info.FullMethod, ss.SetHeader); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allow counts a call to method against its client and returns a status error
+// once the client is over the limit. Calls are let through when the client
+// can't be told or the limiter fails.
+func allow(ctx context.Context, l Limiter, rules Rules, method string, setHeader func(metadata.MD) error) error {
+	name, limit := rules.limit(method)
+	client := ByPeer(ctx)
+	if limit.Unlimited() || client == "" {
+		return nil
+	}
+
+	result, err := l.Allow(ctx, name+"|"+client, limit)
+	if err != nil {
+		logging.FromContext(ctx).WithError(fmt.Errorf("limiter.Allow: %w", err)).Error("unable to rate limit call")
+		return nil
+	}
+
+	md := metadata.Pairs(
+		strings.ToLower(HeaderLimit), strconv.Itoa(result.Limit),
+		strings.ToLower(HeaderRemaining), strconv.Itoa(result.Remaining),
+		strings.ToLower(HeaderReset), ceilSeconds(result.Reset),
+	)
+	if !result.Allowed {
+		md.Set(strings.ToLower(HeaderRetryAfter), ceilSeconds(result.RetryAfter))
+	}
+	if err := setHeader(md); err != nil {
+		logging.FromContext(ctx).WithError(fmt.Errorf("grpc.SetHeader: %w", err)).Warn("unable to send rate limit headers")
+	}
+	if !result.Allowed {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
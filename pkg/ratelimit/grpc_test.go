@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	rules := Rules{
+		Default: Limit{Requests: 1, Per: time.Minute},
+		Routes: map[string]Limit{
+			"/grpc.health.v1.Health/Check": {Requests: 2, Per: time.Minute},
+		},
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(UnaryServerInterceptor(NewMemory(), rules)))
+	healthv1.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := healthv1.NewHealthClient(conn)
+
+	for i := 0; i < 2; i++ {
+		var header metadata.MD
+		if _, err := client.Check(context.Background(), &healthv1.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+			t.Fatalf("expected call %d to be allowed, got %v", i, err)
+		}
+		if got := header.Get("ratelimit-limit"); len(got) != 1 || got[0] != "2" {
+			t.Fatalf("expected a limit of 2, got %v", got)
+		}
+	}
+
+	var header metadata.MD
+	_, err = client.Check(context.Background(), &healthv1.HealthCheckRequest{}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected %s, got %v", codes.ResourceExhausted, err)
+	}
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] != "30" {
+		t.Fatalf("expected Retry-After 30, got %v", got)
+	}
+}
+
+func TestByPeer(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	if got := ByPeer(ctx); got != "ip:10.0.0.1" {
+		t.Fatalf("expected ip:10.0.0.1, got %s", got)
+	}
+	if got := ByPeer(context.Background()); got != "" {
+		t.Fatalf("expected no key without a peer, got %s", got)
+	}
+}
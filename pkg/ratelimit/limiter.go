@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled to Requests per Per.
+// The zero Limit is unlimited.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Unlimited reports whether l lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// rate returns the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// burst returns the capacity of the bucket
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// String formats l the way ParseLimit reads it
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "unlimited"
+	}
+	s := fmt.Sprintf("%d/%s", l.Requests, l.Per)
+	if l.Burst > 0 && l.Burst != l.Requests {
+		s += fmt.Sprintf(",burst=%d", l.Burst)
+	}
+	return s
+}
+
+// ParseLimit reads a limit such as "100/1m", "10/1s,burst=20" or "unlimited"
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "unlimited" {
+		return Limit{}, nil
+	}
+
+	rate, burst, hasBurst := strings.Cut(s, ",burst=")
+	requests, per, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/duration", s)
+	}
+
+	var (
+		l   Limit
+		err error
+	)
+	if l.Requests, err = strconv.Atoi(requests); err != nil || l.Requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid request count in limit %q", s)
+	}
+	if l.Per, err = time.ParseDuration(per); err != nil || l.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid duration in limit %q", s)
+	}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst in limit %q", s)
+		}
+	}
+	return l, nil
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the bucket
+	Limit int
+	// Remaining is the number of tokens left
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when the request was denied
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from the bucket of a key. The in-process Memory limiter
+// is one implementation; a shared backend lets several instances share buckets.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of a token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket refills completely, after which it can be dropped
+	full time.Time
+}
+
+// Memory is a Limiter keeping the buckets in process memory
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+var _ Limiter = (*Memory)(nil)
+
+// sweepInterval is how often full buckets are dropped from memory
+const sweepInterval = time.Minute
+
+// NewMemory creates a new Memory limiter
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	capacity := float64(limit.burst())
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*limit.rate())
+	b.updated = now
+
+	result := Result{Limit: limit.burst()}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.rate())
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / limit.rate())
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep drops the buckets that refilled completely, since a new bucket is
+// full as well, so idle clients don't accumulate. It runs at most once per sweepInterval.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// seconds converts a number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	testTable := map[string]struct {
+		input       string
+		expected    Limit
+		expectedErr bool
+	}{
+		"per minute":     {input: "100/1m", expected: Limit{Requests: 100, Per: time.Minute}},
+		"with burst":     {input: "10/1s,burst=20", expected: Limit{Requests: 10, Per: time.Second, Burst: 20}},
+		"unlimited":      {input: "unlimited", expected: Limit{}},
+		"missing period": {input: "100", expectedErr: true},
+		"invalid count":  {input: "x/1s", expectedErr: true},
+		"invalid period": {input: "10/x", expectedErr: true},
+		"zero requests":  {input: "0/1s", expectedErr: true},
+		"invalid burst":  {input: "10/1s,burst=0", expectedErr: true},
+	}
+
+	for name, tt := range testTable {
+		t.Run(name, func(t *testing.T) {
+			l, err := ParseLimit(tt.input)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", l)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if l != tt.expected {
+				t.Fatalf("expected %+v, got %+v", tt.expected, l)
+			}
+		})
+	}
+}
+
+func TestMemoryAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Per: time.Second, Burst: 3}
+	ctx := context.Background()
+
+	// the burst goes through at once
+	for i := 2; i >= 0; i-- {
+		res, _ := m.Allow(ctx, "a", limit)
+		if !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("expected an allowed request with %d remaining, got %+v", i, res)
+		}
+	}
+
+	res, _ := m.Allow(ctx, "a", limit)
+	if res.Allowed {
+		t.Fatalf("expected the request to be denied")
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected to retry after 500ms, got %s", res.RetryAfter)
+	}
+	if res.Reset != 1500*time.Millisecond {
+		t.Fatalf("expected a reset after 1.5s, got %s", res.Reset)
+	}
+
+	// other keys have their own bucket
+	if res, _ := m.Allow(ctx, "b", limit); !res.Allowed {
+		t.Fatalf("expected another key to be allowed")
+	}
+
+	// tokens refill at the rate of the limit
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := m.Allow(ctx, "a", limit); !res.Allowed {
+		t.Fatalf("expected the request to be allowed after a refill")
+	}
+	if res, _ := m.Allow(ctx, "a", limit); res.Allowed {
+		t.Fatalf("expected the request to be denied before the next refill")
+	}
+
+	// full buckets are dropped
+	now = now.Add(time.Hour)
+	m.Allow(ctx, "c", limit)
+	if len(m.buckets) != 1 {
+		t.Fatalf("expected idle buckets to be dropped, got %d buckets", len(m.buckets))
+	}
+}
+
+func TestMemoryUnlimited(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < 100; i++ {
+		if res, _ := m.Allow(context.Background(), "a", Limit{}); !res.Allowed {
+			t.Fatalf("expected an unlimited request to be allowed")
+		}
+	}
+	if len(m.buckets) != 0 {
+		t.Fatalf("expected no bucket for unlimited requests")
+	}
+}
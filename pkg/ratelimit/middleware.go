@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"device/pkg/logging"
+	"device/pkg/web"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Headers set on rate limited responses
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// defaultRoute keys the bucket shared by the routes without their own limit
+const defaultRoute = "default"
+
+// Rules are the limits applied per route. Routes are keyed by method and
+// chi route pattern, e.g. "POST /api/v1/devices".
+type Rules struct {
+	Default Limit
+	Routes  map[string]Limit
+}
+
+// limit returns the bucket name and limit of a route
+func (rs Rules) limit(route string) (string, Limit) {
+	if l, ok := rs.Routes[route]; ok {
+		return route, l
+	}
+	return defaultRoute, rs.Default
+}
+
+// KeyFunc returns the client a request is counted against, or "" if it can't tell
+type KeyFunc func(r *http.Request) string
+
+// ByIP counts requests per client IP
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// FirstKey returns the key of the first fn that can tell the client
+func FirstKey(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, fn := range fns {
+			if key := fn(r); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+// KeyFuncByName returns the key functions of names, tried in order. ip is the
+// only one: API keys and tenant headers are not verified, so a client could get
+// a fresh bucket by sending a new one on each request.
+func KeyFuncByName(names []string) (KeyFunc, error) {
+	fns := make([]KeyFunc, 0, len(names))
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "ip":
+			fns = append(fns, ByIP)
+		default:
+			return nil, fmt.Errorf("unknown rate limit key %q", name)
+		}
+	}
+	return FirstKey(fns...), nil
+}
+
+// Middleware limits the requests of each client with l. Requests are
+// let through when the client can't be told or the limiter fails. The client
+// is recorded as the principal of the access log.
+func Middleware(l Limiter, rules Rules, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, limit := rules.limit(route(r))
+			client := key(r)
+			logging.SetPrincipal(r.Context(), client)
+			if limit.Unlimited() || client == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := l.Allow(r.Context(), name+"|"+client, limit)
+			if err != nil {
+				logging.FromContext(r.Context()).WithError(fmt.Errorf("limiter.Allow: %w", err)).Error("unable to rate limit request")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set(HeaderLimit, strconv.Itoa(result.Limit))
+			w.Header().Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			w.Header().Set(HeaderReset, ceilSeconds(result.Reset))
+			if !result.Allowed {
+				w.Header().Set(HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+				web.SendError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// route returns the method and route pattern the request will be served by.
+// The middleware runs before routing, so the route is looked up on the router.
+func route(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+
+	tctx := chi.NewRouteContext()
+	if !rctx.Routes.Match(tctx, r.Method, r.URL.Path) {
+		return ""
+	}
+	pattern := tctx.RoutePattern()
+	if len(pattern) > 1 {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return r.Method + " " + pattern
+}
+
+// ceilSeconds formats d as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"bytes"
+	"device/pkg/logging"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMiddleware(t *testing.T) {
+	rules := Rules{
+		Default: Limit{Requests: 3, Per: time.Minute},
+		Routes: map[string]Limit{
+			"POST /api/v1/devices": {Requests: 1, Per: time.Minute},
+			"GET /healthz":         {},
+		},
+	}
+	key, err := KeyFuncByName([]string{"ip"})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(Middleware(NewMemory(), rules, key))
+	r.Route("/api/v1/devices", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// the route limit applies to POST only
+	if w := do(http.MethodPost, "/api/v1/devices", nil); w.Code != http.StatusOK || w.Header().Get(HeaderLimit) != "1" {
+		t.Fatalf("expected the first create to be allowed with a limit of 1, got %d %v", w.Code, w.Header())
+	}
+	w := do(http.MethodPost, "/api/v1/devices/", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get(HeaderRetryAfter) != "60" || w.Header().Get(HeaderRemaining) != "0" {
+		t.Fatalf("expected Retry-After 60 and no remaining request, got %v", w.Header())
+	}
+
+	// the default limit is a separate bucket shared by the other routes
+	for i, id := range []string{"1", "2", "3"} {
+		w := do(http.MethodGet, "/api/v1/devices/"+id, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected request %d to be allowed, got %d", i, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, "/api/v1/devices/4", nil); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	// other clients have their own bucket
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/2", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the other IP to have its own bucket, got %d", w.Code)
+	}
+
+	// unlimited routes carry no headers
+	for i := 0; i < 10; i++ {
+		if w := do(http.MethodGet, "/healthz", nil); w.Code != http.StatusOK || w.Header().Get(HeaderLimit) != "" {
+			t.Fatalf("expected health checks not to be limited, got %d", w.Code)
+		}
+	}
+}
+
+func TestRotatingHeadersShareTheLimit(t *testing.T) {
+	rules := Rules{Default: Limit{Requests: 2, Per: time.Minute}}
+	key, err := KeyFuncByName([]string{"ip"})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(Middleware(NewMemory(), rules, key))
+	r.Get("/api/v1/devices/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/1", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-API-Key", fmt.Sprintf("forged-%d", i))
+		req.Header.Set("X-Tenant-ID", fmt.Sprintf("tenant-%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		expected := http.StatusOK
+		if i == 2 {
+			expected = http.StatusTooManyRequests
+		}
+		if w.Code != expected {
+			t.Fatalf("expected request %d to get %d, got %d", i, expected, w.Code)
+		}
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	if got := ByIP(req); got != "ip:10.0.0.1" {
+		t.Fatalf("expected ip:10.0.0.1, got %s", got)
+	}
+
+	for _, name := range []string{"cookie", "api_key", "tenant"} {
+		if _, err := KeyFuncByName([]string{name}); err == nil {
+			t.Fatalf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestAccessLogPrincipal(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	limit := Middleware(NewMemory(), Rules{Default: Limit{Requests: 1, Per: time.Minute}}, ByIP)
+	h := logging.AccessLog(logger)(limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON entry, got %q: %v", buf.String(), err)
+	}
+	if entry["principal"] != "ip:10.0.0.1" {
+		t.Fatalf("expected principal ip:10.0.0.1, got %v", entry["principal"])
+	}
+}
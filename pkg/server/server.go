@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config represents the HTTP server configuration
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	// DrainDelay is how long the server keeps serving after the shutdown
+	// started, so readiness probes see it draining before listeners close
+	DrainDelay time.Duration
+}
+
+// listener is a server that runs next to the HTTP server, such as a gRPC server
+type listener struct {
+	name  string
+	serve func() error
+	stop  func(ctx context.Context) error
+}
+
+// worker is a background task that runs until its context is cancelled
+type worker struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// closer releases a resource once everything else has stopped
+type closer struct {
+	name  string
+	close func() error
+}
+
+// Server runs the HTTP server together with the other listeners and
+// background workers of the process. On SIGINT or SIGTERM it stops, in order:
+// the listeners (draining in-flight requests), the workers in reverse order of
+// registration, and finally the closers, all within the shutdown timeout.
+type Server struct {
+	http            *http.Server
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	listeners       []listener
+	workers         []worker
+	closers         []closer
+	onShutdown      []func()
+	draining        atomic.Bool
+}
+
+// New creates a new Server serving handler
+func New(cfg Config, handler http.Handler) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+		drainDelay:      cfg.DrainDelay,
+	}
+}
+
+// AddListener registers a server that runs next to the HTTP server. serve
+// blocks until the server stops, and stop drains it within ctx.
+func (s *Server) AddListener(name string, serve func() error, stop func(ctx context.Context) error) {
+	s.listeners = append(s.listeners, listener{name: name, serve: serve, stop: stop})
+}
+
+// AddWorker registers a background task. run must return once ctx is cancelled.
+func (s *Server) AddWorker(name string, run func(ctx context.Context)) {
+	s.workers = append(s.workers, worker{name: name, run: run})
+}
+
+// AddCloser registers a resource to release after the listeners and workers stopped
+func (s *Server) AddCloser(name string, close func() error) {
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+// OnShutdown registers a function called as soon as the shutdown starts,
+// such as one that ends long-lived streams
+func (s *Server) OnShutdown(fn func()) {
+	s.onShutdown = append(s.onShutdown, fn)
+}
+
+// Draining reports whether the server is shutting down
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// ListenAndServe runs until the process receives SIGINT or SIGTERM, or a listener fails
+func (s *Server) ListenAndServe() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	lis, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("net.Listen: %w", err)
+	}
+	return s.Serve(ctx, lis)
+}
+
+// Serve serves HTTP on lis until ctx is done or a listener fails, then shuts down
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	errc := make(chan error, len(s.listeners)+1)
+
+	running := make([]runningWorker, len(s.workers))
+	for i, w := range s.workers {
+		wctx, cancel := context.WithCancel(context.Background())
+		running[i] = runningWorker{name: w.name, cancel: cancel, done: make(chan struct{})}
+		go func(w worker, done chan struct{}) {
+			defer close(done)
+			w.run(wctx)
+		}(w, running[i].done)
+	}
+
+	for _, l := range s.listeners {
+		go func(l listener) {
+			logrus.Infof("starting %s", l.name)
+			if err := l.serve(); err != nil {
+				errc <- fmt.Errorf("%s: %w", l.name, err)
+			}
+		}(l)
+	}
+
+	go func() {
+		logrus.Info("starting HTTP server on ", lis.Addr())
+		if err := s.http.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+			errc <- fmt.Errorf("http: %w", err)
+		}
+	}()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		logrus.Info("shutdown signal received")
+	case serveErr = <-errc:
+		logrus.WithError(serveErr).Error("server failed")
+	}
+
+	return errors.Join(serveErr, s.shutdown(running))
+}
+
+// runningWorker is a started worker
+type runningWorker struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// shutdown stops everything in order within the shutdown timeout
+func (s *Server) shutdown(running []runningWorker) error {
+	s.draining.Store(true)
+	for _, fn := range s.onShutdown {
+		fn()
+	}
+	if s.drainDelay > 0 {
+		logrus.Infof("draining for %s", s.drainDelay)
+		time.Sleep(s.drainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	addErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := s.http.Shutdown(ctx); err != nil {
+			addErr(fmt.Errorf("http.Shutdown: %w", err))
+		}
+	}()
+	for _, l := range s.listeners {
+		wg.Add(1)
+		go func(l listener) {
+			defer wg.Done()
+			if err := l.stop(ctx); err != nil {
+				addErr(fmt.Errorf("%s: %w", l.name, err))
+			}
+		}(l)
+	}
+	wg.Wait()
+	logrus.Info("listeners stopped")
+
+	// workers stop one by one, last registered first, so a worker can rely
+	// on the ones registered before it while it stops
+	for i := len(running) - 1; i >= 0; i-- {
+		w := running[i]
+		w.cancel()
+		select {
+		case <-w.done:
+			logrus.Infof("%s stopped", w.name)
+		case <-ctx.Done():
+			addErr(fmt.Errorf("%s: %w", w.name, ctx.Err()))
+		}
+	}
+
+	for _, c := range s.closers {
+		if err := c.close(); err != nil {
+			addErr(fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+
+	logrus.Info("shutdown complete")
+	return errors.Join(errs...)
+}
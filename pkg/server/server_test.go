@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"context"
+	"device/pkg/server"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	srv := server.New(server.Config{ShutdownTimeout: 5 * time.Second}, handler)
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+
+	srv.OnShutdown(func() { record("on shutdown") })
+	for _, name := range []string{"first worker", "second worker"} {
+		name := name
+		srv.AddWorker(name, func(ctx context.Context) {
+			<-ctx.Done()
+			record(name)
+		})
+	}
+	srv.AddCloser("database", func() error {
+		record("database")
+		return nil
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(ctx, lis)
+	}()
+
+	body := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + lis.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+
+	if got := <-body; got != "done" {
+		t.Fatalf("expected the in-flight request to complete, got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if !srv.Draining() {
+		t.Fatalf("expected the server to be draining")
+	}
+
+	expected := []string{"on shutdown", "second worker", "first worker", "database"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+}
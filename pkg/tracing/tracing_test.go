@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	testTable := map[string]struct {
+		path           string
+		traceparent    string
+		status         int
+		expectedName   string
+		expectedStatus codes.Code
+	}{
+		"new trace": {
+			path:           "/api/v1/devices/1",
+			status:         http.StatusOK,
+			expectedName:   "GET /api/v1/devices/{id}",
+			expectedStatus: codes.Unset,
+		},
+		"propagated trace": {
+			path:           "/api/v1/devices/1",
+			traceparent:    fmt.Sprintf("00-%s-%s-01", traceID, spanID),
+			status:         http.StatusOK,
+			expectedName:   "GET /api/v1/devices/{id}",
+			expectedStatus: codes.Unset,
+		},
+		"server error": {
+			path:           "/api/v1/devices/1",
+			status:         http.StatusInternalServerError,
+			expectedName:   "GET /api/v1/devices/{id}",
+			expectedStatus: codes.Error,
+		},
+		"unmatched route": {
+			path:           "/unknown",
+			status:         http.StatusNotFound,
+			expectedName:   "GET",
+			expectedStatus: codes.Unset,
+		},
+	}
+
+	for name, tt := range testTable {
+		t.Run(name, func(t *testing.T) {
+			recorder := newRecorder(t)
+
+			r := chi.NewRouter()
+			r.Use(Middleware)
+			r.Route("/api/v1/devices", func(r chi.Router) {
+				r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+					// the business layer continues the request span
+					_, span := Start(r.Context(), "device.Business.GetByID")
+					End(span, nil)
+					w.WriteHeader(tt.status)
+				})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			server := spans[len(spans)-1]
+			if server.Name() != tt.expectedName {
+				t.Fatalf("expected span %q, got %q", tt.expectedName, server.Name())
+			}
+			if server.Status().Code != tt.expectedStatus {
+				t.Fatalf("expected status %v, got %v", tt.expectedStatus, server.Status().Code)
+			}
+
+			found := false
+			for _, attr := range server.Attributes() {
+				if attr.Key == semconv.HTTPResponseStatusCodeKey {
+					found = attr.Value.AsInt64() == int64(tt.status)
+				}
+			}
+			if !found {
+				t.Fatalf("expected the status code %d to be recorded", tt.status)
+			}
+
+			if tt.traceparent != "" {
+				if got := server.SpanContext().TraceID().String(); got != traceID {
+					t.Fatalf("expected trace %s, got %s", traceID, got)
+				}
+				if got := server.Parent().SpanID().String(); got != spanID {
+					t.Fatalf("expected parent %s, got %s", spanID, got)
+				}
+			}
+
+			if len(spans) == 2 && spans[0].Parent().SpanID() != server.SpanContext().SpanID() {
+				t.Fatalf("expected the business span to be a child of the server span")
+			}
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := newRecorder(t)
+
+	_, span := Start(context.Background(), "failing")
+	End(span, fmt.Errorf("store err"))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error || spans[0].Status().Description != "store err" {
+		t.Fatalf("expected an error status, got %+v", spans[0].Status())
+	}
+	if len(spans[0].Events()) != 1 {
+		t.Fatalf("expected the error to be recorded")
+	}
+}
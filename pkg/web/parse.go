@@ -35,9 +35,16 @@ func ParseIntQuery(key string, r *http.Request, defaultValue int, required bool)
 	return v, nil
 }
 
-// ParsePaginationParams parses the offset and limit query parameters
+// MaxLimit is the largest page a list returns, so a client can't load a whole table at once
+const MaxLimit = 100
+
+// ParsePaginationParams parses the offset and limit query parameters. The
+// limit is capped at MaxLimit.
 func ParsePaginationParams(r *http.Request) (int, int) {
 	offset, _ := ParseIntQuery("offset", r, 0, false)
 	limit, _ := ParseIntQuery("limit", r, 10, false)
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
 	return offset, limit
 }